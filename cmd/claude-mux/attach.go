@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/daemon"
+	"github.com/enriikke/claude-mux/internal/terminal"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// detachKey detaches from a session, like in dtach
+const detachKey = 0x1c // Ctrl-\
+
+// errNoDaemon explains how to start the daemon for commands that need it
+var errNoDaemon = errors.New("no claude-mux daemon is running for this repository, start one with: claude-mux daemon")
+
+// connectDaemon returns a client for the daemon serving the repository, or
+// nil when none is running and commands should fall back to direct calls
+func connectDaemon(ctx context.Context, cfg config.Config, noDaemon bool) *daemon.Client {
+	if noDaemon {
+		return nil
+	}
+	root, err := newClient(cfg).Root(ctx)
+	if err != nil {
+		return nil
+	}
+	client, err := daemon.Dial(ctx, daemon.SocketPath(root))
+	if errors.Is(err, daemon.ErrInsecureSocket) {
+		fmt.Fprintf(os.Stderr, "⚠️  Not using the daemon: %v\n", err)
+	}
+	if err != nil {
+		return nil
+	}
+	return client
+}
+
+// agentFlags maps the flags configuring sessions and agents to the daemon
+// setting they change
+var agentFlags = map[string]func(daemon.Settings) any{
+	"base-path":          func(s daemon.Settings) any { return s.WorktreeBasePath },
+	"claude-cmd":         func(s daemon.Settings) any { return s.ClaudeCommand },
+	"claude-resume-flag": func(s daemon.Settings) any { return s.ClaudeResumeFlag },
+	"stop-timeout":       func(s daemon.Settings) any { return s.StopTimeout },
+	"logs":               func(s daemon.Settings) any { return s.SessionLogs },
+	"checkpoint":         func(s daemon.Settings) any { return s.CheckpointInterval },
+	"max-checkpoints":    func(s daemon.Settings) any { return s.MaxCheckpoints },
+	"cpus":               func(s daemon.Settings) any { return s.Limits.CPUs },
+	"memory":             func(s daemon.Settings) any { return s.Limits.Memory },
+	"pids":               func(s daemon.Settings) any { return s.Limits.PIDs },
+	"sandbox":            func(s daemon.Settings) any { return s.Sandbox },
+	"sandbox-allow":      func(s daemon.Settings) any { return s.SandboxWritable },
+	"isolation":          func(s daemon.Settings) any { return s.Isolation },
+	"container-runtime":  func(s daemon.Settings) any { return s.ContainerRuntime },
+	"container-image":    func(s daemon.Settings) any { return s.ContainerImage },
+	"container-arg":      func(s daemon.Settings) any { return s.ContainerArgs },
+	"disk-quota":         func(s daemon.Settings) any { return s.DiskQuota },
+	"quota-action":       func(s daemon.Settings) any { return s.QuotaAction },
+}
+
+// checkDaemonSettings fails when flags given to cmd ask for other settings
+// than the daemon d was started with. The daemon starts every agent with
+// its own settings, so it would silently ignore them.
+func checkDaemonSettings(cmd *cobra.Command, cfg config.Config, d *daemon.Client) error {
+	health, err := d.Health(cmd.Context())
+	if err != nil {
+		return err
+	}
+	want := daemon.NewSettings(cfg)
+	var differ []string
+	for _, name := range slices.Sorted(maps.Keys(agentFlags)) {
+		setting := agentFlags[name]
+		// Printing makes nil and empty lists equal
+		if cmd.Flags().Changed(name) && fmt.Sprint(setting(want)) != fmt.Sprint(setting(health.Settings)) {
+			differ = append(differ, "--"+name)
+		}
+	}
+	if len(differ) > 0 {
+		return fmt.Errorf("%s differ from the settings the daemon starts Claude with, restart it with the same flags or pass --no-daemon",
+			strings.Join(differ, ", "))
+	}
+	return nil
+}
+
+// attachTerminal connects the current terminal to a session running in the
+// daemon until the agent exits or the user detaches
+func attachTerminal(ctx context.Context, d *daemon.Client, name string) error {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("attaching needs a terminal")
+	}
+
+	rows, cols := terminal.Size(os.Stdout)
+	conn, err := d.Attach(ctx, name, rows, cols)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	fmt.Printf("📎 Attached to %s, detach with Ctrl-\\\n", name)
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+
+	stopResize := terminal.NotifyResize(func() {
+		if rows, cols := terminal.Size(os.Stdout); rows > 0 {
+			_ = d.Resize(ctx, name, rows, cols)
+		}
+	})
+
+	exited := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(os.Stdout, conn)
+		close(exited)
+	}()
+	detached := make(chan struct{})
+	go func() {
+		_ = copyInput(conn, os.Stdin)
+		close(detached)
+	}()
+
+	select {
+	case <-exited:
+		stopResize()
+		_ = term.Restore(fd, state)
+		fmt.Printf("\n👋 Session %s exited\n", name)
+	case <-detached:
+		stopResize()
+		_ = term.Restore(fd, state)
+		fmt.Printf("\n📎 Detached from %s\n", name)
+		fmt.Printf("💡 To reattach: claude-mux attach %s\n", name)
+	}
+	return nil
+}
+
+// copyInput forwards input to the session until the detach key is pressed
+func copyInput(dst io.Writer, src io.Reader) error {
+	buf := make([]byte, 1024)
+	for {
+		n, err := src.Read(buf)
+		if i := bytes.IndexByte(buf[:n], detachKey); i >= 0 {
+			_, werr := dst.Write(buf[:i])
+			return werr
+		}
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
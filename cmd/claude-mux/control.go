@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/daemon"
+	"github.com/enriikke/claude-mux/pkg/claudemux"
+	"github.com/spf13/cobra"
+)
+
+// agentControl is an action on the agent of a session, such as stop
+type agentControl struct {
+	// applies reports whether the action applies to an agent in a state,
+	// which selects the sessions of --all
+	applies func(claudemux.AgentState) bool
+	// viaDaemon and viaLibrary apply the action with or without a daemon
+	viaDaemon  func(d *daemon.Client, ctx context.Context, name string) (*daemon.Session, error)
+	viaLibrary func(c *claudemux.Client, ctx context.Context, name string) (*claudemux.Session, error)
+	// done is printed with the name of every session the action applied to
+	done string
+}
+
+// sessionOrAll accepts a session name, or with --all an optional group
+func sessionOrAll(cmd *cobra.Command, args []string) error {
+	if all, _ := cmd.Flags().GetBool("all"); all {
+		return cobra.MaximumNArgs(1)(cmd, args)
+	}
+	return cobra.ExactArgs(1)(cmd, args)
+}
+
+// controlAgents applies action to the session named by args, or with --all
+// to every session it applies to, limited to a group if one is given
+func controlAgents(cmd *cobra.Command, cfg config.Config, noDaemon bool, args []string, action agentControl) error {
+	ctx := cmd.Context()
+	client := newClient(cfg)
+
+	names := args
+	all, _ := cmd.Flags().GetBool("all")
+	if all {
+		sessions, err := client.List(ctx)
+		if err != nil {
+			return err
+		}
+		names = nil
+		for _, s := range sessions {
+			if (len(args) == 0 || s.Group == args[0]) && action.applies(s.State) {
+				names = append(names, s.Name)
+			}
+		}
+		if len(names) == 0 {
+			fmt.Println("No matching sessions.")
+			return nil
+		}
+	}
+
+	d := connectDaemon(ctx, cfg, noDaemon)
+	var errs []error
+	for _, name := range names {
+		if d != nil {
+			session, err := action.viaDaemon(d, ctx, name)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			name = session.Name
+		} else {
+			session, err := action.viaLibrary(client, ctx, name)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			name = session.Name
+		}
+		fmt.Printf(action.done+"\n", name)
+	}
+	return errors.Join(errs...)
+}
+
+// agentActive reports whether an agent runs and is not paused
+func agentActive(s claudemux.AgentState) bool {
+	return s == claudemux.AgentRunning || s == claudemux.AgentWaiting
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/asciicast"
+)
+
+// followInterval is how often a followed log is checked for new output
+const followInterval = 200 * time.Millisecond
+
+// printLog writes the output recorded in a session log to standard output.
+// With follow it keeps waiting for new output until interrupted or the
+// session is removed.
+func printLog(ctx context.Context, path string, follow bool) error {
+	f, err := os.Open(path) // #nosec G304 -- path of a session log
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	var src io.Reader = f
+	if follow {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt)
+		defer stop()
+		src = asciicast.Follow(ctx, f, followInterval)
+	}
+
+	r, err := asciicast.NewReader(src)
+	if err != nil {
+		return err
+	}
+	for {
+		e, err := r.Next()
+		if errors.Is(err, io.EOF) || errors.Is(err, context.Canceled) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch e.Type {
+		case asciicast.Output:
+			if _, err := io.WriteString(os.Stdout, e.Data); err != nil {
+				return err
+			}
+		case asciicast.Marker:
+			if _, err := fmt.Fprintf(os.Stdout, "\r\n📌 %s\r\n", e.Data); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// replayLog plays a session log on standard output with its timing
+func replayLog(ctx context.Context, path string, opts asciicast.PlayOptions) error {
+	f, err := os.Open(path) // #nosec G304 -- path of a session log
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+
+	r, err := asciicast.NewReader(f)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	recorded := time.Unix(r.Header.Timestamp, 0).Format(time.DateTime)
+	fmt.Printf("▶️  Replaying %s recorded %s (%dx%d)\n", r.Header.Title, recorded, r.Header.Width, r.Header.Height)
+	err = asciicast.Play(ctx, r, os.Stdout, opts)
+	if errors.Is(err, context.Canceled) {
+		fmt.Println("\n⏹️  Replay stopped")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("\n⏹️  Replay finished")
+	return nil
+}
@@ -1,11 +1,23 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/enriikke/claude-mux/internal/asciicast"
 	"github.com/enriikke/claude-mux/internal/config"
-	"github.com/enriikke/claude-mux/internal/worktree"
+	"github.com/enriikke/claude-mux/internal/daemon"
+	"github.com/enriikke/claude-mux/internal/terminal"
+	"github.com/enriikke/claude-mux/pkg/claudemux"
 	"github.com/spf13/cobra"
 )
 
@@ -23,8 +35,40 @@ func main() {
 	}
 }
 
+// newClient creates a library client for the CLI configuration
+func newClient(cfg config.Config) *claudemux.Client {
+	return claudemux.New(claudemux.Options{
+		RepoDir:            cfg.RepoDir,
+		BasePath:           cfg.WorktreeBasePath,
+		AgentCommand:       cfg.ClaudeCommand,
+		AgentResumeFlag:    cfg.ClaudeResumeFlag,
+		Verbose:            cfg.Verbose,
+		StopTimeout:        cfg.StopTimeout,
+		DisableLogs:        !cfg.SessionLogs,
+		CheckpointInterval: cfg.CheckpointInterval,
+		MaxCheckpoints:     cfg.MaxCheckpoints,
+		Limits:             cfg.Limits,
+		Sandbox:            cfg.Sandbox,
+		SandboxWritable:    cfg.SandboxWritable,
+		Isolation:          cfg.Isolation,
+		Container:          cfg.Container,
+		DiskQuota:          cfg.DiskQuota,
+		QuotaAction:        cfg.QuotaAction,
+		ForwardSignals:     true,
+		OnEvent:            printEvent,
+	})
+}
+
 func execute() error {
-	var cfg config.Config
+	var (
+		cfg         config.Config
+		noDaemon    bool
+		checkpoint  string
+		memory      string
+		isolation   string
+		diskQuota   string
+		quotaAction string
+	)
 
 	rootCmd := &cobra.Command{
 		Use:   "claude-mux",
@@ -33,12 +77,66 @@ func execute() error {
 Each session runs in its own branch and directory, preventing conflicts when running
 multiple AI coding tasks simultaneously.`,
 		Version: fmt.Sprintf("%s (commit: %s, built: %s)", version, commit, date),
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			interval, err := config.ParseCheckpointInterval(checkpoint)
+			if err != nil {
+				return err
+			}
+			cfg.CheckpointInterval = interval
+			if cfg.MaxCheckpoints < 1 {
+				return errors.New("--max-checkpoints must be at least 1")
+			}
+			if cfg.Limits.Memory, err = config.ParseMemory(memory); err != nil {
+				return err
+			}
+			if cfg.Limits.CPUs < 0 || cfg.Limits.PIDs < 0 {
+				return errors.New("resource limits must not be negative")
+			}
+			if cfg.Isolation, err = config.ParseIsolation(isolation); err != nil {
+				return err
+			}
+			if cfg.DiskQuota, err = config.ParseDiskQuota(diskQuota); err != nil {
+				return err
+			}
+			if cfg.QuotaAction, err = config.ParseQuotaAction(quotaAction); err != nil {
+				return err
+			}
+			for i, path := range cfg.SandboxWritable {
+				if rest, ok := strings.CutPrefix(path, "~/"); ok {
+					home, err := os.UserHomeDir()
+					if err != nil {
+						return err
+					}
+					cfg.SandboxWritable[i] = filepath.Join(home, rest)
+				}
+			}
+			return nil
+		},
 	}
 
 	// Global flags
+	rootCmd.PersistentFlags().StringVarP(&cfg.RepoDir, "repo", "C", "", "Run as if claude-mux was started in this directory")
 	rootCmd.PersistentFlags().StringVar(&cfg.WorktreeBasePath, "base-path", ".claude-mux", "Base path for worktrees")
 	rootCmd.PersistentFlags().StringVar(&cfg.ClaudeCommand, "claude-cmd", "claude", "Claude Code command")
+	rootCmd.PersistentFlags().StringVar(&cfg.ClaudeResumeFlag, "claude-resume-flag", config.DefaultResumeFlag, "Flag passed to Claude to continue its conversation when resuming, empty to pass none")
+	rootCmd.PersistentFlags().DurationVar(&cfg.StopTimeout, "stop-timeout", config.DefaultStopTimeout, "How long Claude may take to exit when stopped before it is killed")
+	rootCmd.PersistentFlags().BoolVar(&cfg.SessionLogs, "logs", true, "Record the terminal output of Claude to a log kept with the session")
+	rootCmd.PersistentFlags().StringVar(&checkpoint, "checkpoint", "off", "Checkpoint the worktree while Claude runs: off, on-change or an interval like 5m")
+	rootCmd.PersistentFlags().IntVar(&cfg.MaxCheckpoints, "max-checkpoints", config.DefaultMaxCheckpoints, "How many checkpoints every session keeps, the oldest are deleted beyond it")
+	rootCmd.PersistentFlags().Float64Var(&cfg.Limits.CPUs, "cpus", 0, "Limit every Claude session to this many CPU cores, e.g. 1.5 (default unlimited)")
+	rootCmd.PersistentFlags().StringVar(&memory, "memory", "", "Limit the memory of every Claude session, e.g. 4G (default unlimited)")
+	rootCmd.PersistentFlags().IntVar(&cfg.Limits.PIDs, "pids", 0, "Limit the processes and threads of every Claude session (default unlimited)")
+	rootCmd.PersistentFlags().BoolVar(&cfg.Sandbox, "sandbox", false, "Only let Claude change its worktree, the git directory, temporary directories and --sandbox-allow paths (Linux)")
+	rootCmd.PersistentFlags().StringArrayVar(&cfg.SandboxWritable, "sandbox-allow", nil, "Further file or directory sandboxed Claude may change besides its conversations and state, can be repeated")
+	rootCmd.PersistentFlags().StringVar(&isolation, "isolation", "host", "Where Claude runs: host or container")
+	rootCmd.PersistentFlags().StringVar(&cfg.Container.Runtime, "container-runtime", "", "Container runtime command for --isolation=container (default podman or docker, whichever is installed)")
+	rootCmd.PersistentFlags().StringVar(&cfg.Container.Image, "container-image", "", "Image Claude runs in with --isolation=container, it must provide --claude-cmd")
+	rootCmd.PersistentFlags().StringArrayVar(&cfg.Container.Args, "container-arg", nil, "Further argument to the run command of the container runtime, e.g. --volume=$HOME/.claude:/home/me/.claude, can be repeated")
+	rootCmd.PersistentFlags().StringVar(&diskQuota, "disk-quota", "", "Cap the disk space taken by all worktrees under --base-path, e.g. 50G (default unlimited)")
+	rootCmd.PersistentFlags().StringVar(&quotaAction, "quota-action", "refuse", "What new does once the disk quota is used up: refuse, or archive the least recently used idle sessions")
+	rootCmd.PersistentFlags().StringVar(&cfg.TmuxSocket, "tmux-socket", "", "tmux socket name or path to open sessions in (default the current tmux server)")
 	rootCmd.PersistentFlags().BoolVarP(&cfg.Verbose, "verbose", "v", false, "Enable verbose output")
+	rootCmd.PersistentFlags().BoolVar(&noDaemon, "no-daemon", false, "Do not use a running daemon, operate on the repository directly")
 
 	// New command - creates worktree and launches Claude
 	newCmd := &cobra.Command{
@@ -54,12 +152,153 @@ multiple AI coding tasks simultaneously.`,
 
 			autoCleanup, _ := cmd.Flags().GetBool("cleanup")
 			cfg.AutoCleanup = autoCleanup
+			detach, _ := cmd.Flags().GetBool("detach")
+			prompt, _ := cmd.Flags().GetString("prompt")
+			policy, _ := cmd.Flags().GetString("autocommit")
+			autocommit, err := claudemux.ParseAutocommitPolicy(policy)
+			if err != nil {
+				return err
+			}
+			mode, _ := cmd.Flags().GetString("network")
+			allowHosts, _ := cmd.Flags().GetStringArray("allow-host")
+			network, err := claudemux.ParseNetworkMode(mode)
+			if err != nil {
+				return err
+			}
+			if len(allowHosts) > 0 && network != claudemux.NetworkAllowlist {
+				return errors.New("--allow-host needs --network=allowlist")
+			}
+			networkPolicy := claudemux.NetworkPolicy{Mode: network, Allow: allowHosts}
+
+			if cmd.Flags().Changed("tmux") {
+				if detach {
+					return errors.New("--detach and --tmux cannot be combined")
+				}
+				mode, _ := cmd.Flags().GetString("tmux")
+				return runInTmux(cmd, cfg, tmuxRun{
+					name:       name,
+					mode:       mode,
+					prompt:     prompt,
+					autocommit: autocommit,
+					cleanup:    cfg.AutoCleanup,
+					network:    networkPolicy,
+				})
+			}
+
+			if d := connectDaemon(cmd.Context(), cfg, noDaemon); d != nil {
+				if err := checkDaemonSettings(cmd, cfg, d); err != nil {
+					return err
+				}
+				rows, cols := terminal.Size(os.Stdout)
+				session, err := d.Create(cmd.Context(), daemon.CreateRequest{
+					Name:       name,
+					Prompt:     prompt,
+					Autocommit: string(autocommit),
+					Cleanup:    cfg.AutoCleanup,
+					Network:    string(network),
+					AllowHosts: allowHosts,
+					Rows:       rows,
+					Cols:       cols,
+				})
+				if err != nil {
+					return err
+				}
+				printEvent(claudemux.Event{Type: claudemux.EventCreated, Session: session.Name, Branch: session.Branch, Path: session.Path})
+				fmt.Printf("🐙 Claude is running in the daemon (pid %d)\n", session.PID)
+				if detach {
+					fmt.Printf("💡 To attach: claude-mux attach %s\n", session.Name)
+					return nil
+				}
+				return attachTerminal(cmd.Context(), d, session.Name)
+			}
+			if detach {
+				return fmt.Errorf("--detach needs a daemon: %w", errNoDaemon)
+			}
 
-			manager := worktree.NewManager(cfg)
-			return manager.CreateAndLaunch(name)
+			_, err = newClient(cfg).CreateAndLaunch(cmd.Context(), claudemux.RunOptions{
+				CreateOptions: claudemux.CreateOptions{Name: name, Network: networkPolicy},
+				Prompt:        prompt,
+				Autocommit:    autocommit,
+				Cleanup:       cfg.AutoCleanup,
+			})
+			return err
 		},
 	}
 	newCmd.Flags().BoolP("cleanup", "c", false, "Auto-cleanup worktree after Claude exits")
+	newCmd.Flags().BoolP("detach", "d", false, "Start Claude in the daemon without attaching to it")
+	newCmd.Flags().StringP("prompt", "p", "", "Initial prompt passed to Claude")
+	newCmd.Flags().String("autocommit", "off", "Commit Claude's work when it exits: off, wip or squash")
+	newCmd.Flags().String("network", "host", "Network Claude may reach, also when resumed: host, none or allowlist (Linux)")
+	newCmd.Flags().StringArray("allow-host", nil, "Host Claude may reach with --network=allowlist besides the API, e.g. github.com, *.npmjs.org or localhost:8080, port 443 if none is given, can be repeated")
+	newCmd.Flags().String("tmux", "", "Run Claude in a new tmux window or pane named after the session: window or pane")
+	newCmd.Flags().Lookup("tmux").NoOptDefVal = "window"
+
+	// Launch command - run Claude in a session created without it, e.g. by new --tmux
+	launchCmd := &cobra.Command{
+		Use:    "launch <name>",
+		Short:  "Run Claude for the first time in a session created without it",
+		Args:   cobra.ExactArgs(1),
+		Hidden: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			autoCleanup, _ := cmd.Flags().GetBool("cleanup")
+			prompt, _ := cmd.Flags().GetString("prompt")
+			policy, _ := cmd.Flags().GetString("autocommit")
+			autocommit, err := claudemux.ParseAutocommitPolicy(policy)
+			if err != nil {
+				return err
+			}
+			_, err = newClient(cfg).LaunchCreated(cmd.Context(), args[0], claudemux.LaunchOptions{
+				Prompt:     prompt,
+				Autocommit: autocommit,
+				Cleanup:    autoCleanup,
+			})
+			return err
+		},
+	}
+	launchCmd.Flags().BoolP("cleanup", "c", false, "Auto-cleanup worktree after Claude exits")
+	launchCmd.Flags().StringP("prompt", "p", "", "Initial prompt passed to Claude")
+	launchCmd.Flags().String("autocommit", "off", "Commit Claude's work when it exits: off, wip or squash")
+
+	// Resume command - relaunches Claude in an existing session
+	resumeCmd := &cobra.Command{
+		Use:     "resume <name>",
+		Short:   "Relaunch Claude in an existing session, continuing its conversation",
+		Aliases: []string{"continue"},
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			autoCleanup, _ := cmd.Flags().GetBool("cleanup")
+			detach, _ := cmd.Flags().GetBool("detach")
+
+			if d := connectDaemon(cmd.Context(), cfg, noDaemon); d != nil {
+				if err := checkDaemonSettings(cmd, cfg, d); err != nil {
+					return err
+				}
+				rows, cols := terminal.Size(os.Stdout)
+				session, err := d.Resume(cmd.Context(), args[0], daemon.ResumeRequest{
+					Cleanup: autoCleanup,
+					Rows:    rows,
+					Cols:    cols,
+				})
+				if err != nil {
+					return err
+				}
+				fmt.Printf("🔄 Resumed %s in the daemon (pid %d)\n", session.Name, session.PID)
+				if detach {
+					fmt.Printf("💡 To attach: claude-mux attach %s\n", session.Name)
+					return nil
+				}
+				return attachTerminal(cmd.Context(), d, session.Name)
+			}
+			if detach {
+				return fmt.Errorf("--detach needs a daemon: %w", errNoDaemon)
+			}
+
+			_, err := newClient(cfg).Resume(cmd.Context(), args[0], claudemux.ResumeOptions{Cleanup: autoCleanup})
+			return err
+		},
+	}
+	resumeCmd.Flags().BoolP("cleanup", "c", false, "Auto-cleanup worktree after Claude exits")
+	resumeCmd.Flags().BoolP("detach", "d", false, "Resume Claude in the daemon without attaching to it")
 
 	// List command - shows active worktrees
 	listCmd := &cobra.Command{
@@ -67,10 +306,31 @@ multiple AI coding tasks simultaneously.`,
 		Short:   "List active Claude worktrees",
 		Aliases: []string{"ls"},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			manager := worktree.NewManager(cfg)
-			return manager.List()
+			asJSON, _ := cmd.Flags().GetBool("json")
+
+			var rows []sessionRow
+			if d := connectDaemon(cmd.Context(), cfg, noDaemon); d != nil {
+				sessions, err := d.List(cmd.Context())
+				if err != nil {
+					return err
+				}
+				rows = daemonSessions(sessions)
+			} else {
+				sessions, err := newClient(cfg).List(cmd.Context())
+				if err != nil {
+					return err
+				}
+				rows = librarySessions(sessions)
+			}
+
+			if asJSON {
+				return printSessionsJSON(rows)
+			}
+			printSessions(rows)
+			return nil
 		},
 	}
+	listCmd.Flags().Bool("json", false, "Print sessions as JSON")
 
 	// Remove command - cleanup specific worktree
 	removeCmd := &cobra.Command{
@@ -80,8 +340,17 @@ multiple AI coding tasks simultaneously.`,
 		Args:    cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			force, _ := cmd.Flags().GetBool("force")
-			manager := worktree.NewManager(cfg)
-			return manager.Remove(args[0], force)
+			if d := connectDaemon(cmd.Context(), cfg, noDaemon); d != nil {
+				result, err := d.Remove(cmd.Context(), args[0], force)
+				if err != nil {
+					return err
+				}
+				printDaemonRemoval(result)
+				return nil
+			}
+
+			_, err := newClient(cfg).Remove(cmd.Context(), args[0], claudemux.RemoveOptions{Force: force})
+			return err
 		},
 	}
 	removeCmd.Flags().BoolP("force", "f", false, "Force removal even if branch has unmerged changes")
@@ -89,13 +358,362 @@ multiple AI coding tasks simultaneously.`,
 	// Prune command - cleanup all claude-mux worktrees
 	pruneCmd := &cobra.Command{
 		Use:   "prune",
-		Short: "Remove all Claude worktrees",
+		Short: "Remove all idle Claude worktrees, stale metadata and orphaned branches",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			force, _ := cmd.Flags().GetBool("force")
+			if d := connectDaemon(cmd.Context(), cfg, noDaemon); d != nil {
+				result, err := d.Prune(cmd.Context(), dryRun, force)
+				if err != nil {
+					return err
+				}
+				printPruneReport(daemonPruneReport(result))
+				return nil
+			}
+
+			report, err := newClient(cfg).Prune(cmd.Context(), claudemux.PruneOptions{DryRun: dryRun, Force: force})
+			if err != nil {
+				return err
+			}
+			printPruneReport(report)
+			return nil
+		},
+	}
+	pruneCmd.Flags().BoolP("dry-run", "n", false, "Show what would be removed without removing anything")
+	pruneCmd.Flags().BoolP("force", "f", false, "Also delete branches with unmerged changes")
+
+	// Du command - show the disk space taken by sessions
+	duCmd := &cobra.Command{
+		Use:   "du",
+		Short: "Show the disk space taken by Claude worktrees",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			asJSON, _ := cmd.Flags().GetBool("json")
+			report, err := newClient(cfg).DiskUsage(cmd.Context())
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				return printDiskReportJSON(report)
+			}
+			printDiskReport(report)
+			return nil
+		},
+	}
+	duCmd.Flags().Bool("json", false, "Print disk usage as JSON")
+
+	// Diff command - show the changes committed in a session
+	diffCmd := &cobra.Command{
+		Use:   "diff <name>",
+		Short: "Show the changes committed in a Claude session",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			diff, err := newClient(cfg).Diff(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Print(diff)
+			return nil
+		},
+	}
+
+	// Merge command - merge a session branch into the current branch
+	mergeCmd := &cobra.Command{
+		Use:   "merge <name>",
+		Short: "Merge a Claude session's branch into the current branch",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return newClient(cfg).Merge(cmd.Context(), args[0])
+		},
+	}
+
+	// Doctor command - diagnose the claude-mux setup
+	doctorCmd := &cobra.Command{
+		Use:          "doctor",
+		Short:        "Check the claude-mux setup for problems",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fix, _ := cmd.Flags().GetBool("fix")
+			findings, err := newClient(cfg).Doctor(cmd.Context(), claudemux.DoctorOptions{Fix: fix})
+			if err != nil {
+				return err
+			}
+			if problems := printFindings(findings, fix); problems > 0 {
+				return fmt.Errorf("found %d problem(s)", problems)
+			}
+			return nil
+		},
+	}
+	doctorCmd.Flags().Bool("fix", false, "Automatically fix problems where it is safe to do so")
+
+	// Attach command - connect to a session running in the daemon
+	attachCmd := &cobra.Command{
+		Use:   "attach <name>",
+		Short: "Attach to a Claude session running in the daemon",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			d := connectDaemon(cmd.Context(), cfg, noDaemon)
+			if d == nil {
+				return errNoDaemon
+			}
+			return attachTerminal(cmd.Context(), d, args[0])
+		},
+	}
+
+	// Stop command - stop Claude in a session, wherever it was started
+	stopCmd := &cobra.Command{
+		Use:   "stop <name> | --all [group]",
+		Short: "Stop Claude in a session, keeping the worktree",
+		Long: "Stop Claude in a session, keeping the worktree. Claude is interrupted like Ctrl-C first,\n" +
+			"terminated if it still runs after half the stop timeout and killed once it passed.",
+		Args: sessionOrAll,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return controlAgents(cmd, cfg, noDaemon, args, agentControl{
+				applies: func(s claudemux.AgentState) bool {
+					return agentActive(s) || s == claudemux.AgentPaused
+				},
+				viaDaemon:  (*daemon.Client).Stop,
+				viaLibrary: (*claudemux.Client).Stop,
+				done:       "🛑 Stopped Claude in %s",
+			})
+		},
+	}
+	stopCmd.Flags().BoolP("all", "a", false, "Stop every running session, or those of the given group")
+
+	// Pause command - suspend Claude to free CPU
+	pauseCmd := &cobra.Command{
+		Use:   "pause <name> | --all [group]",
+		Short: "Pause Claude in a session so it uses no CPU until it is unpaused",
+		Args:  sessionOrAll,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return controlAgents(cmd, cfg, noDaemon, args, agentControl{
+				applies:    agentActive,
+				viaDaemon:  (*daemon.Client).Pause,
+				viaLibrary: (*claudemux.Client).Pause,
+				done:       "⏸️  Paused Claude in %s",
+			})
+		},
+	}
+	pauseCmd.Flags().BoolP("all", "a", false, "Pause every running session, or those of the given group")
+
+	// Unpause command - continue a paused Claude
+	unpauseCmd := &cobra.Command{
+		Use:   "unpause <name> | --all [group]",
+		Short: "Continue Claude in a paused session",
+		Args:  sessionOrAll,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return controlAgents(cmd, cfg, noDaemon, args, agentControl{
+				applies: func(s claudemux.AgentState) bool {
+					return s == claudemux.AgentPaused
+				},
+				viaDaemon:  (*daemon.Client).Unpause,
+				viaLibrary: (*claudemux.Client).Unpause,
+				done:       "▶️  Unpaused Claude in %s",
+			})
+		},
+	}
+	unpauseCmd.Flags().BoolP("all", "a", false, "Unpause every paused session, or those of the given group")
+
+	// Logs command - print the output log of a session
+	logsCmd := &cobra.Command{
+		Use:   "logs <name>",
+		Short: "Print the terminal output recorded in a session",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			follow, _ := cmd.Flags().GetBool("follow")
+			path, err := newClient(cfg).LogPath(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			return printLog(cmd.Context(), path, follow)
+		},
+	}
+	logsCmd.Flags().BoolP("follow", "f", false, "Keep printing output as it is recorded")
+
+	// Replay command - replay the output log of a session with its timing
+	replayCmd := &cobra.Command{
+		Use:   "replay <name>",
+		Short: "Replay the terminal output recorded in a session with its original timing",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			speed, _ := cmd.Flags().GetFloat64("speed")
+			idleLimit, _ := cmd.Flags().GetDuration("idle-limit")
+			path, err := newClient(cfg).LogPath(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			return replayLog(cmd.Context(), path, asciicast.PlayOptions{Speed: speed, IdleLimit: idleLimit})
+		},
+	}
+	replayCmd.Flags().Float64("speed", 1, "Playback speed multiplier")
+	replayCmd.Flags().Duration("idle-limit", 2*time.Second, "Longest pause between output, 0 keeps the recorded pauses")
+
+	// Checkpoints command - list the checkpoints of a session
+	checkpointsCmd := &cobra.Command{
+		Use:   "checkpoints <name>",
+		Short: "List the checkpoints taken of a Claude session",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			checkpoints, err := newClient(cfg).Checkpoints(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			printCheckpoints(args[0], checkpoints)
+			return nil
+		},
+	}
+
+	// Rollback command - restore a session worktree to a checkpoint
+	rollbackCmd := &cobra.Command{
+		Use:   "rollback <name> <checkpoint>",
+		Short: "Restore the files of a Claude session to a checkpoint",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			number, err := strconv.Atoi(strings.TrimPrefix(args[1], "#"))
+			if err != nil {
+				return fmt.Errorf("invalid checkpoint %q, want its number", args[1])
+			}
+			return newClient(cfg).Rollback(cmd.Context(), args[0], number)
+		},
+	}
+
+	// Shell command - open a shell in a session worktree
+	shellCmd := &cobra.Command{
+		Use:   "shell <name>",
+		Short: "Start a shell in a Claude session's worktree",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client := newClient(cfg)
+			path, err := client.Path(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("🐚 Starting a shell in %s, exit it to return\n", path)
+			return client.Shell(cmd.Context(), args[0])
+		},
+	}
+
+	// Cd command - print a session worktree path for the shell to change into
+	cdCmd := &cobra.Command{
+		Use:   "cd <name>",
+		Short: "Print the worktree path of a Claude session, for cd \"$(claude-mux cd <name>)\"",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := newClient(cfg).Path(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Println(path)
+			return nil
+		},
+	}
+
+	// Open command - open a session worktree in an editor
+	openCmd := &cobra.Command{
+		Use:   "open <name>",
+		Short: "Open a Claude session's worktree in an editor",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			editor, _ := cmd.Flags().GetString("editor")
+			return newClient(cfg).Open(cmd.Context(), args[0], editor)
+		},
+	}
+	openCmd.Flags().StringP("editor", "e", "", "Editor command, e.g. code, vim or idea (default $VISUAL or $EDITOR)")
+
+	// Shell-init command - print the shell integration
+	shellInitCmd := &cobra.Command{
+		Use:       "shell-init <bash|zsh|fish>",
+		Short:     "Print a cmux shell function whose cd changes into a session worktree",
+		Long:      "Print a cmux shell function that runs claude-mux, except that \"cmux cd <name>\"\nchanges the current directory to the session's worktree. Add it to your shell:\n\n  eval \"$(claude-mux shell-init bash)\"    # ~/.bashrc\n  eval \"$(claude-mux shell-init zsh)\"     # ~/.zshrc\n  claude-mux shell-init fish | source      # ~/.config/fish/config.fish",
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"bash", "zsh", "fish"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			snippet, err := shellInit(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Print(snippet)
+			return nil
+		},
+	}
+
+	// Tmux command - arrange sessions in tmux
+	tmuxCmd := &cobra.Command{
+		Use:   "tmux",
+		Short: "Arrange Claude sessions in tmux",
+	}
+	tmuxCmd.AddCommand(&cobra.Command{
+		Use:   "layout <group>",
+		Short: "Tile all sessions created with the same name in one tmux window",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return tileGroup(cmd.Context(), cfg, args[0])
+		},
+	})
+
+	// Daemon command - supervise background sessions for the repository
+	daemonCmd := &cobra.Command{
+		Use:          "daemon",
+		Short:        "Run a daemon that supervises Claude sessions in the background",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			specs, _ := cmd.Flags().GetStringArray("notify")
+			n, err := notifier(specs)
+			if err != nil {
+				return err
+			}
+			var opts []daemon.Option
+			if n != nil {
+				opts = append(opts, daemon.WithNotifier(n))
+			}
+
+			server := daemon.New(cfg, log.New(os.Stderr, "claude-mux: ", log.LstdFlags), opts...)
+			root, err := server.Root()
+			if err != nil {
+				return err
+			}
+
+			socket := daemon.SocketPath(root)
+			l, err := daemon.Listen(socket)
+			if err != nil {
+				return err
+			}
+
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			fmt.Printf("🐙 claude-mux daemon for %s listening on %s\n", root, socket)
+			if err := server.Serve(ctx, l); err != nil && !errors.Is(err, context.Canceled) {
+				return err
+			}
+			fmt.Println("👋 Daemon stopped")
+			return nil
+		},
+	}
+	daemonCmd.Flags().StringArray("notify", nil, notifyUsage)
+
+	// Serve command - local HTTP API and web dashboard
+	serveCmd := &cobra.Command{
+		Use:          "serve",
+		Short:        "Serve a local HTTP API and web dashboard over the sessions",
+		SilenceUsage: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			manager := worktree.NewManager(cfg)
-			return manager.Prune()
+			addr, _ := cmd.Flags().GetString("addr")
+			tokenFile, _ := cmd.Flags().GetString("token-file")
+			cfg.VerifyCommand, _ = cmd.Flags().GetString("verify-cmd")
+			specs, _ := cmd.Flags().GetStringArray("notify")
+			n, err := notifier(specs)
+			if err != nil {
+				return err
+			}
+			return serveDashboard(cmd.Context(), cfg, noDaemon, addr, tokenFile, n)
 		},
 	}
+	serveCmd.Flags().String("addr", "127.0.0.1:7777", "Address to listen on")
+	serveCmd.Flags().String("token-file", "", "File holding the access token, created if missing (default is in the user config directory)")
+	serveCmd.Flags().String("verify-cmd", "", "Shell command run in a session worktree to verify it")
+	serveCmd.Flags().StringArray("notify", nil, notifyUsage)
 
-	rootCmd.AddCommand(newCmd, listCmd, removeCmd, pruneCmd)
-	return rootCmd.Execute()
+	rootCmd.AddCommand(newCmd, launchCmd, resumeCmd, listCmd, removeCmd, pruneCmd, duCmd, diffCmd, mergeCmd, doctorCmd,
+		attachCmd, stopCmd, pauseCmd, unpauseCmd, logsCmd, replayCmd, checkpointsCmd, rollbackCmd, shellCmd, cdCmd, openCmd, shellInitCmd, tmuxCmd, daemonCmd, serveCmd)
+	return rootCmd.ExecuteContext(context.Background())
 }
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"os"
+
+	"github.com/enriikke/claude-mux/internal/notify"
+)
+
+// notifyUsage describes the --notify flag of the commands watching sessions
+const notifyUsage = "Notify when a session exits, waits for input or fails verification: bell, osc9, osc777, notify-send, exec:<command> or a webhook URL (repeatable)"
+
+// notifier builds the notifier for the --notify flags, nil if there are none.
+// Terminal notifiers write to the terminal claude-mux runs in.
+func notifier(specs []string) (notify.Notifier, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	var notifiers notify.Multi
+	for _, spec := range specs {
+		n, err := notify.Parse(spec, os.Stdout)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	return notifiers, nil
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/daemon"
+	"github.com/enriikke/claude-mux/pkg/claudemux"
+)
+
+// printEvent renders library progress events as CLI output
+func printEvent(e claudemux.Event) {
+	switch e.Type {
+	case claudemux.EventExcluded:
+		fmt.Printf("🙈 Added %s to .git/info/exclude\n", e.Message)
+	case claudemux.EventCreating:
+		fmt.Printf("🌳 Creating worktree: %s\n", e.Session)
+	case claudemux.EventRetrying:
+		fmt.Printf("⚠️  %s already exists, retrying with a new name\n", e.Session)
+	case claudemux.EventCreated:
+		fmt.Printf("✅ Worktree created at: %s\n", e.Path)
+		fmt.Printf("🌿 Branch: %s\n", e.Branch)
+	case claudemux.EventLaunching:
+		fmt.Printf("\n🚀 Launching Claude Code...\n")
+	case claudemux.EventStopping:
+		fmt.Printf("\n🛑 Stopping Claude (%s)...\n", e.Message)
+	case claudemux.EventCommitted:
+		fmt.Printf("💾 Committed the work of %s (%s)\n", e.Session, e.Message)
+	case claudemux.EventCheckpointed:
+		fmt.Printf("📸 Saved the current files of %s as checkpoint %s\n", e.Session, e.Message)
+	case claudemux.EventRolledBack:
+		fmt.Printf("⏪ Restored %s to checkpoint %s\n", e.Session, e.Message)
+	case claudemux.EventCleaningUp:
+		fmt.Printf("\n🧹 Cleaning up worktree...\n")
+	case claudemux.EventWorktreeRemoved:
+		fmt.Printf("✅ Removed worktree: %s\n", e.Path)
+	case claudemux.EventBranchDeleted:
+		fmt.Printf("✅ Deleted branch: %s\n", e.Branch)
+	case claudemux.EventBranchPreserved:
+		fmt.Printf("ℹ️  Branch preserved (has unmerged changes): %s\n", e.Branch)
+		fmt.Printf("💡 To delete it anyway: git branch -D %s\n", e.Branch)
+	case claudemux.EventMerged:
+		fmt.Printf("🔀 Merged %s into %s\n", e.Branch, e.Message)
+	case claudemux.EventArchived:
+		fmt.Printf("📦 Archived %s as %s\n", e.Session, e.Message)
+	case claudemux.EventCompleted:
+		fmt.Printf("\n✨ Session completed. Worktree preserved at: %s\n", e.Path)
+		fmt.Printf("💡 To resume: claude-mux resume %s\n", e.Session)
+		fmt.Printf("💡 To remove: claude-mux remove %s\n", e.Session)
+	case claudemux.EventWarning:
+		if e.Err != nil {
+			fmt.Printf("⚠️  %s: %v\n", e.Message, e.Err)
+		} else {
+			fmt.Printf("⚠️  %s\n", e.Message)
+		}
+		if e.Hint != "" {
+			fmt.Printf("💡 %s\n", e.Hint)
+		}
+	}
+}
+
+// sessionRow is a session as shown by the list command
+type sessionRow struct {
+	claudemux.Session
+	Status string
+}
+
+// librarySessions describes sessions listed without a daemon
+func librarySessions(sessions []claudemux.Session) []sessionRow {
+	rows := make([]sessionRow, 0, len(sessions))
+	for _, s := range sessions {
+		rows = append(rows, sessionRow{Session: s, Status: sessionStatus(s)})
+	}
+	return rows
+}
+
+// daemonSessions describes sessions listed by the daemon
+func daemonSessions(sessions []daemon.Session) []sessionRow {
+	rows := make([]sessionRow, 0, len(sessions))
+	for _, s := range sessions {
+		session := claudemux.Session{
+			Name:    s.Name,
+			Branch:  s.Branch,
+			Path:    s.Path,
+			Locked:  s.Locked,
+			Changes: s.Changes,
+			State:   claudemux.AgentState(s.State),
+			PID:     s.PID,
+		}
+		if s.LastOutputAt != nil {
+			session.LastOutputAt = *s.LastOutputAt
+		}
+		if r := s.Resources; r != nil {
+			session.Resources = &claudemux.ResourceUsage{
+				Limits:  claudemux.Limits{CPUs: r.CPUs, Memory: r.MemoryLimit, PIDs: r.PIDsLimit},
+				CPUTime: time.Duration(r.CPUSeconds * float64(time.Second)),
+				Memory:  r.Memory,
+				PIDs:    r.PIDs,
+			}
+		}
+		rows = append(rows, sessionRow{Session: session, Status: sessionStatus(session)})
+	}
+	return rows
+}
+
+// sessionStatus describes the worktree and agent state of a session
+func sessionStatus(s claudemux.Session) string {
+	if s.Locked {
+		return "locked"
+	}
+	switch s.State {
+	case claudemux.AgentRunning:
+		return fmt.Sprintf("running (pid %d)", s.PID)
+	case claudemux.AgentWaiting:
+		return fmt.Sprintf("waiting for input (pid %d)", s.PID)
+	case claudemux.AgentPaused:
+		return fmt.Sprintf("paused (pid %d)", s.PID)
+	case claudemux.AgentExited:
+		return "exited"
+	case claudemux.AgentStopped:
+		return "stopped"
+	default:
+		return "idle"
+	}
+}
+
+// resourceUsage describes what an agent uses, next to its limits
+func resourceUsage(r claudemux.ResourceUsage) string {
+	cpu := fmt.Sprintf("%s CPU time", r.CPUTime.Round(time.Second))
+	if r.Limits.CPUs > 0 {
+		cpu += fmt.Sprintf(" (max %g cores)", r.Limits.CPUs)
+	}
+	memory := config.FormatBytes(r.Memory)
+	if r.Limits.Memory > 0 {
+		memory += " / " + config.FormatBytes(r.Limits.Memory)
+	}
+	pids := strconv.Itoa(r.PIDs)
+	if r.Limits.PIDs > 0 {
+		pids += " / " + strconv.Itoa(r.Limits.PIDs)
+	}
+	return fmt.Sprintf("%s, %s memory, %s processes", cpu, memory, pids)
+}
+
+// printSessions renders the output of the list command
+func printSessions(sessions []sessionRow) {
+	if len(sessions) == 0 {
+		fmt.Println("No active Claude worktrees found.")
+		return
+	}
+
+	fmt.Println("Active Claude worktrees:")
+	fmt.Println()
+	for _, s := range sessions {
+		fmt.Printf("  %s\n", s.Branch)
+		fmt.Printf("    Path:    %s\n", s.Path)
+		fmt.Printf("    Status:  %s\n", s.Status)
+		if s.Resources != nil {
+			fmt.Printf("    Usage:   %s\n", resourceUsage(*s.Resources))
+		}
+		if s.Changes > 0 {
+			fmt.Printf("    Changes: %d uncommitted file(s)\n", s.Changes)
+		}
+		fmt.Println()
+	}
+}
+
+// sessionJSON is a session as printed by list --json
+type sessionJSON struct {
+	Name         string     `json:"name"`
+	Branch       string     `json:"branch"`
+	Path         string     `json:"path"`
+	Locked       bool       `json:"locked"`
+	Changes      int        `json:"changes"`
+	State        string     `json:"state"`
+	PID          int        `json:"pid,omitempty"`
+	LastOutputAt *time.Time `json:"last_output_at,omitempty"`
+	// Resources is set while an agent runs under resource limits
+	Resources *daemon.Resources `json:"resources,omitempty"`
+}
+
+// printSessionsJSON renders the output of list --json, for scripts
+func printSessionsJSON(sessions []sessionRow) error {
+	result := make([]sessionJSON, 0, len(sessions))
+	for _, s := range sessions {
+		session := sessionJSON{
+			Name:    s.Name,
+			Branch:  s.Branch,
+			Path:    s.Path,
+			Locked:  s.Locked,
+			Changes: s.Changes,
+			State:   string(s.State),
+			PID:     s.PID,
+		}
+		if !s.LastOutputAt.IsZero() {
+			session.LastOutputAt = &s.LastOutputAt
+		}
+		session.Resources = daemon.NewResources(s.Resources)
+		result = append(result, session)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+// printCheckpoints renders the output of the checkpoints command
+func printCheckpoints(name string, checkpoints []claudemux.Checkpoint) {
+	if len(checkpoints) == 0 {
+		fmt.Printf("No checkpoints of %s yet.\n", name)
+		fmt.Println("💡 Take them while Claude runs with --checkpoint on-change")
+		return
+	}
+
+	fmt.Printf("📸 Checkpoints of %s:\n\n", name)
+	for _, c := range checkpoints {
+		commit := c.Commit
+		if len(commit) > 7 {
+			commit = commit[:7]
+		}
+		fmt.Printf("  #%-4d %s  %s\n", c.Number, c.CreatedAt.Format(time.DateTime), commit)
+	}
+	fmt.Printf("\n💡 To restore one: claude-mux rollback %s <number>\n", name)
+}
+
+// printDaemonRemoval renders a removal done by the daemon like the events
+// of a direct removal
+func printDaemonRemoval(r *daemon.RemoveResult) {
+	e := claudemux.Event{Session: r.Session.Name, Branch: r.Session.Branch, Path: r.Session.Path}
+
+	e.Type = claudemux.EventWorktreeRemoved
+	printEvent(e)
+	switch {
+	case r.BranchDeleted:
+		e.Type = claudemux.EventBranchDeleted
+		printEvent(e)
+	case r.BranchPreserved:
+		e.Type = claudemux.EventBranchPreserved
+		printEvent(e)
+	case r.BranchError != "":
+		e.Type = claudemux.EventWarning
+		e.Message = fmt.Sprintf("Failed to delete branch %s", r.Session.Branch)
+		e.Err = errors.New(r.BranchError)
+		printEvent(e)
+	}
+}
+
+// daemonPruneReport describes a prune done by the daemon
+func daemonPruneReport(r *daemon.PruneResult) *claudemux.PruneReport {
+	report := &claudemux.PruneReport{
+		DryRun:            r.DryRun,
+		StaleMetadata:     r.StaleMetadata,
+		BranchesDeleted:   r.BranchesDeleted,
+		BranchesPreserved: r.BranchesPreserved,
+	}
+	for _, removed := range r.Removed {
+		result := claudemux.RemoveResult{
+			Session:         claudemux.Session{Name: removed.Session.Name, Branch: removed.Session.Branch, Path: removed.Session.Path},
+			BranchDeleted:   removed.BranchDeleted,
+			BranchPreserved: removed.BranchPreserved,
+		}
+		if removed.BranchError != "" {
+			result.BranchErr = errors.New(removed.BranchError)
+		}
+		report.Removed = append(report.Removed, result)
+	}
+	for _, kept := range r.Kept {
+		report.Kept = append(report.Kept, claudemux.KeptSession{
+			Session: claudemux.Session{Name: kept.Session.Name, Branch: kept.Session.Branch, Path: kept.Session.Path},
+			Err:     errors.New(kept.Error),
+		})
+	}
+	for _, err := range r.Errors {
+		report.Errors = append(report.Errors, errors.New(err))
+	}
+	return report
+}
+
+// printPruneReport renders the output of the prune command
+func printPruneReport(r *claudemux.PruneReport) {
+	if r.DryRun {
+		fmt.Println("🔍 Dry run: nothing will be removed")
+		fmt.Println()
+	}
+
+	fmt.Println("Stale worktree metadata:")
+	for _, entry := range r.StaleMetadata {
+		fmt.Printf("  🗑️  %s\n", entry)
+	}
+	if len(r.StaleMetadata) == 0 {
+		fmt.Println("  None")
+	}
+	fmt.Println()
+
+	fmt.Println("Worktrees:")
+	for _, removed := range r.Removed {
+		if r.DryRun {
+			fmt.Printf("  Would remove worktree: %s (%s)\n", removed.Session.Path, removed.Session.Branch)
+			continue
+		}
+		fmt.Printf("  ✅ Removed worktree: %s\n", removed.Session.Path)
+		if removed.BranchPreserved {
+			fmt.Printf("  ℹ️  Branch preserved (has unmerged changes): %s\n", removed.Session.Branch)
+		}
+	}
+	for _, kept := range r.Kept {
+		fmt.Printf("  ⏭️  Kept worktree: %s (%v)\n", kept.Session.Path, kept.Err)
+	}
+	if len(r.Removed) == 0 && len(r.Kept) == 0 {
+		fmt.Println("  None")
+	}
+	fmt.Println()
+
+	fmt.Println("Orphaned branches:")
+	for _, branch := range r.BranchesDeleted {
+		if r.DryRun {
+			fmt.Printf("  Would delete branch: %s\n", branch)
+		} else {
+			fmt.Printf("  ✅ Deleted branch: %s\n", branch)
+		}
+	}
+	for _, branch := range r.BranchesPreserved {
+		fmt.Printf("  ℹ️  Branch preserved (has unmerged changes): %s\n", branch)
+	}
+	if len(r.BranchesDeleted) == 0 && len(r.BranchesPreserved) == 0 {
+		fmt.Println("  None")
+	}
+	fmt.Println()
+
+	for _, err := range r.Errors {
+		fmt.Printf("⚠️  %v\n", err)
+	}
+
+	verb := "🧹 Removed"
+	if r.DryRun {
+		verb = "🔍 Would remove"
+	}
+	fmt.Printf("%s %d worktree(s), %d stale metadata entries and %d orphaned branch(es)\n",
+		verb, len(r.Removed), len(r.StaleMetadata), len(r.BranchesDeleted))
+	if len(r.Kept) > 0 {
+		fmt.Printf("⏭️  Kept %d worktree(s) whose Claude runs or that are locked\n", len(r.Kept))
+	}
+}
+
+// printDiskReport renders the output of the du command
+func printDiskReport(r *claudemux.DiskReport) {
+	fmt.Printf("💾 Disk usage of Claude worktrees in %s:\n\n", r.BasePath)
+	if len(r.Sessions) == 0 {
+		fmt.Println("  No active Claude worktrees found.")
+		fmt.Println()
+	}
+	for _, s := range r.Sessions {
+		u := s.Usage
+		fmt.Printf("  %s\n", s.Session.Branch)
+		fmt.Printf("    Size:        %s (checkout %s, artifacts %s, dependencies %s)\n",
+			config.FormatBytes(u.Total()), config.FormatBytes(u.Checkout), config.FormatBytes(u.Artifacts), config.FormatBytes(u.Dependencies))
+		fmt.Printf("    Status:      %s\n", sessionStatus(s.Session))
+		if !s.LastActive.IsZero() {
+			fmt.Printf("    Last active: %s\n", s.LastActive.Format(time.DateTime))
+		}
+		fmt.Println()
+	}
+	if r.Other > 0 {
+		fmt.Printf("  Other files: %s\n\n", config.FormatBytes(r.Other))
+	}
+
+	if r.Quota <= 0 {
+		fmt.Printf("📊 Total: %s\n", config.FormatBytes(r.Total))
+		return
+	}
+	fmt.Printf("📊 Total: %s of the %s quota (%d%%)\n", config.FormatBytes(r.Total), config.FormatBytes(r.Quota), r.Total*100/r.Quota)
+	if r.Total >= r.Quota {
+		fmt.Println("⚠️  The disk quota is used up, new sessions need room first")
+		fmt.Println("💡 To make room: claude-mux remove <name>, or create sessions with --quota-action=archive")
+	}
+}
+
+// diskReportJSON is the output of du --json
+type diskReportJSON struct {
+	BasePath string            `json:"base_path"`
+	Sessions []sessionDiskJSON `json:"sessions"`
+	Other    int64             `json:"other"`
+	Total    int64             `json:"total"`
+	Quota    int64             `json:"quota,omitempty"`
+}
+
+// sessionDiskJSON is the disk usage of a session as printed by du --json,
+// in bytes
+type sessionDiskJSON struct {
+	Name         string     `json:"name"`
+	Branch       string     `json:"branch"`
+	Path         string     `json:"path"`
+	State        string     `json:"state"`
+	Checkout     int64      `json:"checkout"`
+	Artifacts    int64      `json:"artifacts"`
+	Dependencies int64      `json:"dependencies"`
+	Total        int64      `json:"total"`
+	LastActive   *time.Time `json:"last_active,omitempty"`
+}
+
+// printDiskReportJSON renders the output of du --json, for scripts
+func printDiskReportJSON(r *claudemux.DiskReport) error {
+	result := diskReportJSON{
+		BasePath: r.BasePath,
+		Sessions: make([]sessionDiskJSON, 0, len(r.Sessions)),
+		Other:    r.Other,
+		Total:    r.Total,
+		Quota:    r.Quota,
+	}
+	for _, s := range r.Sessions {
+		session := sessionDiskJSON{
+			Name:         s.Session.Name,
+			Branch:       s.Session.Branch,
+			Path:         s.Session.Path,
+			State:        string(s.Session.State),
+			Checkout:     s.Usage.Checkout,
+			Artifacts:    s.Usage.Artifacts,
+			Dependencies: s.Usage.Dependencies,
+			Total:        s.Usage.Total(),
+		}
+		if !s.LastActive.IsZero() {
+			session.LastActive = &s.LastActive
+		}
+		result.Sessions = append(result.Sessions, session)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(result)
+}
+
+// printFindings renders doctor findings and returns how many problems remain
+func printFindings(findings []claudemux.Finding, fix bool) int {
+	fmt.Println("🩺 Checking claude-mux setup...")
+	fmt.Println()
+
+	problems := 0
+	for _, f := range findings {
+		icon := "✅"
+		switch f.Level {
+		case claudemux.LevelWarning:
+			icon = "⚠️ "
+		case claudemux.LevelError:
+			icon = "❌"
+		}
+		fmt.Printf("%s %s: %s\n", icon, f.Check, f.Message)
+
+		switch {
+		case f.Level == claudemux.LevelOK:
+			continue
+		case f.Fixed:
+			fmt.Println("    🔧 Fixed")
+			continue
+		case f.FixErr != nil:
+			fmt.Printf("    ❌ Fix failed: %v\n", f.FixErr)
+		}
+
+		problems++
+		if f.Hint != "" {
+			fmt.Printf("    💡 %s\n", f.Hint)
+		}
+		if f.Fixable && !fix {
+			fmt.Println("    💡 Run 'claude-mux doctor --fix' to fix automatically")
+		}
+	}
+
+	fmt.Println()
+	if problems == 0 {
+		fmt.Println("✨ Everything looks good")
+	}
+	return problems
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/daemon"
+	"github.com/enriikke/claude-mux/internal/notify"
+	"github.com/enriikke/claude-mux/internal/web"
+)
+
+// serveDashboard serves the HTTP API and dashboard on addr until interrupted
+func serveDashboard(ctx context.Context, cfg config.Config, noDaemon bool, addr, tokenFile string, n notify.Notifier) error {
+	root, err := newClient(cfg).Root(ctx)
+	if err != nil {
+		return err
+	}
+
+	if tokenFile == "" {
+		if tokenFile, err = web.DefaultTokenPath(); err != nil {
+			return err
+		}
+	}
+	token, err := web.LoadToken(tokenFile)
+	if err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	server := web.New(cfg, web.Options{
+		Token: token,
+		Daemon: func(ctx context.Context) *daemon.Client {
+			return connectDaemon(ctx, cfg, noDaemon)
+		},
+		Notifier: n,
+		OnNotifyError: func(err error) {
+			fmt.Printf("⚠️  Notification failed: %v\n", err)
+		},
+	})
+
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("🌐 Dashboard for %s: http://%s/?token=%s\n", root, l.Addr(), url.QueryEscape(token))
+	if !isLoopback(l.Addr()) {
+		fmt.Println("⚠️  Warning: the dashboard is reachable from other machines, anyone with the token can control your sessions")
+	}
+	if connectDaemon(ctx, cfg, noDaemon) == nil {
+		fmt.Println("💡 Start 'claude-mux daemon' to view live output of background sessions")
+	}
+
+	if err := server.Serve(ctx, l); err != nil {
+		return err
+	}
+	fmt.Println("👋 Dashboard stopped")
+	return nil
+}
+
+// isLoopback reports whether addr only accepts local connections
+func isLoopback(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// shellInits define a cmux function that runs claude-mux, except that
+// "cmux cd <name>" changes the current directory of the shell itself
+var shellInits = map[string]string{
+	"bash": posixShellInit,
+	"zsh":  posixShellInit,
+	"fish": `function cmux --description 'claude-mux, with cd changing into a session worktree'
+    if test (count $argv) -gt 0; and test "$argv[1]" = cd
+        set -l dir (command claude-mux cd $argv[2..-1]); or return
+        cd $dir
+    else
+        command claude-mux $argv
+    end
+end
+`,
+}
+
+const posixShellInit = `cmux() {
+    if [ "$1" = cd ]; then
+        shift
+        local dir
+        dir="$(command claude-mux cd "$@")" || return
+        cd -- "$dir"
+    else
+        command claude-mux "$@"
+    fi
+}
+`
+
+// shellInit returns the shell integration snippet for shell
+func shellInit(shell string) (string, error) {
+	snippet, ok := shellInits[shell]
+	if !ok {
+		shells := make([]string, 0, len(shellInits))
+		for name := range shellInits {
+			shells = append(shells, name)
+		}
+		sort.Strings(shells)
+		return "", fmt.Errorf("unsupported shell %q, want one of %s", shell, strings.Join(shells, ", "))
+	}
+	return snippet, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/tmux"
+	"github.com/enriikke/claude-mux/pkg/claudemux"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// tmuxRun describes a session to create and run in tmux
+type tmuxRun struct {
+	name       string
+	mode       string
+	prompt     string
+	autocommit claudemux.AutocommitPolicy
+	cleanup    bool
+	network    claudemux.NetworkPolicy
+}
+
+// runInTmux creates a session and runs Claude in a new tmux window or
+// pane named after it. The session is removed again if tmux fails.
+func runInTmux(cmd *cobra.Command, cfg config.Config, run tmuxRun) error {
+	if run.mode != "window" && run.mode != "pane" {
+		return fmt.Errorf("invalid --tmux %q, want window or pane", run.mode)
+	}
+
+	ctx := cmd.Context()
+	client := newClient(cfg)
+	root, err := client.Root(ctx)
+	if err != nil {
+		return err
+	}
+	session, err := client.Create(ctx, claudemux.CreateOptions{Name: run.name, Network: run.network})
+	if err != nil {
+		return err
+	}
+
+	args := []string{"launch", session.Name, "--prompt=" + run.prompt, "--autocommit=" + string(run.autocommit)}
+	if run.cleanup {
+		args = append(args, "--cleanup")
+	}
+	command, err := selfCommand(cmd, root, args...)
+	if err != nil {
+		return removeAfter(ctx, client, session.Name, err)
+	}
+
+	t := tmux.NewClient(cfg.TmuxSocket, cfg.Verbose)
+	pane := tmux.Pane{Session: session.Name, Dir: session.Path, Command: command}
+	if run.mode == "pane" {
+		_, err = t.OpenPane(pane)
+	} else {
+		_, err = t.OpenWindow(pane)
+	}
+	if err != nil {
+		return removeAfter(ctx, client, session.Name, err)
+	}
+
+	fmt.Printf("🪟 Claude is running in tmux %s %s\n", run.mode, session.Name)
+	if !t.Inside() {
+		fmt.Printf("💡 To watch it: %s\n", t.AttachCommand())
+	}
+	return nil
+}
+
+// removeAfter removes a session that could not be started and returns err
+func removeAfter(ctx context.Context, client *claudemux.Client, name string, err error) error {
+	if _, removeErr := client.Remove(ctx, name, claudemux.RemoveOptions{}); removeErr != nil {
+		return fmt.Errorf("%w (removing %s also failed: %v)", err, name, removeErr)
+	}
+	return err
+}
+
+// tileGroup tiles the sessions of a group in one tmux window. Sessions
+// that do not run in tmux get a shell in their worktree.
+func tileGroup(ctx context.Context, cfg config.Config, group string) error {
+	sessions, err := newClient(cfg).List(ctx)
+	if err != nil {
+		return err
+	}
+	var panes []tmux.Pane
+	for _, s := range sessions {
+		if s.Group == group {
+			panes = append(panes, tmux.Pane{Session: s.Name, Dir: s.Path})
+		}
+	}
+	if len(panes) == 0 {
+		return fmt.Errorf("no sessions in group %q", group)
+	}
+
+	t := tmux.NewClient(cfg.TmuxSocket, cfg.Verbose)
+	if _, err := t.Tile(group, panes); err != nil {
+		return err
+	}
+	fmt.Printf("🧩 Tiled %d session(s) of %s in tmux window %s\n", len(panes), group, group)
+	if !t.Inside() {
+		fmt.Printf("💡 To watch them: %s\n", t.AttachCommand())
+	}
+	return nil
+}
+
+// selfCommand returns a shell command running claude-mux with args and
+// the global flags given on the command line, against the repository at root
+func selfCommand(cmd *cobra.Command, root string, args ...string) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the claude-mux executable: %w", err)
+	}
+
+	command := []string{exe, "--repo=" + root}
+	// Flags are marked changed on the subcommand that parsed them
+	cmd.Root().PersistentFlags().VisitAll(func(f *pflag.Flag) {
+		if f.Changed && f.Name != "repo" {
+			command = append(command, "--"+f.Name+"="+f.Value.String())
+		}
+	})
+	return tmux.Quote(append(command, args...)...), nil
+}
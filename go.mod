@@ -2,9 +2,12 @@ module github.com/enriikke/claude-mux
 
 go 1.25.0
 
-require github.com/spf13/cobra v1.9.1
-
 require (
-	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/pflag v1.0.6 // indirect
+	github.com/creack/pty v1.1.24
+	github.com/spf13/cobra v1.9.1
+	github.com/spf13/pflag v1.0.6
+	golang.org/x/sys v0.47.0
+	golang.org/x/term v0.45.0
 )
+
+require github.com/inconshreveable/mousetrap v1.1.0 // indirect
@@ -0,0 +1,295 @@
+// Package asciicast reads, writes and plays terminal recordings in the
+// asciicast v2 format of asciinema. A recording is a JSON header line
+// followed by one JSON array per event: [time, type, data].
+package asciicast
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Version is the asciicast format version written and read by this package
+const Version = 2
+
+// Event types
+const (
+	// Output is data written to the terminal
+	Output = "o"
+	// Input is data typed into the terminal
+	Input = "i"
+	// Resize changes the terminal size, its data is "COLSxROWS"
+	Resize = "r"
+	// Marker marks a point of interest in the recording
+	Marker = "m"
+)
+
+// Header is the first line of a recording
+type Header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Event is something that happened in the terminal
+type Event struct {
+	// Time is the number of seconds since the recording started
+	Time float64
+	Type string
+	Data string
+}
+
+// MarshalJSON encodes the event as a [time, type, data] array
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{e.Time, e.Type, e.Data})
+}
+
+// UnmarshalJSON decodes a [time, type, data] array
+func (e *Event) UnmarshalJSON(data []byte) error {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if len(fields) != 3 {
+		return fmt.Errorf("event has %d fields, want 3", len(fields))
+	}
+	if err := json.Unmarshal(fields[0], &e.Time); err != nil {
+		return fmt.Errorf("invalid event time: %w", err)
+	}
+	if err := json.Unmarshal(fields[1], &e.Type); err != nil {
+		return fmt.Errorf("invalid event type: %w", err)
+	}
+	if err := json.Unmarshal(fields[2], &e.Data); err != nil {
+		return fmt.Errorf("invalid event data: %w", err)
+	}
+	return nil
+}
+
+// Writer records terminal output. It is safe for concurrent use.
+type Writer struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+	// pending holds the start of a rune split across writes
+	pending []byte
+	err     error
+}
+
+// NewWriter writes the header of a new recording to w. The version is
+// always set, and the timestamp defaults to the current time.
+func NewWriter(w io.Writer, h Header) (*Writer, error) {
+	start := time.Now()
+	h.Version = Version
+	if h.Timestamp == 0 {
+		h.Timestamp = start.Unix()
+	}
+
+	line, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append(line, '\n')); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, start: start}, nil
+}
+
+// Write records p as terminal output. A rune split across writes is kept
+// back until it is complete, since event data must be valid UTF-8.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	data := append(w.pending, p...)
+	end := completeRunes(data)
+	w.pending = append([]byte(nil), data[end:]...)
+	if end > 0 {
+		if err := w.event(Output, string(data[:end])); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Resize records a change of the terminal size
+func (w *Writer) Resize(cols, rows int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.event(Resize, fmt.Sprintf("%dx%d", cols, rows))
+}
+
+// Mark records a marker labeled with a point of interest
+func (w *Writer) Mark(label string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.event(Marker, label)
+}
+
+// Flush records output kept back by Write, even if it is not valid UTF-8
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.pending) == 0 {
+		return w.err
+	}
+	data := string(w.pending)
+	w.pending = nil
+	return w.event(Output, data)
+}
+
+// event writes an event line, remembering the first error
+func (w *Writer) event(kind, data string) error {
+	if w.err != nil {
+		return w.err
+	}
+	elapsed := time.Since(w.start).Seconds()
+	line, err := json.Marshal(Event{Time: math.Round(elapsed*1e6) / 1e6, Type: kind, Data: data})
+	if err != nil {
+		return err
+	}
+	if _, err := w.w.Write(append(line, '\n')); err != nil {
+		w.err = err
+	}
+	return w.err
+}
+
+// Reader reads the events of a recording
+type Reader struct {
+	Header Header
+	dec    *json.Decoder
+}
+
+// NewReader reads the header of a recording from r
+func NewReader(r io.Reader) (*Reader, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	var h Header
+	if err := dec.Decode(&h); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("recording is empty")
+		}
+		return nil, fmt.Errorf("invalid recording header: %w", err)
+	}
+	if h.Version != Version {
+		return nil, fmt.Errorf("unsupported asciicast version %d", h.Version)
+	}
+	return &Reader{Header: h, dec: dec}, nil
+}
+
+// Next returns the next event, or io.EOF at the end of the recording
+func (r *Reader) Next() (Event, error) {
+	var e Event
+	if err := r.dec.Decode(&e); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// The recorder was interrupted in the middle of an event
+			return e, io.EOF
+		}
+		return e, err
+	}
+	return e, nil
+}
+
+// PlayOptions configure Play
+type PlayOptions struct {
+	// Speed multiplies the playback speed. Defaults to 1.
+	Speed float64
+	// IdleLimit caps pauses between events. Zero keeps the recorded pauses.
+	IdleLimit time.Duration
+}
+
+// Play writes the output of a recording to w with its original timing
+func Play(ctx context.Context, r *Reader, w io.Writer, opts PlayOptions) error {
+	speed := opts.Speed
+	if speed <= 0 {
+		speed = 1
+	}
+
+	var last float64
+	for {
+		e, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if e.Type != Output {
+			continue
+		}
+
+		delay := time.Duration((e.Time - last) / speed * float64(time.Second))
+		last = e.Time
+		if opts.IdleLimit > 0 && delay > opts.IdleLimit {
+			delay = opts.IdleLimit
+		}
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		if _, err := io.WriteString(w, e.Data); err != nil {
+			return err
+		}
+	}
+}
+
+// Follow returns a reader of f that waits for data appended to the file
+// instead of ending at its end, like tail -f. It ends when ctx is done or
+// the file is removed.
+func Follow(ctx context.Context, f *os.File, interval time.Duration) io.Reader {
+	return &follower{ctx: ctx, f: f, interval: interval}
+}
+
+type follower struct {
+	ctx      context.Context
+	f        *os.File
+	interval time.Duration
+}
+
+func (f *follower) Read(p []byte) (int, error) {
+	for {
+		n, err := f.f.Read(p)
+		if n > 0 || !errors.Is(err, io.EOF) {
+			return n, err
+		}
+		if _, err := os.Stat(f.f.Name()); errors.Is(err, os.ErrNotExist) {
+			return 0, io.EOF
+		}
+
+		timer := time.NewTimer(f.interval)
+		select {
+		case <-f.ctx.Done():
+			timer.Stop()
+			return 0, f.ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// completeRunes returns the length of p without a trailing incomplete rune
+func completeRunes(p []byte) int {
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if utf8.FullRune(p[i:]) {
+				return len(p)
+			}
+			return i
+		}
+	}
+	return len(p)
+}
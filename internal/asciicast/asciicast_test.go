@@ -0,0 +1,225 @@
+package asciicast
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriterReader(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Header{Width: 80, Height: 24, Title: "task"})
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+
+	octopus := []byte("🐙")
+	writes := [][]byte{[]byte("hello\r\n"), append([]byte("a "), octopus[:2]...), octopus[2:]}
+	for _, p := range writes {
+		if n, err := w.Write(p); err != nil || n != len(p) {
+			t.Fatalf("Write(%q) = %d, %v", p, n, err)
+		}
+	}
+	if err := w.Resize(120, 40); err != nil {
+		t.Fatalf("Resize() error = %v", err)
+	}
+	if err := w.Mark("tests pass"); err != nil {
+		t.Fatalf("Mark() error = %v", err)
+	}
+	if _, err := w.Write([]byte{'!', 0xf0}); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	if !strings.HasPrefix(buf.String(), `{"version":2,"width":80,"height":24,"timestamp":`) {
+		t.Errorf("Unexpected header line in %q", buf.String())
+	}
+
+	r, err := NewReader(&buf)
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	if r.Header.Title != "task" || r.Header.Timestamp == 0 {
+		t.Errorf("Unexpected header %+v", r.Header)
+	}
+
+	want := []Event{
+		{Type: Output, Data: "hello\r\n"},
+		{Type: Output, Data: "a "},
+		{Type: Output, Data: "🐙"},
+		{Type: Resize, Data: "120x40"},
+		{Type: Marker, Data: "tests pass"},
+		{Type: Output, Data: "!"},
+		{Type: Output, Data: "�"},
+	}
+	var last float64
+	for i, wantEvent := range want {
+		e, err := r.Next()
+		if err != nil {
+			t.Fatalf("Next() #%d error = %v", i, err)
+		}
+		if e.Type != wantEvent.Type || e.Data != wantEvent.Data {
+			t.Errorf("Next() #%d = %+v, want %+v", i, e, wantEvent)
+		}
+		if e.Time < last {
+			t.Errorf("Event #%d at %v is earlier than the previous one at %v", i, e.Time, last)
+		}
+		last = e.Time
+	}
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected io.EOF after the last event, got %v", err)
+	}
+}
+
+func TestNewReader_Invalid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"not json", "hello\n"},
+		{"version 1", `{"version":1,"width":80,"height":24}` + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if _, err := NewReader(strings.NewReader(tt.input)); err == nil {
+				t.Errorf("NewReader(%q) succeeded, want an error", tt.input)
+			}
+		})
+	}
+}
+
+func TestReader_TruncatedEvent(t *testing.T) {
+	t.Parallel()
+
+	input := `{"version":2,"width":80,"height":24}` + "\n" +
+		`[0.1,"o","done"]` + "\n" +
+		`[0.2,"o","cut o`
+	r, err := NewReader(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	if e, err := r.Next(); err != nil || e.Data != "done" {
+		t.Fatalf("Next() = %+v, %v", e, err)
+	}
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected a truncated event to end the recording, got %v", err)
+	}
+}
+
+func TestPlay(t *testing.T) {
+	t.Parallel()
+
+	input := `{"version":2,"width":80,"height":24}` + "\n" +
+		`[0.0,"o","one "]` + "\n" +
+		`[0.1,"r","100x30"]` + "\n" +
+		`[0.2,"o","two "]` + "\n" +
+		`[30.0,"o","three"]` + "\n"
+
+	tests := []struct {
+		name    string
+		opts    PlayOptions
+		minimum time.Duration
+		maximum time.Duration
+	}{
+		{"idle limit", PlayOptions{IdleLimit: 50 * time.Millisecond}, 100 * time.Millisecond, 2 * time.Second},
+		{"speed", PlayOptions{Speed: 100}, 250 * time.Millisecond, 2 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r, err := NewReader(strings.NewReader(input))
+			if err != nil {
+				t.Fatalf("NewReader() error = %v", err)
+			}
+			var out bytes.Buffer
+			start := time.Now()
+			if err := Play(context.Background(), r, &out, tt.opts); err != nil {
+				t.Fatalf("Play() error = %v", err)
+			}
+			elapsed := time.Since(start)
+
+			if out.String() != "one two three" {
+				t.Errorf("Play() wrote %q", out.String())
+			}
+			if elapsed < tt.minimum || elapsed > tt.maximum {
+				t.Errorf("Play() took %v, want between %v and %v", elapsed, tt.minimum, tt.maximum)
+			}
+		})
+	}
+}
+
+func TestPlay_Canceled(t *testing.T) {
+	t.Parallel()
+
+	input := `{"version":2,"width":80,"height":24}` + "\n" + `[60.0,"o","late"]` + "\n"
+	r, err := NewReader(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := Play(ctx, r, io.Discard, PlayOptions{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Play() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestFollow(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "output.cast")
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create recording: %v", err)
+	}
+	defer func() { _ = out.Close() }()
+	w, err := NewWriter(out, Header{Width: 80, Height: 24})
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+
+	in, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open recording: %v", err)
+	}
+	defer func() { _ = in.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r, err := NewReader(Follow(ctx, in, 10*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_, _ = w.Write([]byte("appended"))
+		time.Sleep(50 * time.Millisecond)
+		_ = os.Remove(path)
+	}()
+
+	e, err := r.Next()
+	if err != nil || e.Data != "appended" {
+		t.Fatalf("Next() = %+v, %v, want the appended output", e, err)
+	}
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Errorf("Expected following to end once the recording is removed, got %v", err)
+	}
+}
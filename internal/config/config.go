@@ -1,26 +1,291 @@
 package config
 
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultStopTimeout is how long a stopping agent may take to exit before it is killed
+const DefaultStopTimeout = 10 * time.Second
+
+// DefaultResumeFlag makes Claude Code continue the most recent conversation
+// in its working directory
+const DefaultResumeFlag = "--continue"
+
+// OnChangeCheckpointInterval is how often the worktree is checked for
+// changes when checkpoints are taken on every change
+const OnChangeCheckpointInterval = 2 * time.Second
+
+// DefaultMaxCheckpoints is how many checkpoints a session keeps by default
+const DefaultMaxCheckpoints = 100
+
 // Config holds the configuration for claude-mux
 type Config struct {
+	// RepoDir is the repository directory git commands run in.
+	// An empty value means the current working directory.
+	RepoDir string
+
 	// WorktreeBasePath is the base directory for all worktrees
 	WorktreeBasePath string
 
 	// ClaudeCommand is the command to launch Claude Code
 	ClaudeCommand string
 
+	// ClaudeResumeFlag is passed to ClaudeCommand when a session is resumed
+	// so the agent continues its previous conversation. Empty passes none.
+	ClaudeResumeFlag string
+
 	// AutoCleanup determines if worktrees are removed after Claude exits
 	AutoCleanup bool
 
+	// VerifyCommand is the shell command that checks the work of a session,
+	// e.g. "make test". It runs in the session worktree.
+	VerifyCommand string
+
+	// StopTimeout is how long Claude may take to exit after being asked to
+	// stop before it is killed
+	StopTimeout time.Duration
+
+	// SessionLogs records the terminal output of agents to a log per session
+	SessionLogs bool
+
+	// CheckpointInterval is how often the worktree of a running agent is
+	// checked for changes, which are then kept as a checkpoint. Zero
+	// disables checkpoints.
+	CheckpointInterval time.Duration
+
+	// MaxCheckpoints is how many checkpoints a session keeps, the oldest
+	// are deleted beyond it. Zero keeps DefaultMaxCheckpoints.
+	MaxCheckpoints int
+
+	// TmuxSocket selects the tmux server sessions are opened in: a socket
+	// name or path. Empty uses the server claude-mux runs in, or the default.
+	TmuxSocket string
+
+	// Limits caps the resources of every agent, each in its own cgroup.
+	// Zero values are unlimited.
+	Limits Limits
+
+	// Sandbox confines agents to their worktree, the git common directory,
+	// temporary directories and SandboxWritable. Everything else is
+	// read-only to them.
+	Sandbox bool
+
+	// SandboxWritable lists further files and directories sandboxed
+	// agents may change, besides the conversations and state Claude Code
+	// writes, which they may always change
+	SandboxWritable []string
+
+	// Isolation is where agents run: on the host or in a container
+	Isolation Isolation
+
+	// Container configures the containers agents run in with
+	// IsolationContainer
+	Container Container
+
+	// DiskQuota caps the disk space taken under WorktreeBasePath, in bytes.
+	// Zero is unlimited.
+	DiskQuota int64
+
+	// QuotaAction is what creating a session does once DiskQuota is used up
+	QuotaAction QuotaAction
+
 	// Verbose enables detailed output
 	Verbose bool
 }
 
+// Limits caps the resources an agent and all of its children may use
+type Limits struct {
+	// CPUs is how many CPU cores they may keep busy, e.g. 1.5
+	CPUs float64 `json:"cpus,omitempty"`
+	// Memory is how many bytes of memory they may use
+	Memory int64 `json:"memory,omitempty"`
+	// PIDs is how many processes and threads they may run
+	PIDs int `json:"pids,omitempty"`
+}
+
+// IsZero reports whether no limit is set
+func (l Limits) IsZero() bool {
+	return l == Limits{}
+}
+
+// Isolation is where agents run
+type Isolation string
+
+const (
+	// IsolationHost runs agents as processes on the host
+	IsolationHost Isolation = "host"
+	// IsolationContainer runs agents in containers with the worktree and
+	// the git common directory mounted
+	IsolationContainer Isolation = "container"
+)
+
+// ParseIsolation parses "host" or "container". An empty name means host.
+func ParseIsolation(s string) (Isolation, error) {
+	switch isolation := Isolation(s); isolation {
+	case "", IsolationHost:
+		return IsolationHost, nil
+	case IsolationContainer:
+		return isolation, nil
+	default:
+		return "", fmt.Errorf("invalid isolation %q, want host or container", s)
+	}
+}
+
+// Container configures the containers agents run in
+type Container struct {
+	// Runtime is the container runtime command, such as podman or docker.
+	// Empty picks whichever is installed, podman first.
+	Runtime string
+	// Image is the image agents run in. It must provide ClaudeCommand.
+	Image string
+	// Args are further arguments to the run command of the runtime, such
+	// as --volume options
+	Args []string
+}
+
+// QuotaAction is what creating a session does once the disk quota is
+// used up
+type QuotaAction string
+
+const (
+	// QuotaRefuse refuses to create the session
+	QuotaRefuse QuotaAction = "refuse"
+	// QuotaArchive archives the idle sessions that were used least recently
+	// until there is room, and refuses if that is not enough
+	QuotaArchive QuotaAction = "archive"
+)
+
+// ParseQuotaAction parses "refuse" or "archive". An empty name means refuse.
+func ParseQuotaAction(s string) (QuotaAction, error) {
+	switch action := QuotaAction(s); action {
+	case "", QuotaRefuse:
+		return QuotaRefuse, nil
+	case QuotaArchive:
+		return action, nil
+	default:
+		return "", fmt.Errorf("invalid quota action %q, want refuse or archive", s)
+	}
+}
+
 // DefaultConfig returns the default configuration
 func DefaultConfig() Config {
 	return Config{
 		WorktreeBasePath: ".claude-mux",
 		ClaudeCommand:    "claude",
+		ClaudeResumeFlag: DefaultResumeFlag,
 		AutoCleanup:      false,
+		StopTimeout:      DefaultStopTimeout,
+		SessionLogs:      true,
+		MaxCheckpoints:   DefaultMaxCheckpoints,
 		Verbose:          false,
 	}
 }
+
+// UserDir returns the directory claude-mux keeps the files of the current
+// user in, such as the token of the dashboard
+func UserDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "claude-mux"), nil
+}
+
+// RuntimeDir returns the directory claude-mux keeps the sockets of the
+// current user in. Without a runtime directory it is kept in the user's
+// state directory rather than a temporary one, which sandboxed agents may
+// write to.
+func RuntimeDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "claude-mux")
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "claude-mux")
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "state", "claude-mux")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("claude-mux-%d", os.Getuid()))
+}
+
+// ParseCheckpointInterval parses the checkpoint setting: "off", "on-change"
+// or an interval such as "5m"
+func ParseCheckpointInterval(s string) (time.Duration, error) {
+	switch s {
+	case "", "off":
+		return 0, nil
+	case "on-change":
+		return OnChangeCheckpointInterval, nil
+	}
+	interval, err := time.ParseDuration(s)
+	if err != nil || interval <= 0 {
+		return 0, fmt.Errorf("invalid checkpoint setting %q, want off, on-change or a positive interval like 5m", s)
+	}
+	return interval, nil
+}
+
+// sizeUnits are the suffixes ParseMemory and ParseDiskQuota accept, in
+// binary multiples
+var sizeUnits = map[string]int64{
+	"":  1,
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+	"t": 1 << 40,
+}
+
+// ParseMemory parses an amount of memory such as "512M" or "4GiB" into
+// bytes. Units are binary. An empty string or "0" means unlimited.
+func ParseMemory(s string) (int64, error) {
+	return parseSize(s, "memory limit")
+}
+
+// ParseDiskQuota parses an amount of disk space such as "50G" into bytes.
+// Units are binary. An empty string or "0" means unlimited.
+func ParseDiskQuota(s string) (int64, error) {
+	return parseSize(s, "disk quota")
+}
+
+// parseSize parses an amount of bytes with an optional unit, naming what
+// it is in errors
+func parseSize(s, what string) (int64, error) {
+	value := strings.TrimSpace(s)
+	if value == "" {
+		return 0, nil
+	}
+
+	unit := strings.ToLower(strings.TrimLeft(value, "0123456789."))
+	number := value[:len(value)-len(unit)]
+	unit = strings.TrimSuffix(strings.TrimSuffix(unit, "b"), "i")
+	multiple, ok := sizeUnits[unit]
+	n, err := strconv.ParseFloat(number, 64)
+	if !ok || err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s %q, want an amount like 512M or 4G", what, s)
+	}
+	// float64(math.MaxInt64) rounds up to 2^63, which no longer fits
+	bytes := n * float64(multiple)
+	if bytes >= float64(math.MaxInt64) || bytes < 0 || math.IsNaN(bytes) {
+		return 0, fmt.Errorf("invalid %s %q, want at most %s", what, s, FormatBytes(math.MaxInt64))
+	}
+	return int64(bytes), nil
+}
+
+// FormatBytes renders a number of bytes in binary units, e.g. 1.5 GiB
+func FormatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
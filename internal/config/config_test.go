@@ -1,8 +1,11 @@
 package config
 
 import (
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDefaultConfig(t *testing.T) {
@@ -10,7 +13,11 @@ func TestDefaultConfig(t *testing.T) {
 	want := Config{
 		WorktreeBasePath: ".claude-mux",
 		ClaudeCommand:    "claude",
+		ClaudeResumeFlag: DefaultResumeFlag,
 		AutoCleanup:      false,
+		StopTimeout:      DefaultStopTimeout,
+		SessionLogs:      true,
+		MaxCheckpoints:   DefaultMaxCheckpoints,
 		Verbose:          false,
 	}
 
@@ -61,3 +68,171 @@ func TestConfig_Fields(t *testing.T) {
 		})
 	}
 }
+
+func TestParseCheckpointInterval(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"off", 0, false},
+		{"", 0, false},
+		{"on-change", OnChangeCheckpointInterval, false},
+		{"5m", 5 * time.Minute, false},
+		{"0s", 0, true},
+		{"often", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseCheckpointInterval(tt.input)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseCheckpointInterval(%q) = %v, %v, want %v", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseIsolation(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Isolation
+		wantErr bool
+	}{
+		{"", IsolationHost, false},
+		{"host", IsolationHost, false},
+		{"container", IsolationContainer, false},
+		{"vm", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseIsolation(tt.input)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseIsolation(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"0", 0, false},
+		{"1048576", 1 << 20, false},
+		{"512M", 512 << 20, false},
+		{"4g", 4 << 30, false},
+		{"4GiB", 4 << 30, false},
+		{"1.5G", 3 << 29, false},
+		{"2KB", 2 << 10, false},
+		{"-1G", 0, true},
+		{"-0.5", 0, true},
+		{"9223372036854775808", 0, true},
+		{"8388608T", 0, true},
+		{"1e10T", 0, true},
+		{"G", 0, true},
+		{"4X", 0, true},
+		{"lots", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseMemory(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMemory(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMemory(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDiskQuota(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr string
+	}{
+		{"", 0, ""},
+		{"50G", 50 << 30, ""},
+		{"1.5T", 3 << 39, ""},
+		{"plenty", 0, `invalid disk quota "plenty"`},
+		{"99999999999T", 0, `invalid disk quota "99999999999T", want at most 8.0 EiB`},
+		{"-50G", 0, `invalid disk quota "-50G"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseDiskQuota(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseDiskQuota(%q) error = %v, want %q", tt.input, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseDiskQuota(%q) = %d, %v, want %d", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQuotaAction(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    QuotaAction
+		wantErr bool
+	}{
+		{"", QuotaRefuse, false},
+		{"refuse", QuotaRefuse, false},
+		{"archive", QuotaArchive, false},
+		{"delete", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseQuotaAction(tt.input)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseQuotaAction(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		input int64
+		want  string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KiB"},
+		{5 << 30, "5.0 GiB"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatBytes(tt.input); got != tt.want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestRuntimeDir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_STATE_HOME", "")
+
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	if dir := RuntimeDir(); dir != "/run/user/1000/claude-mux" {
+		t.Errorf("Expected the runtime directory, got %s", dir)
+	}
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	if dir, want := RuntimeDir(), filepath.Join(home, ".local", "state", "claude-mux"); dir != want {
+		t.Errorf("Expected the state directory %s rather than a temporary one, got %s", want, dir)
+	}
+}
@@ -0,0 +1,33 @@
+package daemon
+
+import "sync"
+
+// ringBuffer keeps the most recent output of an agent
+type ringBuffer struct {
+	mu   sync.Mutex
+	data []byte
+	size int
+}
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{size: size}
+}
+
+// Write appends p, dropping the oldest bytes beyond the buffer size
+func (b *ringBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.data = append(b.data, p...)
+	if over := len(b.data) - b.size; over > 0 {
+		b.data = append(b.data[:0], b.data[over:]...)
+	}
+	return len(p), nil
+}
+
+// Bytes returns a copy of the buffered output
+func (b *ringBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.data...)
+}
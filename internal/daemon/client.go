@@ -0,0 +1,330 @@
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/worktree"
+)
+
+// attachProtocol is the protocol an attach request upgrades the connection to
+const attachProtocol = "claude-mux-tty"
+
+// ErrNotRunning is returned by Dial when no daemon serves the socket
+var ErrNotRunning = errors.New("daemon is not running")
+
+// ErrInsecureSocket is returned when the daemon socket could have been
+// planted by another user: its directory is not private to the current
+// user or the daemon runs as someone else
+var ErrInsecureSocket = errors.New("insecure daemon socket")
+
+// Client talks to a daemon over its Unix socket
+type Client struct {
+	socket string
+	http   *http.Client
+}
+
+// Dial connects to the daemon listening on socket and checks that it responds
+func Dial(ctx context.Context, socket string) (*Client, error) {
+	c := &Client{
+		socket: socket,
+		http: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					return dialSocket(ctx, socket)
+				},
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	if _, err := c.Health(ctx); err != nil {
+		if errors.Is(err, ErrInsecureSocket) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", ErrNotRunning, err)
+	}
+	return c, nil
+}
+
+// dialSocket connects to a daemon socket after making sure no other user
+// could have planted it
+func dialSocket(ctx context.Context, socket string) (net.Conn, error) {
+	if err := checkSocketDir(filepath.Dir(socket)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkPeer(conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// Health returns information about the daemon
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	var health Health
+	if err := c.do(ctx, http.MethodGet, "/v1/health", nil, &health); err != nil {
+		return nil, err
+	}
+	return &health, nil
+}
+
+// Create creates a session and starts its agent in the background
+func (c *Client) Create(ctx context.Context, req CreateRequest) (*Session, error) {
+	var session Session
+	if err := c.do(ctx, http.MethodPost, "/v1/sessions", req, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Resume relaunches the agent of an existing session in the background
+func (c *Client) Resume(ctx context.Context, name string, req ResumeRequest) (*Session, error) {
+	var session Session
+	if err := c.do(ctx, http.MethodPost, sessionPath(name, "resume"), req, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// List returns all sessions of the repository
+func (c *Client) List(ctx context.Context) ([]Session, error) {
+	var sessions []Session
+	if err := c.do(ctx, http.MethodGet, "/v1/sessions", nil, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Stop stops the agent of a session and waits until it exited
+func (c *Client) Stop(ctx context.Context, name string) (*Session, error) {
+	var session Session
+	if err := c.do(ctx, http.MethodPost, sessionPath(name, "stop"), nil, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Pause suspends the agent of a session until it is unpaused
+func (c *Client) Pause(ctx context.Context, name string) (*Session, error) {
+	var session Session
+	if err := c.do(ctx, http.MethodPost, sessionPath(name, "pause"), nil, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Unpause resumes the paused agent of a session
+func (c *Client) Unpause(ctx context.Context, name string) (*Session, error) {
+	var session Session
+	if err := c.do(ctx, http.MethodPost, sessionPath(name, "unpause"), nil, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// Remove stops the agent of a session, if it runs, and removes the session
+func (c *Client) Remove(ctx context.Context, name string, force bool) (*RemoveResult, error) {
+	path := sessionPath(name, "")
+	if force {
+		path += "?force=true"
+	}
+
+	var result RemoveResult
+	if err := c.do(ctx, http.MethodDelete, path, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Prune removes all sessions whose agent does not run, stale worktree
+// metadata and orphaned branches
+func (c *Client) Prune(ctx context.Context, dryRun, force bool) (*PruneResult, error) {
+	query := url.Values{}
+	if dryRun {
+		query.Set("dry_run", "true")
+	}
+	if force {
+		query.Set("force", "true")
+	}
+	path := "/v1/prune"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var result PruneResult
+	if err := c.do(ctx, http.MethodPost, path, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Logs returns the recent terminal output of a session's agent
+func (c *Client) Logs(ctx context.Context, name string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://daemon"+sessionPath(name, "logs"), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, decodeError(resp)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Resize changes the terminal size of a session's agent
+func (c *Client) Resize(ctx context.Context, name string, rows, cols uint16) error {
+	return c.do(ctx, http.MethodPost, sessionPath(name, "resize"), ResizeRequest{Rows: rows, Cols: cols}, nil)
+}
+
+// Attach connects to the terminal of a session's agent. Reads return the
+// agent's output, writes send input. The connection is closed by the
+// daemon when the agent exits; closing it detaches.
+func (c *Client) Attach(ctx context.Context, name string, rows, cols uint16) (net.Conn, error) {
+	conn, err := dialSocket(ctx, c.socket)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("rows", fmt.Sprint(rows))
+	query.Set("cols", fmt.Sprint(cols))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://daemon"+sessionPath(name, "attach")+"?"+query.Encode(), nil)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", attachProtocol)
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		defer func() { _ = conn.Close() }()
+		return nil, decodeError(resp)
+	}
+	return &attachedConn{Conn: conn, r: r}, nil
+}
+
+// attachedConn reads through the buffer that parsed the upgrade response
+type attachedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *attachedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// do sends a JSON request and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, "http://daemon"+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode >= 300 {
+		return decodeError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// decodeError turns an error response back into an error, restoring the
+// sentinel errors of the worktree package
+func decodeError(resp *http.Response) error {
+	var e errorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+		return fmt.Errorf("daemon returned %s", resp.Status)
+	}
+
+	switch e.Code {
+	case codeNotFound:
+		return &remoteError{msg: e.Error, sentinel: worktree.ErrNotFound}
+	case codeAmbiguous:
+		return &remoteError{msg: e.Error, sentinel: worktree.ErrAmbiguous}
+	case codeNotRepository:
+		return &remoteError{msg: e.Error, sentinel: worktree.ErrNotRepository}
+	case codeNotRunning:
+		return &remoteError{msg: e.Error, sentinel: ErrAgentStopped}
+	case codeRunning:
+		return &remoteError{msg: e.Error, sentinel: ErrAgentRunning}
+	case codeQuota:
+		return &remoteError{msg: e.Error, sentinel: worktree.ErrQuotaExceeded}
+	}
+	return errors.New(e.Error)
+}
+
+// remoteError keeps the message of a daemon error while matching the
+// sentinel error it was created from
+type remoteError struct {
+	msg      string
+	sentinel error
+}
+
+func (e *remoteError) Error() string {
+	return e.msg
+}
+
+func (e *remoteError) Unwrap() error {
+	return e.sentinel
+}
+
+// sessionPath returns the API path of a session or one of its actions
+func sessionPath(name, action string) string {
+	path := "/v1/sessions/" + url.PathEscape(name)
+	if action != "" {
+		path += "/" + action
+	}
+	return path
+}
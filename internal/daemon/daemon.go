@@ -0,0 +1,217 @@
+// Package daemon implements the optional claude-mux daemon. The daemon
+// supervises agents running in the background, keeps a registry of them in
+// memory and serves an HTTP API over a Unix socket, so several clients can
+// manage sessions without racing each other.
+package daemon
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/worktree"
+)
+
+// SocketPath returns the socket of the daemon serving the repository rooted
+// at root. Sockets live in a per-user directory because socket paths are
+// limited to about a hundred bytes.
+func SocketPath(root string) string {
+	sum := sha256.Sum256([]byte(filepath.Clean(root)))
+	return filepath.Join(socketDir(), "daemon-"+hex.EncodeToString(sum[:6])+".sock")
+}
+
+// socketDir returns the private directory holding daemon sockets
+func socketDir() string {
+	return config.RuntimeDir()
+}
+
+// Health describes a running daemon
+type Health struct {
+	PID  int    `json:"pid"`
+	Root string `json:"root"`
+	// Settings are what the daemon starts agents with
+	Settings Settings `json:"settings"`
+}
+
+// Settings are the configuration the daemon starts agents with. They are
+// fixed when the daemon starts, requests cannot change them.
+type Settings struct {
+	WorktreeBasePath   string             `json:"base_path"`
+	ClaudeCommand      string             `json:"claude_cmd"`
+	ClaudeResumeFlag   string             `json:"claude_resume_flag"`
+	StopTimeout        time.Duration      `json:"stop_timeout"`
+	SessionLogs        bool               `json:"logs"`
+	CheckpointInterval time.Duration      `json:"checkpoint_interval"`
+	MaxCheckpoints     int                `json:"max_checkpoints"`
+	Limits             config.Limits      `json:"limits"`
+	Sandbox            bool               `json:"sandbox"`
+	SandboxWritable    []string           `json:"sandbox_allow"`
+	Isolation          config.Isolation   `json:"isolation"`
+	ContainerRuntime   string             `json:"container_runtime"`
+	ContainerImage     string             `json:"container_image"`
+	ContainerArgs      []string           `json:"container_args"`
+	DiskQuota          int64              `json:"disk_quota"`
+	QuotaAction        config.QuotaAction `json:"quota_action"`
+}
+
+// NewSettings returns the settings agents are started with under cfg
+func NewSettings(cfg config.Config) Settings {
+	return Settings{
+		WorktreeBasePath:   cfg.WorktreeBasePath,
+		ClaudeCommand:      cfg.ClaudeCommand,
+		ClaudeResumeFlag:   cfg.ClaudeResumeFlag,
+		StopTimeout:        cfg.StopTimeout,
+		SessionLogs:        cfg.SessionLogs,
+		CheckpointInterval: cfg.CheckpointInterval,
+		MaxCheckpoints:     cfg.MaxCheckpoints,
+		Limits:             cfg.Limits,
+		Sandbox:            cfg.Sandbox,
+		SandboxWritable:    cfg.SandboxWritable,
+		Isolation:          cfg.Isolation,
+		ContainerRuntime:   cfg.Container.Runtime,
+		ContainerImage:     cfg.Container.Image,
+		ContainerArgs:      cfg.Container.Args,
+		DiskQuota:          cfg.DiskQuota,
+		QuotaAction:        cfg.QuotaAction,
+	}
+}
+
+// Session describes a session known to the daemon
+type Session struct {
+	Name    string `json:"name"`
+	Branch  string `json:"branch"`
+	Path    string `json:"path"`
+	Locked  bool   `json:"locked"`
+	Changes int    `json:"changes"`
+	// State is what the agent of the session is doing: idle, running,
+	// waiting, paused, exited or stopped, wherever it was started
+	State string `json:"state"`
+	// LastOutputAt is when the agent last wrote to its terminal, if recorded
+	LastOutputAt *time.Time `json:"last_output_at,omitempty"`
+	// Running is set while the daemon supervises an agent in the session
+	Running bool `json:"running"`
+	// PID is the process ID of the running or last agent, if any
+	PID int `json:"pid,omitempty"`
+	// StartedAt is when the daemon started the agent
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	// ExitError describes why the agent failed, once it exited
+	ExitError string `json:"exit_error,omitempty"`
+	// Resources is what a running agent uses, set when it runs under
+	// resource limits
+	Resources *Resources `json:"resources,omitempty"`
+}
+
+// Resources describes the resource limits of an agent and what it uses.
+// Limits of zero are unlimited.
+type Resources struct {
+	CPUs        float64 `json:"cpus,omitempty"`
+	MemoryLimit int64   `json:"memory_limit,omitempty"`
+	PIDsLimit   int     `json:"pids_limit,omitempty"`
+	// CPUSeconds is the CPU time used since the agent started
+	CPUSeconds float64 `json:"cpu_seconds"`
+	// Memory is the memory in use, in bytes
+	Memory int64 `json:"memory"`
+	PIDs   int   `json:"pids"`
+}
+
+// NewResources describes the resources of an agent, nil if not limited
+func NewResources(usage *worktree.ResourceUsage) *Resources {
+	if usage == nil {
+		return nil
+	}
+	return &Resources{
+		CPUs:        usage.Limits.CPUs,
+		MemoryLimit: usage.Limits.Memory,
+		PIDsLimit:   usage.Limits.PIDs,
+		CPUSeconds:  usage.CPUTime.Seconds(),
+		Memory:      usage.Memory,
+		PIDs:        usage.PIDs,
+	}
+}
+
+// CreateRequest asks the daemon to create a session and start its agent
+type CreateRequest struct {
+	Name string `json:"name"`
+	// Prompt is the task passed to the agent when it starts
+	Prompt string `json:"prompt,omitempty"`
+	// Autocommit is the autocommit policy: off, wip or squash
+	Autocommit string `json:"autocommit,omitempty"`
+	// Cleanup removes the session once the agent exits
+	Cleanup bool `json:"cleanup"`
+	// Network is the network mode of the agent: host, none or allowlist
+	Network string `json:"network,omitempty"`
+	// AllowHosts lists the hosts an allowlisted agent may reach besides
+	// the API endpoint
+	AllowHosts []string `json:"allow_hosts,omitempty"`
+	// Rows and Cols size the agent's terminal
+	Rows uint16 `json:"rows"`
+	Cols uint16 `json:"cols"`
+}
+
+// ResumeRequest asks the daemon to relaunch the agent of an existing session
+type ResumeRequest struct {
+	// Cleanup removes the session once the agent exits
+	Cleanup bool `json:"cleanup"`
+	// Rows and Cols size the agent's terminal
+	Rows uint16 `json:"rows"`
+	Cols uint16 `json:"cols"`
+}
+
+// ResizeRequest changes the size of an agent's terminal
+type ResizeRequest struct {
+	Rows uint16 `json:"rows"`
+	Cols uint16 `json:"cols"`
+}
+
+// RemoveResult describes the outcome of removing a session
+type RemoveResult struct {
+	Session Session `json:"session"`
+	// BranchDeleted is set when the session branch was deleted
+	BranchDeleted bool `json:"branch_deleted"`
+	// BranchPreserved is set when the branch was kept because of unmerged changes
+	BranchPreserved bool `json:"branch_preserved"`
+	// BranchError describes why deleting the branch failed for another reason
+	BranchError string `json:"branch_error,omitempty"`
+}
+
+// PruneResult describes what a prune removed, or would remove in a dry run
+type PruneResult struct {
+	DryRun bool `json:"dry_run"`
+	// StaleMetadata describes administrative entries of vanished worktrees
+	StaleMetadata []string       `json:"stale_metadata"`
+	Removed       []RemoveResult `json:"removed"`
+	// Kept lists the sessions left in place because their agent runs or
+	// their worktree is locked
+	Kept []KeptSession `json:"kept"`
+	// BranchesDeleted and BranchesPreserved list orphaned branches
+	BranchesDeleted   []string `json:"branches_deleted"`
+	BranchesPreserved []string `json:"branches_preserved"`
+	// Errors describes problems that did not stop the prune
+	Errors []string `json:"errors,omitempty"`
+}
+
+// KeptSession is a session a prune left in place
+type KeptSession struct {
+	Session Session `json:"session"`
+	// Error says why
+	Error string `json:"error"`
+}
+
+// errorResponse is the body of failed requests
+type errorResponse struct {
+	Error string `json:"error"`
+	// Code classifies the error so clients can map it back to sentinel errors
+	Code string `json:"code,omitempty"`
+}
+
+// Error codes of errorResponse
+const (
+	codeNotFound      = "not_found"
+	codeAmbiguous     = "ambiguous"
+	codeNotRepository = "not_repository"
+	codeNotRunning    = "not_running"
+	codeRunning       = "running"
+	codeQuota         = "quota_exceeded"
+)
@@ -0,0 +1,39 @@
+package daemon
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCred returns the user and the process the peer of a Unix socket runs
+// as
+func peerCred(fd uintptr) (uid, pid int, err error) {
+	cred, err := unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(cred.Uid), int(cred.Pid), nil
+}
+
+// checkPeerNetwork makes sure the peer process shares the network namespace
+// of this one. Sessions with a network of their own reach the socket
+// through the file system, and could have the daemon start agents on the
+// network of the host for them otherwise.
+func checkPeerNetwork(pid int) error {
+	own, err := os.Readlink("/proc/self/ns/net")
+	if err != nil {
+		// Without /proc there are no namespaces to tell apart
+		return nil
+	}
+	peer, err := os.Readlink("/proc/" + strconv.Itoa(pid) + "/ns/net")
+	if err != nil {
+		return fmt.Errorf("%w: cannot tell the network of process %d: %v", ErrInsecureSocket, pid, err)
+	}
+	if peer != own {
+		return fmt.Errorf("%w: process %d runs in a network namespace of its own", ErrInsecureSocket, pid)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package daemon
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestCheckPeerNetwork(t *testing.T) {
+	t.Parallel()
+
+	// A process with a network of its own, like a session with --network none
+	cmd := exec.Command("unshare", "--user", "--map-root-user", "--net", "sh", "-c", "echo ready && exec sleep 30")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("unshare is not available: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	if _, err := bufio.NewReader(stdout).ReadString('\n'); err != nil {
+		t.Skip("unprivileged network namespaces are not available")
+	}
+
+	tests := []struct {
+		name    string
+		pid     int
+		wantErr bool
+	}{
+		{name: "same network", pid: os.Getpid()},
+		{name: "isolated network", pid: cmd.Process.Pid, wantErr: true},
+		{name: "unknown process", pid: 0, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkPeerNetwork(tt.pid)
+			if tt.wantErr != errors.Is(err, ErrInsecureSocket) {
+				t.Errorf("checkPeerNetwork() error = %v, want ErrInsecureSocket: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
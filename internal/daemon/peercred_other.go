@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package daemon
+
+import "errors"
+
+// peerCred cannot identify the peer of a Unix socket on this platform
+func peerCred(uintptr) (uid, pid int, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
+
+// checkPeerNetwork accepts any peer, sessions cannot get a network of their
+// own on this platform
+func checkPeerNetwork(int) error {
+	return nil
+}
@@ -0,0 +1,686 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/notify"
+	"github.com/enriikke/claude-mux/internal/worktree"
+)
+
+// logSize is how much recent output is kept per session
+const logSize = 256 * 1024
+
+var (
+	// ErrAgentStopped is returned for operations that need a running agent
+	ErrAgentStopped = worktree.ErrAgentNotRunning
+
+	// ErrAgentRunning is returned when an agent is started in a session whose agent still runs
+	ErrAgentRunning = worktree.ErrAgentRunning
+)
+
+// Server supervises background agents and serves the daemon API
+type Server struct {
+	manager  *worktree.Manager
+	settings Settings
+	logger   *log.Logger
+	// notifier is told when a session needs attention, if set
+	notifier notify.Notifier
+
+	// agentCtx bounds the lifetime of all agents started by the server
+	agentCtx    context.Context
+	stopAgents  context.CancelFunc
+	agentsGroup sync.WaitGroup
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	// starting holds the sessions whose agent is being started
+	starting map[string]bool
+}
+
+// session is an agent supervised by the daemon
+type session struct {
+	agent   *worktree.Agent
+	output  *ringBuffer
+	cleanup bool
+
+	mu      sync.Mutex
+	viewers map[net.Conn]struct{}
+}
+
+// Option configures a Server
+type Option func(*Server)
+
+// WithNotifier makes the server notify n when the agent of a session
+// exits or waits for input
+func WithNotifier(n notify.Notifier) Option {
+	return func(s *Server) {
+		s.notifier = n
+	}
+}
+
+// New creates a daemon server for the repository described by cfg
+func New(cfg config.Config, logger *log.Logger, opts ...Option) *Server {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		settings:   NewSettings(cfg),
+		logger:     logger,
+		agentCtx:   ctx,
+		stopAgents: cancel,
+		sessions:   make(map[string]*session),
+		starting:   make(map[string]bool),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.manager = worktree.NewManager(cfg, worktree.WithEventHandler(s.logEvent))
+	return s
+}
+
+// Root returns the root of the repository the server manages
+func (s *Server) Root() (string, error) {
+	return s.manager.Root()
+}
+
+// Listen listens on the daemon socket at path. A leftover socket of a
+// daemon that is gone is replaced; a live daemon is reported as an error.
+func Listen(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	if err := checkSocketDir(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("a daemon is already running at %s", path)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		_ = l.Close()
+		return nil, fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+	return peerListener{l}, nil
+}
+
+// peerListener drops connections from other users, which the permissions
+// of the socket keep out already unless they are root
+type peerListener struct {
+	net.Listener
+}
+
+func (l peerListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if checkPeer(conn) == nil {
+			return conn, nil
+		}
+		_ = conn.Close()
+	}
+}
+
+// Serve handles API requests on l until ctx is canceled. It then stops all
+// agents and waits for their post-exit processing.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	srv := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	if s.notifier != nil {
+		watcher := notify.NewWatcher(s.notifier, func(err error) {
+			s.logger.Printf("notification failed: %v", err)
+		})
+		go watcher.Watch(ctx, notify.DefaultInterval, s.manager.ListAgents)
+	}
+
+	err := srv.Serve(l)
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+
+	s.stopAgents()
+	s.agentsGroup.Wait()
+	return err
+}
+
+// Handler returns the HTTP handler of the daemon API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/health", s.handleHealth)
+	mux.HandleFunc("GET /v1/sessions", s.handleList)
+	mux.HandleFunc("POST /v1/sessions", s.handleCreate)
+	mux.HandleFunc("DELETE /v1/sessions/{name}", s.handleRemove)
+	mux.HandleFunc("POST /v1/prune", s.handlePrune)
+	mux.HandleFunc("GET /v1/sessions/{name}/attach", s.handleAttach)
+	mux.HandleFunc("POST /v1/sessions/{name}/resize", s.handleResize)
+	mux.HandleFunc("POST /v1/sessions/{name}/stop", s.handleStop)
+	mux.HandleFunc("POST /v1/sessions/{name}/pause", s.handlePause)
+	mux.HandleFunc("POST /v1/sessions/{name}/unpause", s.handleUnpause)
+	mux.HandleFunc("POST /v1/sessions/{name}/resume", s.handleResume)
+	mux.HandleFunc("GET /v1/sessions/{name}/logs", s.handleLogs)
+	return mux
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	root, err := s.manager.Root()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, Health{PID: os.Getpid(), Root: root, Settings: s.settings})
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	sessions, err := s.manager.List(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	result := make([]Session, 0, len(sessions))
+	for _, ws := range sessions {
+		result = append(result, s.describe(ws))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var req CreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+	autocommit, err := worktree.ParseAutocommitPolicy(req.Autocommit)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	network, err := worktree.ParseNetworkMode(req.Network)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	policy := worktree.NetworkPolicy{Mode: network, Allow: req.AllowHosts}
+	if err := policy.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	agent, err := s.manager.CreateAndStart(s.agentCtx, worktree.CreateOptions{
+		Name:       req.Name,
+		Prompt:     req.Prompt,
+		Autocommit: autocommit,
+		Cleanup:    req.Cleanup,
+		Network:    policy,
+	}, worktree.TermSize{Rows: req.Rows, Cols: req.Cols})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	details := s.supervise(agent, req.Cleanup)
+	writeJSON(w, http.StatusCreated, s.describe(worktree.Session{
+		Name:   details.Name,
+		Branch: details.Branch,
+		Path:   details.Path,
+	}))
+}
+
+func (s *Server) handleResume(w http.ResponseWriter, r *http.Request) {
+	var req ResumeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+	details, err := s.manager.Find(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	release, err := s.reserveStart(details.Name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer release()
+
+	agent, err := s.manager.ResumeAndStart(s.agentCtx, details.Name, worktree.ResumeOptions{
+		Cleanup: req.Cleanup,
+	}, worktree.TermSize{Rows: req.Rows, Cols: req.Cols})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	s.supervise(agent, req.Cleanup)
+	writeJSON(w, http.StatusOK, s.describe(worktree.Session{
+		Name:   details.Name,
+		Branch: details.Branch,
+		Path:   details.Path,
+	}))
+}
+
+// reserveStart marks the agent of a session as starting until release is
+// called, after it was supervised, so concurrent requests cannot start it
+// twice. It fails while the agent runs or starts.
+func (s *Server) reserveStart(name string) (release func(), err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ss := s.sessions[name]; s.starting[name] || ss != nil && ss.agent.Running() {
+		return nil, fmt.Errorf("%w: %s", ErrAgentRunning, name)
+	}
+	s.starting[name] = true
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.starting, name)
+	}, nil
+}
+
+// supervise registers a started agent and relays its output until it exits
+func (s *Server) supervise(agent *worktree.Agent, cleanup bool) worktree.WorktreeDetails {
+	ss := &session{
+		agent:   agent,
+		output:  newRingBuffer(logSize),
+		cleanup: cleanup,
+		viewers: make(map[net.Conn]struct{}),
+	}
+	details := agent.Session()
+	s.mu.Lock()
+	s.sessions[details.Name] = ss
+	s.mu.Unlock()
+
+	s.agentsGroup.Add(1)
+	go func() {
+		defer s.agentsGroup.Done()
+		ss.pump()
+	}()
+	return details
+}
+
+func (s *Server) handleRemove(w http.ResponseWriter, r *http.Request) {
+	details, err := s.manager.FindExact(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	result := RemoveResult{Session: Session{Name: details.Name, Branch: details.Branch, Path: details.Path}}
+	if ss := s.session(details.Name); ss != nil {
+		ss.agent.Stop()
+		s.mu.Lock()
+		delete(s.sessions, details.Name)
+		s.mu.Unlock()
+
+		if ss.cleanup {
+			// Stopping the agent already removed the session
+			writeJSON(w, http.StatusOK, result)
+			return
+		}
+	}
+
+	removal, err := s.manager.Remove(r.Context(), details.Name, r.URL.Query().Get("force") == "true")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	result.BranchDeleted = removal.BranchDeleted
+	result.BranchPreserved = removal.BranchPreserved
+	if removal.BranchErr != nil {
+		result.BranchError = removal.BranchErr.Error()
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handlePrune(w http.ResponseWriter, r *http.Request) {
+	report, err := s.manager.Prune(r.Context(), r.URL.Query().Get("dry_run") == "true", r.URL.Query().Get("force") == "true")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	result := PruneResult{
+		DryRun:            report.DryRun,
+		StaleMetadata:     report.StaleMetadata,
+		BranchesDeleted:   report.BranchesDeleted,
+		BranchesPreserved: report.BranchesPreserved,
+	}
+	for _, removal := range report.Worktrees {
+		removed := RemoveResult{
+			Session:         Session{Name: removal.Name, Branch: removal.Branch, Path: removal.Path},
+			BranchDeleted:   removal.BranchDeleted,
+			BranchPreserved: removal.BranchPreserved,
+		}
+		if removal.BranchErr != nil {
+			removed.BranchError = removal.BranchErr.Error()
+		}
+		result.Removed = append(result.Removed, removed)
+		if !report.DryRun {
+			s.mu.Lock()
+			delete(s.sessions, removal.Name)
+			s.mu.Unlock()
+		}
+	}
+	for _, kept := range report.Kept {
+		result.Kept = append(result.Kept, KeptSession{
+			Session: Session{Name: kept.Name, Branch: kept.Branch, Path: kept.Path},
+			Error:   kept.Err.Error(),
+		})
+	}
+	for _, err := range report.Errors {
+		result.Errors = append(result.Errors, err.Error())
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handleAttach(w http.ResponseWriter, r *http.Request) {
+	ss, details, err := s.runningSession(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var size ResizeRequest
+	_, _ = fmt.Sscan(r.URL.Query().Get("rows"), &size.Rows)
+	_, _ = fmt.Sscan(r.URL.Query().Get("cols"), &size.Cols)
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "connection does not support attaching"})
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		s.logger.Printf("attach %s: %v", details.Name, err)
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: " + attachProtocol + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		return
+	}
+
+	ss.addViewer(conn)
+	defer ss.removeViewer(conn)
+
+	// Resizing makes full screen agents redraw for the new viewer
+	if size.Rows > 0 && size.Cols > 0 {
+		_ = ss.agent.Resize(worktree.TermSize{Rows: size.Rows, Cols: size.Cols})
+	}
+
+	// Forward input until the client detaches or the agent exits
+	_, _ = io.Copy(ss.agent, rw.Reader)
+}
+
+func (s *Server) handleResize(w http.ResponseWriter, r *http.Request) {
+	ss, details, err := s.runningSession(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var req ResizeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Rows == 0 || req.Cols == 0 {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid terminal size"})
+		return
+	}
+	if err := ss.agent.Resize(worktree.TermSize{Rows: req.Rows, Cols: req.Cols}); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.describe(worktree.Session{Name: details.Name, Branch: details.Branch, Path: details.Path}))
+}
+
+func (s *Server) handleStop(w http.ResponseWriter, r *http.Request) {
+	ss, details, err := s.runningSession(r.PathValue("name"))
+	switch {
+	case err == nil:
+		ss.agent.Stop()
+	case errors.Is(err, ErrAgentStopped):
+		// Agents started outside of the daemon are stopped through their process
+		details, err = s.manager.Stop(r.Context(), details.Name)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeSession(w, r, details)
+}
+
+func (s *Server) handlePause(w http.ResponseWriter, r *http.Request) {
+	details, err := s.manager.Pause(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeSession(w, r, details)
+}
+
+func (s *Server) handleUnpause(w http.ResponseWriter, r *http.Request) {
+	details, err := s.manager.Unpause(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	s.writeSession(w, r, details)
+}
+
+// writeSession responds with the current state of a session
+func (s *Server) writeSession(w http.ResponseWriter, r *http.Request, details worktree.WorktreeDetails) {
+	status, err := s.manager.Status(r.Context(), details.Name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.describe(status.Session))
+}
+
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	details, err := s.manager.Find(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	ss := s.session(details.Name)
+	if ss == nil {
+		writeError(w, fmt.Errorf("%w: %s was not started by the daemon", ErrAgentStopped, details.Name))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(ss.output.Bytes())
+}
+
+// session returns the supervised session with the given full name, if any
+func (s *Server) session(name string) *session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[name]
+}
+
+// runningSession resolves name to a session whose agent is still running
+func (s *Server) runningSession(name string) (*session, worktree.WorktreeDetails, error) {
+	details, err := s.manager.Find(name)
+	if err != nil {
+		return nil, details, err
+	}
+	ss := s.session(details.Name)
+	if ss == nil || !ss.agent.Running() {
+		return nil, details, fmt.Errorf("%w: %s", ErrAgentStopped, details.Name)
+	}
+	return ss, details, nil
+}
+
+// describe adds the supervision state of the daemon to a session
+func (s *Server) describe(ws worktree.Session) Session {
+	result := Session{
+		Name:         ws.Name,
+		Branch:       ws.Branch,
+		Path:         ws.Path,
+		Locked:       ws.Locked,
+		Changes:      ws.Changes,
+		State:        string(ws.Agent.State),
+		LastOutputAt: lastOutput(ws.Agent),
+		PID:          ws.Agent.PID,
+		Resources:    NewResources(ws.Agent.Resources),
+	}
+
+	ss := s.session(ws.Name)
+	if ss == nil {
+		return result
+	}
+	startedAt := ss.agent.StartedAt()
+	result.PID = ss.agent.PID()
+	result.StartedAt = &startedAt
+	result.Running = ss.agent.Running()
+	// The daemon knows best whether the agents it supervises run
+	state := worktree.AgentState(result.State)
+	switch {
+	case !result.Running && state != worktree.AgentStopped:
+		result.State = string(worktree.AgentExited)
+	case result.Running && state != worktree.AgentWaiting && state != worktree.AgentPaused:
+		result.State = string(worktree.AgentRunning)
+	}
+	if !result.Running {
+		select {
+		case <-ss.agent.Done():
+			if err := ss.agent.Err(); err != nil {
+				result.ExitError = err.Error()
+			}
+		default:
+		}
+	}
+	return result
+}
+
+// lastOutput returns when an agent last wrote output, nil if unknown
+func lastOutput(status worktree.AgentStatus) *time.Time {
+	if status.LastOutputAt.IsZero() {
+		return nil
+	}
+	return &status.LastOutputAt
+}
+
+// logEvent writes manager events to the daemon log
+func (s *Server) logEvent(e worktree.Event) {
+	msg := string(e.Type)
+	if e.Session != "" {
+		msg += " " + e.Session
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Err != nil {
+		msg += fmt.Sprintf(" (%v)", e.Err)
+	}
+	s.logger.Print(msg)
+}
+
+// pump copies agent output to the log buffer and all viewers until the
+// agent exits, then disconnects the viewers
+func (ss *session) pump() {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := ss.agent.Read(buf)
+		if n > 0 {
+			_, _ = ss.output.Write(buf[:n])
+			ss.broadcast(buf[:n])
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	<-ss.agent.Done()
+	_ = ss.agent.Close()
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for conn := range ss.viewers {
+		_ = conn.Close()
+		delete(ss.viewers, conn)
+	}
+}
+
+// broadcast sends output to all viewers, dropping those that cannot keep up
+func (ss *session) broadcast(p []byte) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for conn := range ss.viewers {
+		_ = conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Write(p); err != nil {
+			_ = conn.Close()
+			delete(ss.viewers, conn)
+		}
+	}
+}
+
+func (ss *session) addViewer(conn net.Conn) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.viewers[conn] = struct{}{}
+}
+
+func (ss *session) removeViewer(conn net.Conn) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	delete(ss.viewers, conn)
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError maps err to an HTTP status and error code
+func writeError(w http.ResponseWriter, err error) {
+	resp := errorResponse{Error: err.Error()}
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, worktree.ErrNotFound):
+		status, resp.Code = http.StatusNotFound, codeNotFound
+	case errors.Is(err, worktree.ErrAmbiguous):
+		status, resp.Code = http.StatusBadRequest, codeAmbiguous
+	case errors.Is(err, worktree.ErrNotRepository):
+		status, resp.Code = http.StatusBadRequest, codeNotRepository
+	case errors.Is(err, ErrAgentStopped):
+		status, resp.Code = http.StatusConflict, codeNotRunning
+	case errors.Is(err, ErrAgentRunning):
+		status, resp.Code = http.StatusConflict, codeRunning
+	case errors.Is(err, worktree.ErrQuotaExceeded):
+		status, resp.Code = http.StatusInsufficientStorage, codeQuota
+	}
+	writeJSON(w, status, resp)
+}
@@ -0,0 +1,542 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/notify"
+	"github.com/enriikke/claude-mux/internal/worktree"
+)
+
+// runGit runs a git command in dir and fails the test on error
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to run git %v: %v\n%s", args, err, output)
+	}
+}
+
+func setupTestRepo(t *testing.T) string {
+	t.Helper()
+	tmpDir := t.TempDir()
+
+	runGit(t, tmpDir, "init")
+	runGit(t, tmpDir, "config", "user.email", "test@example.com")
+	runGit(t, tmpDir, "config", "user.name", "Test User")
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "test.txt"), []byte("test"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	runGit(t, tmpDir, "add", ".")
+	runGit(t, tmpDir, "commit", "-m", "initial")
+
+	return tmpDir
+}
+
+// startDaemon serves a daemon for a new test repository and returns a
+// client connected to it. agent is the shell script the sessions run.
+func startDaemon(t *testing.T, agent string, opts ...Option) *Client {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("background agents need a pseudo terminal")
+	}
+
+	script := filepath.Join(t.TempDir(), "agent.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"+agent), 0755); err != nil {
+		t.Fatalf("Failed to write agent script: %v", err)
+	}
+
+	server := New(config.Config{
+		RepoDir:          setupTestRepo(t),
+		WorktreeBasePath: ".claude-mux-test",
+		ClaudeCommand:    script,
+		StopTimeout:      time.Second,
+	}, log.New(io.Discard, "", 0), opts...)
+
+	socket := filepath.Join(t.TempDir(), "run", "d.sock")
+	l, err := Listen(socket)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ctx, l)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	})
+
+	client, err := Dial(context.Background(), socket)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	return client
+}
+
+// readUntil reads from r until the output contains want
+func readUntil(t *testing.T, r io.Reader, want string) string {
+	t.Helper()
+	var out bytes.Buffer
+	buf := make([]byte, 1024)
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(out.String(), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %q, got %q", want, out.String())
+		}
+		n, err := r.Read(buf)
+		out.Write(buf[:n])
+		if err != nil {
+			t.Fatalf("Read() error = %v, got %q", err, out.String())
+		}
+	}
+	return out.String()
+}
+
+func TestServer_Health(t *testing.T) {
+	t.Parallel()
+
+	client := startDaemon(t, "exec sleep 60\n")
+	health, err := client.Health(context.Background())
+	if err != nil {
+		t.Fatalf("Health() error = %v", err)
+	}
+	if health.PID != os.Getpid() || health.Root == "" {
+		t.Errorf("Expected the daemon to run as pid %d in a repository, got %+v", os.Getpid(), health)
+	}
+	if settings := health.Settings; settings.WorktreeBasePath != ".claude-mux-test" || settings.StopTimeout != time.Second || !strings.HasSuffix(settings.ClaudeCommand, "agent.sh") {
+		t.Errorf("Expected the settings the daemon starts agents with, got %+v", settings)
+	}
+}
+
+func TestServer_SessionLifecycle(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	// The agent echoes its input until it reads "quit"
+	client := startDaemon(t, "echo ready\nwhile read line; do\n  [ \"$line\" = quit ] && exit 0\n  echo \"got $line\"\ndone\n")
+
+	session, err := client.Create(ctx, CreateRequest{Name: "echo", Rows: 40, Cols: 120})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if !session.Running || session.PID == 0 {
+		t.Errorf("Expected a running agent, got %+v", session)
+	}
+
+	conn, err := client.Attach(ctx, session.Name, 40, 120)
+	if err != nil {
+		t.Fatalf("Attach() error = %v", err)
+	}
+	if _, err := conn.Write([]byte("hello\n")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	readUntil(t, conn, "got hello")
+
+	if err := client.Resize(ctx, session.Name, 50, 100); err != nil {
+		t.Errorf("Resize() error = %v", err)
+	}
+
+	logs, err := client.Logs(ctx, session.Name)
+	if err != nil {
+		t.Fatalf("Logs() error = %v", err)
+	}
+	if !strings.Contains(string(logs), "ready") || !strings.Contains(string(logs), "got hello") {
+		t.Errorf("Expected logs to contain the agent output, got %q", logs)
+	}
+
+	// The daemon disconnects viewers once the agent exits
+	if _, err := conn.Write([]byte("quit\n")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.Copy(io.Discard, conn); err != nil {
+		t.Errorf("Expected the daemon to close the connection, got %v", err)
+	}
+	_ = conn.Close()
+
+	sessions, err := client.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].Running {
+		t.Errorf("Expected one stopped session, got %+v", sessions)
+	}
+
+	if _, err := client.Stop(ctx, session.Name); !errors.Is(err, ErrAgentStopped) {
+		t.Errorf("Stop() of an exited agent error = %v, want ErrAgentStopped", err)
+	}
+
+	result, err := client.Remove(ctx, session.Name, false)
+	if err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if !result.BranchDeleted {
+		t.Errorf("Expected the unchanged branch to be deleted, got %+v", result)
+	}
+	if _, err := client.Logs(ctx, session.Name); !errors.Is(err, worktree.ErrNotFound) {
+		t.Errorf("Logs() of a removed session error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestServer_StopAndCleanup(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := startDaemon(t, "exec sleep 60\n")
+
+	kept, err := client.Create(ctx, CreateRequest{Name: "kept"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	cleaned, err := client.Create(ctx, CreateRequest{Name: "cleaned", Cleanup: true})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	stopped, err := client.Stop(ctx, kept.Name)
+	if err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if stopped.Running || stopped.State != string(worktree.AgentStopped) {
+		t.Errorf("Expected the agent to be stopped, got %+v", stopped)
+	}
+
+	// Removing a running session stops it first; cleanup removes the worktree
+	if _, err := client.Remove(ctx, cleaned.Name, false); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := os.Stat(cleaned.Path); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed, stat error = %v", cleaned.Path, err)
+	}
+
+	sessions, err := client.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].Name != kept.Name {
+		t.Errorf("Expected only %s to remain, got %+v", kept.Name, sessions)
+	}
+}
+
+func TestServer_Prune(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := startDaemon(t, "exec sleep 60\n")
+
+	running, err := client.Create(ctx, CreateRequest{Name: "running"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	stopped, err := client.Create(ctx, CreateRequest{Name: "stopped"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := client.Stop(ctx, stopped.Name); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+
+	result, err := client.Prune(ctx, false, false)
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if len(result.Removed) != 1 || result.Removed[0].Session.Name != stopped.Name {
+		t.Errorf("Expected only %s to be removed, got %+v", stopped.Name, result.Removed)
+	}
+	if len(result.Kept) != 1 || result.Kept[0].Session.Name != running.Name || result.Kept[0].Error == "" {
+		t.Errorf("Expected %s to be kept with a reason, got %+v", running.Name, result.Kept)
+	}
+
+	sessions, err := client.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].Name != running.Name || !sessions[0].Running {
+		t.Errorf("Expected only the running %s to remain, got %+v", running.Name, sessions)
+	}
+}
+
+func TestServer_Resume(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := startDaemon(t, "exec sleep 60\n")
+
+	session, err := client.Create(ctx, CreateRequest{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := client.Resume(ctx, session.Name, ResumeRequest{}); !errors.Is(err, ErrAgentRunning) {
+		t.Errorf("Resume() of a running agent error = %v, want ErrAgentRunning", err)
+	}
+
+	if _, err := client.Stop(ctx, session.Name); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	resumed, err := client.Resume(ctx, session.Name, ResumeRequest{Rows: 40, Cols: 120})
+	if err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	if !resumed.Running || resumed.PID == 0 || resumed.Path != session.Path {
+		t.Errorf("Expected the agent to run again in %s, got %+v", session.Path, resumed)
+	}
+
+	if _, err := client.Resume(ctx, "missing", ResumeRequest{}); !errors.Is(err, worktree.ErrNotFound) {
+		t.Errorf("Resume() of a missing session error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestServer_ResumeOnce(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := startDaemon(t, "exec sleep 60\n")
+
+	session, err := client.Create(ctx, CreateRequest{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := client.Stop(ctx, session.Name); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+
+	const resumes = 4
+	errs := make(chan error, resumes)
+	for range resumes {
+		go func() {
+			_, err := client.Resume(ctx, session.Name, ResumeRequest{})
+			errs <- err
+		}()
+	}
+	started := 0
+	for range resumes {
+		err := <-errs
+		switch {
+		case err == nil:
+			started++
+		case !errors.Is(err, ErrAgentRunning):
+			t.Errorf("Resume() error = %v, want nil or ErrAgentRunning", err)
+		}
+	}
+	if started != 1 {
+		t.Errorf("Expected the agent to be started once, got %d", started)
+	}
+}
+
+func TestServer_PauseUnpause(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := startDaemon(t, "exec sleep 60\n")
+
+	session, err := client.Create(ctx, CreateRequest{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	paused, err := client.Pause(ctx, session.Name)
+	if err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	if !paused.Running || paused.State != string(worktree.AgentPaused) {
+		t.Errorf("Expected the agent to be paused, got %+v", paused)
+	}
+	unpaused, err := client.Unpause(ctx, session.Name)
+	if err != nil {
+		t.Fatalf("Unpause() error = %v", err)
+	}
+	if !unpaused.Running || unpaused.State == string(worktree.AgentPaused) {
+		t.Errorf("Expected the agent to run again, got %+v", unpaused)
+	}
+
+	if _, err := client.Stop(ctx, session.Name); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if _, err := client.Pause(ctx, session.Name); !errors.Is(err, ErrAgentStopped) {
+		t.Errorf("Pause() of a stopped agent error = %v, want ErrAgentStopped", err)
+	}
+}
+
+func TestServer_StopOutsideAgent(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := startDaemon(t, "exec sleep 60\n")
+	health, err := client.Health(ctx)
+	if err != nil {
+		t.Fatalf("Health() error = %v", err)
+	}
+
+	// An agent started by another claude-mux process
+	script := filepath.Join(t.TempDir(), "agent.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nexec sleep 60\n"), 0755); err != nil {
+		t.Fatalf("Failed to write agent script: %v", err)
+	}
+	manager := worktree.NewManager(config.Config{
+		RepoDir:          health.Root,
+		WorktreeBasePath: ".claude-mux-test",
+		ClaudeCommand:    script,
+		StopTimeout:      time.Second,
+	})
+	details, err := manager.Create(ctx, worktree.CreateOptions{Name: "outside"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	agent, err := manager.Start(ctx, details.Name, worktree.TermSize{})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer func() { _ = agent.Close() }()
+
+	stopped, err := client.Stop(ctx, details.Name)
+	if err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if stopped.State != string(worktree.AgentStopped) {
+		t.Errorf("Expected the agent to be stopped, got %+v", stopped)
+	}
+	select {
+	case <-agent.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("Expected the agent to have exited")
+	}
+}
+
+func TestServer_NotifiesExit(t *testing.T) {
+	t.Parallel()
+
+	var recorder notify.Recorder
+	client := startDaemon(t, "sleep 0.2", WithNotifier(&recorder))
+	session, err := client.Create(context.Background(), CreateRequest{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	deadline := time.Now().Add(3 * notify.DefaultInterval)
+	for len(recorder.Notifications()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+	got := recorder.Notifications()
+	if len(got) != 1 || got[0].Kind != notify.KindExited || got[0].Session != session.Name {
+		t.Errorf("Expected an exit notification about %s, got %+v", session.Name, got)
+	}
+}
+
+func TestServer_CreateInvalidOptions(t *testing.T) {
+	t.Parallel()
+
+	client := startDaemon(t, "exit 0\n")
+	tests := []struct {
+		name    string
+		req     CreateRequest
+		wantErr string
+	}{
+		{"autocommit", CreateRequest{Name: "task", Autocommit: "always"}, "invalid autocommit policy"},
+		{"network", CreateRequest{Name: "task", Network: "bridge"}, "invalid network mode"},
+		{"allowed hosts", CreateRequest{Name: "task", AllowHosts: []string{"github.com"}}, "allowlist"},
+	}
+	for _, tt := range tests {
+		_, err := client.Create(context.Background(), tt.req)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Create() with invalid %s error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDial_NotRunning(t *testing.T) {
+	t.Parallel()
+
+	_, err := Dial(context.Background(), filepath.Join(t.TempDir(), "run", "missing.sock"))
+	if !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Dial() error = %v, want ErrNotRunning", err)
+	}
+}
+
+func TestListen_AlreadyRunning(t *testing.T) {
+	t.Parallel()
+
+	socket := filepath.Join(t.TempDir(), "run", "d.sock")
+	l, err := Listen(socket)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer func() { _ = l.Close() }()
+
+	if _, err := Listen(socket); err == nil {
+		t.Error("Expected Listen() to refuse a socket with a live listener")
+	}
+}
+
+func TestListen_InsecureDir(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("socket directories are not checked on Windows")
+	}
+
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, dir string)
+	}{
+		{name: "shared", setup: func(t *testing.T, dir string) {
+			if err := os.Mkdir(dir, 0700); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{name: "symlink", setup: func(t *testing.T, dir string) {
+			target := filepath.Join(t.TempDir(), "target")
+			if err := os.Mkdir(target, 0700); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Symlink(target, dir); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			dir := filepath.Join(t.TempDir(), "run")
+			tt.setup(t, dir)
+			socket := filepath.Join(dir, "d.sock")
+
+			if _, err := Listen(socket); !errors.Is(err, ErrInsecureSocket) {
+				t.Errorf("Listen() error = %v, want ErrInsecureSocket", err)
+			}
+			if _, err := Dial(context.Background(), socket); !errors.Is(err, ErrInsecureSocket) {
+				t.Errorf("Dial() error = %v, want ErrInsecureSocket", err)
+			}
+		})
+	}
+}
+
+func TestSocketPath(t *testing.T) {
+	t.Parallel()
+
+	a := SocketPath("/repos/a")
+	if a != SocketPath("/repos/a/") {
+		t.Errorf("Expected equivalent roots to share a socket, got %q and %q", a, SocketPath("/repos/a/"))
+	}
+	if a == SocketPath("/repos/b") {
+		t.Errorf("Expected different repositories to use different sockets, both got %q", a)
+	}
+}
@@ -0,0 +1,61 @@
+//go:build !windows
+
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// checkSocketDir makes sure dir is a directory only the current user can
+// use, so no other user can plant a socket in it
+func checkSocketDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 || !info.IsDir() {
+		return fmt.Errorf("%w: %s is not a directory", ErrInsecureSocket, dir)
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("%w: %s belongs to user %d", ErrInsecureSocket, dir, stat.Uid)
+	}
+	if perm := info.Mode().Perm(); perm != 0700 {
+		return fmt.Errorf("%w: %s has mode %#o, want 0700", ErrInsecureSocket, dir, perm)
+	}
+	return nil
+}
+
+// checkPeer makes sure the other end of a socket connection runs as the
+// current user and on the same network. Platforms that cannot tell rely on
+// the socket directory.
+func checkPeer(conn net.Conn) error {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var uid, pid int
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		uid, pid, credErr = peerCred(fd)
+	}); err != nil {
+		return err
+	}
+	if errors.Is(credErr, errors.ErrUnsupported) {
+		return nil
+	}
+	if credErr != nil {
+		return fmt.Errorf("failed to identify the socket peer: %w", credErr)
+	}
+	if uid != os.Getuid() {
+		return fmt.Errorf("%w: the peer runs as user %d", ErrInsecureSocket, uid)
+	}
+	return checkPeerNetwork(pid)
+}
@@ -0,0 +1,75 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Error describes a git command that exited unsuccessfully
+type Error struct {
+	// Subcommand is the git subcommand that failed, e.g. "worktree"
+	Subcommand string
+	// Args are the arguments passed after the subcommand
+	Args []string
+	// ExitCode is git's exit status, or -1 if git could not be run
+	ExitCode int
+	// Stderr is the trimmed error output of git
+	Stderr string
+	// Err is the underlying error from running the command
+	Err error
+}
+
+func (e *Error) Error() string {
+	command := strings.TrimSpace("git " + e.Subcommand + " " + strings.Join(e.Args, " "))
+	if e.Stderr == "" {
+		return fmt.Sprintf("%s: %v", command, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", command, e.Stderr)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// IsBranchExists reports whether err was caused by creating a branch that already exists
+func IsBranchExists(err error) bool {
+	return stderrContains(err, "a branch named") && stderrContains(err, "already exists")
+}
+
+// IsPathExists reports whether err was caused by adding a worktree at an existing path
+func IsPathExists(err error) bool {
+	return stderrContains(err, "already exists") && !stderrContains(err, "a branch named")
+}
+
+// IsNotMerged reports whether err was caused by deleting a branch with unmerged changes
+func IsNotMerged(err error) bool {
+	return stderrContains(err, "not fully merged")
+}
+
+// IsLockedWorktree reports whether err was caused by modifying a locked worktree
+func IsLockedWorktree(err error) bool {
+	return stderrContains(err, "locked working tree")
+}
+
+// IsRefExists reports whether err was caused by creating a ref that already exists
+func IsRefExists(err error) bool {
+	return stderrContains(err, "reference already exists")
+}
+
+// IsInvalidRef reports whether err was caused by an invalid or unknown reference
+func IsInvalidRef(err error) bool {
+	return stderrContains(err, "invalid reference") ||
+		stderrContains(err, "not a valid branch name") ||
+		stderrContains(err, "not a valid object name") ||
+		stderrContains(err, "unknown revision")
+}
+
+// stderrContains reports whether err wraps a git Error whose output contains substr
+func stderrContains(err error, substr string) bool {
+	var gitErr *Error
+	if !errors.As(err, &gitErr) {
+		return false
+	}
+	return strings.Contains(gitErr.Stderr, substr)
+}
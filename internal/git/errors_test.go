@@ -0,0 +1,109 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestError_Classification(t *testing.T) {
+	t.Parallel()
+
+	repoDir := setupTestRepo(t)
+	client := NewClient(repoDir, false)
+
+	worktreePath := filepath.Join(repoDir, "wt")
+	if err := client.CreateWorktree(worktreePath, "existing"); err != nil {
+		t.Fatalf("CreateWorktree() error = %v", err)
+	}
+
+	// Commit on a branch so it has unmerged changes
+	runGit(t, repoDir, "branch", "unmerged")
+	runGit(t, worktreePath, "checkout", "-q", "-b", "unmerged-wt")
+	if err := os.WriteFile(filepath.Join(worktreePath, "work.txt"), []byte("work"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	runGit(t, worktreePath, "add", "work.txt")
+	runGit(t, worktreePath, "commit", "-q", "-m", "work")
+	runGit(t, worktreePath, "checkout", "-q", "existing")
+
+	lockedPath := filepath.Join(repoDir, "locked")
+	if err := client.CreateWorktree(lockedPath, "locked"); err != nil {
+		t.Fatalf("CreateWorktree() error = %v", err)
+	}
+	runGit(t, repoDir, "worktree", "lock", lockedPath)
+
+	tests := []struct {
+		name     string
+		run      func() error
+		classify func(error) bool
+	}{
+		{"branch exists", func() error {
+			return client.CreateWorktree(filepath.Join(repoDir, "other"), "existing")
+		}, IsBranchExists},
+		{"path exists", func() error {
+			return client.CreateWorktree(worktreePath, "fresh")
+		}, IsPathExists},
+		{"not merged", func() error {
+			return client.DeleteBranch("unmerged-wt", false)
+		}, IsNotMerged},
+		{"locked worktree", func() error {
+			return client.RemoveWorktree(lockedPath)
+		}, IsLockedWorktree},
+		{"invalid ref", func() error {
+			return client.CreateWorktree(filepath.Join(repoDir, "bad"), "bad..name")
+		}, IsInvalidRef},
+	}
+
+	classifiers := []func(error) bool{IsBranchExists, IsPathExists, IsNotMerged, IsLockedWorktree, IsInvalidRef}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.run()
+			if err == nil {
+				t.Fatal("Expected an error, got nil")
+			}
+
+			var gitErr *Error
+			if !errors.As(err, &gitErr) {
+				t.Fatalf("Expected a *git.Error, got %T: %v", err, err)
+			}
+			if gitErr.ExitCode <= 0 || gitErr.Stderr == "" {
+				t.Errorf("Expected exit code and stderr to be captured, got %+v", gitErr)
+			}
+
+			matches := 0
+			for _, classify := range classifiers {
+				if classify(err) {
+					matches++
+				}
+			}
+			if !tt.classify(err) || matches != 1 {
+				t.Errorf("Expected error to match exactly its own classifier, got %d matches for: %v", matches, err)
+			}
+		})
+	}
+}
+
+func TestError_Error(t *testing.T) {
+	t.Parallel()
+
+	err := &Error{
+		Subcommand: "branch",
+		Args:       []string{"-d", "topic"},
+		ExitCode:   1,
+		Stderr:     "error: The branch 'topic' is not fully merged.",
+	}
+
+	want := "git branch -d topic: error: The branch 'topic' is not fully merged."
+	if got := err.Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if !IsNotMerged(err) {
+		t.Error("Expected IsNotMerged() to classify the error")
+	}
+	if IsNotMerged(errors.New("not fully merged")) {
+		t.Error("Expected plain errors not to be classified")
+	}
+}
@@ -2,67 +2,325 @@ package git
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// Backend is the set of git operations claude-mux relies on. Client
+// implements it by running the git executable; tests can substitute an
+// in-memory implementation.
+type Backend interface {
+	// At returns a backend that operates on the repository in dir
+	At(dir string) Backend
+
+	Version() (string, error)
+	ValidateRepo() error
+	TopLevel() (string, error)
+	CommonDir() (string, error)
+	MainWorktreeRoot() (string, error)
+	CurrentBranch() (string, error)
+
+	IsIgnored(path string) (bool, error)
+	ExcludeFile() (string, error)
+	AddExclude(pattern string) (bool, error)
+
+	CreateWorktree(path, branch string) error
+	ListWorktrees() ([]Worktree, error)
+	RemoveWorktree(path string) error
+	PruneWorktrees(dryRun bool) ([]string, error)
+
+	ListBranches(pattern string) ([]string, error)
+	IsMerged(branch, target string) (bool, error)
+	DeleteBranch(branch string, force bool) error
+	UpdateRef(ref, rev string) error
+	CreateRef(ref, rev string) error
+	DeleteRef(ref string) error
+	ListRefs(prefix string) ([]Ref, error)
+
+	Status(path string) ([]FileStatus, error)
+	Ignored(path string) ([]string, error)
+	Diff(base, branch string) (string, error)
+	Merge(branch string) error
+
+	Head(path string) (string, error)
+	CommitAll(path, message string) (bool, error)
+	ResetSoft(path, rev string) error
+
+	WriteTree(path string) (string, error)
+	CommitTree(path, tree, message string) (string, error)
+	RestoreTree(path, rev string) error
+}
+
+var _ Backend = (*Client)(nil)
+
 // Client handles git operations
 type Client struct {
+	dir     string
 	verbose bool
 }
 
-// NewClient creates a new git client
-func NewClient(verbose bool) *Client {
-	return &Client{verbose: verbose}
+// NewClient creates a new git client that runs git in dir.
+// An empty dir means the current working directory.
+func NewClient(dir string, verbose bool) *Client {
+	return &Client{dir: dir, verbose: verbose}
+}
+
+// Dir returns the repository directory the client runs git in
+func (c *Client) Dir() string {
+	return c.dir
+}
+
+// At returns a client with the same settings that runs git in dir
+func (c *Client) At(dir string) Backend {
+	return &Client{dir: dir, verbose: c.verbose}
+}
+
+// command builds a git command that runs against the client's directory
+func (c *Client) command(args ...string) *exec.Cmd {
+	if c.dir != "" {
+		args = append([]string{"-C", c.dir}, args...)
+	}
+	cmd := exec.Command("git", args...)
+	// Error classification relies on git's untranslated messages
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	return cmd
+}
+
+// run executes a git subcommand and returns its standard output. Failures
+// are reported as *Error carrying git's stderr.
+func (c *Client) run(subcommand string, args ...string) (string, error) {
+	return c.runEnv(nil, subcommand, args...)
+}
+
+// runEnv is like run with additional environment variables
+func (c *Client) runEnv(env []string, subcommand string, args ...string) (string, error) {
+	cmd := c.command(append([]string{subcommand}, args...)...)
+	cmd.Env = append(cmd.Env, env...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if c.verbose {
+		fmt.Fprintf(os.Stderr, "+ %s\n", strings.Join(cmd.Args, " "))
+	}
+
+	if err := cmd.Run(); err != nil {
+		gitErr := &Error{
+			Subcommand: subcommand,
+			Args:       args,
+			ExitCode:   -1,
+			Stderr:     strings.TrimSpace(stderr.String()),
+			Err:        err,
+		}
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			gitErr.ExitCode = exitErr.ExitCode()
+		}
+		return stdout.String(), gitErr
+	}
+	return stdout.String(), nil
+}
+
+// exitCode returns the exit code of a failed git command, or -1
+func exitCode(err error) int {
+	var gitErr *Error
+	if errors.As(err, &gitErr) {
+		return gitErr.ExitCode
+	}
+	return -1
+}
+
+// FileStatus is a changed file reported by git status
+type FileStatus struct {
+	// Code is the two-letter porcelain status, e.g. " M" or "??"
+	Code string
+	Path string
+}
+
+// Ref is a reference and the commit it points at
+type Ref struct {
+	Name   string
+	Commit string
+	// Tree is the tree of the commit
+	Tree    string
+	Subject string
+	// Time is when the commit was made
+	Time time.Time
 }
 
 // Worktree represents a git worktree
 type Worktree struct {
-	Path   string
-	Branch string
-	Commit string
-	Locked bool
+	Path     string
+	Branch   string
+	Commit   string
+	Locked   bool
+	Prunable bool
+}
+
+// Version returns the installed git version, e.g. "2.39.5"
+func (c *Client) Version() (string, error) {
+	output, err := exec.Command("git", "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get git version: %w", err)
+	}
+
+	// Output looks like "git version 2.39.5" or "git version 2.39.5.windows.1"
+	fields := strings.Fields(string(output))
+	if len(fields) < 3 {
+		return "", fmt.Errorf("unexpected git version output: %q", output)
+	}
+	return fields[2], nil
 }
 
 // ValidateRepo checks if we're in a git repository
 func (c *Client) ValidateRepo() error {
-	cmd := exec.Command("git", "rev-parse", "--git-dir")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("not in a git repository")
+	if _, err := c.run("rev-parse", "--git-dir"); err != nil {
+		return fmt.Errorf("not in a git repository: %w", err)
 	}
 	return nil
 }
 
+// TopLevel returns the root directory of the worktree the client runs in
+func (c *Client) TopLevel() (string, error) {
+	output, err := c.run("rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", fmt.Errorf("failed to get worktree root: %w", err)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// CommonDir returns the absolute path of the git directory shared by all worktrees
+func (c *Client) CommonDir() (string, error) {
+	output, err := c.run("rev-parse", "--git-common-dir")
+	if err != nil {
+		return "", fmt.Errorf("failed to get git common directory: %w", err)
+	}
+
+	return c.absPath(strings.TrimSpace(output))
+}
+
+// absPath resolves a path printed by git, which is relative to the
+// directory git ran in unless it is absolute
+func (c *Client) absPath(path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path), nil
+	}
+	base := c.dir
+	if base == "" {
+		var err error
+		if base, err = os.Getwd(); err != nil {
+			return "", err
+		}
+	}
+	return filepath.Join(base, path), nil
+}
+
+// MainWorktreeRoot returns the root directory of the main worktree, even when
+// the client runs inside a linked worktree
+func (c *Client) MainWorktreeRoot() (string, error) {
+	commonDir, err := c.CommonDir()
+	if err != nil {
+		return "", err
+	}
+	if filepath.Base(commonDir) == ".git" {
+		return filepath.Dir(commonDir), nil
+	}
+
+	// Separate git dir or bare repository: the first listed worktree is the main one
+	worktrees, err := c.ListWorktrees()
+	if err != nil {
+		return "", err
+	}
+	if len(worktrees) == 0 {
+		return "", fmt.Errorf("failed to find main worktree")
+	}
+	return worktrees[0].Path, nil
+}
+
+// IsIgnored reports whether path is ignored by git. Directories should be
+// passed with a trailing slash so they match directory-only patterns.
+func (c *Client) IsIgnored(path string) (bool, error) {
+	_, err := c.run("check-ignore", "-q", path)
+	if err == nil {
+		return true, nil
+	}
+	if exitCode(err) == 1 {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to check ignore status of %s: %w", path, err)
+}
+
+// ExcludeFile returns the path of the repository's local exclude file, as
+// git resolves it in linked worktrees and with separate git directories
+func (c *Client) ExcludeFile() (string, error) {
+	output, err := c.run("rev-parse", "--git-path", "info/exclude")
+	if err != nil {
+		return "", fmt.Errorf("failed to locate the exclude file: %w", err)
+	}
+	return c.absPath(strings.TrimSpace(output))
+}
+
+// AddExclude appends pattern to the repository's local exclude file unless
+// it is already listed. It reports whether the file was changed.
+func (c *Client) AddExclude(pattern string) (bool, error) {
+	excludeFile, err := c.ExcludeFile()
+	if err != nil {
+		return false, err
+	}
+
+	content, err := os.ReadFile(excludeFile) // #nosec G304 -- path derived from git's common dir
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read %s: %w", excludeFile, err)
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(line) == pattern {
+			return false, nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(excludeFile), 0750); err != nil {
+		return false, fmt.Errorf("failed to create directory: %w", err)
+	}
+	f, err := os.OpenFile(excludeFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600) // #nosec G304 -- path derived from git's common dir
+	if err != nil {
+		return false, fmt.Errorf("failed to open %s: %w", excludeFile, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	entry := pattern + "\n"
+	if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		entry = "\n" + entry
+	}
+	if _, err := f.WriteString(entry); err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", excludeFile, err)
+	}
+	return true, nil
+}
+
 // CurrentBranch returns the current git branch name
 func (c *Client) CurrentBranch() (string, error) {
-	cmd := exec.Command("git", "branch", "--show-current")
-	output, err := cmd.Output()
-	if err != nil {
+	output, err := c.run("branch", "--show-current")
+	if err != nil || strings.TrimSpace(output) == "" {
 		// Handle detached HEAD
-		cmd = exec.Command("git", "rev-parse", "--short", "HEAD")
-		output, err = cmd.Output()
+		output, err = c.run("rev-parse", "--short", "HEAD")
 		if err != nil {
 			return "", fmt.Errorf("failed to get current branch: %w", err)
 		}
-		return fmt.Sprintf("detached-%s", strings.TrimSpace(string(output))), nil
+		return fmt.Sprintf("detached-%s", strings.TrimSpace(output)), nil
 	}
-	return strings.TrimSpace(string(output)), nil
+	return strings.TrimSpace(output), nil
 }
 
 // CreateWorktree creates a new worktree with a new branch
 func (c *Client) CreateWorktree(path, branch string) error {
-	cmd := exec.Command("git", "worktree", "add", "-b", branch, path)
-	if c.verbose {
-		cmd.Stdout = &bytes.Buffer{}
-		cmd.Stderr = &bytes.Buffer{}
-	}
-
-	if err := cmd.Run(); err != nil {
-		if c.verbose {
-			return fmt.Errorf("failed to create worktree: %w\nOutput: %s\nError: %s",
-				err, cmd.Stdout, cmd.Stderr)
-		}
+	if _, err := c.run("worktree", "add", "-b", branch, path); err != nil {
 		return fmt.Errorf("failed to create worktree: %w", err)
 	}
 	return nil
@@ -70,8 +328,7 @@ func (c *Client) CreateWorktree(path, branch string) error {
 
 // ListWorktrees returns all git worktrees
 func (c *Client) ListWorktrees() ([]Worktree, error) {
-	cmd := exec.Command("git", "worktree", "list", "--porcelain")
-	output, err := cmd.Output()
+	output, err := c.run("worktree", "list", "--porcelain")
 	if err != nil {
 		return nil, fmt.Errorf("failed to list worktrees: %w", err)
 	}
@@ -79,7 +336,7 @@ func (c *Client) ListWorktrees() ([]Worktree, error) {
 	var worktrees []Worktree
 	var current Worktree
 
-	lines := strings.Split(string(output), "\n")
+	lines := strings.Split(output, "\n")
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
 		if line == "" {
@@ -112,6 +369,8 @@ func (c *Client) ListWorktrees() ([]Worktree, error) {
 			}
 		case "locked":
 			current.Locked = true
+		case "prunable":
+			current.Prunable = true
 		}
 	}
 
@@ -123,10 +382,68 @@ func (c *Client) ListWorktrees() ([]Worktree, error) {
 	return worktrees, nil
 }
 
+// PruneWorktrees removes administrative data for worktrees whose directories
+// no longer exist and returns git's description of each pruned entry. With
+// dryRun nothing is removed.
+func (c *Client) PruneWorktrees(dryRun bool) ([]string, error) {
+	args := []string{"prune", "--verbose"}
+	if dryRun {
+		args = append(args, "--dry-run")
+	}
+
+	// git reports pruned entries on stderr, so capture both streams
+	cmd := c.command(append([]string{"worktree"}, args...)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune worktrees: %w", &Error{
+			Subcommand: "worktree",
+			Args:       args,
+			ExitCode:   cmd.ProcessState.ExitCode(),
+			Stderr:     strings.TrimSpace(string(output)),
+			Err:        err,
+		})
+	}
+	return nonEmptyLines(string(output)), nil
+}
+
+// ListBranches returns local branch names matching a glob pattern such as "claude-mux-*"
+func (c *Client) ListBranches(pattern string) ([]string, error) {
+	output, err := c.run("for-each-ref", "--format=%(refname:short)", "refs/heads/"+pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list branches: %w", err)
+	}
+	return nonEmptyLines(output), nil
+}
+
+// IsMerged reports whether branch is fully merged into target
+func (c *Client) IsMerged(branch, target string) (bool, error) {
+	_, err := c.run("merge-base", "--is-ancestor", branch, target)
+	if err == nil {
+		return true, nil
+	}
+	if exitCode(err) == 1 {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to check whether %s is merged: %w", branch, err)
+}
+
+// nonEmptyLines splits output into trimmed, non-empty lines
+func nonEmptyLines(output string) []string {
+	var lines []string
+	for _, line := range strings.Split(output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
 // RemoveWorktree removes a git worktree
 func (c *Client) RemoveWorktree(path string) error {
-	cmd := exec.Command("git", "worktree", "remove", path, "--force")
-	return cmd.Run()
+	if _, err := c.run("worktree", "remove", path, "--force"); err != nil {
+		return fmt.Errorf("failed to remove worktree: %w", err)
+	}
+	return nil
 }
 
 // DeleteBranch deletes a git branch
@@ -135,6 +452,236 @@ func (c *Client) DeleteBranch(branch string, force bool) error {
 	if force {
 		flag = "-D"
 	}
-	cmd := exec.Command("git", "branch", flag, branch)
-	return cmd.Run()
+	if _, err := c.run("branch", flag, branch); err != nil {
+		return fmt.Errorf("failed to delete branch: %w", err)
+	}
+	return nil
+}
+
+// UpdateRef points ref at the commit rev resolves to, creating ref if needed
+func (c *Client) UpdateRef(ref, rev string) error {
+	if _, err := c.run("update-ref", ref, rev); err != nil {
+		return fmt.Errorf("failed to update %s: %w", ref, err)
+	}
+	return nil
+}
+
+// CreateRef points the new ref at the commit rev resolves to. It fails if
+// ref exists, so concurrent writers cannot overwrite each other.
+func (c *Client) CreateRef(ref, rev string) error {
+	// An empty old value makes git refuse to update an existing ref
+	if _, err := c.run("update-ref", ref, rev, ""); err != nil {
+		return fmt.Errorf("failed to create %s: %w", ref, err)
+	}
+	return nil
+}
+
+// DeleteRef deletes ref
+func (c *Client) DeleteRef(ref string) error {
+	if _, err := c.run("update-ref", "-d", ref); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", ref, err)
+	}
+	return nil
+}
+
+// ListRefs returns the refs below prefix, e.g. "refs/claude-mux/archive".
+// The refs must point at commits.
+func (c *Client) ListRefs(prefix string) ([]Ref, error) {
+	output, err := c.run("for-each-ref", "--format=%(refname)%00%(objectname)%00%(tree)%00%(committerdate:unix)%00%(subject)", prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list refs: %w", err)
+	}
+
+	var refs []Ref
+	for _, line := range nonEmptyLines(output) {
+		fields := strings.SplitN(line, "\x00", 5)
+		if len(fields) != 5 {
+			continue
+		}
+		ref := Ref{Name: fields[0], Commit: fields[1], Tree: fields[2], Subject: fields[4]}
+		if unix, err := strconv.ParseInt(fields[3], 10, 64); err == nil {
+			ref.Time = time.Unix(unix, 0)
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// Status returns the uncommitted changes in the worktree at path
+func (c *Client) Status(path string) ([]FileStatus, error) {
+	// Status is polled, so it must not take index.lock from under other
+	// commands to refresh the index
+	output, err := NewClient(path, c.verbose).runEnv([]string{"GIT_OPTIONAL_LOCKS=0"}, "status", "--porcelain")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get status: %w", err)
+	}
+
+	var files []FileStatus
+	for _, line := range strings.Split(output, "\n") {
+		if len(line) < 4 {
+			continue
+		}
+		file := line[3:]
+		// Renames are reported as "old -> new"
+		if idx := strings.Index(file, " -> "); idx >= 0 {
+			file = file[idx+4:]
+		}
+		files = append(files, FileStatus{Code: line[:2], Path: file})
+	}
+	return files, nil
+}
+
+// Ignored returns the untracked files of the worktree at path that git
+// ignores, relative to it. Directories that are ignored as a whole are
+// listed once, with a trailing slash.
+func (c *Client) Ignored(path string) ([]string, error) {
+	output, err := NewClient(path, c.verbose).run("ls-files", "-z", "--others", "--ignored", "--exclude-standard", "--directory")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ignored files: %w", err)
+	}
+	var files []string
+	for file := range strings.SplitSeq(output, "\x00") {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// Diff returns the changes made on branch since it diverged from base
+func (c *Client) Diff(base, branch string) (string, error) {
+	output, err := c.run("diff", base+"..."+branch)
+	if err != nil {
+		return "", fmt.Errorf("failed to diff %s: %w", branch, err)
+	}
+	return output, nil
+}
+
+// Merge merges branch into the branch checked out in the client's directory
+func (c *Client) Merge(branch string) error {
+	if _, err := c.run("merge", "--no-edit", branch); err != nil {
+		return fmt.Errorf("failed to merge %s: %w", branch, err)
+	}
+	return nil
+}
+
+// Head returns the commit checked out in the worktree at path
+func (c *Client) Head(path string) (string, error) {
+	output, err := NewClient(path, c.verbose).run("rev-parse", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD: %w", err)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// CommitAll stages every change in the worktree at path, including
+// untracked files, and commits it without running commit hooks. It reports
+// whether there was anything to commit.
+func (c *Client) CommitAll(path, message string) (bool, error) {
+	wt := NewClient(path, c.verbose)
+	if _, err := wt.run("add", "--all"); err != nil {
+		return false, fmt.Errorf("failed to stage changes: %w", err)
+	}
+
+	_, err := wt.run("diff", "--cached", "--quiet")
+	if err == nil {
+		return false, nil
+	}
+	if exitCode(err) != 1 {
+		return false, fmt.Errorf("failed to check staged changes: %w", err)
+	}
+
+	if _, err := wt.run("commit", "--quiet", "--no-verify", "--message", message); err != nil {
+		return false, fmt.Errorf("failed to commit: %w", err)
+	}
+	return true, nil
+}
+
+// ResetSoft points the branch checked out in the worktree at path to rev,
+// keeping the changes of the dropped commits staged
+func (c *Client) ResetSoft(path, rev string) error {
+	if _, err := NewClient(path, c.verbose).run("reset", "--soft", rev); err != nil {
+		return fmt.Errorf("failed to reset to %s: %w", rev, err)
+	}
+	return nil
+}
+
+// WriteTree stores the current content of the worktree at path, including
+// untracked files, as a tree object and returns its id. It works on a
+// temporary copy of the index, so the real index is left untouched.
+func (c *Client) WriteTree(path string) (string, error) {
+	wt := NewClient(path, c.verbose)
+	output, err := wt.run("rev-parse", "--git-path", "index")
+	if err != nil {
+		return "", fmt.Errorf("failed to locate the index: %w", err)
+	}
+	indexPath := strings.TrimSpace(output)
+	if !filepath.IsAbs(indexPath) {
+		indexPath = filepath.Join(path, indexPath)
+	}
+
+	tmp, err := os.MkdirTemp("", "claude-mux-index-")
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+	index := filepath.Join(tmp, "index")
+	if err := copyIndex(indexPath, index); err != nil {
+		return "", err
+	}
+
+	env := []string{"GIT_INDEX_FILE=" + index}
+	if _, err := wt.runEnv(env, "add", "--all"); err != nil {
+		return "", fmt.Errorf("failed to stage the worktree: %w", err)
+	}
+	tree, err := wt.runEnv(env, "write-tree")
+	if err != nil {
+		return "", fmt.Errorf("failed to write tree: %w", err)
+	}
+	return strings.TrimSpace(tree), nil
+}
+
+// copyIndex copies an index file so git can reuse its cached file stats.
+// The modification time is kept as git relies on it to detect files that
+// changed right after they were indexed.
+func copyIndex(src, dst string) error {
+	info, err := os.Stat(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(src) // #nosec G304 -- index file reported by git
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(dst, data, 0600); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// CommitTree creates a commit of tree on top of the HEAD of the worktree
+// at path without updating any branch, and returns its id
+func (c *Client) CommitTree(path, tree, message string) (string, error) {
+	output, err := NewClient(path, c.verbose).run("commit-tree", tree, "-p", "HEAD", "-m", message)
+	if err != nil {
+		return "", fmt.Errorf("failed to commit tree: %w", err)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// RestoreTree makes the files of the worktree at path match the commit
+// rev. Files missing from rev are removed, except ignored ones. The branch
+// and index are left untouched.
+func (c *Client) RestoreTree(path, rev string) error {
+	wt := NewClient(path, c.verbose)
+	if _, err := wt.run("clean", "-d", "--force", "--quiet"); err != nil {
+		return fmt.Errorf("failed to remove untracked files: %w", err)
+	}
+	if _, err := wt.run("restore", "--source="+rev, "--worktree", "--", "."); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", rev, err)
+	}
+	return nil
 }
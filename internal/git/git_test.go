@@ -4,93 +4,65 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 )
 
-// restoreDirectory returns a function that restores the working directory
-// and reports any error via t.Errorf
-func restoreDirectory(t *testing.T, dir string) func() {
-	return func() {
-		if err := os.Chdir(dir); err != nil {
-			t.Errorf("Failed to restore directory: %v", err)
-		}
+// runGit runs a git command in dir and fails the test on error
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to run git %v: %v\n%s", args, err, output)
+	}
+}
+
+// setupTestRepo initializes a git repository with an initial commit
+func setupTestRepo(t *testing.T) string {
+	t.Helper()
+	tmpDir := t.TempDir()
+
+	runGit(t, tmpDir, "init")
+	runGit(t, tmpDir, "config", "user.email", "test@example.com")
+	runGit(t, tmpDir, "config", "user.name", "Test User")
+
+	testFile := filepath.Join(tmpDir, "test.txt")
+	if err := os.WriteFile(testFile, []byte("test"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
 	}
+	runGit(t, tmpDir, "add", ".")
+	runGit(t, tmpDir, "commit", "-m", "initial")
+
+	return tmpDir
 }
 
 func TestClient_ValidateRepo(t *testing.T) {
-	client := NewClient(false)
+	t.Parallel()
 
 	// Test in a non-git directory
 	tmpDir := t.TempDir()
-	originalDir, err := os.Getwd()
-	if err != nil {
-		t.Fatalf("Failed to get current directory: %v", err)
-	}
-	defer restoreDirectory(t, originalDir)()
-
-	if err := os.Chdir(tmpDir); err != nil {
-		t.Fatalf("Failed to change to temp directory: %v", err)
-	}
+	client := NewClient(tmpDir, false)
 
 	if err := client.ValidateRepo(); err == nil {
 		t.Error("Expected error when not in git repo, got nil")
 	}
 
 	// Initialize a git repo
-	if err := exec.Command("git", "init").Run(); err != nil {
-		t.Fatalf("Failed to init git repo: %v", err)
-	}
-	if err := exec.Command("git", "config", "user.email", "test@example.com").Run(); err != nil {
-		t.Fatalf("Failed to set git email: %v", err)
-	}
-	if err := exec.Command("git", "config", "user.name", "Test User").Run(); err != nil {
-		t.Fatalf("Failed to set git name: %v", err)
-	}
+	runGit(t, tmpDir, "init")
 
 	// Should now succeed
-	err = client.ValidateRepo()
-	if err != nil {
+	if err := client.ValidateRepo(); err != nil {
 		t.Errorf("Expected no error in git repo, got: %v", err)
 	}
 }
 
 func TestClient_CurrentBranch(t *testing.T) {
-	client := NewClient(false)
-
-	// Set up test repo
-	tmpDir := t.TempDir()
-	originalDir, err := os.Getwd()
-	if err != nil {
-		t.Fatalf("Failed to get current directory: %v", err)
-	}
-	defer restoreDirectory(t, originalDir)()
-
-	if err := os.Chdir(tmpDir); err != nil {
-		t.Fatalf("Failed to change to temp directory: %v", err)
-	}
-
-	// Initialize repo
-	if err := exec.Command("git", "init").Run(); err != nil {
-		t.Fatalf("Failed to init git repo: %v", err)
-	}
-	if err := exec.Command("git", "config", "user.email", "test@example.com").Run(); err != nil {
-		t.Fatalf("Failed to set git email: %v", err)
-	}
-	if err := exec.Command("git", "config", "user.name", "Test User").Run(); err != nil {
-		t.Fatalf("Failed to set git name: %v", err)
-	}
+	t.Parallel()
 
-	// Create initial commit (required for branch operations)
-	testFile := filepath.Join(tmpDir, "test.txt")
-	if err := os.WriteFile(testFile, []byte("test"), 0644); err != nil {
-		t.Fatalf("Failed to write test file: %v", err)
-	}
-	if err := exec.Command("git", "add", ".").Run(); err != nil {
-		t.Fatalf("Failed to git add: %v", err)
-	}
-	if err := exec.Command("git", "commit", "-m", "initial").Run(); err != nil {
-		t.Fatalf("Failed to git commit: %v", err)
-	}
+	tmpDir := setupTestRepo(t)
+	client := NewClient(tmpDir, false)
 
 	// Test on main/master branch
 	branch, err := client.CurrentBranch()
@@ -104,9 +76,7 @@ func TestClient_CurrentBranch(t *testing.T) {
 	}
 
 	// Create and checkout a new branch
-	if err := exec.Command("git", "checkout", "-b", "test-branch").Run(); err != nil {
-		t.Fatalf("Failed to create test branch: %v", err)
-	}
+	runGit(t, tmpDir, "checkout", "-b", "test-branch")
 
 	branch, err = client.CurrentBranch()
 	if err != nil {
@@ -120,41 +90,10 @@ func TestClient_CurrentBranch(t *testing.T) {
 
 func TestClient_CreateWorktree(t *testing.T) {
 	t.Skip("Temporarily skipping - worktree path comparison issue")
+	t.Parallel()
 
-	client := NewClient(false)
-
-	// Set up test repo
-	tmpDir := t.TempDir()
-	originalDir, err := os.Getwd()
-	if err != nil {
-		t.Fatalf("Failed to get current directory: %v", err)
-	}
-	defer restoreDirectory(t, originalDir)()
-
-	if err := os.Chdir(tmpDir); err != nil {
-		t.Fatalf("Failed to change to temp directory: %v", err)
-	}
-
-	// Initialize repo with a commit
-	if err := exec.Command("git", "init").Run(); err != nil {
-		t.Fatalf("Failed to init git repo: %v", err)
-	}
-	if err := exec.Command("git", "config", "user.email", "test@example.com").Run(); err != nil {
-		t.Fatalf("Failed to set git email: %v", err)
-	}
-	if err := exec.Command("git", "config", "user.name", "Test User").Run(); err != nil {
-		t.Fatalf("Failed to set git name: %v", err)
-	}
-	testFile := filepath.Join(tmpDir, "test.txt")
-	if err := os.WriteFile(testFile, []byte("test"), 0644); err != nil {
-		t.Fatalf("Failed to write test file: %v", err)
-	}
-	if err := exec.Command("git", "add", ".").Run(); err != nil {
-		t.Fatalf("Failed to git add: %v", err)
-	}
-	if err := exec.Command("git", "commit", "-m", "initial").Run(); err != nil {
-		t.Fatalf("Failed to git commit: %v", err)
-	}
+	tmpDir := setupTestRepo(t)
+	client := NewClient(tmpDir, false)
 
 	// Create a worktree
 	worktreePath := filepath.Join(tmpDir, "test-worktree")
@@ -190,40 +129,10 @@ func TestClient_CreateWorktree(t *testing.T) {
 }
 
 func TestClient_RemoveWorktree(t *testing.T) {
-	client := NewClient(false)
+	t.Parallel()
 
-	// Set up test repo
-	tmpDir := t.TempDir()
-	originalDir, err := os.Getwd()
-	if err != nil {
-		t.Fatalf("Failed to get current directory: %v", err)
-	}
-	defer restoreDirectory(t, originalDir)()
-
-	if err := os.Chdir(tmpDir); err != nil {
-		t.Fatalf("Failed to change to temp directory: %v", err)
-	}
-
-	// Initialize repo with a commit
-	if err := exec.Command("git", "init").Run(); err != nil {
-		t.Fatalf("Failed to init git repo: %v", err)
-	}
-	if err := exec.Command("git", "config", "user.email", "test@example.com").Run(); err != nil {
-		t.Fatalf("Failed to set git email: %v", err)
-	}
-	if err := exec.Command("git", "config", "user.name", "Test User").Run(); err != nil {
-		t.Fatalf("Failed to set git name: %v", err)
-	}
-	testFile := filepath.Join(tmpDir, "test.txt")
-	if err := os.WriteFile(testFile, []byte("test"), 0644); err != nil {
-		t.Fatalf("Failed to write test file: %v", err)
-	}
-	if err := exec.Command("git", "add", ".").Run(); err != nil {
-		t.Fatalf("Failed to git add: %v", err)
-	}
-	if err := exec.Command("git", "commit", "-m", "initial").Run(); err != nil {
-		t.Fatalf("Failed to git commit: %v", err)
-	}
+	tmpDir := setupTestRepo(t)
+	client := NewClient(tmpDir, false)
 
 	// Create and then remove a worktree
 	worktreePath := filepath.Join(tmpDir, "test-worktree")
@@ -246,3 +155,389 @@ func TestClient_RemoveWorktree(t *testing.T) {
 		}
 	}
 }
+
+func TestClient_DoesNotDependOnWorkingDirectory(t *testing.T) {
+	t.Parallel()
+
+	repoA := setupTestRepo(t)
+	repoB := setupTestRepo(t)
+	runGit(t, repoB, "checkout", "-b", "other-branch")
+
+	branchA, err := NewClient(repoA, false).CurrentBranch()
+	if err != nil {
+		t.Fatalf("CurrentBranch() for repo A error = %v", err)
+	}
+	branchB, err := NewClient(repoB, false).CurrentBranch()
+	if err != nil {
+		t.Fatalf("CurrentBranch() for repo B error = %v", err)
+	}
+
+	if branchA == branchB {
+		t.Errorf("Expected clients to report different branches, both got %q", branchA)
+	}
+	if branchB != "other-branch" {
+		t.Errorf("Expected other-branch for repo B, got %q", branchB)
+	}
+}
+
+func TestClient_MainWorktreeRoot(t *testing.T) {
+	t.Parallel()
+
+	repoDir := setupTestRepo(t)
+	wantRoot, _ := filepath.EvalSymlinks(repoDir)
+
+	subDir := filepath.Join(repoDir, "src", "api")
+	if err := os.MkdirAll(subDir, 0750); err != nil {
+		t.Fatalf("Failed to create subdirectory: %v", err)
+	}
+	worktreePath := filepath.Join(repoDir, "linked")
+	runGit(t, repoDir, "worktree", "add", "-b", "linked-branch", worktreePath)
+
+	tests := []struct {
+		name         string
+		dir          string
+		wantTopLevel string
+	}{
+		{"repository root", repoDir, repoDir},
+		{"subdirectory", subDir, repoDir},
+		{"linked worktree", worktreePath, worktreePath},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(tt.dir, false)
+
+			root, err := client.MainWorktreeRoot()
+			if err != nil {
+				t.Fatalf("MainWorktreeRoot() error = %v", err)
+			}
+			if got, _ := filepath.EvalSymlinks(root); got != wantRoot {
+				t.Errorf("MainWorktreeRoot() = %q, want %q", got, wantRoot)
+			}
+
+			topLevel, err := client.TopLevel()
+			if err != nil {
+				t.Fatalf("TopLevel() error = %v", err)
+			}
+			want, _ := filepath.EvalSymlinks(tt.wantTopLevel)
+			if got, _ := filepath.EvalSymlinks(topLevel); got != want {
+				t.Errorf("TopLevel() = %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func TestClient_AddExclude(t *testing.T) {
+	t.Parallel()
+
+	repoDir := setupTestRepo(t)
+	client := NewClient(repoDir, false)
+	dir := filepath.Join(repoDir, ".claude-mux") + string(filepath.Separator)
+
+	ignored, err := client.IsIgnored(dir)
+	if err != nil {
+		t.Fatalf("IsIgnored() error = %v", err)
+	}
+	if ignored {
+		t.Fatal("Expected directory not to be ignored initially")
+	}
+
+	added, err := client.AddExclude("/.claude-mux/")
+	if err != nil {
+		t.Fatalf("AddExclude() error = %v", err)
+	}
+	if !added {
+		t.Error("Expected AddExclude() to add the pattern")
+	}
+
+	added, err = client.AddExclude("/.claude-mux/")
+	if err != nil {
+		t.Fatalf("AddExclude() error = %v", err)
+	}
+	if added {
+		t.Error("Expected AddExclude() to skip an existing pattern")
+	}
+
+	ignored, err = client.IsIgnored(dir)
+	if err != nil {
+		t.Fatalf("IsIgnored() error = %v", err)
+	}
+	if !ignored {
+		t.Error("Expected directory to be ignored after AddExclude()")
+	}
+}
+
+func TestClient_ExcludeFile(t *testing.T) {
+	t.Parallel()
+
+	repoDir := setupTestRepo(t)
+	linked := filepath.Join(t.TempDir(), "linked")
+	runGit(t, repoDir, "worktree", "add", "-b", "linked", linked)
+
+	// Linked worktrees share the exclude file of the main worktree
+	wantDir, _ := filepath.EvalSymlinks(filepath.Join(repoDir, ".git", "info"))
+	for _, dir := range []string{repoDir, linked} {
+		got, err := NewClient(dir, false).ExcludeFile()
+		if err != nil {
+			t.Fatalf("ExcludeFile() in %s error = %v", dir, err)
+		}
+		if gotDir, _ := filepath.EvalSymlinks(filepath.Dir(got)); gotDir != wantDir || filepath.Base(got) != "exclude" {
+			t.Errorf("ExcludeFile() in %s = %s, want the exclude file in %s", dir, got, wantDir)
+		}
+	}
+}
+
+func TestClient_PruneWorktrees(t *testing.T) {
+	t.Parallel()
+
+	repoDir := setupTestRepo(t)
+	client := NewClient(repoDir, false)
+
+	worktreePath := filepath.Join(repoDir, "gone")
+	runGit(t, repoDir, "worktree", "add", "-b", "claude-mux-gone", worktreePath)
+	runGit(t, repoDir, "branch", "claude-mux-other")
+	runGit(t, repoDir, "branch", "unrelated")
+	if err := os.RemoveAll(worktreePath); err != nil {
+		t.Fatalf("Failed to remove worktree directory: %v", err)
+	}
+
+	branches, err := client.ListBranches("claude-mux-*")
+	if err != nil {
+		t.Fatalf("ListBranches() error = %v", err)
+	}
+	if len(branches) != 2 {
+		t.Errorf("ListBranches() = %v, want 2 claude-mux branches", branches)
+	}
+
+	stale, err := client.PruneWorktrees(true)
+	if err != nil {
+		t.Fatalf("PruneWorktrees(dryRun) error = %v", err)
+	}
+	if len(stale) != 1 {
+		t.Fatalf("PruneWorktrees(dryRun) = %v, want 1 entry", stale)
+	}
+
+	if _, err := client.PruneWorktrees(false); err != nil {
+		t.Fatalf("PruneWorktrees() error = %v", err)
+	}
+	if stale, _ := client.PruneWorktrees(true); len(stale) != 0 {
+		t.Errorf("Expected nothing left to prune, got %v", stale)
+	}
+}
+
+func TestClient_Version(t *testing.T) {
+	t.Parallel()
+
+	version, err := NewClient("", false).Version()
+	if err != nil {
+		t.Fatalf("Version() error = %v", err)
+	}
+	if version == "" || version[0] < '0' || version[0] > '9' {
+		t.Errorf("Version() = %q, want a dotted version number", version)
+	}
+}
+
+func TestClient_UpdateRef(t *testing.T) {
+	t.Parallel()
+
+	repoDir := setupTestRepo(t)
+	client := NewClient(repoDir, false)
+
+	if err := client.UpdateRef("refs/claude-mux/test/one", "HEAD"); err != nil {
+		t.Fatalf("UpdateRef() error = %v", err)
+	}
+
+	cmd := exec.Command("git", "rev-parse", "refs/claude-mux/test/one", "HEAD")
+	cmd.Dir = repoDir
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Failed to resolve refs: %v", err)
+	}
+	lines := strings.Fields(string(output))
+	if len(lines) != 2 || lines[0] != lines[1] {
+		t.Errorf("Expected ref to point at HEAD, got %q", output)
+	}
+
+	if err := client.UpdateRef("refs/claude-mux/test/two", "no-such-branch"); err == nil {
+		t.Error("Expected UpdateRef() to fail for an unknown revision")
+	}
+}
+
+func TestClient_CreateRef(t *testing.T) {
+	t.Parallel()
+
+	repoDir := setupTestRepo(t)
+	client := NewClient(repoDir, false)
+	runGit(t, repoDir, "commit", "-q", "--allow-empty", "-m", "second")
+
+	if err := client.CreateRef("refs/claude-mux/test/one", "HEAD~1"); err != nil {
+		t.Fatalf("CreateRef() error = %v", err)
+	}
+	err := client.CreateRef("refs/claude-mux/test/one", "HEAD")
+	if !IsRefExists(err) {
+		t.Fatalf("CreateRef() of an existing ref error = %v, want one IsRefExists reports", err)
+	}
+
+	cmd := exec.Command("git", "rev-parse", "refs/claude-mux/test/one", "HEAD~1")
+	cmd.Dir = repoDir
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Failed to resolve refs: %v", err)
+	}
+	if lines := strings.Fields(string(output)); len(lines) != 2 || lines[0] != lines[1] {
+		t.Errorf("Expected the existing ref to be kept, got %q", output)
+	}
+}
+
+func TestClient_CommitAll(t *testing.T) {
+	t.Parallel()
+
+	repoDir := setupTestRepo(t)
+	client := NewClient(repoDir, false)
+
+	start, err := client.Head(repoDir)
+	if err != nil || len(start) != 40 {
+		t.Fatalf("Head() = %q, %v", start, err)
+	}
+
+	if committed, err := client.CommitAll(repoDir, "nothing"); err != nil || committed {
+		t.Errorf("CommitAll() of a clean worktree = %v, %v, want false", committed, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(repoDir, "test.txt"), []byte("changed"), 0644); err != nil {
+		t.Fatalf("Failed to modify file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "new.txt"), []byte("new"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if committed, err := client.CommitAll(repoDir, "first"); err != nil || !committed {
+		t.Fatalf("CommitAll() = %v, %v, want true", committed, err)
+	}
+	if changes, err := client.Status(repoDir); err != nil || len(changes) != 0 {
+		t.Errorf("Expected a clean worktree after CommitAll(), got %v, %v", changes, err)
+	}
+
+	// Squash the commit and new changes into one
+	if err := os.WriteFile(filepath.Join(repoDir, "other.txt"), []byte("other"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := client.ResetSoft(repoDir, start); err != nil {
+		t.Fatalf("ResetSoft() error = %v", err)
+	}
+	if committed, err := client.CommitAll(repoDir, "squashed"); err != nil || !committed {
+		t.Fatalf("CommitAll() after ResetSoft() = %v, %v, want true", committed, err)
+	}
+
+	cmd := exec.Command("git", "log", "--format=%s", start+"..HEAD")
+	cmd.Dir = repoDir
+	output, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+	if got := strings.TrimSpace(string(output)); got != "squashed" {
+		t.Errorf("Expected a single squashed commit, got %q", got)
+	}
+}
+
+func TestClient_Snapshot(t *testing.T) {
+	t.Parallel()
+
+	repoDir := setupTestRepo(t)
+	client := NewClient(repoDir, false)
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(repoDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(repoDir, name))
+		if err != nil {
+			return "<missing>"
+		}
+		return string(data)
+	}
+
+	clean, err := client.WriteTree(repoDir)
+	if err != nil {
+		t.Fatalf("WriteTree() error = %v", err)
+	}
+
+	write("test.txt", "edited")
+	write("new.txt", "new")
+	tree, err := client.WriteTree(repoDir)
+	if err != nil {
+		t.Fatalf("WriteTree() error = %v", err)
+	}
+	if tree == clean {
+		t.Error("Expected WriteTree() to pick up changed and untracked files")
+	}
+	if changes, _ := client.Status(repoDir); len(changes) != 2 || changes[1].Code != "??" {
+		t.Errorf("Expected WriteTree() to leave the index alone, got status %v", changes)
+	}
+
+	commit, err := client.CommitTree(repoDir, tree, "checkpoint 1")
+	if err != nil {
+		t.Fatalf("CommitTree() error = %v", err)
+	}
+	if err := client.UpdateRef("refs/claude-mux/checkpoints/task/1", commit); err != nil {
+		t.Fatalf("UpdateRef() error = %v", err)
+	}
+	refs, err := client.ListRefs("refs/claude-mux/checkpoints/task")
+	if err != nil {
+		t.Fatalf("ListRefs() error = %v", err)
+	}
+	if len(refs) != 1 || refs[0].Commit != commit || refs[0].Tree != tree || refs[0].Subject != "checkpoint 1" || refs[0].Time.IsZero() {
+		t.Errorf("ListRefs() = %+v", refs)
+	}
+
+	write("test.txt", "broken")
+	write("later.txt", "later")
+	if err := os.Remove(filepath.Join(repoDir, "new.txt")); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+	if err := client.RestoreTree(repoDir, commit); err != nil {
+		t.Fatalf("RestoreTree() error = %v", err)
+	}
+	for name, want := range map[string]string{"test.txt": "edited", "new.txt": "new", "later.txt": "<missing>"} {
+		if got := read(name); got != want {
+			t.Errorf("After RestoreTree() %s = %q, want %q", name, got, want)
+		}
+	}
+
+	if err := client.DeleteRef("refs/claude-mux/checkpoints/task/1"); err != nil {
+		t.Fatalf("DeleteRef() error = %v", err)
+	}
+	if refs, err := client.ListRefs("refs/claude-mux/checkpoints/task"); err != nil || len(refs) != 0 {
+		t.Errorf("ListRefs() after DeleteRef() = %+v, %v", refs, err)
+	}
+}
+
+func TestClient_Ignored(t *testing.T) {
+	t.Parallel()
+
+	repoDir := setupTestRepo(t)
+	client := NewClient(repoDir, false)
+	for name, content := range map[string]string{
+		".gitignore":              ".env\nnode_modules/\n",
+		".env":                    "SECRET=1",
+		"new.txt":                 "new",
+		"node_modules/pkg/pkg.js": "",
+	} {
+		path := filepath.Join(repoDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	files, err := client.Ignored(repoDir)
+	if err != nil {
+		t.Fatalf("Ignored() error = %v", err)
+	}
+	if want := []string{".env", "node_modules/"}; !slices.Equal(files, want) {
+		t.Errorf("Ignored() = %q, want %q", files, want)
+	}
+}
@@ -0,0 +1,802 @@
+// Package gitfake provides an in-memory git.Backend for tests.
+//
+// The fake keeps branches and worktrees in memory and mirrors worktree
+// directories on disk, so code that launches processes inside a worktree
+// keeps working. Failures can be injected per method with FailOn and
+// FailOnce to exercise error paths that are hard to trigger with real git.
+package gitfake
+
+import (
+	"crypto/sha1" // #nosec G505 -- fake object ids, not security relevant
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/git"
+)
+
+var _ git.Backend = (*Backend)(nil)
+
+// Backend is an in-memory git repository rooted at a directory on disk
+type Backend struct {
+	*state
+	dir string
+}
+
+// state is shared between backends returned by At
+type state struct {
+	mu sync.Mutex
+
+	root      string
+	head      string
+	version   string
+	branches  map[string]*branch
+	worktrees []git.Worktree
+	excludes  []string
+	changes   map[string][]git.FileStatus
+	ignored   map[string][]string
+	diffs     map[string]string
+	refs      map[string]string
+	// nextCommit numbers the commits created by CommitAll and CommitTree
+	nextCommit int
+	// snapshots are the commits created by CommitTree
+	snapshots map[string]snapshot
+
+	failures map[string][]failure
+	calls    []string
+}
+
+// branch tracks what the fake needs to know about a branch
+type branch struct {
+	merged bool
+	// base is the commit the branch was created at
+	base string
+	// commits were made on the branch with CommitAll, oldest first
+	commits []commit
+}
+
+// commit is a commit made with CommitAll
+type commit struct {
+	id      string
+	message string
+	files   []git.FileStatus
+}
+
+// snapshot is a commit of a worktree's changes made with CommitTree
+type snapshot struct {
+	tree    string
+	message string
+	files   []git.FileStatus
+	time    time.Time
+}
+
+// failure is an injected error; once failures are consumed by a single call
+type failure struct {
+	err  error
+	once bool
+}
+
+// New returns a fake repository whose main worktree is root with branch
+// "main" checked out. The root directory is created if needed.
+func New(root string) *Backend {
+	_ = os.MkdirAll(filepath.Join(root, ".git", "info"), 0750)
+
+	return &Backend{
+		state: &state{
+			root:     root,
+			head:     "main",
+			version:  "2.45.0",
+			branches: map[string]*branch{"main": {merged: true}},
+			worktrees: []git.Worktree{
+				{Path: root, Branch: "main", Commit: "0000000"},
+			},
+			changes:   map[string][]git.FileStatus{},
+			ignored:   map[string][]string{},
+			diffs:     map[string]string{},
+			refs:      map[string]string{},
+			snapshots: map[string]snapshot{},
+			failures:  map[string][]failure{},
+		},
+		dir: root,
+	}
+}
+
+// FailOn makes every call to method return err
+func (b *Backend) FailOn(method string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures[method] = append(b.failures[method], failure{err: err})
+}
+
+// FailOnce makes the next call to method return err. Multiple FailOnce
+// errors for the same method are returned in order.
+func (b *Backend) FailOnce(method string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures[method] = append(b.failures[method], failure{err: err, once: true})
+}
+
+// Calls returns the methods called so far, in order
+func (b *Backend) Calls() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.calls...)
+}
+
+// AddBranch creates a branch. Unmerged branches refuse non-forced deletion.
+func (b *Backend) AddBranch(name string, merged bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.branches[name] = &branch{merged: merged}
+}
+
+// HasBranch reports whether a branch exists
+func (b *Backend) HasBranch(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, ok := b.branches[name]
+	return ok
+}
+
+// SetMerged marks a branch as merged or unmerged
+func (b *Backend) SetMerged(name string, merged bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if br, ok := b.branches[name]; ok {
+		br.merged = merged
+	}
+}
+
+// Lock marks the worktree at p as locked
+func (b *Backend) Lock(p string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if wt := b.worktreeAt(p); wt != nil {
+		wt.Locked = true
+	}
+}
+
+// SetChanges sets the uncommitted changes reported for the worktree at path
+func (b *Backend) SetChanges(path string, changes []git.FileStatus) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.changes[path] = changes
+}
+
+// SetIgnored sets the ignored files reported for the worktree at path
+func (b *Backend) SetIgnored(path string, files []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ignored[path] = files
+}
+
+// SetDiff sets the diff reported for branch
+func (b *Backend) SetDiff(branch, diff string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.diffs[branch] = diff
+}
+
+// Ref returns the revision ref was pointed at with UpdateRef
+func (b *Backend) Ref(ref string) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	rev, ok := b.refs[ref]
+	return rev, ok
+}
+
+// Commits returns the messages of the commits made on branch with
+// CommitAll, oldest first
+func (b *Backend) Commits(name string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	br, ok := b.branches[name]
+	if !ok {
+		return nil
+	}
+	messages := make([]string, 0, len(br.commits))
+	for _, c := range br.commits {
+		messages = append(messages, c.message)
+	}
+	return messages
+}
+
+// Excludes returns the patterns added with AddExclude
+func (b *Backend) Excludes() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.excludes...)
+}
+
+// begin records a call and returns any injected failure. The caller must
+// hold the lock.
+func (b *Backend) begin(method string) error {
+	b.calls = append(b.calls, method)
+
+	failures := b.failures[method]
+	if len(failures) == 0 {
+		return nil
+	}
+	f := failures[0]
+	if f.once {
+		b.failures[method] = failures[1:]
+	}
+	return f.err
+}
+
+// gitError builds an error shaped like the one real git would return
+func gitError(subcommand string, args []string, stderr string) error {
+	return &git.Error{
+		Subcommand: subcommand,
+		Args:       args,
+		ExitCode:   128,
+		Stderr:     stderr,
+		Err:        fmt.Errorf("exit status 128"),
+	}
+}
+
+// At returns a backend sharing this repository that operates from dir
+func (b *Backend) At(dir string) git.Backend {
+	return &Backend{state: b.state, dir: dir}
+}
+
+// Version returns the fake git version
+func (b *Backend) Version() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("Version"); err != nil {
+		return "", err
+	}
+	return b.version, nil
+}
+
+// ValidateRepo succeeds when the backend's directory is inside the repository
+func (b *Backend) ValidateRepo() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("ValidateRepo"); err != nil {
+		return err
+	}
+	if b.worktreeFor(b.dir) == nil {
+		return fmt.Errorf("not in a git repository")
+	}
+	return nil
+}
+
+// TopLevel returns the worktree containing the backend's directory
+func (b *Backend) TopLevel() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("TopLevel"); err != nil {
+		return "", err
+	}
+	wt := b.worktreeFor(b.dir)
+	if wt == nil {
+		return "", fmt.Errorf("not in a git repository")
+	}
+	return wt.Path, nil
+}
+
+// CommonDir returns the .git directory of the main worktree
+func (b *Backend) CommonDir() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("CommonDir"); err != nil {
+		return "", err
+	}
+	return filepath.Join(b.root, ".git"), nil
+}
+
+// MainWorktreeRoot returns the root passed to New
+func (b *Backend) MainWorktreeRoot() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("MainWorktreeRoot"); err != nil {
+		return "", err
+	}
+	return b.root, nil
+}
+
+// CurrentBranch returns the branch checked out in the backend's worktree
+func (b *Backend) CurrentBranch() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("CurrentBranch"); err != nil {
+		return "", err
+	}
+	if wt := b.worktreeFor(b.dir); wt != nil {
+		return wt.Branch, nil
+	}
+	return b.head, nil
+}
+
+// IsIgnored reports whether path matches a pattern added with AddExclude
+func (b *Backend) IsIgnored(p string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("IsIgnored"); err != nil {
+		return false, err
+	}
+
+	rel, err := filepath.Rel(b.root, p)
+	if err != nil {
+		return false, err
+	}
+	rel = "/" + filepath.ToSlash(rel)
+	for _, pattern := range b.excludes {
+		if strings.HasPrefix(rel+"/", pattern) || strings.HasPrefix(rel, pattern) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ExcludeFile returns the exclude file in the .git directory of the main
+// worktree. Patterns are recorded in memory, not written to it.
+func (b *Backend) ExcludeFile() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("ExcludeFile"); err != nil {
+		return "", err
+	}
+	return filepath.Join(b.root, ".git", "info", "exclude"), nil
+}
+
+// AddExclude records an exclude pattern
+func (b *Backend) AddExclude(pattern string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("AddExclude"); err != nil {
+		return false, err
+	}
+	for _, existing := range b.excludes {
+		if existing == pattern {
+			return false, nil
+		}
+	}
+	b.excludes = append(b.excludes, pattern)
+	return true, nil
+}
+
+// CreateWorktree creates a branch and a worktree directory for it
+func (b *Backend) CreateWorktree(p, name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("CreateWorktree"); err != nil {
+		return err
+	}
+
+	args := []string{"add", "-b", name, p}
+	if _, ok := b.branches[name]; ok {
+		return gitError("worktree", args, fmt.Sprintf("fatal: a branch named '%s' already exists", name))
+	}
+	if b.worktreeAt(p) != nil {
+		return gitError("worktree", args, fmt.Sprintf("fatal: '%s' already exists", p))
+	}
+	if strings.Contains(name, "..") || strings.ContainsAny(name, " ~^:?*[\\") {
+		return gitError("worktree", args, fmt.Sprintf("fatal: '%s' is not a valid branch name", name))
+	}
+
+	if err := os.MkdirAll(p, 0750); err != nil {
+		return err
+	}
+	b.branches[name] = &branch{merged: true, base: "0000000"}
+	b.worktrees = append(b.worktrees, git.Worktree{Path: p, Branch: name, Commit: "0000000"})
+	return nil
+}
+
+// ListWorktrees returns the main worktree followed by linked worktrees
+func (b *Backend) ListWorktrees() ([]git.Worktree, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("ListWorktrees"); err != nil {
+		return nil, err
+	}
+
+	worktrees := make([]git.Worktree, len(b.worktrees))
+	copy(worktrees, b.worktrees)
+	for i := range worktrees {
+		if _, err := os.Stat(worktrees[i].Path); os.IsNotExist(err) {
+			worktrees[i].Prunable = true
+		}
+	}
+	return worktrees, nil
+}
+
+// RemoveWorktree deletes a linked worktree and its directory
+func (b *Backend) RemoveWorktree(p string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("RemoveWorktree"); err != nil {
+		return err
+	}
+
+	for i, wt := range b.worktrees {
+		if i == 0 || wt.Path != p {
+			continue
+		}
+		if wt.Locked {
+			return gitError("worktree", []string{"remove", p, "--force"},
+				"fatal: cannot remove a locked working tree;\nuse 'remove -f -f' to override or unlock first")
+		}
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+		b.worktrees = append(b.worktrees[:i], b.worktrees[i+1:]...)
+		return nil
+	}
+	return gitError("worktree", []string{"remove", p, "--force"}, fmt.Sprintf("fatal: '%s' is not a working tree", p))
+}
+
+// PruneWorktrees forgets linked worktrees whose directories are missing
+func (b *Backend) PruneWorktrees(dryRun bool) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("PruneWorktrees"); err != nil {
+		return nil, err
+	}
+
+	var pruned []string
+	kept := b.worktrees[:1]
+	for _, wt := range b.worktrees[1:] {
+		if _, err := os.Stat(wt.Path); os.IsNotExist(err) && !wt.Locked {
+			pruned = append(pruned, fmt.Sprintf("Removing worktrees/%s: gitdir file points to non-existent location", filepath.Base(wt.Path)))
+			continue
+		}
+		kept = append(kept, wt)
+	}
+	if !dryRun {
+		b.worktrees = kept
+	}
+	return pruned, nil
+}
+
+// ListBranches returns branches matching a glob pattern, sorted by name
+func (b *Backend) ListBranches(pattern string) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("ListBranches"); err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for name := range b.branches {
+		if ok, _ := path.Match(pattern, name); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// IsMerged reports the merged state set with AddBranch or SetMerged
+func (b *Backend) IsMerged(name, target string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("IsMerged"); err != nil {
+		return false, err
+	}
+	br, ok := b.branches[name]
+	if !ok {
+		return false, gitError("merge-base", []string{"--is-ancestor", name, target}, fmt.Sprintf("fatal: Not a valid object name %s", name))
+	}
+	return br.merged, nil
+}
+
+// DeleteBranch deletes a branch that is not checked out in any worktree
+func (b *Backend) DeleteBranch(name string, force bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("DeleteBranch"); err != nil {
+		return err
+	}
+
+	flag := "-d"
+	if force {
+		flag = "-D"
+	}
+	args := []string{flag, name}
+
+	br, ok := b.branches[name]
+	if !ok {
+		return gitError("branch", args, fmt.Sprintf("error: branch '%s' not found.", name))
+	}
+	for _, wt := range b.worktrees {
+		if wt.Branch == name {
+			return gitError("branch", args, fmt.Sprintf("error: Cannot delete branch '%s' checked out at '%s'", name, wt.Path))
+		}
+	}
+	if !br.merged && !force {
+		return gitError("branch", args, fmt.Sprintf("error: The branch '%s' is not fully merged.", name))
+	}
+	delete(b.branches, name)
+	return nil
+}
+
+// UpdateRef records that ref points at rev, which must be a known branch
+// or a commit made with CommitTree
+func (b *Backend) UpdateRef(ref, rev string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("UpdateRef"); err != nil {
+		return err
+	}
+	_, isBranch := b.branches[rev]
+	if _, isSnapshot := b.snapshots[rev]; !isBranch && !isSnapshot {
+		return gitError("update-ref", []string{ref, rev}, fmt.Sprintf("fatal: %s: not a valid SHA1", rev))
+	}
+	b.refs[ref] = rev
+	return nil
+}
+
+// CreateRef is like UpdateRef but fails if ref exists
+func (b *Backend) CreateRef(ref, rev string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("CreateRef"); err != nil {
+		return err
+	}
+	if _, exists := b.refs[ref]; exists {
+		return gitError("update-ref", []string{ref, rev, ""}, fmt.Sprintf("fatal: cannot lock ref '%s': reference already exists", ref))
+	}
+	_, isBranch := b.branches[rev]
+	if _, isSnapshot := b.snapshots[rev]; !isBranch && !isSnapshot {
+		return gitError("update-ref", []string{ref, rev, ""}, fmt.Sprintf("fatal: %s: not a valid SHA1", rev))
+	}
+	b.refs[ref] = rev
+	return nil
+}
+
+// DeleteRef forgets ref
+func (b *Backend) DeleteRef(ref string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("DeleteRef"); err != nil {
+		return err
+	}
+	delete(b.refs, ref)
+	return nil
+}
+
+// ListRefs returns the refs below prefix that point at commits made with
+// CommitTree, sorted by name
+func (b *Backend) ListRefs(prefix string) ([]git.Ref, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("ListRefs"); err != nil {
+		return nil, err
+	}
+
+	var refs []git.Ref
+	for name, rev := range b.refs {
+		snap, ok := b.snapshots[rev]
+		if !ok || !strings.HasPrefix(name, strings.TrimSuffix(prefix, "/")+"/") {
+			continue
+		}
+		subject, _, _ := strings.Cut(snap.message, "\n")
+		refs = append(refs, git.Ref{Name: name, Commit: rev, Tree: snap.tree, Subject: subject, Time: snap.time})
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+	return refs, nil
+}
+
+// Status returns the changes set with SetChanges
+func (b *Backend) Status(p string) ([]git.FileStatus, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("Status"); err != nil {
+		return nil, err
+	}
+	return append([]git.FileStatus(nil), b.changes[p]...), nil
+}
+
+// Ignored returns the ignored files set with SetIgnored
+func (b *Backend) Ignored(p string) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("Ignored"); err != nil {
+		return nil, err
+	}
+	return append([]string(nil), b.ignored[p]...), nil
+}
+
+// Diff returns the diff set with SetDiff
+func (b *Backend) Diff(base, name string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("Diff"); err != nil {
+		return "", err
+	}
+	return b.diffs[name], nil
+}
+
+// Merge marks branch as merged
+func (b *Backend) Merge(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("Merge"); err != nil {
+		return err
+	}
+	br, ok := b.branches[name]
+	if !ok {
+		return gitError("merge", []string{"--no-edit", name}, fmt.Sprintf("merge: %s - not something we can merge", name))
+	}
+	br.merged = true
+	return nil
+}
+
+// Head returns the commit checked out in the worktree at p
+func (b *Backend) Head(p string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("Head"); err != nil {
+		return "", err
+	}
+	wt := b.worktreeAt(p)
+	if wt == nil {
+		return "", gitError("rev-parse", []string{"HEAD"}, "fatal: not a git repository (or any of the parent directories): .git")
+	}
+	return wt.Commit, nil
+}
+
+// CommitAll turns the changes set with SetChanges into a commit on the
+// branch checked out at p, which then counts as unmerged
+func (b *Backend) CommitAll(p, message string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("CommitAll"); err != nil {
+		return false, err
+	}
+	wt := b.worktreeAt(p)
+	if wt == nil {
+		return false, gitError("add", []string{"--all"}, "fatal: not a git repository (or any of the parent directories): .git")
+	}
+	if len(b.changes[p]) == 0 {
+		return false, nil
+	}
+
+	b.nextCommit++
+	c := commit{id: fmt.Sprintf("%07x", b.nextCommit), message: message, files: b.changes[p]}
+	if br, ok := b.branches[wt.Branch]; ok {
+		br.commits = append(br.commits, c)
+		br.merged = false
+	}
+	wt.Commit = c.id
+	delete(b.changes, p)
+	return true, nil
+}
+
+// ResetSoft drops the commits made after rev on the branch checked out at
+// p, turning their files back into changes
+func (b *Backend) ResetSoft(p, rev string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("ResetSoft"); err != nil {
+		return err
+	}
+	args := []string{"--soft", rev}
+	wt := b.worktreeAt(p)
+	if wt == nil {
+		return gitError("reset", args, "fatal: not a git repository (or any of the parent directories): .git")
+	}
+	br, ok := b.branches[wt.Branch]
+	if !ok {
+		return gitError("reset", args, fmt.Sprintf("fatal: ambiguous argument '%s': unknown revision", rev))
+	}
+
+	keep := -1
+	if rev != br.base {
+		for i, c := range br.commits {
+			if c.id == rev {
+				keep = i
+			}
+		}
+		if keep < 0 {
+			return gitError("reset", args, fmt.Sprintf("fatal: ambiguous argument '%s': unknown revision", rev))
+		}
+	}
+	for _, c := range br.commits[keep+1:] {
+		b.changes[p] = append(b.changes[p], c.files...)
+	}
+	br.commits = br.commits[:keep+1]
+	wt.Commit = rev
+	return nil
+}
+
+// worktreeAt returns the worktree registered at exactly p. The caller must
+// hold the lock.
+func (b *Backend) worktreeAt(p string) *git.Worktree {
+	for i := range b.worktrees {
+		if b.worktrees[i].Path == p {
+			return &b.worktrees[i]
+		}
+	}
+	return nil
+}
+
+// worktreeFor returns the innermost worktree containing dir. The caller
+// must hold the lock.
+func (b *Backend) worktreeFor(dir string) *git.Worktree {
+	var found *git.Worktree
+	for i := range b.worktrees {
+		wt := &b.worktrees[i]
+		rel, err := filepath.Rel(wt.Path, dir)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if found == nil || len(wt.Path) > len(found.Path) {
+			found = wt
+		}
+	}
+	return found
+}
+
+// WriteTree returns an id derived from the commit checked out at p and
+// its changes, so unchanged worktrees produce the same tree
+func (b *Backend) WriteTree(p string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("WriteTree"); err != nil {
+		return "", err
+	}
+	wt := b.worktreeAt(p)
+	if wt == nil {
+		return "", gitError("write-tree", nil, "fatal: not a git repository (or any of the parent directories): .git")
+	}
+	return treeID(wt.Commit, b.changes[p]), nil
+}
+
+// treeID hashes a commit and a set of changes into a fake tree id
+func treeID(commit string, changes []git.FileStatus) string {
+	h := sha1.New() // #nosec G401 -- fake object ids, not security relevant
+	_, _ = fmt.Fprintln(h, commit)
+	for _, c := range changes {
+		_, _ = fmt.Fprintln(h, c.Code, c.Path)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CommitTree records the changes of the worktree at p as a commit that
+// RestoreTree can bring back. The tree must match the worktree.
+func (b *Backend) CommitTree(p, tree, message string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("CommitTree"); err != nil {
+		return "", err
+	}
+	wt := b.worktreeAt(p)
+	if wt == nil || treeID(wt.Commit, b.changes[p]) != tree {
+		return "", gitError("commit-tree", []string{tree}, fmt.Sprintf("fatal: %s is not a valid 'tree' object", tree))
+	}
+
+	b.nextCommit++
+	id := fmt.Sprintf("%07x", b.nextCommit)
+	b.snapshots[id] = snapshot{
+		tree:    tree,
+		message: message,
+		files:   append([]git.FileStatus(nil), b.changes[p]...),
+		time:    time.Now(),
+	}
+	return id, nil
+}
+
+// RestoreTree brings back the changes recorded by CommitTree
+func (b *Backend) RestoreTree(p, rev string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.begin("RestoreTree"); err != nil {
+		return err
+	}
+	snap, ok := b.snapshots[rev]
+	if !ok || b.worktreeAt(p) == nil {
+		return gitError("restore", []string{"--source=" + rev, "--worktree", "--", "."}, fmt.Sprintf("fatal: could not resolve %s", rev))
+	}
+	b.changes[p] = append([]git.FileStatus(nil), snap.files...)
+	return nil
+}
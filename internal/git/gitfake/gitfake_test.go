@@ -0,0 +1,189 @@
+package gitfake
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/enriikke/claude-mux/internal/git"
+)
+
+func TestBackend_WorktreeLifecycle(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	b := New(root)
+	path := filepath.Join(root, ".claude-mux", "task")
+
+	if err := b.CreateWorktree(path, "claude-mux-task"); err != nil {
+		t.Fatalf("CreateWorktree() error = %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected worktree directory to exist: %v", err)
+	}
+
+	if err := b.CreateWorktree(filepath.Join(root, "other"), "claude-mux-task"); !git.IsBranchExists(err) {
+		t.Errorf("Expected branch exists error, got %v", err)
+	}
+	if err := b.CreateWorktree(path, "claude-mux-other"); !git.IsPathExists(err) {
+		t.Errorf("Expected path exists error, got %v", err)
+	}
+
+	// A backend re-targeted at the worktree sees the same repository
+	linked := b.At(path)
+	if branch, err := linked.CurrentBranch(); err != nil || branch != "claude-mux-task" {
+		t.Errorf("CurrentBranch() = %q, %v, want claude-mux-task", branch, err)
+	}
+	if top, err := linked.TopLevel(); err != nil || top != path {
+		t.Errorf("TopLevel() = %q, %v, want %q", top, err, path)
+	}
+
+	b.Lock(path)
+	if err := b.RemoveWorktree(path); !git.IsLockedWorktree(err) {
+		t.Errorf("Expected locked worktree error, got %v", err)
+	}
+}
+
+func TestBackend_DeleteBranch(t *testing.T) {
+	t.Parallel()
+
+	b := New(t.TempDir())
+	b.AddBranch("claude-mux-unmerged", false)
+
+	if err := b.DeleteBranch("claude-mux-unmerged", false); !git.IsNotMerged(err) {
+		t.Errorf("Expected not merged error, got %v", err)
+	}
+	if err := b.DeleteBranch("claude-mux-unmerged", true); err != nil {
+		t.Errorf("DeleteBranch(force) error = %v", err)
+	}
+	if b.HasBranch("claude-mux-unmerged") {
+		t.Error("Expected branch to be deleted")
+	}
+}
+
+func TestBackend_Failures(t *testing.T) {
+	t.Parallel()
+
+	b := New(t.TempDir())
+	errBoom := errors.New("boom")
+
+	b.FailOnce("ListWorktrees", errBoom)
+	if _, err := b.ListWorktrees(); !errors.Is(err, errBoom) {
+		t.Errorf("Expected injected error, got %v", err)
+	}
+	if _, err := b.ListWorktrees(); err != nil {
+		t.Errorf("Expected one-shot failure to be consumed, got %v", err)
+	}
+
+	b.FailOn("Merge", errBoom)
+	for i := 0; i < 2; i++ {
+		if err := b.Merge("main"); !errors.Is(err, errBoom) {
+			t.Errorf("Expected persistent injected error, got %v", err)
+		}
+	}
+
+	want := []string{"ListWorktrees", "ListWorktrees", "Merge", "Merge"}
+	got := b.Calls()
+	if len(got) != len(want) {
+		t.Fatalf("Calls() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Calls()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestBackend_CommitAll(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	b := New(root)
+	path := filepath.Join(root, ".claude-mux", "task")
+	if err := b.CreateWorktree(path, "claude-mux-task"); err != nil {
+		t.Fatalf("CreateWorktree() error = %v", err)
+	}
+	start, err := b.Head(path)
+	if err != nil {
+		t.Fatalf("Head() error = %v", err)
+	}
+
+	if committed, err := b.CommitAll(path, "nothing"); err != nil || committed {
+		t.Errorf("CommitAll() without changes = %v, %v, want false", committed, err)
+	}
+
+	for _, message := range []string{"one", "two"} {
+		b.SetChanges(path, []git.FileStatus{{Code: "??", Path: message + ".txt"}})
+		if committed, err := b.CommitAll(path, message); err != nil || !committed {
+			t.Fatalf("CommitAll(%q) = %v, %v, want true", message, committed, err)
+		}
+	}
+	if merged, _ := b.IsMerged("claude-mux-task", "main"); merged {
+		t.Error("Expected a branch with commits to be unmerged")
+	}
+
+	if err := b.ResetSoft(path, start); err != nil {
+		t.Fatalf("ResetSoft() error = %v", err)
+	}
+	if changes, _ := b.Status(path); len(changes) != 2 {
+		t.Errorf("Expected the files of dropped commits to be changes again, got %v", changes)
+	}
+	if committed, err := b.CommitAll(path, "squashed"); err != nil || !committed {
+		t.Fatalf("CommitAll() after ResetSoft() = %v, %v, want true", committed, err)
+	}
+	if commits := b.Commits("claude-mux-task"); len(commits) != 1 || commits[0] != "squashed" {
+		t.Errorf("Commits() = %v, want [squashed]", commits)
+	}
+
+	if err := b.ResetSoft(path, "deadbee"); err == nil {
+		t.Error("Expected ResetSoft() to fail for an unknown revision")
+	}
+}
+
+func TestBackend_Snapshot(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	b := New(root)
+	path := filepath.Join(root, ".claude-mux", "task")
+	if err := b.CreateWorktree(path, "claude-mux-task"); err != nil {
+		t.Fatalf("CreateWorktree() error = %v", err)
+	}
+
+	edited := []git.FileStatus{{Code: " M", Path: "main.go"}}
+	b.SetChanges(path, edited)
+	tree, err := b.WriteTree(path)
+	if err != nil {
+		t.Fatalf("WriteTree() error = %v", err)
+	}
+	if again, _ := b.WriteTree(path); again != tree {
+		t.Errorf("Expected an unchanged worktree to produce the same tree, got %s and %s", tree, again)
+	}
+	commit, err := b.CommitTree(path, tree, "checkpoint 1")
+	if err != nil {
+		t.Fatalf("CommitTree() error = %v", err)
+	}
+	if err := b.UpdateRef("refs/claude-mux/checkpoints/task/1", commit); err != nil {
+		t.Fatalf("UpdateRef() error = %v", err)
+	}
+
+	b.SetChanges(path, []git.FileStatus{{Code: " D", Path: "main.go"}})
+	if err := b.RestoreTree(path, commit); err != nil {
+		t.Fatalf("RestoreTree() error = %v", err)
+	}
+	if changes, _ := b.Status(path); len(changes) != 1 || changes[0] != edited[0] {
+		t.Errorf("Status() after RestoreTree() = %v, want %v", changes, edited)
+	}
+
+	refs, err := b.ListRefs("refs/claude-mux/checkpoints/task")
+	if err != nil || len(refs) != 1 || refs[0].Commit != commit || refs[0].Tree != tree || refs[0].Subject != "checkpoint 1" {
+		t.Errorf("ListRefs() = %+v, %v", refs, err)
+	}
+	if err := b.DeleteRef(refs[0].Name); err != nil {
+		t.Fatalf("DeleteRef() error = %v", err)
+	}
+	if refs, _ := b.ListRefs("refs/claude-mux/checkpoints/task"); len(refs) != 0 {
+		t.Errorf("ListRefs() after DeleteRef() = %+v", refs)
+	}
+}
@@ -0,0 +1,254 @@
+// Package notify tells the user when a session needs attention: its agent
+// exited, waits for input or its verification failed.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kind identifies why a session needs attention
+type Kind string
+
+// Notification kinds
+const (
+	// KindExited is sent when the agent of a session exited
+	KindExited Kind = "exited"
+	// KindWaiting is sent when the agent of a session waits for input
+	KindWaiting Kind = "waiting"
+	// KindVerifyFailed is sent when the verify command failed in a session
+	KindVerifyFailed Kind = "verify_failed"
+)
+
+// webhookTimeout bounds how long a webhook may take to accept a notification
+const webhookTimeout = 10 * time.Second
+
+// Notification describes a session that needs attention
+type Notification struct {
+	Kind    Kind      `json:"kind"`
+	Session string    `json:"session"`
+	Branch  string    `json:"branch,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+// Title is a short heading for the notification
+func (n Notification) Title() string {
+	return "claude-mux: " + n.Session
+}
+
+// Notifier delivers notifications
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// Multi delivers notifications to all of its notifiers
+type Multi []Notifier
+
+// Notify delivers n to every notifier, even if some of them fail
+func (m Multi) Notify(ctx context.Context, n Notification) error {
+	var errs []error
+	for _, notifier := range m {
+		errs = append(errs, notifier.Notify(ctx, n))
+	}
+	return errors.Join(errs...)
+}
+
+// Parse creates the notifier described by spec:
+//
+//	bell           ring the terminal bell
+//	osc9           desktop notification through OSC 9 (iTerm2, WezTerm, Windows Terminal)
+//	osc777         desktop notification through OSC 777 (foot, Konsole, VTE terminals)
+//	notify-send    desktop notification through notify-send
+//	exec:<command> run a shell command, the notification is passed in CLAUDE_MUX_* variables
+//	<http(s) URL>  post the notification as JSON to a webhook
+//
+// Terminal notifiers write their escape sequences to out.
+func Parse(spec string, out io.Writer) (Notifier, error) {
+	inTmux := os.Getenv("TMUX") != ""
+	switch {
+	case spec == "bell":
+		return Bell{Out: out}, nil
+	case spec == "osc9":
+		return OSC9{Out: out, Tmux: inTmux}, nil
+	case spec == "osc777":
+		return OSC777{Out: out, Tmux: inTmux}, nil
+	case spec == "notify-send":
+		return NotifySend{}, nil
+	case strings.HasPrefix(spec, "exec:"):
+		command := strings.TrimSpace(strings.TrimPrefix(spec, "exec:"))
+		if command == "" {
+			return nil, errors.New("exec notifier needs a command, e.g. exec:say done")
+		}
+		return Command{Command: command}, nil
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return Webhook{URL: spec}, nil
+	}
+	return nil, fmt.Errorf("unknown notifier %q, want bell, osc9, osc777, notify-send, exec:<command> or a webhook URL", spec)
+}
+
+// Bell rings the terminal bell
+type Bell struct {
+	Out io.Writer
+}
+
+// Notify rings the bell
+func (b Bell) Notify(_ context.Context, _ Notification) error {
+	_, err := io.WriteString(b.Out, "\a")
+	return err
+}
+
+// OSC9 shows a desktop notification through the OSC 9 escape sequence
+type OSC9 struct {
+	Out io.Writer
+	// Tmux passes the sequence through tmux to the outer terminal
+	Tmux bool
+}
+
+// Notify writes the escape sequence
+func (o OSC9) Notify(_ context.Context, n Notification) error {
+	return writeOSC(o.Out, o.Tmux, "9;"+sanitize(n.Title()+": "+n.Message))
+}
+
+// OSC777 shows a desktop notification through the OSC 777 escape sequence
+type OSC777 struct {
+	Out io.Writer
+	// Tmux passes the sequence through tmux to the outer terminal
+	Tmux bool
+}
+
+// Notify writes the escape sequence
+func (o OSC777) Notify(_ context.Context, n Notification) error {
+	title := strings.ReplaceAll(sanitize(n.Title()), ";", ",")
+	return writeOSC(o.Out, o.Tmux, "777;notify;"+title+";"+sanitize(n.Message))
+}
+
+// writeOSC writes an operating system command escape sequence
+func writeOSC(out io.Writer, tmux bool, payload string) error {
+	seq := "\x1b]" + payload + "\x07"
+	if tmux {
+		// tmux forwards sequences wrapped in a DCS with doubled escapes
+		seq = "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+	}
+	_, err := io.WriteString(out, seq)
+	return err
+}
+
+// sanitize removes control characters that would end an escape sequence early
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// NotifySend shows a desktop notification through notify-send
+type NotifySend struct {
+	// Command is the notify-send binary, looked up in PATH by default
+	Command string
+}
+
+// Notify runs notify-send
+func (s NotifySend) Notify(ctx context.Context, n Notification) error {
+	command := s.Command
+	if command == "" {
+		command = "notify-send"
+	}
+	cmd := exec.CommandContext(ctx, command, "--app-name=claude-mux", n.Title(), n.Message) // #nosec G204 -- configured by the user
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("notify-send failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Command runs a shell command for every notification. The notification is
+// passed in the CLAUDE_MUX_NOTIFICATION, CLAUDE_MUX_SESSION,
+// CLAUDE_MUX_BRANCH, CLAUDE_MUX_WORKTREE and CLAUDE_MUX_MESSAGE variables.
+type Command struct {
+	Command string
+}
+
+// Notify runs the command
+func (c Command) Notify(ctx context.Context, n Notification) error {
+	cmd := shellCommand(ctx, c.Command)
+	cmd.Env = append(os.Environ(),
+		"CLAUDE_MUX_NOTIFICATION="+string(n.Kind),
+		"CLAUDE_MUX_SESSION="+n.Session,
+		"CLAUDE_MUX_BRANCH="+n.Branch,
+		"CLAUDE_MUX_WORKTREE="+n.Path,
+		"CLAUDE_MUX_MESSAGE="+n.Message,
+	)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("notify command failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Webhook posts notifications as JSON to a URL
+type Webhook struct {
+	URL string
+	// Client sends the requests, a client with a short timeout by default
+	Client *http.Client
+}
+
+// Notify posts the notification
+func (w Webhook) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: webhookTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// Recorder keeps the notifications it receives in memory. It stands in for
+// real notifiers in tests.
+type Recorder struct {
+	mu            sync.Mutex
+	notifications []Notification
+}
+
+// Notify records n
+func (r *Recorder) Notify(_ context.Context, n Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifications = append(r.notifications, n)
+	return nil
+}
+
+// Notifications returns the notifications received so far
+func (r *Recorder) Notifications() []Notification {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Notification(nil), r.notifications...)
+}
@@ -0,0 +1,210 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testNotification = Notification{
+	Kind:    KindWaiting,
+	Session: "task-abc123",
+	Branch:  "claude-mux-main-task-abc123",
+	Path:    "/repo/.claude-mux/task-abc123",
+	Message: "Claude is waiting for input",
+	Time:    time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+}
+
+func TestParse(t *testing.T) {
+	t.Setenv("TMUX", "")
+
+	tests := []struct {
+		spec    string
+		want    Notifier
+		wantErr bool
+	}{
+		{spec: "bell", want: Bell{}},
+		{spec: "osc9", want: OSC9{}},
+		{spec: "osc777", want: OSC777{}},
+		{spec: "notify-send", want: NotifySend{}},
+		{spec: "exec: say done", want: Command{Command: "say done"}},
+		{spec: "https://example.com/hook", want: Webhook{URL: "https://example.com/hook"}},
+		{spec: "exec:", wantErr: true},
+		{spec: "email", wantErr: true},
+		{spec: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := Parse(tt.spec, nil)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %#v, want %#v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTerminalNotifiers(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		notifier func(out *bytes.Buffer) Notifier
+		want     string
+	}{
+		{
+			name:     "bell",
+			notifier: func(out *bytes.Buffer) Notifier { return Bell{Out: out} },
+			want:     "\a",
+		},
+		{
+			name:     "osc9",
+			notifier: func(out *bytes.Buffer) Notifier { return OSC9{Out: out} },
+			want:     "\x1b]9;claude-mux: task-abc123: Claude is waiting for input\a",
+		},
+		{
+			name:     "osc777",
+			notifier: func(out *bytes.Buffer) Notifier { return OSC777{Out: out} },
+			want:     "\x1b]777;notify;claude-mux: task-abc123;Claude is waiting for input\a",
+		},
+		{
+			name:     "osc9 in tmux",
+			notifier: func(out *bytes.Buffer) Notifier { return OSC9{Out: out, Tmux: true} },
+			want:     "\x1bPtmux;\x1b\x1b]9;claude-mux: task-abc123: Claude is waiting for input\a\x1b\\",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var out bytes.Buffer
+			if err := tt.notifier(&out).Notify(context.Background(), testNotification); err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("Notify() wrote %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestOSC_Sanitize(t *testing.T) {
+	t.Parallel()
+
+	var out bytes.Buffer
+	n := testNotification
+	n.Session = "a;b"
+	n.Message = "line\x07\x1b]evil"
+	if err := (OSC777{Out: &out}).Notify(context.Background(), n); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	want := "\x1b]777;notify;claude-mux: a,b;line  ]evil\a"
+	if out.String() != want {
+		t.Errorf("Notify() wrote %q, want %q", out.String(), want)
+	}
+}
+
+func TestCommandNotifiers(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake commands are shell scripts")
+	}
+
+	dir := t.TempDir()
+	sink := filepath.Join(dir, "sink")
+	// A fake notify-send found through PATH records its arguments
+	script := "#!/bin/sh\nprintf '%s|' \"$@\" > " + sink + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "notify-send"), []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write fake notify-send: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	tests := []struct {
+		name     string
+		notifier Notifier
+		want     string
+	}{
+		{
+			name:     "notify-send",
+			notifier: NotifySend{},
+			want:     "--app-name=claude-mux|claude-mux: task-abc123|Claude is waiting for input|",
+		},
+		{
+			name:     "exec",
+			notifier: Command{Command: `echo "$CLAUDE_MUX_NOTIFICATION $CLAUDE_MUX_SESSION $CLAUDE_MUX_MESSAGE" > ` + sink},
+			want:     "waiting task-abc123 Claude is waiting for input\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.notifier.Notify(context.Background(), testNotification); err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+			got, err := os.ReadFile(sink)
+			if err != nil {
+				t.Fatalf("Failed to read sink: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Notify() recorded %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if err := (Command{Command: "echo broken >&2; exit 3"}).Notify(context.Background(), testNotification); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Notify() of a failing command error = %v, want its output", err)
+	}
+}
+
+func TestWebhook(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan Notification, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/hook" {
+			http.NotFound(w, r)
+			return
+		}
+		var n Notification
+		if err := json.NewDecoder(r.Body).Decode(&n); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received <- n
+	}))
+	defer srv.Close()
+
+	if err := (Webhook{URL: srv.URL + "/hook"}).Notify(context.Background(), testNotification); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if got := <-received; got != testNotification {
+		t.Errorf("Webhook received %+v, want %+v", got, testNotification)
+	}
+
+	if err := (Webhook{URL: srv.URL + "/missing"}).Notify(context.Background(), testNotification); err == nil {
+		t.Error("Notify() to a failing webhook succeeded")
+	}
+}
+
+func TestMulti(t *testing.T) {
+	t.Parallel()
+
+	var first, second Recorder
+	multi := Multi{&first, Command{Command: "exit 1"}, &second}
+	if err := multi.Notify(context.Background(), testNotification); err == nil {
+		t.Error("Notify() error = nil, want the failing notifier's error")
+	}
+	if len(first.Notifications()) != 1 || len(second.Notifications()) != 1 {
+		t.Errorf("Expected every notifier to be notified, got %d and %d", len(first.Notifications()), len(second.Notifications()))
+	}
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package notify
+
+import (
+	"context"
+	"os/exec"
+)
+
+// shellCommand runs command through the Windows command interpreter
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd", "/C", command)
+}
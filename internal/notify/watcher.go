@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"context"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/worktree"
+)
+
+// DefaultInterval is how often sessions are checked for state changes
+const DefaultInterval = 2 * time.Second
+
+// Watcher notifies when the agent of a session starts waiting for input or
+// exits on its own. It compares each list of sessions with the one before.
+type Watcher struct {
+	notifier Notifier
+	onError  func(error)
+	// agents holds the agent of every session last observed, nil until
+	// the first observation
+	agents map[string]worktree.AgentStatus
+}
+
+// NewWatcher creates a watcher delivering notifications to n. Delivery
+// failures are passed to onError, if set.
+func NewWatcher(n Notifier, onError func(error)) *Watcher {
+	return &Watcher{notifier: n, onError: onError}
+}
+
+// Watch observes the sessions returned by list every interval until ctx is
+// canceled. Sessions that cannot be listed are retried at the next interval.
+func (w *Watcher) Watch(ctx context.Context, interval time.Duration, list func(context.Context) ([]worktree.Session, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if sessions, err := list(ctx); err == nil {
+			w.Observe(ctx, sessions)
+		} else if ctx.Err() == nil && w.onError != nil {
+			w.onError(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Observe notifies about sessions whose agent started waiting or exited
+// since the last observation. The first observation only records the
+// state, so existing sessions do not all notify at once.
+func (w *Watcher) Observe(ctx context.Context, sessions []worktree.Session) {
+	first := w.agents == nil
+	agents := make(map[string]worktree.AgentStatus, len(sessions))
+	for _, s := range sessions {
+		agents[s.Name] = s.Agent
+		if first {
+			continue
+		}
+
+		// Sessions created since the last observation had no agent yet
+		prev := w.agents[s.Name]
+		restarted := !s.Agent.StartedAt.Equal(prev.StartedAt)
+		if s.Agent.State == prev.State && !restarted {
+			continue
+		}
+		switch s.Agent.State {
+		case worktree.AgentExited:
+			w.notify(ctx, KindExited, s, "Claude exited")
+		case worktree.AgentWaiting:
+			// Unpaused agents are quiet until they notice they continue
+			if prev.State == worktree.AgentPaused && !restarted {
+				continue
+			}
+			w.notify(ctx, KindWaiting, s, "Claude is waiting for input")
+		}
+	}
+	w.agents = agents
+}
+
+func (w *Watcher) notify(ctx context.Context, kind Kind, s worktree.Session, message string) {
+	err := w.notifier.Notify(ctx, Notification{
+		Kind:    kind,
+		Session: s.Name,
+		Branch:  s.Branch,
+		Path:    s.Path,
+		Message: message,
+		Time:    time.Now(),
+	})
+	if err != nil && w.onError != nil {
+		w.onError(err)
+	}
+}
@@ -0,0 +1,145 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/worktree"
+)
+
+// session is a session whose agent is in state, started at startedAt
+func session(name string, state worktree.AgentState, startedAt time.Time) worktree.Session {
+	return worktree.Session{
+		Name:  name,
+		Agent: worktree.AgentStatus{State: state, StartedAt: startedAt},
+	}
+}
+
+func TestWatcher_Observe(t *testing.T) {
+	t.Parallel()
+
+	start := time.Now()
+	restart := start.Add(time.Minute)
+	tests := []struct {
+		name   string
+		before []worktree.Session
+		after  []worktree.Session
+		want   []Kind
+	}{
+		{
+			name:   "exited",
+			before: []worktree.Session{session("a", worktree.AgentRunning, start)},
+			after:  []worktree.Session{session("a", worktree.AgentExited, start)},
+			want:   []Kind{KindExited},
+		},
+		{
+			name:   "waiting",
+			before: []worktree.Session{session("a", worktree.AgentRunning, start)},
+			after:  []worktree.Session{session("a", worktree.AgentWaiting, start)},
+			want:   []Kind{KindWaiting},
+		},
+		{
+			name:   "still waiting",
+			before: []worktree.Session{session("a", worktree.AgentWaiting, start)},
+			after:  []worktree.Session{session("a", worktree.AgentWaiting, start)},
+		},
+		{
+			name:   "unpaused",
+			before: []worktree.Session{session("a", worktree.AgentPaused, start)},
+			after:  []worktree.Session{session("a", worktree.AgentWaiting, start)},
+		},
+		{
+			name:   "stopped",
+			before: []worktree.Session{session("a", worktree.AgentRunning, start)},
+			after:  []worktree.Session{session("a", worktree.AgentStopped, start)},
+		},
+		{
+			name:   "started",
+			before: []worktree.Session{session("a", worktree.AgentIdle, time.Time{})},
+			after:  []worktree.Session{session("a", worktree.AgentRunning, start)},
+		},
+		{
+			name:   "resumed and exited in between",
+			before: []worktree.Session{session("a", worktree.AgentExited, start)},
+			after:  []worktree.Session{session("a", worktree.AgentExited, restart)},
+			want:   []Kind{KindExited},
+		},
+		{
+			name:  "new session exited in between",
+			after: []worktree.Session{session("a", worktree.AgentExited, start)},
+			want:  []Kind{KindExited},
+		},
+		{
+			name:   "removed",
+			before: []worktree.Session{session("a", worktree.AgentRunning, start)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var recorder Recorder
+			watcher := NewWatcher(&recorder, nil)
+			watcher.Observe(context.Background(), tt.before)
+			watcher.Observe(context.Background(), tt.after)
+
+			got := recorder.Notifications()
+			if len(got) != len(tt.want) {
+				t.Fatalf("Observe() sent %+v, want kinds %v", got, tt.want)
+			}
+			for i, n := range got {
+				if n.Kind != tt.want[i] || n.Session != "a" || n.Message == "" {
+					t.Errorf("Notification %d = %+v, want kind %s about a", i, n, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWatcher_FirstObservation(t *testing.T) {
+	t.Parallel()
+
+	var recorder Recorder
+	watcher := NewWatcher(&recorder, nil)
+	watcher.Observe(context.Background(), []worktree.Session{
+		session("a", worktree.AgentExited, time.Now()),
+		session("b", worktree.AgentWaiting, time.Now()),
+	})
+	if got := recorder.Notifications(); len(got) != 0 {
+		t.Errorf("Expected the first observation not to notify, got %+v", got)
+	}
+}
+
+func TestWatcher_Watch(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	states := []worktree.AgentState{worktree.AgentRunning, worktree.AgentExited}
+	calls := 0
+	list := func(context.Context) ([]worktree.Session, error) {
+		calls++
+		switch {
+		case calls == 2:
+			return nil, errors.New("listing failed")
+		case calls > 3:
+			cancel()
+		}
+		return []worktree.Session{session("a", states[min(calls-1, 1)], time.Time{})}, nil
+	}
+
+	var recorder Recorder
+	var errs []error
+	watcher := NewWatcher(&recorder, func(err error) { errs = append(errs, err) })
+	watcher.Watch(ctx, time.Millisecond, list)
+
+	if got := recorder.Notifications(); len(got) != 1 || got[0].Kind != KindExited {
+		t.Errorf("Watch() sent %+v, want one exit", got)
+	}
+	if len(errs) != 1 {
+		t.Errorf("Expected the listing failure to be reported, got %v", errs)
+	}
+}
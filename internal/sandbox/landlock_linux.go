@@ -0,0 +1,237 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// init runs the helper when the current executable was started to run a
+// sandboxed agent. It runs before main, so programs embedding claude-mux
+// need no changes.
+func init() {
+	if data, ok := os.LookupEnv(forwardVar); ok {
+		err := runForwarder(data)
+		fmt.Fprintf(os.Stderr, "claude-mux: the network forwarder failed: %v\n", err)
+		os.Exit(1)
+	}
+	data, ok := os.LookupEnv(envVar)
+	if !ok {
+		return
+	}
+	err := runHelper(data)
+	fmt.Fprintf(os.Stderr, "claude-mux: failed to start the sandboxed agent: %v\n", err)
+	os.Exit(126)
+}
+
+// runHelper restricts the current thread and executes the agent on it,
+// which hands the restrictions on to the agent. It only returns on failure.
+func runHelper(data string) error {
+	var s spec
+	if err := json.Unmarshal([]byte(data), &s); err != nil {
+		return err
+	}
+	if err := os.Unsetenv(envVar); err != nil {
+		return err
+	}
+
+	// Landlock rulesets and capabilities apply to a single thread
+	runtime.LockOSThread()
+	if s.Network != nil {
+		if err := joinNetwork(*s.Network); err != nil {
+			return err
+		}
+	}
+	if s.Writable != nil {
+		if err := restrict(s.Policy); err != nil {
+			return err
+		}
+	}
+	return syscall.Exec(s.Path, s.Args, os.Environ()) // #nosec G204 -- the agent command claude-mux was configured with
+}
+
+// Available reports why agents cannot be sandboxed, or nil if they can
+func Available() error {
+	if _, err := landlockABI(); err != nil {
+		return fmt.Errorf("the sandbox needs the Landlock LSM: %w", err)
+	}
+	return nil
+}
+
+// landlockABI returns the version of the Landlock ABI of the kernel
+func landlockABI() (int, error) {
+	abi, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		if errors.Is(errno, unix.ENOSYS) || errors.Is(errno, unix.EOPNOTSUPP) {
+			return 0, errors.New("it is not enabled in this kernel")
+		}
+		return 0, errno
+	}
+	return int(abi), nil
+}
+
+// writeAccess returns the Landlock access rights to files that change
+// them, for kernels with the given ABI version. Files only take fileAccess.
+func writeAccess(abi int) (access, fileAccess uint64) {
+	fileAccess = unix.LANDLOCK_ACCESS_FS_WRITE_FILE
+	access = fileAccess |
+		unix.LANDLOCK_ACCESS_FS_REMOVE_DIR |
+		unix.LANDLOCK_ACCESS_FS_REMOVE_FILE |
+		unix.LANDLOCK_ACCESS_FS_MAKE_CHAR |
+		unix.LANDLOCK_ACCESS_FS_MAKE_DIR |
+		unix.LANDLOCK_ACCESS_FS_MAKE_REG |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_FIFO |
+		unix.LANDLOCK_ACCESS_FS_MAKE_BLOCK |
+		unix.LANDLOCK_ACCESS_FS_MAKE_SYM
+	if abi >= 2 {
+		access |= unix.LANDLOCK_ACCESS_FS_REFER
+	}
+	if abi >= 3 {
+		fileAccess |= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+		access |= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+	return access, fileAccess
+}
+
+// restrict makes everything but the writable paths of policy read-only
+// and its hidden paths unreadable for the current thread and the programs
+// it executes
+func restrict(policy Policy) error {
+	abi, err := landlockABI()
+	if err != nil {
+		return err
+	}
+	access, fileAccess := writeAccess(abi)
+	hidden, err := resolveHidden(policy.Hidden)
+	if err != nil {
+		return err
+	}
+	handled := access
+	if len(hidden) > 0 {
+		handled |= unix.LANDLOCK_ACCESS_FS_READ_FILE
+	}
+
+	attr := unix.LandlockRulesetAttr{Access_fs: handled}
+	fd, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("failed to create the Landlock ruleset: %w", errno)
+	}
+	ruleset := int(fd)
+	defer func() { _ = unix.Close(ruleset) }()
+
+	// Programs write to terminals and /dev/null, but never create devices
+	if err := allow(ruleset, "/dev", fileAccess, fileAccess); err != nil {
+		return err
+	}
+	for _, path := range policy.Writable {
+		if err := allow(ruleset, path, access, fileAccess); err != nil {
+			return err
+		}
+	}
+	if len(hidden) > 0 {
+		if err := allowReading(ruleset, "/", hidden); err != nil {
+			return err
+		}
+	}
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to drop privileges: %w", err)
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, uintptr(ruleset), 0, 0); errno != 0 {
+		return fmt.Errorf("failed to enforce the Landlock ruleset: %w", errno)
+	}
+	return nil
+}
+
+// allow grants access below path, or fileAccess if path is a file. Paths
+// that do not exist are skipped.
+func allow(ruleset int, path string, access, fileAccess uint64) error {
+	fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if errors.Is(err, unix.ENOENT) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer func() { _ = unix.Close(fd) }()
+
+	var stat unix.Stat_t
+	if err := unix.Fstat(fd, &stat); err != nil {
+		return err
+	}
+	if stat.Mode&unix.S_IFMT != unix.S_IFDIR {
+		access = fileAccess
+	}
+
+	rule := unix.LandlockPathBeneathAttr{Allowed_access: access, Parent_fd: int32(fd)} // #nosec G115 -- file descriptors fit in int32
+	_, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, uintptr(ruleset), unix.LANDLOCK_RULE_PATH_BENEATH, uintptr(unsafe.Pointer(&rule)), 0, 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("failed to allow access to %s: %w", path, errno)
+	}
+	return nil
+}
+
+// resolveHidden returns the real paths of the hidden paths that exist
+func resolveHidden(paths []string) ([]string, error) {
+	var hidden []string
+	for _, path := range paths {
+		real, err := filepath.EvalSymlinks(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		hidden = append(hidden, real)
+	}
+	return hidden, nil
+}
+
+// allowReading grants reading files below dir except the hidden paths.
+// Landlock only grants access, so every entry of dir is allowed but the
+// ones leading to a hidden path, which are walked in turn.
+func allowReading(ruleset int, dir string, hidden []string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		// Rules apply to what symbolic links point to
+		real, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			continue
+		}
+		switch {
+		case slices.ContainsFunc(hidden, func(h string) bool { return within(h, real) }):
+		case slices.ContainsFunc(hidden, func(h string) bool { return within(real, h) }):
+			if real == path {
+				if err := allowReading(ruleset, path, hidden); err != nil {
+					return err
+				}
+			}
+		default:
+			read := uint64(unix.LANDLOCK_ACCESS_FS_READ_FILE)
+			if err := allow(ruleset, path, read, read); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// within reports whether path is dir or below it
+func within(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
@@ -0,0 +1,81 @@
+package sandbox
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	t.Parallel()
+	if err := Available(); err != nil {
+		t.Skip(err)
+	}
+
+	dir := t.TempDir()
+	allowed, denied := filepath.Join(dir, "allowed"), filepath.Join(dir, "denied")
+	for _, d := range []string{allowed, denied} {
+		if err := os.Mkdir(d, 0750); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	script := `echo "${CLAUDE_MUX_SANDBOX:-unset}" && echo ok > "$1/file" && mkdir "$1/sub" && echo ok > /dev/null && cat "$2/../allowed/file" && echo no > "$2/file"`
+	cmd := exec.Command("/bin/sh", "-c", script, "sh", allowed, denied)
+	if err := Wrap(cmd, Policy{Writable: []string{allowed, filepath.Join(dir, "missing")}}); err != nil {
+		t.Fatalf("Wrap() error = %v", err)
+	}
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("Expected writing outside the sandbox to fail, got %s", out)
+	}
+	if !strings.Contains(string(out), "ok") || !strings.Contains(string(out), "Permission denied") {
+		t.Errorf("Expected the agent to read, write where allowed and be denied elsewhere, got %s", out)
+	}
+	if !strings.HasPrefix(string(out), "unset\n") {
+		t.Errorf("Expected the sandbox not to leak into the agent's environment")
+	}
+
+	if _, err := os.Stat(filepath.Join(allowed, "sub")); err != nil {
+		t.Errorf("Expected the agent to create a directory where allowed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(denied, "file")); err == nil {
+		t.Error("Expected the agent not to write outside the sandbox")
+	}
+}
+
+func TestWrapHidden(t *testing.T) {
+	t.Parallel()
+	if err := Available(); err != nil {
+		t.Skip(err)
+	}
+
+	dir := t.TempDir()
+	visible, hidden := filepath.Join(dir, "visible"), filepath.Join(dir, "hidden")
+	for _, d := range []string{visible, hidden} {
+		if err := os.Mkdir(d, 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(d, "file"), []byte(filepath.Base(d)+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(hidden, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	script := `cat "$1/visible/file" /etc/passwd >/dev/null && cat "$1/visible/file" && ! cat "$1/hidden/file" && ! cat "$1/link/file" && echo done`
+	cmd := exec.Command("/bin/sh", "-c", script, "sh", dir)
+	if err := Wrap(cmd, Policy{Writable: []string{}, Hidden: []string{hidden, filepath.Join(dir, "missing")}}); err != nil {
+		t.Fatalf("Wrap() error = %v", err)
+	}
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Expected the agent to read all but the hidden files: %v, output %s", err, out)
+	}
+	if !strings.HasPrefix(string(out), "visible\n") || !strings.HasSuffix(string(out), "done\n") || strings.Contains(string(out), "hidden\n") {
+		t.Errorf("Expected the hidden file to stay unreadable, got %s", out)
+	}
+}
@@ -0,0 +1,183 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// forwardVar passes the proxy to the forwarder process
+const forwardVar = "CLAUDE_MUX_FORWARD"
+
+// noProxy lists the hosts agents reach without the proxy, on their own
+// loopback interface
+const noProxy = "localhost,127.0.0.1,::1"
+
+// forwarder is what the forwarder process needs
+type forwarder struct {
+	// Proxy is the Unix socket of the proxy
+	Proxy string `json:"proxy"`
+	// Parent is the process ID of the agent, the forwarder exits with it
+	Parent int `json:"parent"`
+}
+
+// isolateNetwork makes cmd start in new user and network namespaces. The
+// user namespace maps the current user to itself, and lets the helper
+// bring up the loopback interface of the network namespace.
+func isolateNetwork(cmd *exec.Cmd) error {
+	if err := namespacesAvailable(); err != nil {
+		return err
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	attr := cmd.SysProcAttr
+	attr.Cloneflags |= unix.CLONE_NEWUSER | unix.CLONE_NEWNET
+	attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+	attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+	attr.AmbientCaps = append(attr.AmbientCaps, unix.CAP_NET_ADMIN)
+	return nil
+}
+
+// namespacesAvailable reports why the current user cannot create user
+// namespaces, or nil if they can
+func namespacesAvailable() error {
+	if limit, err := os.ReadFile("/proc/sys/user/max_user_namespaces"); err == nil && strings.TrimSpace(string(limit)) == "0" {
+		return errors.New("network isolation needs user namespaces, which are disabled by user.max_user_namespaces")
+	}
+	if os.Geteuid() == 0 {
+		return nil
+	}
+	if restricted, err := os.ReadFile("/proc/sys/kernel/apparmor_restrict_unprivileged_userns"); err == nil && strings.TrimSpace(string(restricted)) == "1" {
+		return errors.New("network isolation needs user namespaces, which AppArmor restricts by kernel.apparmor_restrict_unprivileged_userns")
+	}
+	return nil
+}
+
+// joinNetwork sets up the network namespace the helper started in: it
+// brings up the loopback interface, drops the capability it needed and
+// starts the forwarder to the proxy, if any, which the agent is pointed to
+func joinNetwork(network Network) error {
+	if err := loopbackUp(); err != nil {
+		return fmt.Errorf("failed to bring up the loopback interface: %w", err)
+	}
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to drop capabilities: %w", err)
+	}
+	if network.Proxy == "" {
+		return nil
+	}
+
+	addr, err := startForwarder(network.Proxy)
+	if err != nil {
+		return fmt.Errorf("failed to start the network forwarder: %w", err)
+	}
+	proxy := "http://" + addr
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"} {
+		if err := os.Setenv(name, proxy); err != nil {
+			return err
+		}
+	}
+	for _, name := range []string{"NO_PROXY", "no_proxy"} {
+		if err := os.Setenv(name, noProxy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loopbackUp brings up the loopback interface of the network namespace
+func loopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = unix.Close(fd) }()
+
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return err
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+}
+
+// startForwarder listens on the loopback interface of the network
+// namespace and starts a process passing the connections on to the proxy.
+// It returns the address the agent reaches the proxy at.
+func startForwarder(proxy string) (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = ln.Close() }()
+	file, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = file.Close() }()
+
+	self, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(forwarder{Proxy: proxy, Parent: os.Getpid()})
+	if err != nil {
+		return "", err
+	}
+	cmd := exec.Command(self) // #nosec G204 -- the current executable
+	cmd.Env = append(os.Environ(), forwardVar+"="+string(data))
+	cmd.ExtraFiles = []*os.File{file}
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	return ln.Addr().String(), cmd.Process.Release()
+}
+
+// runForwarder passes the connections accepted on file descriptor 3 on to
+// the proxy until the agent exits
+func runForwarder(data string) error {
+	var f forwarder
+	if err := json.Unmarshal([]byte(data), &f); err != nil {
+		return err
+	}
+	ln, err := net.FileListener(os.NewFile(3, "listener"))
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for range time.Tick(time.Second) {
+			if os.Getppid() != f.Parent {
+				os.Exit(0)
+			}
+		}
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer func() { _ = conn.Close() }()
+			upstream, err := net.Dial("unix", f.Proxy)
+			if err != nil {
+				return
+			}
+			defer func() { _ = upstream.Close() }()
+			pipe(conn, upstream)
+		}()
+	}
+}
@@ -0,0 +1,57 @@
+package sandbox
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"testing"
+)
+
+func TestWrap_Network(t *testing.T) {
+	t.Parallel()
+	if err := namespacesAvailable(); err != nil {
+		t.Skip(err)
+	}
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl is not installed")
+	}
+
+	// A stand-in for the API endpoint, on the loopback interface of the host
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "api")
+	}))
+	t.Cleanup(api.Close)
+	proxy, err := ListenProxy(t.TempDir(), []string{api.Listener.Addr().String()}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = proxy.Close() })
+
+	// The agent only reaches the host through the proxy, which curl would
+	// skip for 127.0.0.1 by NO_PROXY
+	script := `curl -s --noproxy '*' "$1" || echo direct refused
+curl -s --noproxy '' "$1" || echo proxied refused
+curl -s --noproxy '' -o /dev/null -w '%{http_code}' http://denied.invalid/ || echo " denied refused"`
+	tests := []struct {
+		name    string
+		network Network
+		want    string
+	}{
+		{name: "none", network: Network{}, want: "direct refused\nproxied refused\n000 denied refused\n"},
+		{name: "allowlist", network: Network{Proxy: proxy.Socket()}, want: "direct refused\napi403"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			cmd := exec.Command("/bin/sh", "-c", script, "sh", api.URL)
+			if err := Wrap(cmd, Policy{Network: &tt.network}); err != nil {
+				t.Fatalf("Wrap() error = %v", err)
+			}
+			out, _ := cmd.CombinedOutput()
+			if string(out) != tt.want {
+				t.Errorf("Expected the agent to print %q, got %q", tt.want, out)
+			}
+		})
+	}
+}
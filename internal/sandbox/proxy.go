@@ -0,0 +1,202 @@
+package sandbox
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// dialTimeout bounds how long the proxy takes to connect to a host
+const dialTimeout = 30 * time.Second
+
+// defaultPort is the port allowed for hosts given without one, HTTPS
+const defaultPort = "443"
+
+// Proxy is an HTTP proxy on a Unix socket that only connects to allowed
+// hosts. Agents in an isolated network reach it through a forwarder on
+// their loopback interface. It tunnels HTTPS with CONNECT and forwards
+// plain HTTP requests.
+type Proxy struct {
+	allow  []string
+	deny   func(host string)
+	dir    string
+	server *http.Server
+	direct *httputil.ReverseProxy
+
+	mu     sync.Mutex
+	denied map[string]bool
+}
+
+// ListenProxy starts a proxy connecting to the hosts in allow, see Allowed.
+// Every distinct host and port that is denied is passed to deny once. The
+// socket is created in a private directory below parent, which no agent
+// should be able to write to.
+func ListenProxy(parent string, allow []string, deny func(host string)) (*Proxy, error) {
+	// Unix socket paths are short, so the socket gets a directory of its own
+	if err := os.MkdirAll(parent, 0700); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(parent, "net-")
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen("unix", filepath.Join(dir, "proxy.sock"))
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, err
+	}
+
+	transport := &http.Transport{
+		DialContext:         (&net.Dialer{Timeout: dialTimeout}).DialContext,
+		TLSHandshakeTimeout: dialTimeout,
+	}
+	p := &Proxy{
+		allow:  allow,
+		deny:   deny,
+		dir:    dir,
+		direct: &httputil.ReverseProxy{Rewrite: func(*httputil.ProxyRequest) {}, Transport: transport},
+		denied: map[string]bool{},
+	}
+	p.server = &http.Server{Handler: p, ReadHeaderTimeout: dialTimeout}
+	go func() { _ = p.server.Serve(ln) }()
+	return p, nil
+}
+
+// Socket returns the path of the Unix socket the proxy listens on
+func (p *Proxy) Socket() string {
+	return filepath.Join(p.dir, "proxy.sock")
+}
+
+// Close stops the proxy, closing the connections through it
+func (p *Proxy) Close() error {
+	return errors.Join(p.server.Close(), os.RemoveAll(p.dir))
+}
+
+// ServeHTTP handles a request of an agent
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	host, port := r.URL.Hostname(), cmp.Or(r.URL.Port(), "80")
+	if r.Method == http.MethodConnect {
+		host, port = splitHostPort(r.Host)
+	}
+	if host == "" {
+		http.Error(w, "claude-mux only proxies requests to other hosts", http.StatusBadRequest)
+		return
+	}
+	address := net.JoinHostPort(host, port)
+	if !Allowed(p.allow, host, port) {
+		p.report(address)
+		http.Error(w, fmt.Sprintf("claude-mux: %s is not in the network allowlist of this session", address), http.StatusForbidden)
+		return
+	}
+
+	if r.Method != http.MethodConnect {
+		p.direct.ServeHTTP(w, r)
+		return
+	}
+	upstream, err := net.DialTimeout("tcp", address, dialTimeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	client, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		_ = upstream.Close()
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = client.Close() }()
+	defer func() { _ = upstream.Close() }()
+	if _, err := io.WriteString(client, "HTTP/1.1 200 Connection Established\r\n\r\n"); err != nil {
+		return
+	}
+	pipe(&bufferedConn{Conn: client, r: buf.Reader}, upstream)
+}
+
+// report passes a denied host to deny, once
+func (p *Proxy) report(host string) {
+	p.mu.Lock()
+	seen := p.denied[host]
+	p.denied[host] = true
+	p.mu.Unlock()
+	if !seen && p.deny != nil {
+		p.deny(host)
+	}
+}
+
+// Allowed reports whether host and port match an entry of allow. Entries
+// are host names, *.domain wildcards matching the subdomains of domain, or
+// IP addresses, each with an optional port such as example.com:8080. An
+// entry without a port only allows port 443.
+func Allowed(allow []string, host, port string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for _, entry := range allow {
+		entryHost, entryPort := splitHostPort(entry)
+		entryHost = strings.TrimSuffix(strings.ToLower(entryHost), ".")
+		if entryPort != port {
+			continue
+		}
+		if domain, ok := strings.CutPrefix(entryHost, "*."); ok {
+			if strings.HasSuffix(host, "."+domain) {
+				return true
+			}
+		} else if host == entryHost {
+			return true
+		}
+	}
+	return false
+}
+
+// splitHostPort splits an address into host and port, defaulting to port
+// 443 when it has none
+func splitHostPort(address string) (host, port string) {
+	if host, port, err := net.SplitHostPort(address); err == nil {
+		return host, port
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(address, "["), "]"), defaultPort
+}
+
+// bufferedConn is a hijacked connection whose reads start with what the
+// HTTP server buffered
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// pipe copies between a and b until both directions are done
+func pipe(a, b net.Conn) {
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(a, b)
+		closeWrite(a)
+		close(done)
+	}()
+	_, _ = io.Copy(b, a)
+	closeWrite(b)
+	<-done
+}
+
+// closeWrite tells the other end of conn that no more data follows
+func closeWrite(conn net.Conn) {
+	if buffered, ok := conn.(*bufferedConn); ok {
+		conn = buffered.Conn
+	}
+	if c, ok := conn.(interface{ CloseWrite() error }); ok {
+		_ = c.CloseWrite()
+		return
+	}
+	_ = conn.Close()
+}
@@ -0,0 +1,136 @@
+package sandbox
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestAllowed(t *testing.T) {
+	t.Parallel()
+
+	allow := []string{"api.anthropic.com", "*.github.com", "127.0.0.1", "registry.example:8080", "*.example.org:80", "[::1]:22", "::2"}
+	tests := []struct {
+		host string
+		port string
+		want bool
+	}{
+		{"api.anthropic.com", "443", true},
+		{"API.Anthropic.com.", "443", true},
+		{"api.anthropic.com", "80", false},
+		{"api.anthropic.com", "22", false},
+		{"anthropic.com", "443", false},
+		{"evil-api.anthropic.com", "443", false},
+		{"codeload.github.com", "443", true},
+		{"codeload.github.com", "22", false},
+		{"github.com", "443", false},
+		{"github.com.evil.example", "443", false},
+		{"127.0.0.1", "443", true},
+		{"127.0.0.1", "6379", false},
+		{"127.0.0.2", "443", false},
+		{"registry.example", "8080", true},
+		{"registry.example", "443", false},
+		{"www.example.org", "80", true},
+		{"www.example.org", "443", false},
+		{"::1", "22", true},
+		{"::1", "443", false},
+		{"::2", "443", true},
+	}
+	for _, tt := range tests {
+		if got := Allowed(allow, tt.host, tt.port); got != tt.want {
+			t.Errorf("Allowed(%q, %q) = %v, want %v", tt.host, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestProxy(t *testing.T) {
+	t.Parallel()
+
+	// Stand-ins for the API endpoint
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "plain")
+	}))
+	defer plain.Close()
+	secure := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "secure")
+	}))
+	defer secure.Close()
+
+	// A third server on the same host but a port that is not allowed
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "other")
+	}))
+	defer other.Close()
+
+	var mu sync.Mutex
+	var denied []string
+	parent := t.TempDir()
+	allow := []string{plain.Listener.Addr().String(), secure.Listener.Addr().String()}
+	proxy, err := ListenProxy(parent, allow, func(host string) {
+		mu.Lock()
+		defer mu.Unlock()
+		denied = append(denied, host)
+	})
+	if err != nil {
+		t.Fatalf("ListenProxy() error = %v", err)
+	}
+	defer func() { _ = proxy.Close() }()
+	dir := filepath.Dir(proxy.Socket())
+	if info, err := os.Stat(dir); err != nil || filepath.Dir(dir) != parent || info.Mode().Perm() != 0700 {
+		t.Errorf("Expected the socket in a private directory below %s, got %s", parent, proxy.Socket())
+	}
+
+	transport := secure.Client().Transport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyURL(&url.URL{Scheme: "http", Host: "proxy"})
+	transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return (&net.Dialer{}).DialContext(ctx, "unix", proxy.Socket())
+	}
+	client := &http.Client{Transport: transport}
+
+	tests := []struct {
+		url        string
+		wantStatus int
+		wantBody   string
+	}{
+		{url: plain.URL, wantStatus: http.StatusOK, wantBody: "plain"},
+		{url: secure.URL, wantStatus: http.StatusOK, wantBody: "secure"},
+		{url: "http://denied.invalid/", wantStatus: http.StatusForbidden},
+		{url: "http://denied.invalid/again", wantStatus: http.StatusForbidden},
+		{url: other.URL, wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		resp, err := client.Get(tt.url)
+		if err != nil {
+			t.Errorf("GET %s error = %v", tt.url, err)
+			continue
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("GET %s status = %d, want %d", tt.url, resp.StatusCode, tt.wantStatus)
+		}
+		if tt.wantBody != "" && string(body) != tt.wantBody {
+			t.Errorf("GET %s body = %q, want %q", tt.url, body, tt.wantBody)
+		}
+	}
+
+	// HTTPS to a denied host fails when the tunnel is refused
+	if _, err := client.Get("https://denied.invalid/"); err == nil {
+		t.Error("Expected tunneling to a denied host to fail")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	otherAddr := other.Listener.Addr().String()
+	if want := []string{"denied.invalid:80", otherAddr, "denied.invalid:443"}; !slices.Equal(denied, want) {
+		t.Errorf("Expected %v to be reported once each, got %v", want, denied)
+	}
+}
@@ -0,0 +1,141 @@
+// Package sandbox confines agents to the files they may change and the
+// network they may reach. A sandboxed agent is started through the current
+// executable, which restricts itself with the Landlock LSM, joins a network
+// namespace of its own and then executes the agent, so the restrictions
+// cover the agent and all of its children.
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// envVar passes the sandbox of an agent to the helper process
+const envVar = "CLAUDE_MUX_SANDBOX"
+
+// Policy describes what a sandboxed agent may change and reach
+type Policy struct {
+	// Writable lists the files and directories the agent may change, with
+	// everything below them. Everything else is read-only. Nil leaves
+	// files unconfined.
+	Writable []string `json:"writable"`
+	// Hidden lists files and directories the agent may not read, with
+	// everything below them, when Writable confines it. Entries created
+	// later in the directories above them are not readable either.
+	Hidden []string `json:"hidden,omitempty"`
+	// Network confines the network access of the agent, nil leaves it the
+	// network of the host
+	Network *Network `json:"network,omitempty"`
+}
+
+// Network describes the network of a sandboxed agent. It only has a
+// loopback interface of its own.
+type Network struct {
+	// Proxy is the Unix socket of a proxy, see Proxy, through which the
+	// agent reaches other hosts. Without one the agent has no network.
+	Proxy string `json:"proxy,omitempty"`
+}
+
+// spec is what the helper process needs to start the agent
+type spec struct {
+	Policy
+	Path string   `json:"path"`
+	Args []string `json:"args"`
+}
+
+// Wrap makes cmd run confined by policy. It fails when the system cannot
+// enforce the policy, rather than running the agent unconfined.
+func Wrap(cmd *exec.Cmd, policy Policy) error {
+	if policy.Writable != nil {
+		if err := Available(); err != nil {
+			return err
+		}
+	}
+	if policy.Network != nil {
+		if err := isolateNetwork(cmd); err != nil {
+			return err
+		}
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(spec{Policy: policy, Path: cmd.Path, Args: cmd.Args})
+	if err != nil {
+		return err
+	}
+
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = append(env, envVar+"="+string(data))
+	cmd.Path = self
+	return nil
+}
+
+// Describe summarizes policy for the session log
+func Describe(policy Policy) string {
+	description := fmt.Sprintf("sandbox: writable %s", strings.Join(policy.Writable, ", "))
+	if len(policy.Hidden) > 0 {
+		description += fmt.Sprintf("; hidden %s", strings.Join(policy.Hidden, ", "))
+	}
+	return description
+}
+
+var (
+	// escapes matches terminal control sequences
+	escapes = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+	// denials matches the errors programs print when file access is denied
+	denials = regexp.MustCompile(`(?i)permission denied|read-only file system|\bEACCES\b|\bEROFS\b`)
+)
+
+// maxLine is how much of a line of output is inspected
+const maxLine = 4096
+
+// Monitor spots file access the sandbox denied in the output of an agent.
+// The kernel does not report denials, so it looks for the errors programs
+// print. Every distinct denial is reported once.
+type Monitor struct {
+	report func(string)
+
+	mu   sync.Mutex
+	line []byte
+	seen map[string]bool
+}
+
+// NewMonitor creates a monitor passing denials to report
+func NewMonitor(report func(string)) *Monitor {
+	return &Monitor{report: report, seen: map[string]bool{}}
+}
+
+// Write inspects output of the agent
+func (m *Monitor) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, b := range p {
+		if b == '\n' || b == '\r' {
+			m.check()
+			m.line = m.line[:0]
+			continue
+		}
+		if len(m.line) < maxLine {
+			m.line = append(m.line, b)
+		}
+	}
+	return len(p), nil
+}
+
+func (m *Monitor) check() {
+	text := strings.TrimSpace(escapes.ReplaceAllString(string(m.line), ""))
+	if text == "" || m.seen[text] || !denials.MatchString(text) {
+		return
+	}
+	m.seen[text] = true
+	m.report(text)
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// Available reports why agents cannot be sandboxed, which needs Linux
+func Available() error {
+	return errors.New("the sandbox needs the Landlock LSM of Linux")
+}
+
+// isolateNetwork fails, network namespaces need Linux
+func isolateNetwork(*exec.Cmd) error {
+	return errors.New("network isolation needs the network namespaces of Linux")
+}
@@ -0,0 +1,57 @@
+package sandbox
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMonitor(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		output []string
+		want   []string
+	}{
+		{
+			name:   "node error",
+			output: []string{"Error: EACCES: permission denied, open '/home/me/.bashrc'\n"},
+			want:   []string{"Error: EACCES: permission denied, open '/home/me/.bashrc'"},
+		},
+		{
+			name:   "split across writes",
+			output: []string{"sh: 1: cannot create /etc/x: Perm", "ission denied\r\n"},
+			want:   []string{"sh: 1: cannot create /etc/x: Permission denied"},
+		},
+		{
+			name:   "terminal escapes",
+			output: []string{"\x1b[31mtouch: cannot touch '/opt/x': Read-only file system\x1b[0m\n"},
+			want:   []string{"touch: cannot touch '/opt/x': Read-only file system"},
+		},
+		{
+			name:   "reported once",
+			output: []string{"rm: Permission denied\n", "redraw\r", "rm: Permission denied\n"},
+			want:   []string{"rm: Permission denied"},
+		},
+		{
+			name:   "other output",
+			output: []string{"All tests passed\n", "no newline yet: Permission denied"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			var got []string
+			m := NewMonitor(func(denial string) { got = append(got, denial) })
+			for _, out := range tt.output {
+				if n, err := m.Write([]byte(out)); n != len(out) || err != nil {
+					t.Fatalf("Write() = %d, %v", n, err)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected denials %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package terminal
+
+// NotifyResize is a no-op because Windows consoles have no resize signal
+func NotifyResize(func()) (stop func()) {
+	return func() {}
+}
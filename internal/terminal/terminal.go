@@ -0,0 +1,26 @@
+// Package terminal has helpers for the terminal claude-mux runs in
+package terminal
+
+import (
+	"os"
+
+	"golang.org/x/term"
+)
+
+// File returns the file behind v if it is a terminal
+func File(v any) (*os.File, bool) {
+	f, ok := v.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return nil, false
+	}
+	return f, true
+}
+
+// Size returns the size of the terminal f, or zero when it is not a terminal
+func Size(f *os.File) (rows, cols uint16) {
+	width, height, err := term.GetSize(int(f.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return 0, 0
+	}
+	return uint16(height), uint16(width)
+}
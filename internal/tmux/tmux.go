@@ -0,0 +1,293 @@
+// Package tmux opens claude-mux sessions in tmux windows and panes
+package tmux
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultSession is the tmux session windows are opened in when claude-mux
+// does not run inside tmux
+const DefaultSession = "claude-mux"
+
+// sessionOption is the pane option holding the claude-mux session a pane runs
+const sessionOption = "@claude-mux-session"
+
+// Error describes a tmux command that failed
+type Error struct {
+	Command string
+	Stderr  string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	if e.Stderr != "" {
+		return fmt.Sprintf("tmux %s failed: %s", e.Command, e.Stderr)
+	}
+	return fmt.Sprintf("tmux %s failed: %v", e.Command, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Client runs tmux commands against one tmux server
+type Client struct {
+	command string
+	socket  string
+	verbose bool
+	// current is $TMUX, set when claude-mux runs inside tmux
+	current string
+}
+
+// NewClient creates a client for the tmux server at socket. A socket
+// without a path separator names a socket in tmux's default directory, an
+// empty socket means the server claude-mux runs in, or the default one.
+func NewClient(socket string, verbose bool) *Client {
+	return &Client{
+		command: "tmux",
+		socket:  socket,
+		verbose: verbose,
+		current: os.Getenv("TMUX"),
+	}
+}
+
+// Inside reports whether claude-mux runs inside a pane of the client's server
+func (c *Client) Inside() bool {
+	if c.current == "" {
+		return false
+	}
+	if c.socket == "" {
+		return true
+	}
+	// $TMUX starts with the path of the server socket
+	current, _, _ := strings.Cut(c.current, ",")
+	if strings.ContainsRune(c.socket, filepath.Separator) {
+		return filepath.Clean(current) == filepath.Clean(c.socket)
+	}
+	return filepath.Base(current) == c.socket
+}
+
+// socketArgs returns the tmux flags selecting the client's server
+func (c *Client) socketArgs() []string {
+	switch {
+	case strings.ContainsRune(c.socket, filepath.Separator):
+		return []string{"-S", c.socket}
+	case c.socket != "":
+		return []string{"-L", c.socket}
+	}
+	return nil
+}
+
+// AttachCommand returns the shell command attaching to DefaultSession
+func (c *Client) AttachCommand() string {
+	args := append([]string{"tmux"}, c.socketArgs()...)
+	return Quote(append(args, "attach", "-t", DefaultSession)...)
+}
+
+// run executes a tmux command and returns its output without the trailing newline
+func (c *Client) run(command string, args ...string) (string, error) {
+	args = append(append(c.socketArgs(), command), args...)
+	// #nosec G204 -- arguments are built by claude-mux, the socket comes from user config
+	cmd := exec.Command(c.command, args...)
+	if c.socket != "" {
+		// Commands would otherwise go to the server claude-mux runs in
+		cmd.Env = append(os.Environ(), "TMUX=")
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if c.verbose {
+		fmt.Fprintf(os.Stderr, "+ %s\n", strings.Join(cmd.Args, " "))
+	}
+	if err := cmd.Run(); err != nil {
+		return "", &Error{Command: command, Stderr: strings.TrimSpace(stderr.String()), Err: err}
+	}
+	return strings.TrimRight(stdout.String(), "\n"), nil
+}
+
+// Pane describes a pane running a claude-mux session
+type Pane struct {
+	// Session is the claude-mux session name, which also names the pane
+	Session string
+	// Dir is the directory the pane starts in
+	Dir string
+	// Command is the shell command run in the pane. Empty starts a shell.
+	Command string
+}
+
+// OpenWindow runs a session in a new window named after it and returns
+// the pane id. Inside tmux the window opens in the current session and is
+// selected, otherwise in DefaultSession.
+func (c *Client) OpenWindow(p Pane) (string, error) {
+	return c.open(p, false)
+}
+
+// OpenPane runs a session in a new pane split from the current one, or
+// from the current window of DefaultSession outside of tmux
+func (c *Client) OpenPane(p Pane) (string, error) {
+	return c.open(p, true)
+}
+
+func (c *Client) open(p Pane, split bool) (string, error) {
+	target, pane, err := c.target(p)
+	if err != nil {
+		return "", err
+	}
+
+	if pane == "" {
+		command, args := "new-window", []string{"-n", p.Session}
+		if split {
+			command, args = "split-window", nil
+		}
+		if target != "" {
+			args = append(args, "-t", target)
+		}
+		if pane, err = c.run(command, withCommand(append(args, "-P", "-F", "#{pane_id}", "-c", p.Dir), p)...); err != nil {
+			return "", err
+		}
+	}
+	return pane, c.tag(pane, p.Session)
+}
+
+// withCommand appends the command of p to tmux arguments creating its pane
+func withCommand(args []string, p Pane) []string {
+	if p.Command == "" {
+		return args
+	}
+	return append(args, p.Command)
+}
+
+// target returns where new windows go. Outside of tmux that is
+// DefaultSession; when it does not exist yet, it is created with a first
+// window for p whose pane is returned.
+func (c *Client) target(p Pane) (target, pane string, err error) {
+	if c.Inside() {
+		return "", "", nil
+	}
+	if _, err := c.run("has-session", "-t", "="+DefaultSession); err == nil {
+		return DefaultSession + ":", "", nil
+	}
+
+	args := []string{"-d", "-s", DefaultSession, "-n", p.Session, "-P", "-F", "#{pane_id}", "-c", p.Dir}
+	pane, err = c.run("new-session", withCommand(args, p)...)
+	return "", pane, err
+}
+
+// tag names a pane after the session it runs and remembers the session,
+// since programs in the pane may change its title
+func (c *Client) tag(pane, session string) error {
+	if _, err := c.run("set-option", "-p", "-t", pane, sessionOption, session); err != nil {
+		return err
+	}
+	_, err := c.run("select-pane", "-t", pane, "-T", session)
+	return err
+}
+
+// SessionPanes returns the panes running claude-mux sessions by session
+// name. No server running means no panes.
+func (c *Client) SessionPanes() (map[string]string, error) {
+	out, err := c.run("list-panes", "-a", "-F", "#{pane_id} #{"+sessionOption+"}")
+	if err != nil {
+		var tmuxErr *Error
+		if errors.As(err, &tmuxErr) && (strings.Contains(tmuxErr.Stderr, "no server running") || strings.Contains(tmuxErr.Stderr, "error connecting")) {
+			return map[string]string{}, nil
+		}
+		return nil, err
+	}
+
+	panes := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		pane, session, _ := strings.Cut(line, " ")
+		if session != "" {
+			panes[session] = pane
+		}
+	}
+	return panes, nil
+}
+
+// Tile gathers the panes of sessions in one window named name and tiles
+// them. Sessions already running in a pane are moved there, the others get
+// a new pane. It returns the window id.
+func (c *Client) Tile(name string, panes []Pane) (string, error) {
+	if len(panes) == 0 {
+		return "", errors.New("no panes to tile")
+	}
+	existing, err := c.SessionPanes()
+	if err != nil {
+		return "", err
+	}
+
+	// Start from a placeholder pane so every session pane can be moved in
+	placeholder := Pane{Session: name, Dir: panes[0].Dir}
+	target, created, err := c.target(placeholder)
+	if err != nil {
+		return "", err
+	}
+	if created == "" {
+		args := []string{"-d", "-n", name}
+		if target != "" {
+			args = append(args, "-t", target)
+		}
+		if created, err = c.run("new-window", append(args, "-P", "-F", "#{pane_id}", "-c", placeholder.Dir)...); err != nil {
+			return "", err
+		}
+	}
+	window, err := c.run("display-message", "-p", "-t", created, "#{window_id}")
+	if err != nil {
+		return "", err
+	}
+
+	for _, p := range panes {
+		if pane, ok := existing[p.Session]; ok {
+			if _, err := c.run("join-pane", "-d", "-s", pane, "-t", window); err != nil {
+				return "", err
+			}
+		} else {
+			args := []string{"-d", "-t", window, "-P", "-F", "#{pane_id}", "-c", p.Dir}
+			pane, err := c.run("split-window", withCommand(args, p)...)
+			if err != nil {
+				return "", err
+			}
+			if err := c.tag(pane, p.Session); err != nil {
+				return "", err
+			}
+		}
+		// Retile as panes are added so they never get too small to split
+		if _, err := c.run("select-layout", "-t", window, "tiled"); err != nil {
+			return "", err
+		}
+	}
+
+	if _, err := c.run("kill-pane", "-t", created); err != nil {
+		return "", err
+	}
+	if _, err := c.run("select-layout", "-t", window, "tiled"); err != nil {
+		return "", err
+	}
+	if c.Inside() {
+		if _, err := c.run("select-window", "-t", window); err != nil {
+			return "", err
+		}
+	}
+	return window, nil
+}
+
+// Quote quotes args for the POSIX shell tmux runs commands with
+func Quote(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./=:,@%+") == "" {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
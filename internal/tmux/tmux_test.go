@@ -0,0 +1,143 @@
+package tmux
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// newPrivateClient returns a client for a tmux server of its own, which is
+// killed when the test ends
+func newPrivateClient(t *testing.T) *Client {
+	t.Helper()
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux is not installed")
+	}
+
+	// Socket paths are limited in length, so avoid the long test temp dir
+	dir, err := os.MkdirTemp("", "cmux")
+	if err != nil {
+		t.Fatalf("Failed to create socket dir: %v", err)
+	}
+	c := NewClient(filepath.Join(dir, "tmux.sock"), false)
+	c.current = ""
+	t.Cleanup(func() {
+		_, _ = c.run("kill-server")
+		_ = os.RemoveAll(dir)
+	})
+	return c
+}
+
+// windowPanes returns the sessions of the panes in each window by window name
+func windowPanes(t *testing.T, c *Client) map[string][]string {
+	t.Helper()
+	out, err := c.run("list-panes", "-a", "-F", "#{window_name} #{"+sessionOption+"}")
+	if err != nil {
+		t.Fatalf("list-panes error = %v", err)
+	}
+	windows := make(map[string][]string)
+	for _, line := range strings.Split(out, "\n") {
+		window, session, _ := strings.Cut(line, " ")
+		windows[window] = append(windows[window], session)
+	}
+	for _, sessions := range windows {
+		sort.Strings(sessions)
+	}
+	return windows
+}
+
+func TestClient_OpenAndTile(t *testing.T) {
+	t.Parallel()
+
+	c := newPrivateClient(t)
+	dir := t.TempDir()
+	if panes, err := c.SessionPanes(); err != nil || len(panes) != 0 {
+		t.Fatalf("SessionPanes() without a server = %v, %v, want none", panes, err)
+	}
+
+	// Outside of tmux, windows open in the claude-mux session
+	first, err := c.OpenWindow(Pane{Session: "task-1a2b3c", Dir: dir, Command: "sleep 60"})
+	if err != nil {
+		t.Fatalf("OpenWindow() error = %v", err)
+	}
+	if _, err := c.OpenWindow(Pane{Session: "task-4d5e6f", Dir: dir, Command: "sleep 60"}); err != nil {
+		t.Fatalf("OpenWindow() error = %v", err)
+	}
+	if _, err := c.OpenPane(Pane{Session: "other-7a8b9c", Dir: dir, Command: "sleep 60"}); err != nil {
+		t.Fatalf("OpenPane() error = %v", err)
+	}
+	if title, _ := c.run("display-message", "-p", "-t", first, "#{pane_title}"); title != "task-1a2b3c" {
+		t.Errorf("Pane title = %q, want the session name", title)
+	}
+
+	panes, err := c.SessionPanes()
+	if err != nil || len(panes) != 3 || panes["task-1a2b3c"] != first {
+		t.Fatalf("SessionPanes() = %v, %v, want 3 panes", panes, err)
+	}
+
+	_, err = c.Tile("task", []Pane{
+		{Session: "task-1a2b3c", Dir: dir},
+		{Session: "task-4d5e6f", Dir: dir},
+		{Session: "task-0f0f0f", Dir: dir, Command: "sleep 60"},
+	})
+	if err != nil {
+		t.Fatalf("Tile() error = %v", err)
+	}
+
+	windows := windowPanes(t, c)
+	want := []string{"task-0f0f0f", "task-1a2b3c", "task-4d5e6f"}
+	if strings.Join(windows["task"], ",") != strings.Join(want, ",") {
+		t.Errorf("Expected window task to hold %v, got windows %v", want, windows)
+	}
+	if _, ok := windows["task-1a2b3c"]; ok {
+		t.Errorf("Expected the emptied window to be closed, got windows %v", windows)
+	}
+}
+
+func TestClient_Inside(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		current string
+		socket  string
+		want    bool
+	}{
+		{"outside tmux", "", "", false},
+		{"inside tmux", "/tmp/tmux-1000/default,123,0", "", true},
+		{"configured socket name", "/tmp/tmux-1000/work,123,0", "work", true},
+		{"other socket name", "/tmp/tmux-1000/default,123,0", "work", false},
+		{"configured socket path", "/tmp/work.sock,123,0", "/tmp/work.sock", true},
+		{"other socket path", "/tmp/tmux-1000/default,123,0", "/tmp/work.sock", false},
+	}
+
+	for _, tt := range tests {
+		c := &Client{socket: tt.socket, current: tt.current}
+		if got := c.Inside(); got != tt.want {
+			t.Errorf("%s: Inside() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"claude-mux", "--repo=/src/app", "launch", "task-1a2b3c"}, "claude-mux --repo=/src/app launch task-1a2b3c"},
+		{[]string{"-p", "Fix the login bug"}, "-p 'Fix the login bug'"},
+		{[]string{"it's", ""}, `'it'\''s' ''`},
+		{[]string{"$HOME;rm"}, `'$HOME;rm'`},
+	}
+
+	for _, tt := range tests {
+		if got := Quote(tt.args...); got != tt.want {
+			t.Errorf("Quote(%q) = %s, want %s", tt.args, got, tt.want)
+		}
+	}
+}
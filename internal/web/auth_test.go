@@ -0,0 +1,100 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/enriikke/claude-mux/internal/config"
+)
+
+func TestLoadToken(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "claude-mux", "token")
+	token, err := LoadToken(path)
+	if err != nil {
+		t.Fatalf("LoadToken() error = %v", err)
+	}
+	if len(token) != 64 {
+		t.Errorf("Expected a 64 character token, got %q", token)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected the token to be written: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("Expected token file mode 0600, got %v", info.Mode().Perm())
+	}
+
+	again, err := LoadToken(path)
+	if err != nil || again != token {
+		t.Errorf("LoadToken() = %q, %v, want the existing token %q", again, err, token)
+	}
+
+	empty := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(empty, []byte("\n"), 0600); err != nil {
+		t.Fatalf("Failed to write token: %v", err)
+	}
+	if _, err := LoadToken(empty); err == nil {
+		t.Error("Expected an empty token file to be rejected")
+	}
+}
+
+func TestServer_Authenticate(t *testing.T) {
+	t.Parallel()
+
+	handler := New(config.Config{RepoDir: t.TempDir()}, Options{Token: testToken}).Handler()
+
+	tests := []struct {
+		name       string
+		path       string
+		header     string
+		cookie     string
+		wantStatus int
+	}{
+		{"no token", "/", "", "", http.StatusUnauthorized},
+		{"wrong token", "/", "Bearer wrong", "", http.StatusUnauthorized},
+		{"bearer token", "/", "Bearer " + testToken, "", http.StatusOK},
+		{"cookie", "/", "", testToken, http.StatusOK},
+		{"wrong cookie", "/", "", "wrong", http.StatusUnauthorized},
+		{"query token", "/?token=" + testToken, "", "", http.StatusSeeOther},
+		{"wrong query token", "/?token=wrong", "", "", http.StatusUnauthorized},
+		{"query token only opens the dashboard", "/api/sessions?token=" + testToken, "", "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: tokenCookie, Value: tt.cookie})
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("GET %s status = %d, want %d", tt.path, rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusSeeOther {
+				return
+			}
+
+			cookies := rec.Result().Cookies()
+			if len(cookies) != 1 || cookies[0].Value != testToken || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteStrictMode {
+				t.Errorf("Expected a strict HttpOnly token cookie, got %+v", cookies)
+			}
+			if got := rec.Header().Get("Location"); got != "/" {
+				t.Errorf("Expected a redirect to /, got %q", got)
+			}
+		})
+	}
+}
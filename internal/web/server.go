@@ -0,0 +1,550 @@
+// Package web serves a local HTTP API and dashboard over the sessions of a
+// repository. Live output comes from agents supervised by the daemon.
+package web
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/daemon"
+	"github.com/enriikke/claude-mux/internal/notify"
+	"github.com/enriikke/claude-mux/internal/worktree"
+)
+
+// DefaultPollInterval is how often session changes are checked for streams
+const DefaultPollInterval = 2 * time.Second
+
+// changesInterval is how often streams count the uncommitted changes of the
+// sessions, which takes a git status per worktree. The state of agents is
+// polled every poll interval.
+const changesInterval = 10 * time.Second
+
+//go:embed static
+var static embed.FS
+
+// errNoDaemon is returned for live output when no daemon supervises agents
+var errNoDaemon = fmt.Errorf("%w: no daemon is running, start one with claude-mux daemon", daemon.ErrAgentStopped)
+
+// Options configure a Server
+type Options struct {
+	// Token authenticates every request
+	Token string
+	// Daemon returns a client for the running daemon, or nil if there is none
+	Daemon func(ctx context.Context) *daemon.Client
+	// PollInterval is how often session changes are checked for streams
+	PollInterval time.Duration
+	// Notifier is told when a session needs attention: its agent exited or
+	// waits for input, or its verification failed
+	Notifier notify.Notifier
+	// OnNotifyError receives notifications that could not be delivered
+	OnNotifyError func(error)
+}
+
+// Server serves the API and dashboard
+type Server struct {
+	manager      *worktree.Manager
+	token        string
+	daemon       func(ctx context.Context) *daemon.Client
+	pollInterval time.Duration
+	notifier     notify.Notifier
+	onNotifyErr  func(error)
+}
+
+// New creates a server for the repository described by cfg
+func New(cfg config.Config, opts Options) *Server {
+	s := &Server{
+		manager:      worktree.NewManager(cfg),
+		token:        opts.Token,
+		daemon:       opts.Daemon,
+		pollInterval: opts.PollInterval,
+		notifier:     opts.Notifier,
+		onNotifyErr:  opts.OnNotifyError,
+	}
+	if s.daemon == nil {
+		s.daemon = func(context.Context) *daemon.Client { return nil }
+	}
+	if s.pollInterval <= 0 {
+		s.pollInterval = DefaultPollInterval
+	}
+	return s
+}
+
+// Serve handles requests on l until ctx is canceled
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	srv := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		// Streams end with ctx so shutting down does not wait for them
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	if s.notifier != nil {
+		go notify.NewWatcher(s.notifier, s.onNotifyErr).Watch(ctx, s.pollInterval, s.manager.ListAgents)
+	}
+
+	if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Handler returns the authenticated HTTP handler of the API and dashboard
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleIndex)
+	mux.HandleFunc("GET /api/sessions", s.handleList)
+	mux.HandleFunc("GET /api/sessions/{name}", s.handleStatus)
+	mux.HandleFunc("GET /api/sessions/{name}/diff", s.handleDiff)
+	mux.HandleFunc("GET /api/sessions/{name}/logs", s.handleLogs)
+	mux.HandleFunc("GET /api/sessions/{name}/output", s.handleOutput)
+	mux.HandleFunc("POST /api/sessions/{name}/verify", s.handleVerify)
+	mux.HandleFunc("POST /api/sessions/{name}/merge", s.handleMerge)
+	mux.HandleFunc("POST /api/sessions/{name}/archive", s.handleArchive)
+	mux.HandleFunc("GET /api/events", s.handleEvents)
+	return s.authenticate(mux)
+}
+
+// SessionStatus describes a session and its uncommitted changes
+type SessionStatus struct {
+	daemon.Session
+	Files []FileStatus `json:"files"`
+}
+
+// FileStatus is an uncommitted change in a session worktree
+type FileStatus struct {
+	// Code is the two letter status code of git status --porcelain
+	Code string `json:"code"`
+	Path string `json:"path"`
+}
+
+// VerifyResult is the outcome of running the verify command in a session
+type VerifyResult struct {
+	Command    string `json:"command"`
+	Passed     bool   `json:"passed"`
+	ExitCode   int    `json:"exit_code"`
+	Output     string `json:"output"`
+	DurationMS int64  `json:"duration_ms"`
+}
+
+// ArchiveResult describes where an archived session's commits are kept
+type ArchiveResult struct {
+	Ref string `json:"ref"`
+}
+
+// errorResponse is the body of failed requests
+type errorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	page, err := static.ReadFile("static/index.html")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write(page)
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	sessions, err := s.sessions(r.Context(), s.manager.List)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, sessions)
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	status, err := s.manager.Status(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	result := SessionStatus{
+		Session: s.supervised(r.Context(), status.Session),
+		Files:   make([]FileStatus, 0, len(status.Files)),
+	}
+	for _, f := range status.Files {
+		result.Files = append(result.Files, FileStatus{Code: f.Code, Path: f.Path})
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handleDiff(w http.ResponseWriter, r *http.Request) {
+	diff, err := s.manager.Diff(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(diff))
+}
+
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	client := s.daemon(r.Context())
+	if client == nil {
+		writeError(w, errNoDaemon)
+		return
+	}
+	output, err := client.Logs(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(output)
+}
+
+// handleOutput streams the output of a running agent as server-sent events:
+// "output" events carry text as a JSON string and "exit" describes the
+// session once the agent exits
+func (s *Server) handleOutput(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	details, err := s.manager.Find(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	client := s.daemon(ctx)
+	if client == nil {
+		writeError(w, errNoDaemon)
+		return
+	}
+
+	// Replay recent output first so the viewer does not start blank
+	backlog, err := client.Logs(ctx, details.Name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	// Zero rows and columns attach without resizing the agent's terminal
+	conn, err := client.Attach(ctx, details.Name, 0, 0)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer func() { _ = conn.Close() }()
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	stream := newEventStream(w)
+	buf := make([]byte, 32*1024)
+	pending := copy(buf, backlog[max(0, len(backlog)-len(buf)):])
+	for {
+		// Runes split across reads are held back until they are complete
+		end := completeRunes(buf[:pending])
+		if end > 0 {
+			if err := stream.send("output", string(buf[:end])); err != nil {
+				return
+			}
+		}
+		pending = copy(buf, buf[end:pending])
+
+		n, err := conn.Read(buf[pending:])
+		pending += n
+		if err != nil {
+			break
+		}
+	}
+	if pending > 0 {
+		_ = stream.send("output", string(buf[:pending]))
+	}
+
+	if ctx.Err() == nil {
+		sessions, _ := client.List(context.WithoutCancel(ctx))
+		exited := daemon.Session{Name: details.Name, Branch: details.Branch, Path: details.Path}
+		for _, session := range sessions {
+			if session.Name == details.Name {
+				exited = session
+			}
+		}
+		_ = stream.send("exit", exited)
+	}
+}
+
+func (s *Server) handleVerify(w http.ResponseWriter, r *http.Request) {
+	result, err := s.manager.Verify(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if !result.Passed {
+		s.notifyVerifyFailed(r.Context(), r.PathValue("name"), result)
+	}
+	writeJSON(w, http.StatusOK, VerifyResult{
+		Command:    result.Command,
+		Passed:     result.Passed,
+		ExitCode:   result.ExitCode,
+		Output:     result.Output,
+		DurationMS: result.Duration.Milliseconds(),
+	})
+}
+
+// notifyVerifyFailed tells the notifier that a session failed verification.
+// Slow notifiers do not hold up the response.
+func (s *Server) notifyVerifyFailed(ctx context.Context, name string, result worktree.VerifyResult) {
+	if s.notifier == nil {
+		return
+	}
+	n := notify.Notification{
+		Kind:    notify.KindVerifyFailed,
+		Session: name,
+		Message: fmt.Sprintf("Verification failed: %s exited with %d", result.Command, result.ExitCode),
+		Time:    time.Now(),
+	}
+	if details, err := s.manager.Find(name); err == nil {
+		n.Session, n.Branch, n.Path = details.Name, details.Branch, details.Path
+	}
+	go func() {
+		if err := s.notifier.Notify(context.WithoutCancel(ctx), n); err != nil && s.onNotifyErr != nil {
+			s.onNotifyErr(err)
+		}
+	}()
+}
+
+func (s *Server) handleMerge(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := s.manager.Merge(r.Context(), name); err != nil {
+		writeError(w, err)
+		return
+	}
+	status, err := s.manager.Status(r.Context(), name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.supervised(r.Context(), status.Session))
+}
+
+func (s *Server) handleArchive(w http.ResponseWriter, r *http.Request) {
+	ref, err := s.manager.Archive(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ArchiveResult{Ref: ref})
+}
+
+// handleEvents streams the session list as "sessions" events, once on
+// connect and again whenever it changes. Changes are counted every
+// changesInterval and carried over in between.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	stream := newEventStream(w)
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	var (
+		last    []byte
+		changes map[string]int
+		counted time.Time
+	)
+	for {
+		count := changes == nil || time.Since(counted) >= changesInterval
+		list := s.manager.ListAgents
+		if count {
+			list = s.manager.List
+		}
+		sessions, err := s.sessions(ctx, list)
+		switch {
+		case err == nil && count:
+			changes = make(map[string]int, len(sessions))
+			for _, session := range sessions {
+				changes[session.Name] = session.Changes
+			}
+			counted = time.Now()
+		case err == nil:
+			for i := range sessions {
+				sessions[i].Changes = changes[sessions[i].Name]
+			}
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := stream.send("error", errorResponse{Error: err.Error()}); err != nil {
+				return
+			}
+		} else if data, err := json.Marshal(sessions); err == nil && !bytes.Equal(data, last) {
+			last = data
+			if err := stream.sendRaw("sessions", data); err != nil {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sessions lists all sessions with list and adds the supervision state of
+// the daemon
+func (s *Server) sessions(ctx context.Context, list func(context.Context) ([]worktree.Session, error)) ([]daemon.Session, error) {
+	sessions, err := list(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	supervised := map[string]daemon.Session{}
+	if client := s.daemon(ctx); client != nil {
+		if list, err := client.List(ctx); err == nil {
+			for _, session := range list {
+				supervised[session.Name] = session
+			}
+		}
+	}
+
+	result := make([]daemon.Session, 0, len(sessions))
+	for _, ws := range sessions {
+		result = append(result, combine(ws, supervised[ws.Name]))
+	}
+	return result, nil
+}
+
+// supervised adds the supervision state of the daemon to a single session
+func (s *Server) supervised(ctx context.Context, ws worktree.Session) daemon.Session {
+	var state daemon.Session
+	if client := s.daemon(ctx); client != nil {
+		if list, err := client.List(ctx); err == nil {
+			for _, session := range list {
+				if session.Name == ws.Name {
+					state = session
+				}
+			}
+		}
+	}
+	return combine(ws, state)
+}
+
+// combine combines a session with the daemon's view of it. Agents the
+// daemon did not start are described by what the session recorded.
+func combine(ws worktree.Session, state daemon.Session) daemon.Session {
+	session := daemon.Session{
+		Name:      ws.Name,
+		Branch:    ws.Branch,
+		Path:      ws.Path,
+		Locked:    ws.Locked,
+		Changes:   ws.Changes,
+		State:     string(ws.Agent.State),
+		Running:   state.Running,
+		PID:       state.PID,
+		StartedAt: state.StartedAt,
+		ExitError: state.ExitError,
+		Resources: daemon.NewResources(ws.Agent.Resources),
+	}
+	if state.Resources != nil {
+		session.Resources = state.Resources
+	}
+	if state.State != "" {
+		session.State = state.State
+	}
+	if session.PID == 0 && ws.Agent.PID != 0 {
+		startedAt := ws.Agent.StartedAt
+		session.PID, session.StartedAt = ws.Agent.PID, &startedAt
+	}
+	if !ws.Agent.LastOutputAt.IsZero() {
+		lastOutputAt := ws.Agent.LastOutputAt
+		session.LastOutputAt = &lastOutputAt
+	}
+	return session
+}
+
+// completeRunes returns the length of p without a trailing incomplete rune
+func completeRunes(p []byte) int {
+	for i := len(p) - 1; i >= 0 && i >= len(p)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(p[i]) {
+			if utf8.FullRune(p[i:]) {
+				return len(p)
+			}
+			return i
+		}
+	}
+	return len(p)
+}
+
+// eventStream writes server-sent events
+type eventStream struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func newEventStream(w http.ResponseWriter) *eventStream {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	stream := &eventStream{w: w, rc: http.NewResponseController(w)}
+	_ = stream.rc.Flush()
+	return stream
+}
+
+// send writes an event with v encoded as JSON
+func (e *eventStream) send(event string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return e.sendRaw(event, data)
+}
+
+// sendRaw writes an event with data that must not contain newlines
+func (e *eventStream) sendRaw(event string, data []byte) error {
+	if _, err := fmt.Fprintf(e.w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+		return err
+	}
+	return e.rc.Flush()
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError maps err to an HTTP status and error code
+func writeError(w http.ResponseWriter, err error) {
+	resp := errorResponse{Error: err.Error()}
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, worktree.ErrNotFound):
+		status, resp.Code = http.StatusNotFound, "not_found"
+	case errors.Is(err, worktree.ErrAmbiguous):
+		status, resp.Code = http.StatusBadRequest, "ambiguous"
+	case errors.Is(err, worktree.ErrNotRepository):
+		status, resp.Code = http.StatusBadRequest, "not_repository"
+	case errors.Is(err, worktree.ErrNoVerifyCommand):
+		status, resp.Code = http.StatusConflict, "no_verify_command"
+	case errors.Is(err, worktree.ErrUncommittedChanges):
+		status, resp.Code = http.StatusConflict, "uncommitted_changes"
+	case errors.Is(err, worktree.ErrAgentRunning):
+		status, resp.Code = http.StatusConflict, "running"
+	case errors.Is(err, worktree.ErrLocked):
+		status, resp.Code = http.StatusConflict, "locked"
+	case errors.Is(err, daemon.ErrAgentStopped):
+		status, resp.Code = http.StatusConflict, "not_running"
+	case errors.Is(err, worktree.ErrQuotaExceeded):
+		status, resp.Code = http.StatusInsufficientStorage, "quota_exceeded"
+	}
+	writeJSON(w, status, resp)
+}
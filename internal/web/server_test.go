@@ -0,0 +1,425 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/daemon"
+	"github.com/enriikke/claude-mux/internal/notify"
+	"github.com/enriikke/claude-mux/internal/worktree"
+)
+
+const testToken = "secret"
+
+// runGit runs a git command in dir and fails the test on error
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Failed to run git %v: %v\n%s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func setupTestRepo(t *testing.T) string {
+	t.Helper()
+	tmpDir := t.TempDir()
+
+	runGit(t, tmpDir, "init")
+	runGit(t, tmpDir, "config", "user.email", "test@example.com")
+	runGit(t, tmpDir, "config", "user.name", "Test User")
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "test.txt"), []byte("test"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	runGit(t, tmpDir, "add", ".")
+	runGit(t, tmpDir, "commit", "-m", "initial")
+
+	return tmpDir
+}
+
+// testServer is a dashboard server for a new test repository
+type testServer struct {
+	*httptest.Server
+	cfg config.Config
+	// daemon is set when the server was started with a daemon
+	daemon *daemon.Client
+}
+
+// startServer serves the API for a new test repository. With a non-empty
+// agent script a daemon is started too and runs it for new sessions.
+func startServer(t *testing.T, agent string) *testServer {
+	t.Helper()
+	ts := &testServer{cfg: config.Config{
+		RepoDir:          setupTestRepo(t),
+		WorktreeBasePath: ".claude-mux-test",
+		VerifyCommand:    "echo verified",
+		StopTimeout:      time.Second,
+	}}
+	if agent != "" {
+		ts.daemon = startDaemon(t, ts.cfg, agent)
+	}
+
+	server := New(ts.cfg, Options{
+		Token:        testToken,
+		Daemon:       func(context.Context) *daemon.Client { return ts.daemon },
+		PollInterval: 10 * time.Millisecond,
+	})
+	ts.Server = httptest.NewServer(server.Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func startDaemon(t *testing.T, cfg config.Config, agent string) *daemon.Client {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("background agents need a pseudo terminal")
+	}
+
+	script := filepath.Join(t.TempDir(), "agent.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"+agent), 0755); err != nil {
+		t.Fatalf("Failed to write agent script: %v", err)
+	}
+	cfg.ClaudeCommand = script
+	server := daemon.New(cfg, log.New(io.Discard, "", 0))
+
+	socket := filepath.Join(t.TempDir(), "run", "d.sock")
+	l, err := daemon.Listen(socket)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ctx, l)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-served
+	})
+
+	client, err := daemon.Dial(context.Background(), socket)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	return client
+}
+
+// createSession creates a session without an agent
+func (ts *testServer) createSession(t *testing.T, name string) worktree.WorktreeDetails {
+	t.Helper()
+	details, err := worktree.NewManager(ts.cfg).Create(context.Background(), worktree.CreateOptions{Name: name})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	return details
+}
+
+// request sends an authenticated request and returns the response and body
+func (ts *testServer) request(t *testing.T, method, path string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL+path, nil)
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s error = %v", method, path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	return resp, string(body)
+}
+
+// stream opens a server-sent event stream
+func (ts *testServer) stream(t *testing.T, path string) *bufio.Reader {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+path, nil)
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatalf("GET %s error = %v", path, err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s status = %d", path, resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("GET %s Content-Type = %q", path, got)
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// readEvent reads the next server-sent event
+func readEvent(t *testing.T, r *bufio.Reader) (event, data string) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && event != "":
+			return event, data
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func decode[T any](t *testing.T, body string) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		t.Fatalf("Failed to decode %q: %v", body, err)
+	}
+	return v
+}
+
+func TestServer_Sessions(t *testing.T) {
+	t.Parallel()
+
+	ts := startServer(t, "")
+	details := ts.createSession(t, "task")
+	if err := os.WriteFile(filepath.Join(details.Path, "new.txt"), []byte("new"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	resp, body := ts.request(t, http.MethodGet, "/api/sessions")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /api/sessions status = %d: %s", resp.StatusCode, body)
+	}
+	sessions := decode[[]daemon.Session](t, body)
+	if len(sessions) != 1 || sessions[0].Name != details.Name || sessions[0].Changes != 1 || sessions[0].State != "idle" {
+		t.Errorf("Expected one idle session with one change, got %+v", sessions)
+	}
+
+	resp, body = ts.request(t, http.MethodGet, "/api/sessions/task")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET status = %d: %s", resp.StatusCode, body)
+	}
+	status := decode[SessionStatus](t, body)
+	if status.Branch != details.Branch || len(status.Files) != 1 || status.Files[0].Path != "new.txt" {
+		t.Errorf("Expected status with new.txt, got %+v", status)
+	}
+
+	resp, body = ts.request(t, http.MethodGet, "/api/sessions/missing")
+	if resp.StatusCode != http.StatusNotFound || decode[errorResponse](t, body).Code != "not_found" {
+		t.Errorf("Expected 404 for an unknown session, got %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestServer_DiffMergeArchive(t *testing.T) {
+	t.Parallel()
+
+	ts := startServer(t, "")
+	details := ts.createSession(t, "feature")
+	if err := os.WriteFile(filepath.Join(details.Path, "feature.txt"), []byte("feature line\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	// Archiving destroys the worktree, so a partial name is not enough
+	resp, body := ts.request(t, http.MethodPost, "/api/sessions/feature/archive")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected archive to refuse a partial name, got %d: %s", resp.StatusCode, body)
+	}
+
+	resp, body = ts.request(t, http.MethodPost, "/api/sessions/"+details.Name+"/archive")
+	if resp.StatusCode != http.StatusConflict || decode[errorResponse](t, body).Code != "uncommitted_changes" {
+		t.Errorf("Expected archive to refuse uncommitted changes, got %d: %s", resp.StatusCode, body)
+	}
+
+	runGit(t, details.Path, "add", ".")
+	runGit(t, details.Path, "commit", "-m", "add feature")
+
+	resp, body = ts.request(t, http.MethodGet, "/api/sessions/feature/diff")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "+feature line") {
+		t.Errorf("Expected the diff to contain the new line, got %d: %s", resp.StatusCode, body)
+	}
+
+	resp, body = ts.request(t, http.MethodPost, "/api/sessions/feature/merge")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("merge status = %d: %s", resp.StatusCode, body)
+	}
+	if _, err := os.Stat(filepath.Join(ts.cfg.RepoDir, "feature.txt")); err != nil {
+		t.Errorf("Expected feature.txt to be merged: %v", err)
+	}
+
+	commit := runGit(t, ts.cfg.RepoDir, "rev-parse", details.Branch)
+	resp, body = ts.request(t, http.MethodPost, "/api/sessions/"+details.Name+"/archive")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("archive status = %d: %s", resp.StatusCode, body)
+	}
+	result := decode[ArchiveResult](t, body)
+	if got := runGit(t, ts.cfg.RepoDir, "rev-parse", result.Ref); got != commit {
+		t.Errorf("Expected %s to point at %s, got %s", result.Ref, commit, got)
+	}
+	if _, err := os.Stat(details.Path); !os.IsNotExist(err) {
+		t.Errorf("Expected the worktree to be removed, Stat() error = %v", err)
+	}
+}
+
+func TestServer_Verify(t *testing.T) {
+	t.Parallel()
+
+	ts := startServer(t, "")
+	ts.createSession(t, "task")
+
+	resp, body := ts.request(t, http.MethodPost, "/api/sessions/task/verify")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("verify status = %d: %s", resp.StatusCode, body)
+	}
+	result := decode[VerifyResult](t, body)
+	if !result.Passed || !strings.Contains(result.Output, "verified") {
+		t.Errorf("Expected verify to pass, got %+v", result)
+	}
+}
+
+func TestServer_VerifyFailed(t *testing.T) {
+	t.Parallel()
+
+	var recorder notify.Recorder
+	ts := &testServer{cfg: config.Config{
+		RepoDir:          setupTestRepo(t),
+		WorktreeBasePath: ".claude-mux-test",
+		VerifyCommand:    "echo broken && exit 2",
+	}}
+	ts.Server = httptest.NewServer(New(ts.cfg, Options{Token: testToken, Notifier: &recorder}).Handler())
+	t.Cleanup(ts.Close)
+	details := ts.createSession(t, "task")
+
+	resp, body := ts.request(t, http.MethodPost, "/api/sessions/task/verify")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("verify status = %d: %s", resp.StatusCode, body)
+	}
+	if result := decode[VerifyResult](t, body); result.Passed || result.ExitCode != 2 {
+		t.Errorf("Expected verify to fail with exit code 2, got %+v", result)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(recorder.Notifications()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	got := recorder.Notifications()
+	if len(got) != 1 || got[0].Kind != notify.KindVerifyFailed || got[0].Session != details.Name || got[0].Path != details.Path {
+		t.Errorf("Expected a verify failure notification about %s, got %+v", details.Name, got)
+	}
+}
+
+func TestServer_WithoutDaemon(t *testing.T) {
+	t.Parallel()
+
+	ts := startServer(t, "")
+	ts.createSession(t, "task")
+
+	for _, path := range []string{"/api/sessions/task/logs", "/api/sessions/task/output"} {
+		resp, body := ts.request(t, http.MethodGet, path)
+		if resp.StatusCode != http.StatusConflict || decode[errorResponse](t, body).Code != "not_running" {
+			t.Errorf("GET %s = %d: %s, want 409 not_running", path, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestServer_Events(t *testing.T) {
+	t.Parallel()
+
+	ts := startServer(t, "")
+	events := ts.stream(t, "/api/events")
+
+	event, data := readEvent(t, events)
+	if event != "sessions" || data != "[]" {
+		t.Fatalf("Expected an empty session list first, got %s %s", event, data)
+	}
+
+	details := ts.createSession(t, "task")
+	event, data = readEvent(t, events)
+	sessions := decode[[]daemon.Session](t, data)
+	if event != "sessions" || len(sessions) != 1 || sessions[0].Name != details.Name {
+		t.Errorf("Expected the new session to be streamed, got %s %s", event, data)
+	}
+}
+
+func TestServer_Output(t *testing.T) {
+	t.Parallel()
+
+	ts := startServer(t, "echo started\nsleep 1\necho finished\n")
+	session, err := ts.daemon.Create(context.Background(), daemon.CreateRequest{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	events := ts.stream(t, "/api/sessions/task/output")
+	var output strings.Builder
+	for {
+		event, data := readEvent(t, events)
+		if event == "exit" {
+			exited := decode[daemon.Session](t, data)
+			if exited.Name != session.Name || exited.Running {
+				t.Errorf("Expected the exit event to describe the stopped session, got %+v", exited)
+			}
+			break
+		}
+		if event != "output" {
+			t.Fatalf("Unexpected event %s %s", event, data)
+		}
+		output.WriteString(decode[string](t, data))
+	}
+
+	for _, want := range []string{"started", "finished"} {
+		if !strings.Contains(output.String(), want) {
+			t.Errorf("Expected output to contain %q, got %q", want, output.String())
+		}
+	}
+}
+
+func TestCompleteRunes(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		input []byte
+		want  int
+	}{
+		{"empty", nil, 0},
+		{"ascii", []byte("hello"), 5},
+		{"complete rune", []byte("hi 🐙"), 7},
+		{"split rune", []byte("hi 🐙")[:5], 3},
+		{"invalid bytes", []byte{'a', 0xff}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := completeRunes(tt.input); got != tt.want {
+				t.Errorf("completeRunes(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+		})
+	}
+}
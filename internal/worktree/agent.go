@@ -0,0 +1,248 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+// TermSize is the size of the terminal a detached agent renders into
+type TermSize struct {
+	Rows uint16
+	Cols uint16
+}
+
+// defaultTermSize is used when a detached agent is started without a size
+var defaultTermSize = TermSize{Rows: 24, Cols: 80}
+
+// Agent is an agent process running in the background under a pseudo
+// terminal. Its output is read and its input written through the Agent.
+type Agent struct {
+	details   WorktreeDetails
+	cmd       *exec.Cmd
+	pty       *os.File
+	startedAt time.Time
+	timeout   time.Duration
+	manager   *Manager
+	// log records the output, nil when logging is disabled
+	log *sessionLog
+
+	stopOnce sync.Once
+	exited   chan struct{}
+	done     chan struct{}
+	err      error
+}
+
+// Start runs the agent of an existing session in the background. Canceling
+// ctx stops the agent.
+func (m *Manager) Start(ctx context.Context, name string, size TermSize) (*Agent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	details, err := m.Find(name)
+	if err != nil {
+		return nil, err
+	}
+	return m.startAgent(ctx, details, size, nil, func() error { return nil })
+}
+
+// CreateAndStart creates a new session and runs its agent in the
+// background. Post-exit processing such as cleanup runs once the agent
+// exits. Canceling ctx stops the agent.
+func (m *Manager) CreateAndStart(ctx context.Context, opts CreateOptions, size TermSize) (*Agent, error) {
+	details, err := m.Create(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	run := m.beginRun(details, opts)
+	agent, err := m.startAgent(ctx, details, size, agentArgs(opts), func() error {
+		return m.afterExit(details, opts, run)
+	})
+	if err != nil {
+		_ = m.afterExit(details, opts, run)
+		return nil, err
+	}
+	return agent, nil
+}
+
+// startAgent launches the agent with args under a new pseudo terminal and
+// supervises it until it exits, then runs finish
+func (m *Manager) startAgent(ctx context.Context, details WorktreeDetails, size TermSize, args []string, finish func() error) (*Agent, error) {
+	if size.Rows == 0 || size.Cols == 0 {
+		size = defaultTermSize
+	}
+
+	m.emit(sessionEvent(EventLaunching, details))
+
+	// The pseudo terminal makes the agent a session and process group
+	// leader, so it can be stopped with all of its children
+	cmd, release, err := m.isolation.command(details, true, args)
+	if err != nil {
+		return nil, err
+	}
+	log := m.openSessionLog(details, size)
+	cgroup := m.isolation.limit(details, cmd)
+	tty, err := pty.StartWithSize(cmd, &pty.Winsize{Rows: size.Rows, Cols: size.Cols})
+	cgroup.release(err == nil)
+	if err != nil {
+		release()
+		if log != nil {
+			_ = log.Close()
+		}
+		return nil, fmt.Errorf("failed to launch Claude: %w", err)
+	}
+
+	a := &Agent{
+		details:   details,
+		cmd:       cmd,
+		pty:       tty,
+		startedAt: time.Now(),
+		timeout:   m.stopTimeout(),
+		manager:   m,
+		log:       log,
+		exited:    make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	m.recordAgentStart(details, cmd.Process.Pid, cgroup)
+	stopCheckpoints := m.watchCheckpoints(details)
+	go func() {
+		err := cmd.Wait()
+		release()
+		m.recordAgentExit(details)
+		stopCheckpoints()
+		if err != nil && !m.stopRequested(details, cmd.Process.Pid) {
+			err = fmt.Errorf("agent exited: %w", err)
+		}
+		a.err = err
+		close(a.exited)
+
+		exited := sessionEvent(EventExited, details)
+		exited.Err = err
+		m.emit(exited)
+
+		if err := finish(); err != nil && a.err == nil {
+			a.err = err
+		}
+		close(a.done)
+	}()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			a.stop(ctx.Err())
+		case <-a.exited:
+		}
+	}()
+
+	return a, nil
+}
+
+// Session returns the session the agent runs in
+func (a *Agent) Session() WorktreeDetails {
+	return a.details
+}
+
+// PID returns the process ID of the agent
+func (a *Agent) PID() int {
+	return a.cmd.Process.Pid
+}
+
+// StartedAt returns when the agent was started
+func (a *Agent) StartedAt() time.Time {
+	return a.startedAt
+}
+
+// Read reads output of the agent, recording it in the session log. It
+// fails once the agent exited and its output was drained.
+func (a *Agent) Read(p []byte) (int, error) {
+	n, err := a.pty.Read(p)
+	if n > 0 && a.log != nil {
+		_, _ = a.log.Write(p[:n])
+	}
+	return n, err
+}
+
+// Write sends input to the agent
+func (a *Agent) Write(p []byte) (int, error) {
+	return a.pty.Write(p)
+}
+
+// Resize changes the size of the agent's terminal
+func (a *Agent) Resize(size TermSize) error {
+	if err := pty.Setsize(a.pty, &pty.Winsize{Rows: size.Rows, Cols: size.Cols}); err != nil {
+		return err
+	}
+	if a.log != nil {
+		a.log.resize(size)
+	}
+	return nil
+}
+
+// Done is closed once the agent exited and post-exit processing finished
+func (a *Agent) Done() <-chan struct{} {
+	return a.done
+}
+
+// Err returns why the agent or its post-exit processing failed. It is only
+// valid once Done is closed.
+func (a *Agent) Err() error {
+	return a.err
+}
+
+// Running reports whether the agent process is still alive
+func (a *Agent) Running() bool {
+	select {
+	case <-a.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// Stop asks the agent to exit, first like Ctrl-C and then with SIGTERM,
+// kills it if it is still running after the stop timeout and waits for
+// post-exit processing
+func (a *Agent) Stop() {
+	a.stop(errors.New("stop requested"))
+	<-a.done
+}
+
+// Close releases the agent's terminal and finishes the session log. Call it
+// once the output was drained.
+func (a *Agent) Close() error {
+	err := a.pty.Close()
+	if a.log != nil {
+		err = errors.Join(err, a.log.Close())
+	}
+	return err
+}
+
+// stop asks the agent to exit once, escalating to a kill after the timeout
+func (a *Agent) stop(reason error) {
+	a.stopOnce.Do(func() {
+		if !a.Running() {
+			return
+		}
+
+		stopping := sessionEvent(EventStopping, a.details)
+		stopping.Message = reason.Error()
+		a.manager.emit(stopping)
+		a.manager.stopProcess(a.details, a.PID(), func(d time.Duration) bool {
+			select {
+			case <-a.exited:
+				return true
+			case <-time.After(d):
+				return false
+			}
+		})
+	})
+}
@@ -0,0 +1,115 @@
+package worktree
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AutocommitPolicy decides how the work an agent leaves behind in its
+// worktree is committed once it exits
+type AutocommitPolicy string
+
+const (
+	// AutocommitOff leaves the worktree as the agent left it
+	AutocommitOff AutocommitPolicy = "off"
+	// AutocommitWIP commits uncommitted changes on top of the agent's own commits
+	AutocommitWIP AutocommitPolicy = "wip"
+	// AutocommitSquash replaces the commits made during the run and any
+	// uncommitted changes with a single commit
+	AutocommitSquash AutocommitPolicy = "squash"
+)
+
+// maxSubjectLength bounds the subject line of generated commit messages
+const maxSubjectLength = 72
+
+// ParseAutocommitPolicy parses a policy name. An empty name means off.
+func ParseAutocommitPolicy(s string) (AutocommitPolicy, error) {
+	switch p := AutocommitPolicy(s); p {
+	case "", AutocommitOff:
+		return AutocommitOff, nil
+	case AutocommitWIP, AutocommitSquash:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid autocommit policy %q, want off, wip or squash", s)
+	}
+}
+
+// enabled reports whether the policy commits anything
+func (p AutocommitPolicy) enabled() bool {
+	return p != "" && p != AutocommitOff
+}
+
+// agentRun describes one run of an agent for post-exit processing
+type agentRun struct {
+	startedAt time.Time
+	// head is the commit checked out when the agent started, only
+	// resolved when the work is squashed
+	head    string
+	headErr error
+}
+
+// beginRun records the state of a session worktree before its agent starts
+func (m *Manager) beginRun(details WorktreeDetails, opts CreateOptions) agentRun {
+	run := agentRun{startedAt: time.Now()}
+	if opts.Autocommit == AutocommitSquash {
+		run.head, run.headErr = m.git.Head(details.Path)
+	}
+	return run
+}
+
+// autocommit commits everything the agent left in its worktree according
+// to the session's policy
+func (m *Manager) autocommit(details WorktreeDetails, opts CreateOptions, run agentRun) error {
+	if !opts.Autocommit.enabled() {
+		return nil
+	}
+	if opts.Autocommit == AutocommitSquash {
+		if run.headErr != nil {
+			return fmt.Errorf("failed to resolve the commit the agent started from: %w", run.headErr)
+		}
+		if err := m.git.ResetSoft(details.Path, run.head); err != nil {
+			return err
+		}
+	}
+
+	message := commitMessage(details, opts, time.Since(run.startedAt))
+	committed, err := m.git.CommitAll(details.Path, message)
+	if err != nil {
+		return err
+	}
+	if committed {
+		event := sessionEvent(EventCommitted, details)
+		event.Message = string(opts.Autocommit)
+		m.emit(event)
+	}
+	return nil
+}
+
+// commitMessage describes the work of an agent run. The subject is the
+// first line of the prompt, the body records the full prompt, the session
+// and how long the agent ran.
+func commitMessage(details WorktreeDetails, opts CreateOptions, duration time.Duration) string {
+	prompt := strings.TrimSpace(opts.Prompt)
+
+	subject, _, _ := strings.Cut(prompt, "\n")
+	subject = strings.TrimSpace(subject)
+	if subject == "" {
+		subject = "Work from claude-mux session " + details.Name
+	}
+	if opts.Autocommit == AutocommitWIP {
+		subject = "WIP: " + subject
+	}
+	if runes := []rune(subject); len(runes) > maxSubjectLength {
+		subject = string(runes[:maxSubjectLength-1]) + "…"
+	}
+
+	var b strings.Builder
+	b.WriteString(subject + "\n\n")
+	if prompt != "" {
+		b.WriteString("Prompt:\n" + prompt + "\n\n")
+	}
+	fmt.Fprintf(&b, "Session: %s\n", details.Name)
+	fmt.Fprintf(&b, "Duration: %s\n", duration.Round(time.Second))
+	return b.String()
+}
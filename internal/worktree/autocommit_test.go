@@ -0,0 +1,195 @@
+package worktree
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/git"
+	"github.com/enriikke/claude-mux/internal/git/gitfake"
+)
+
+func TestParseAutocommitPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input   string
+		want    AutocommitPolicy
+		wantErr bool
+	}{
+		{"", AutocommitOff, false},
+		{"off", AutocommitOff, false},
+		{"wip", AutocommitWIP, false},
+		{"squash", AutocommitSquash, false},
+		{"always", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseAutocommitPolicy(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseAutocommitPolicy(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestCommitMessage(t *testing.T) {
+	t.Parallel()
+
+	details := WorktreeDetails{Name: "task-1a2b3c"}
+	tests := []struct {
+		name        string
+		opts        CreateOptions
+		wantSubject string
+		wantBody    []string
+	}{
+		{
+			name:        "prompt",
+			opts:        CreateOptions{Prompt: "Fix the login bug\nIt fails on empty passwords", Autocommit: AutocommitSquash},
+			wantSubject: "Fix the login bug",
+			wantBody:    []string{"Prompt:\nFix the login bug\nIt fails on empty passwords", "Session: task-1a2b3c", "Duration: 1m30s"},
+		},
+		{
+			name:        "wip without prompt",
+			opts:        CreateOptions{Autocommit: AutocommitWIP},
+			wantSubject: "WIP: Work from claude-mux session task-1a2b3c",
+			wantBody:    []string{"Session: task-1a2b3c", "Duration: 1m30s"},
+		},
+		{
+			name:        "long prompt",
+			opts:        CreateOptions{Prompt: strings.Repeat("a", 100), Autocommit: AutocommitSquash},
+			wantSubject: strings.Repeat("a", maxSubjectLength-1) + "…",
+			wantBody:    []string{"Prompt:\n" + strings.Repeat("a", 100)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			message := commitMessage(details, tt.opts, 90*time.Second+200*time.Millisecond)
+			subject, body, _ := strings.Cut(message, "\n\n")
+			if subject != tt.wantSubject {
+				t.Errorf("Subject = %q, want %q", subject, tt.wantSubject)
+			}
+			for _, want := range tt.wantBody {
+				if !strings.Contains(body, want) {
+					t.Errorf("Expected body to contain %q, got %q", want, body)
+				}
+			}
+		})
+	}
+}
+
+// simulateAgentWork makes the fake repository look like the agent changed
+// files, and committed the first of them, as soon as it is launched
+func simulateAgentWork(manager *Manager, backend *gitfake.Backend) {
+	manager.onEvent = func(e Event) {
+		if e.Type != EventLaunching {
+			return
+		}
+		backend.SetChanges(e.Path, []git.FileStatus{{Code: "??", Path: "committed.go"}})
+		_, _ = backend.CommitAll(e.Path, "Agent commit")
+		backend.SetChanges(e.Path, []git.FileStatus{{Code: " M", Path: "uncommitted.go"}})
+	}
+}
+
+func TestManager_CreateAndLaunch_Autocommit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		policy AutocommitPolicy
+		want   []string
+	}{
+		{AutocommitOff, []string{"Agent commit"}},
+		{AutocommitWIP, []string{"Agent commit", "WIP: Add a README"}},
+		{AutocommitSquash, []string{"Add a README"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			t.Parallel()
+
+			manager, backend := newFakeManager(t)
+			var stdout bytes.Buffer
+			manager.stdout, manager.stderr = &stdout, &stdout
+			simulateAgentWork(manager, backend)
+
+			details, err := manager.CreateAndLaunch(context.Background(), CreateOptions{
+				Name:       "task",
+				Prompt:     "Add a README",
+				Autocommit: tt.policy,
+			})
+			if err != nil {
+				t.Fatalf("CreateAndLaunch() error = %v", err)
+			}
+			if !strings.Contains(stdout.String(), "Add a README") {
+				t.Errorf("Expected the prompt to be passed to the agent, got output %q", stdout.String())
+			}
+
+			commits := backend.Commits(details.Branch)
+			if len(commits) != len(tt.want) {
+				t.Fatalf("Commits() = %q, want subjects %q", commits, tt.want)
+			}
+			for i, want := range tt.want {
+				if subject, _, _ := strings.Cut(commits[i], "\n"); subject != want {
+					t.Errorf("Commit %d subject = %q, want %q", i, subject, want)
+				}
+			}
+			changes, _ := backend.Status(details.Path)
+			if tt.policy != AutocommitOff && len(changes) != 0 {
+				t.Errorf("Expected no uncommitted changes after autocommit, got %v", changes)
+			}
+		})
+	}
+}
+
+func TestManager_CreateAndLaunch_AutocommitCleanupKeepsBranch(t *testing.T) {
+	t.Parallel()
+
+	manager, backend := newFakeManager(t)
+	manager.stdout, manager.stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	simulateAgentWork(manager, backend)
+
+	details, err := manager.CreateAndLaunch(context.Background(), CreateOptions{
+		Name:       "task",
+		Autocommit: AutocommitWIP,
+		Cleanup:    true,
+	})
+	if err != nil {
+		t.Fatalf("CreateAndLaunch() error = %v", err)
+	}
+	if _, err := os.Stat(details.Path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the worktree to be removed, Stat() error = %v", err)
+	}
+	if !backend.HasBranch(details.Branch) {
+		t.Error("Expected the branch with the committed work to be kept")
+	}
+}
+
+func TestManager_CreateAndLaunch_AutocommitFailureKeepsWorktree(t *testing.T) {
+	t.Parallel()
+
+	manager, backend := newFakeManager(t)
+	manager.stdout, manager.stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	simulateAgentWork(manager, backend)
+	commitErr := errors.New("no identity")
+	backend.FailOn("CommitAll", commitErr)
+
+	details, err := manager.CreateAndLaunch(context.Background(), CreateOptions{
+		Name:       "task",
+		Autocommit: AutocommitWIP,
+		Cleanup:    true,
+	})
+	if !errors.Is(err, commitErr) {
+		t.Fatalf("CreateAndLaunch() error = %v, want %v", err, commitErr)
+	}
+	if _, err := os.Stat(details.Path); err != nil {
+		t.Errorf("Expected the worktree to be kept when committing failed: %v", err)
+	}
+	if !backend.HasBranch(details.Branch) {
+		t.Error("Expected the branch to be kept when committing failed")
+	}
+}
@@ -0,0 +1,269 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/git"
+	"github.com/enriikke/claude-mux/internal/git/gitfake"
+)
+
+// newFakeManager returns a manager backed by an in-memory repository
+func newFakeManager(t *testing.T) (*Manager, *gitfake.Backend) {
+	t.Helper()
+	backend := gitfake.New(t.TempDir())
+	manager := NewManager(config.Config{
+		WorktreeBasePath: ".claude-mux",
+		ClaudeCommand:    "echo",
+	}, WithBackend(backend))
+	return manager, backend
+}
+
+func TestManager_createUniqueWorktree_RetriesOnCollision(t *testing.T) {
+	t.Parallel()
+
+	manager, backend := newFakeManager(t)
+	backend.FailOnce("CreateWorktree", &git.Error{
+		Subcommand: "worktree",
+		ExitCode:   128,
+		Stderr:     "fatal: a branch named 'claude-mux-main-task' already exists",
+	})
+
+	details, err := manager.createUniqueWorktree(context.Background(), "task")
+	if err != nil {
+		t.Fatalf("createUniqueWorktree() error = %v", err)
+	}
+	if !backend.HasBranch(details.Branch) {
+		t.Errorf("Expected branch %s to be created", details.Branch)
+	}
+
+	attempts := 0
+	for _, call := range backend.Calls() {
+		if call == "CreateWorktree" {
+			attempts++
+		}
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts to create the worktree, got %d", attempts)
+	}
+}
+
+func TestManager_createUniqueWorktree_GivesUp(t *testing.T) {
+	t.Parallel()
+
+	manager, backend := newFakeManager(t)
+	backend.FailOn("CreateWorktree", &git.Error{
+		Subcommand: "worktree",
+		ExitCode:   128,
+		Stderr:     "fatal: a branch named 'claude-mux-main-task' already exists",
+	})
+
+	_, err := manager.createUniqueWorktree(context.Background(), "task")
+	if !git.IsBranchExists(err) {
+		t.Errorf("Expected branch exists error after retries, got %v", err)
+	}
+}
+
+func TestManager_cleanup_PartialFailures(t *testing.T) {
+	t.Parallel()
+
+	t.Run("branch deletion fails after worktree removal", func(t *testing.T) {
+		t.Parallel()
+
+		manager, backend := newFakeManager(t)
+		details, err := manager.createUniqueWorktree(context.Background(), "task")
+		if err != nil {
+			t.Fatalf("createUniqueWorktree() error = %v", err)
+		}
+		backend.FailOn("DeleteBranch", errors.New("permission denied"))
+
+		if _, err := manager.Remove(context.Background(), details.Name, true); err != nil {
+			t.Fatalf("Remove() error = %v", err)
+		}
+		if _, err := os.Stat(details.Path); !os.IsNotExist(err) {
+			t.Errorf("Expected worktree directory to be removed, stat error = %v", err)
+		}
+		if !backend.HasBranch(details.Branch) {
+			t.Error("Expected branch to survive the failed deletion")
+		}
+	})
+
+	t.Run("locked worktree keeps its branch", func(t *testing.T) {
+		t.Parallel()
+
+		manager, backend := newFakeManager(t)
+		details, err := manager.createUniqueWorktree(context.Background(), "task")
+		if err != nil {
+			t.Fatalf("createUniqueWorktree() error = %v", err)
+		}
+		backend.Lock(details.Path)
+
+		if _, err := manager.Remove(context.Background(), details.Name, true); !git.IsLockedWorktree(err) {
+			t.Errorf("Expected locked worktree error, got %v", err)
+		}
+		if _, err := os.Stat(details.Path); err != nil {
+			t.Errorf("Expected locked worktree to remain: %v", err)
+		}
+		if !backend.HasBranch(details.Branch) {
+			t.Error("Expected branch of locked worktree to remain")
+		}
+		for _, call := range backend.Calls() {
+			if call == "DeleteBranch" {
+				t.Error("Expected no branch deletion for a locked worktree")
+			}
+		}
+	})
+}
+
+func TestManager_CreateAndLaunch_Fake(t *testing.T) {
+	t.Parallel()
+
+	manager, backend := newFakeManager(t)
+	if _, err := manager.CreateAndLaunch(context.Background(), CreateOptions{Name: "task", Cleanup: true}); err != nil {
+		t.Fatalf("CreateAndLaunch() error = %v", err)
+	}
+
+	worktrees, err := backend.ListWorktrees()
+	if err != nil {
+		t.Fatalf("ListWorktrees() error = %v", err)
+	}
+	if len(worktrees) != 1 {
+		t.Errorf("Expected auto-cleanup to leave only the main worktree, got %v", worktrees)
+	}
+	if got := backend.Excludes(); len(got) != 1 || got[0] != "/.claude-mux/" {
+		t.Errorf("Expected base path to be excluded, got %v", got)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(manager.root, ".claude-mux")); len(entries) != 0 {
+		t.Errorf("Expected base path to be empty, got %d entries", len(entries))
+	}
+}
+
+func TestManager_ListAgents(t *testing.T) {
+	t.Parallel()
+
+	manager, backend := newFakeManager(t)
+	ctx := context.Background()
+	details, err := manager.Create(ctx, CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	backend.SetChanges(details.Path, []git.FileStatus{{Code: " M", Path: "main.go"}})
+
+	sessions, err := manager.ListAgents(ctx)
+	if err != nil {
+		t.Fatalf("ListAgents() error = %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].Name != details.Name || sessions[0].Changes != 0 {
+		t.Errorf("Expected %s without counted changes, got %+v", details.Name, sessions)
+	}
+	if slices.Contains(backend.Calls(), "Status") {
+		t.Error("Expected ListAgents() not to run git status")
+	}
+
+	sessions, err = manager.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].Changes != 1 {
+		t.Errorf("Expected List() to count the change of %s, got %+v", details.Name, sessions)
+	}
+}
+
+func TestManager_PruneKeepsActive(t *testing.T) {
+	t.Parallel()
+
+	manager, backend := newFakeManager(t)
+	ctx := context.Background()
+	sessions := map[string]WorktreeDetails{}
+	for _, name := range []string{"running", "locked", "idle"} {
+		details, err := manager.Create(ctx, CreateOptions{Name: name})
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		sessions[name] = details
+	}
+	// Started by another claude-mux process, which prune cannot stop
+	manager.writeAgentRecord(sessions["running"], agentRecord{PID: os.Getpid(), StartedAt: time.Now()})
+	backend.Lock(sessions["locked"].Path)
+
+	for _, dryRun := range []bool{true, false} {
+		report, err := manager.Prune(ctx, dryRun, false)
+		if err != nil {
+			t.Fatalf("Prune(%v) error = %v", dryRun, err)
+		}
+		if len(report.Worktrees) != 1 || report.Worktrees[0].Name != sessions["idle"].Name {
+			t.Errorf("Prune(%v) removed %+v, want only %s", dryRun, report.Worktrees, sessions["idle"].Name)
+		}
+		kept := map[string]error{}
+		for _, k := range report.Kept {
+			kept[k.Name] = k.Err
+		}
+		if !errors.Is(kept[sessions["running"].Name], ErrAgentRunning) || !errors.Is(kept[sessions["locked"].Name], ErrLocked) || len(kept) != 2 {
+			t.Errorf("Prune(%v) kept %v, want the running and the locked session", dryRun, kept)
+		}
+	}
+	for name, details := range sessions {
+		if _, err := manager.Find(details.Name); (err == nil) != (name != "idle") {
+			t.Errorf("Expected %s to be kept: %v, Find() error = %v", name, name != "idle", err)
+		}
+	}
+}
+
+func TestManager_Find(t *testing.T) {
+	t.Parallel()
+
+	manager, _ := newFakeManager(t)
+	ctx := context.Background()
+	foo, err := manager.Create(ctx, CreateOptions{Name: "foo"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	foobar, err := manager.Create(ctx, CreateOptions{Name: "foobar"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		exact   bool
+		want    string
+		wantErr error
+	}{
+		{name: "exact name", query: foo.Name, want: foo.Name},
+		{name: "exact branch", query: foobar.Branch, exact: true, want: foobar.Name},
+		{name: "unique partial", query: "foob", want: foobar.Name},
+		{name: "ambiguous partial", query: "foo", wantErr: ErrAmbiguous},
+		{name: "partial when exact", query: "foob", exact: true, wantErr: ErrNotFound},
+		{name: "no match", query: "baz", wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			find := manager.Find
+			if tt.exact {
+				find = manager.FindExact
+			}
+			details, err := find(tt.query)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Find(%q) error = %v, want %v", tt.query, err, tt.wantErr)
+			}
+			if details.Name != tt.want {
+				t.Errorf("Find(%q) = %s, want %s", tt.query, details.Name, tt.want)
+			}
+		})
+	}
+
+	// Removing by a partial name must not pick another session
+	if _, err := manager.Remove(ctx, "foob", true); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Remove() by a partial name error = %v, want %v", err, ErrNotFound)
+	}
+	if _, err := manager.FindExact(foobar.Name); err != nil {
+		t.Errorf("Expected %s to be kept, FindExact() error = %v", foobar.Name, err)
+	}
+}
@@ -0,0 +1,314 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/git"
+)
+
+// ErrNoCheckpoint is returned when a session has no checkpoint with the given number
+var ErrNoCheckpoint = errors.New("checkpoint not found")
+
+// checkpointRefPrefix is where checkpoints are kept, one ref per checkpoint
+// under refs/claude-mux/checkpoints/<session>/<n>
+const checkpointRefPrefix = "refs/claude-mux/checkpoints/"
+
+// checkpointAttempts is how often a checkpoint is numbered anew when other
+// processes take the number first
+const checkpointAttempts = 5
+
+// Checkpoint is a snapshot of the files of a session worktree, including
+// uncommitted and untracked ones
+type Checkpoint struct {
+	Number    int
+	Commit    string
+	CreatedAt time.Time
+
+	// tree identifies the snapshotted content
+	tree string
+}
+
+// checkpointPrefix returns the ref namespace holding a session's checkpoints
+func checkpointPrefix(details WorktreeDetails) string {
+	return checkpointRefPrefix + filepath.Base(details.Name)
+}
+
+// Checkpoints returns the checkpoints of a session, oldest first
+func (m *Manager) Checkpoints(ctx context.Context, name string) ([]Checkpoint, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	details, err := m.Find(name)
+	if err != nil {
+		return nil, err
+	}
+	return m.checkpoints(details)
+}
+
+func (m *Manager) checkpoints(details WorktreeDetails) ([]Checkpoint, error) {
+	prefix := checkpointPrefix(details)
+	refs, err := m.git.ListRefs(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoints := make([]Checkpoint, 0, len(refs))
+	for _, ref := range refs {
+		number, err := strconv.Atoi(strings.TrimPrefix(ref.Name, prefix+"/"))
+		if err != nil {
+			continue
+		}
+		checkpoints = append(checkpoints, Checkpoint{
+			Number:    number,
+			Commit:    ref.Commit,
+			CreatedAt: ref.Time,
+			tree:      ref.Tree,
+		})
+	}
+	sort.Slice(checkpoints, func(i, j int) bool { return checkpoints[i].Number < checkpoints[j].Number })
+	return checkpoints, nil
+}
+
+// CreateCheckpoint snapshots the files of a session worktree without
+// touching its branch or index. It reports false and returns the latest
+// checkpoint when nothing changed since.
+func (m *Manager) CreateCheckpoint(ctx context.Context, name string) (Checkpoint, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return Checkpoint{}, false, err
+	}
+
+	details, err := m.Find(name)
+	if err != nil {
+		return Checkpoint{}, false, err
+	}
+	return m.checkpoint(details, 0)
+}
+
+// checkpoint snapshots the files of a session worktree like
+// CreateCheckpoint. Old checkpoints beyond MaxCheckpoints are deleted,
+// except checkpoint keep.
+func (m *Manager) checkpoint(details WorktreeDetails, keep int) (Checkpoint, bool, error) {
+	tree, err := m.git.WriteTree(details.Path)
+	if err != nil {
+		return Checkpoint{}, false, err
+	}
+
+	// Another process, e.g. the watcher of a running agent and a manual
+	// checkpoint, may take the same number meanwhile. Creating its ref then
+	// fails, and the next number is tried.
+	for range checkpointAttempts {
+		existing, err := m.checkpoints(details)
+		if err != nil {
+			return Checkpoint{}, false, err
+		}
+		number := 1
+		if len(existing) > 0 {
+			last := existing[len(existing)-1]
+			if last.tree == tree {
+				return last, false, nil
+			}
+			number = last.Number + 1
+		}
+
+		message := fmt.Sprintf("claude-mux checkpoint %d of %s", number, details.Name)
+		commit, err := m.git.CommitTree(details.Path, tree, message)
+		if err != nil {
+			return Checkpoint{}, false, err
+		}
+		err = m.git.CreateRef(fmt.Sprintf("%s/%d", checkpointPrefix(details), number), commit)
+		if git.IsRefExists(err) {
+			continue
+		}
+		if err != nil {
+			return Checkpoint{}, false, err
+		}
+		if err := m.pruneCheckpoints(details, existing, keep); err != nil {
+			warning := sessionEvent(EventWarning, details)
+			warning.Message = "Failed to delete old checkpoints"
+			warning.Err = err
+			m.emit(warning)
+		}
+		return Checkpoint{Number: number, Commit: commit, CreatedAt: time.Now(), tree: tree}, true, nil
+	}
+	return Checkpoint{}, false, fmt.Errorf("failed to number a checkpoint of %s, other checkpoints kept being taken", details.Name)
+}
+
+// pruneCheckpoints deletes the oldest of the existing checkpoints but keep
+// so that they and a new one fit within MaxCheckpoints
+func (m *Manager) pruneCheckpoints(details WorktreeDetails, existing []Checkpoint, keep int) error {
+	excess := len(existing) + 1 - m.maxCheckpoints()
+	if excess <= 0 {
+		return nil
+	}
+	deletable := slices.DeleteFunc(slices.Clone(existing), func(c Checkpoint) bool { return c.Number == keep })
+	var errs []error
+	for _, c := range deletable[:min(excess, len(deletable))] {
+		errs = append(errs, m.git.DeleteRef(fmt.Sprintf("%s/%d", checkpointPrefix(details), c.Number)))
+	}
+	return errors.Join(errs...)
+}
+
+// maxCheckpoints returns how many checkpoints a session keeps
+func (m *Manager) maxCheckpoints() int {
+	if m.config.MaxCheckpoints > 0 {
+		return m.config.MaxCheckpoints
+	}
+	return config.DefaultMaxCheckpoints
+}
+
+// Rollback restores the files of a session worktree to a checkpoint. The
+// current files are checkpointed first, so a rollback can be undone.
+// Commits made since the checkpoint stay on the branch.
+func (m *Manager) Rollback(ctx context.Context, name string, number int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	details, err := m.FindExact(name)
+	if err != nil {
+		return err
+	}
+	checkpoints, err := m.checkpoints(details)
+	if err != nil {
+		return err
+	}
+	var target *Checkpoint
+	for i := range checkpoints {
+		if checkpoints[i].Number == number {
+			target = &checkpoints[i]
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("%w: %s has no checkpoint %d", ErrNoCheckpoint, details.Name, number)
+	}
+
+	// The target may be the oldest checkpoint, which must outlive pruning
+	saved, created, err := m.checkpoint(details, target.Number)
+	if err != nil {
+		return fmt.Errorf("failed to checkpoint the current state: %w", err)
+	}
+	if created {
+		event := sessionEvent(EventCheckpointed, details)
+		event.Message = strconv.Itoa(saved.Number)
+		m.emit(event)
+	}
+
+	if err := m.git.RestoreTree(details.Path, target.Commit); err != nil {
+		return err
+	}
+	event := sessionEvent(EventRolledBack, details)
+	event.Message = strconv.Itoa(number)
+	m.emit(event)
+	return nil
+}
+
+// removeCheckpoints deletes all checkpoints of a session
+func (m *Manager) removeCheckpoints(details WorktreeDetails) error {
+	checkpoints, err := m.checkpoints(details)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, c := range checkpoints {
+		errs = append(errs, m.git.DeleteRef(fmt.Sprintf("%s/%d", checkpointPrefix(details), c.Number)))
+	}
+	return errors.Join(errs...)
+}
+
+// watchCheckpoints checkpoints the worktree of a running agent every
+// CheckpointInterval whenever its files changed. Snapshotting takes git to
+// hash the worktree, so it only runs once the size or modification time of
+// a file changed. The returned function stops watching after a last
+// checkpoint.
+func (m *Manager) watchCheckpoints(details WorktreeDetails) (stop func()) {
+	interval := m.config.CheckpointInterval
+	if interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		// A failing checkpoint likely keeps failing, warn only once
+		warned := false
+		var snapshotted uint64
+		take := func() {
+			fingerprint, err := worktreeFingerprint(details.Path)
+			if err == nil && fingerprint == snapshotted {
+				return
+			}
+			_, _, err = m.checkpoint(details, 0)
+			if err == nil {
+				snapshotted = fingerprint
+			} else if !warned {
+				warned = true
+				warning := sessionEvent(EventWarning, details)
+				warning.Message = "Failed to take a checkpoint"
+				warning.Err = err
+				m.emit(warning)
+			}
+		}
+
+		for {
+			select {
+			case <-ticker.C:
+				take()
+			case <-done:
+				take()
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// worktreeFingerprint hashes the path, size, mode and modification time of
+// every file in a worktree, leaving out its .git file or directory
+func worktreeFingerprint(dir string) (uint64, error) {
+	hash := fnv.New64a()
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		if path == dir {
+			return nil
+		}
+		if entry.Name() == ".git" && filepath.Dir(path) == dir {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, path)
+		fmt.Fprintf(hash, "%s\x00%d\x00%d\x00%d\n", rel, info.Size(), info.Mode(), info.ModTime().UnixNano())
+		return nil
+	})
+	return hash.Sum64(), err
+}
@@ -0,0 +1,244 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/git"
+	"github.com/enriikke/claude-mux/internal/git/gitfake"
+)
+
+func TestManager_Checkpoints(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	manager, backend := newFakeManager(t)
+	details, err := manager.Create(ctx, CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	good := []git.FileStatus{{Code: "??", Path: "feature.go"}}
+	backend.SetChanges(details.Path, good)
+	first, created, err := manager.CreateCheckpoint(ctx, details.Name)
+	if err != nil || !created || first.Number != 1 {
+		t.Fatalf("CreateCheckpoint() = %+v, %v, %v, want checkpoint 1", first, created, err)
+	}
+	if again, created, err := manager.CreateCheckpoint(ctx, details.Name); err != nil || created || again.Number != 1 {
+		t.Errorf("CreateCheckpoint() without changes = %+v, %v, %v, want checkpoint 1 again", again, created, err)
+	}
+	if _, ok := backend.Ref("refs/claude-mux/checkpoints/" + details.Name + "/1"); !ok {
+		t.Error("Expected checkpoint 1 to be kept in a hidden ref")
+	}
+
+	var events []Event
+	manager.onEvent = func(e Event) { events = append(events, e) }
+	backend.SetChanges(details.Path, []git.FileStatus{{Code: " D", Path: "main.go"}})
+	if err := manager.Rollback(ctx, details.Name, 1); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if changes, _ := backend.Status(details.Path); len(changes) != 1 || changes[0] != good[0] {
+		t.Errorf("Status() after Rollback() = %v, want %v", changes, good)
+	}
+	if len(events) != 2 || events[0].Type != EventCheckpointed || events[0].Message != "2" || events[1].Type != EventRolledBack {
+		t.Errorf("Expected the current state to be saved as checkpoint 2 before rolling back, got events %+v", events)
+	}
+
+	checkpoints, err := manager.Checkpoints(ctx, details.Name)
+	if err != nil {
+		t.Fatalf("Checkpoints() error = %v", err)
+	}
+	if len(checkpoints) != 2 || checkpoints[0].Number != 1 || checkpoints[1].Number != 2 || checkpoints[0].CreatedAt.IsZero() {
+		t.Errorf("Checkpoints() = %+v", checkpoints)
+	}
+
+	if err := manager.Rollback(ctx, details.Name, 7); !errors.Is(err, ErrNoCheckpoint) {
+		t.Errorf("Rollback() to a missing checkpoint error = %v, want %v", err, ErrNoCheckpoint)
+	}
+
+	if _, err := manager.Remove(ctx, details.Name, true); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, ok := backend.Ref("refs/claude-mux/checkpoints/" + details.Name + "/1"); ok {
+		t.Error("Expected checkpoints to be removed with the session")
+	}
+}
+
+func TestManager_watchCheckpoints(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	manager, backend := newFakeManager(t)
+	manager.config.CheckpointInterval = 10 * time.Millisecond
+	details, err := manager.Create(ctx, CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	writeSizedFile(t, filepath.Join(details.Path, "one.go"), 10)
+	backend.SetChanges(details.Path, []git.FileStatus{{Code: "??", Path: "one.go"}})
+	stop := manager.watchCheckpoints(details)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		checkpoints, _ := manager.Checkpoints(ctx, details.Name)
+		if len(checkpoints) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for a periodic checkpoint, got %+v", checkpoints)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// Unchanged files are not snapshotted again
+	time.Sleep(50 * time.Millisecond)
+	if writes := countCalls(backend.Calls(), "WriteTree"); writes != 1 {
+		t.Errorf("Expected unchanged files to be snapshotted once, got %d snapshots", writes)
+	}
+
+	// Stopping takes a last checkpoint of what changed since
+	writeSizedFile(t, filepath.Join(details.Path, "two.go"), 10)
+	backend.SetChanges(details.Path, []git.FileStatus{{Code: "??", Path: "two.go"}})
+	stop()
+	checkpoints, err := manager.Checkpoints(ctx, details.Name)
+	if err != nil || len(checkpoints) != 2 {
+		t.Errorf("Checkpoints() after stopping = %+v, %v, want 2 checkpoints", checkpoints, err)
+	}
+}
+
+func TestManager_CheckpointRetention(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	manager, backend := newFakeManager(t)
+	manager.config.MaxCheckpoints = 3
+	details, err := manager.Create(ctx, CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	for i := range 5 {
+		backend.SetChanges(details.Path, []git.FileStatus{{Code: "??", Path: fmt.Sprintf("file%d.go", i)}})
+		if _, _, err := manager.CreateCheckpoint(ctx, details.Name); err != nil {
+			t.Fatalf("CreateCheckpoint() error = %v", err)
+		}
+	}
+
+	checkpoints, err := manager.Checkpoints(ctx, details.Name)
+	if err != nil {
+		t.Fatalf("Checkpoints() error = %v", err)
+	}
+	var numbers []int
+	for _, c := range checkpoints {
+		numbers = append(numbers, c.Number)
+	}
+	if !slices.Equal(numbers, []int{3, 4, 5}) {
+		t.Errorf("Expected the 3 newest checkpoints to be kept, got %v", numbers)
+	}
+}
+
+// countCalls counts the calls to method among calls
+func countCalls(calls []string, method string) int {
+	n := 0
+	for _, call := range calls {
+		if call == method {
+			n++
+		}
+	}
+	return n
+}
+
+func TestManager_RollbackOldest(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	manager, backend := newFakeManager(t)
+	manager.config.MaxCheckpoints = 2
+	details, err := manager.Create(ctx, CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	oldest := []git.FileStatus{{Code: "??", Path: "file0.go"}}
+	for i := range 2 {
+		backend.SetChanges(details.Path, []git.FileStatus{{Code: "??", Path: fmt.Sprintf("file%d.go", i)}})
+		if _, _, err := manager.CreateCheckpoint(ctx, details.Name); err != nil {
+			t.Fatalf("CreateCheckpoint() error = %v", err)
+		}
+	}
+
+	// Saving the current state would prune checkpoint 1 otherwise
+	backend.SetChanges(details.Path, []git.FileStatus{{Code: "??", Path: "current.go"}})
+	if err := manager.Rollback(ctx, details.Name, 1); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if changes, _ := backend.Status(details.Path); !slices.Equal(changes, oldest) {
+		t.Errorf("Status() after Rollback() = %v, want %v", changes, oldest)
+	}
+	checkpoints, err := manager.Checkpoints(ctx, details.Name)
+	if err != nil {
+		t.Fatalf("Checkpoints() error = %v", err)
+	}
+	var numbers []int
+	for _, c := range checkpoints {
+		numbers = append(numbers, c.Number)
+	}
+	if !slices.Equal(numbers, []int{1, 3}) {
+		t.Errorf("Expected the rollback target and the saved state to be kept, got %v", numbers)
+	}
+}
+
+// staleRefs is a backend whose first ListRefs misses the refs created since
+// stale was listed, like a process racing another one
+type staleRefs struct {
+	*gitfake.Backend
+	stale  []git.Ref
+	listed atomic.Bool
+}
+
+func (b *staleRefs) ListRefs(prefix string) ([]git.Ref, error) {
+	if b.listed.Swap(true) {
+		return b.Backend.ListRefs(prefix)
+	}
+	return b.stale, nil
+}
+
+func TestManager_CheckpointRace(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	manager, backend := newFakeManager(t)
+	details, err := manager.Create(ctx, CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	backend.SetChanges(details.Path, []git.FileStatus{{Code: "??", Path: "one.go"}})
+	if _, _, err := manager.CreateCheckpoint(ctx, details.Name); err != nil {
+		t.Fatalf("CreateCheckpoint() error = %v", err)
+	}
+	stale, err := backend.ListRefs(checkpointPrefix(details))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process takes checkpoint 2 after this one listed checkpoints
+	backend.SetChanges(details.Path, []git.FileStatus{{Code: "??", Path: "two.go"}})
+	other, _, err := manager.CreateCheckpoint(ctx, details.Name)
+	if err != nil {
+		t.Fatalf("CreateCheckpoint() error = %v", err)
+	}
+	manager.git = &staleRefs{Backend: backend, stale: stale}
+	backend.SetChanges(details.Path, []git.FileStatus{{Code: "??", Path: "three.go"}})
+	checkpoint, created, err := manager.CreateCheckpoint(ctx, details.Name)
+	if err != nil || !created || checkpoint.Number != 3 {
+		t.Fatalf("CreateCheckpoint() = %+v, %v, %v, want checkpoint 3", checkpoint, created, err)
+	}
+	if commit, _ := backend.Ref(checkpointPrefix(details) + "/2"); commit != other.Commit {
+		t.Errorf("Expected checkpoint 2 to stay at %s, got %s", other.Commit, commit)
+	}
+}
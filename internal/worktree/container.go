@@ -0,0 +1,189 @@
+package worktree
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/enriikke/claude-mux/internal/config"
+)
+
+// containerEnv lists the variables passed on to containers besides those
+// starting with containerEnvPrefixes, such as API keys and CLAUDE_MUX_SESSION
+var (
+	containerEnv         = []string{"TERM", "COLORTERM", "LANG"}
+	containerEnvPrefixes = []string{"ANTHROPIC_", "CLAUDE_"}
+)
+
+// agentContainer identifies the container an agent runs in
+type agentContainer struct {
+	// Runtime is the container runtime command that started it
+	Runtime string `json:"runtime"`
+	Name    string `json:"name"`
+}
+
+// run runs a command of the container runtime on the container, such as
+// pause or unpause
+func (c agentContainer) run(command string) error {
+	// #nosec G204 -- the runtime claude-mux was configured with
+	out, err := exec.Command(c.Runtime, command, c.Name).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%s %s: %s", filepath.Base(c.Runtime), command, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// remove removes the container, whether it still runs or not
+func (c agentContainer) remove() {
+	_ = exec.Command(c.Runtime, "rm", "--force", c.Name).Run() // #nosec G204 -- the runtime claude-mux was configured with
+}
+
+// containerIsolation runs agents in containers through the command line of
+// a runtime such as podman or docker. The worktree and the git common
+// directory are mounted at the same paths as on the host, so git works the
+// same in the container.
+type containerIsolation struct {
+	m *Manager
+}
+
+func (c containerIsolation) command(details WorktreeDetails, tty bool, args []string) (*exec.Cmd, func(), error) {
+	m := c.m
+	if m.config.Sandbox {
+		return nil, nil, errors.New("the sandbox cannot be combined with container isolation, which confines Claude to its mounts already")
+	}
+	if m.config.Container.Image == "" {
+		return nil, nil, errors.New("container isolation needs an image, set one with --container-image")
+	}
+	runtime, err := containerRuntime(m.config.Container.Runtime)
+	if err != nil {
+		return nil, nil, err
+	}
+	container := agentContainer{Runtime: runtime, Name: containerName(details)}
+	network, err := m.networkPolicy(details)
+	if err != nil {
+		return nil, nil, err
+	}
+	if network.Mode == NetworkAllowlist {
+		return nil, nil, errors.New("the allowlist network mode is not supported in containers, use none or pass --network options with --container-arg")
+	}
+	commonDir, err := m.git.CommonDir()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	env := sessionEnv(details)
+	run := []string{"run", "--rm", "--interactive", "--init", "--name=" + container.Name, "--workdir=" + details.Path}
+	if tty {
+		run = append(run, "--tty")
+	}
+	// The git directory is read-only but for what commits change, like in
+	// the sandbox
+	run = append(run, "--volume="+details.Path+":"+details.Path, "--volume="+commonDir+":"+commonDir+":ro")
+	for _, dir := range m.gitWritable(details) {
+		run = append(run, "--volume="+dir+":"+dir)
+	}
+	run = append(run, containerUser(container.Runtime)...)
+	if network.Mode == NetworkNone {
+		run = append(run, "--network=none")
+	}
+	run = append(run, containerLimits(m.config.Limits)...)
+	// Values stay out of the arguments, where other users could read them
+	for _, name := range containerEnvNames(env) {
+		run = append(run, "--env="+name)
+	}
+	run = append(run, m.config.Container.Args...)
+	run = append(run, m.config.Container.Image, m.config.ClaudeCommand)
+	run = append(run, args...)
+
+	// A container left behind by a run claude-mux could not clean up after
+	// holds the name
+	container.remove()
+	cmd := exec.Command(container.Runtime, run...) // #nosec G204 -- the runtime and image claude-mux was configured with
+	cmd.Dir = details.Path
+	cmd.Env = env
+	return cmd, container.remove, nil
+}
+
+// limit applies no limits, the runtime enforces them in the container
+func (containerIsolation) limit(WorktreeDetails, *exec.Cmd) agentCgroup {
+	return unlimited
+}
+
+func (c containerIsolation) container(details WorktreeDetails) *agentContainer {
+	runtime, err := containerRuntime(c.m.config.Container.Runtime)
+	if err != nil {
+		return nil
+	}
+	return &agentContainer{Runtime: runtime, Name: containerName(details)}
+}
+
+// containerName returns the name of the container the agent of a session
+// runs in
+func containerName(details WorktreeDetails) string {
+	return "claude-mux-" + filepath.Base(details.Name)
+}
+
+// containerRuntime returns the path of the configured container runtime,
+// or of podman or docker, whichever is installed
+func containerRuntime(configured string) (string, error) {
+	if configured != "" {
+		return exec.LookPath(configured)
+	}
+	for _, runtime := range []string{"podman", "docker"} {
+		if path, err := exec.LookPath(runtime); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.New("no container runtime found, install podman or docker or set --container-runtime")
+}
+
+// containerUser returns the run arguments that make the agent run as the
+// current user, so the files it creates belong to them
+func containerUser(runtime string) []string {
+	if strings.TrimSuffix(filepath.Base(runtime), ".exe") == "podman" {
+		return []string{"--userns=keep-id"}
+	}
+	if uid := os.Getuid(); uid >= 0 {
+		return []string{"--user=" + strconv.Itoa(uid) + ":" + strconv.Itoa(os.Getgid())}
+	}
+	return nil
+}
+
+// containerLimits returns the run arguments enforcing resource limits
+func containerLimits(limits config.Limits) []string {
+	var args []string
+	if limits.CPUs > 0 {
+		args = append(args, "--cpus="+strconv.FormatFloat(limits.CPUs, 'f', -1, 64))
+	}
+	if limits.Memory > 0 {
+		args = append(args, "--memory="+strconv.FormatInt(limits.Memory, 10))
+	}
+	if limits.PIDs > 0 {
+		args = append(args, "--pids-limit="+strconv.Itoa(limits.PIDs))
+	}
+	return args
+}
+
+// containerEnvNames returns the names of the variables of env passed on to
+// the container, sorted
+func containerEnvNames(env []string) []string {
+	var names []string
+	for _, v := range env {
+		name, _, _ := strings.Cut(v, "=")
+		if slices.Contains(containerEnv, name) || slices.ContainsFunc(containerEnvPrefixes, func(prefix string) bool {
+			return strings.HasPrefix(name, prefix)
+		}) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
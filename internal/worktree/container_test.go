@@ -0,0 +1,178 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package worktree
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/enriikke/claude-mux/internal/config"
+)
+
+// fakeRuntime writes a container runtime that records its commands in the
+// returned log, one per line, and runs the command of a container on the host
+func fakeRuntime(t *testing.T) (string, string) {
+	t.Helper()
+	log := filepath.Join(t.TempDir(), "runtime.log")
+	runtime := writeAgent(t, `echo "$@" >> `+log+`
+[ "$1" = run ] || exit 0
+while [ "$1" != test-image ]; do shift; done
+shift
+exec "$@"
+`)
+	return runtime, log
+}
+
+// runtimeCommands returns the commands recorded by a fake runtime
+func runtimeCommands(t *testing.T, log string) []string {
+	t.Helper()
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatalf("Failed to read the runtime log: %v", err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestManager_ContainerIsolation(t *testing.T) {
+	t.Parallel()
+
+	runtime, log := fakeRuntime(t)
+	manager := NewManager(config.Config{
+		RepoDir:          setupTestRepo(t),
+		WorktreeBasePath: ".claude-mux-test",
+		ClaudeCommand:    writeAgent(t, `echo "$CLAUDE_MUX_SESSION $1" > out`+"\n"),
+		Limits:           config.Limits{CPUs: 1.5, Memory: 1 << 30},
+		Isolation:        config.IsolationContainer,
+		Container:        config.Container{Runtime: runtime, Image: "test-image", Args: []string{"--volume=/cache:/cache"}},
+	}, WithStdio(strings.NewReader(""), nil, nil))
+
+	details, err := manager.CreateAndLaunch(context.Background(), CreateOptions{
+		Name:    "task",
+		Prompt:  "fix it",
+		Network: NetworkPolicy{Mode: NetworkNone},
+	})
+	if err != nil {
+		t.Fatalf("CreateAndLaunch() error = %v", err)
+	}
+	if out, _ := os.ReadFile(filepath.Join(details.Path, "out")); string(out) != details.Name+" fix it\n" {
+		t.Errorf("Expected the agent to run in the worktree with its prompt, got %q", out)
+	}
+
+	commonDir, err := manager.git.CommonDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := "claude-mux-" + details.Name
+	commands := runtimeCommands(t, log)
+	if len(commands) != 3 || commands[0] != "rm --force "+name || commands[2] != "rm --force "+name {
+		t.Fatalf("Expected the container to be removed before and after it ran, got %q", commands)
+	}
+	run := strings.Fields(commands[1])
+	for _, want := range []string{
+		"--rm",
+		"--name=" + name,
+		"--workdir=" + details.Path,
+		"--volume=" + details.Path + ":" + details.Path,
+		"--volume=" + commonDir + ":" + commonDir + ":ro",
+		"--volume=" + filepath.Join(commonDir, "objects") + ":" + filepath.Join(commonDir, "objects"),
+		"--network=none",
+		"--cpus=1.5",
+		"--memory=1073741824",
+		"--env=CLAUDE_MUX_SESSION",
+		"--volume=/cache:/cache",
+	} {
+		if !slices.Contains(run, want) {
+			t.Errorf("Expected %s in %q", want, commands[1])
+		}
+	}
+	if slices.Contains(run, "--tty") {
+		t.Errorf("Expected no terminal without one, got %q", commands[1])
+	}
+}
+
+func TestManager_ContainerIsolationRejects(t *testing.T) {
+	t.Parallel()
+
+	runtime, _ := fakeRuntime(t)
+	tests := []struct {
+		name    string
+		config  config.Container
+		sandbox bool
+		network NetworkPolicy
+		wantErr string
+	}{
+		{name: "no image", config: config.Container{Runtime: runtime}, wantErr: "needs an image"},
+		{name: "no runtime", config: config.Container{Runtime: "missing-runtime", Image: "test-image"}, wantErr: "missing-runtime"},
+		{name: "sandbox", config: config.Container{Runtime: runtime, Image: "test-image"}, sandbox: true, wantErr: "sandbox"},
+		{
+			name:    "allowlist",
+			config:  config.Container{Runtime: runtime, Image: "test-image"},
+			network: NetworkPolicy{Mode: NetworkAllowlist},
+			wantErr: "allowlist",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			manager, _ := newFakeManager(t)
+			manager.config.Isolation = config.IsolationContainer
+			manager.config.Container = tt.config
+			manager.config.Sandbox = tt.sandbox
+			manager.isolation = newIsolation(manager)
+
+			_, err := manager.CreateAndLaunch(context.Background(), CreateOptions{Name: "task", Network: tt.network})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CreateAndLaunch() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManager_PauseContainer(t *testing.T) {
+	t.Parallel()
+
+	runtime, log := fakeRuntime(t)
+	started := filepath.Join(t.TempDir(), "started")
+	manager := NewManager(config.Config{
+		RepoDir:          setupTestRepo(t),
+		WorktreeBasePath: ".claude-mux-test",
+		ClaudeCommand:    writeAgent(t, "echo $$ > "+started+"\nwhile :; do sleep 0.05; done\n"),
+		Isolation:        config.IsolationContainer,
+		Container:        config.Container{Runtime: runtime, Image: "test-image"},
+	})
+	ctx := context.Background()
+	details, err := manager.Create(ctx, CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	agent, err := manager.Start(ctx, details.Name, TermSize{})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() {
+		agent.Stop()
+		_ = agent.Close()
+	})
+	if _, err := waitForFile(started); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := manager.Pause(ctx, details.Name); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	if _, err := manager.Unpause(ctx, details.Name); err != nil {
+		t.Fatalf("Unpause() error = %v", err)
+	}
+	name := "claude-mux-" + details.Name
+	commands := runtimeCommands(t, log)
+	if want := []string{"pause " + name, "unpause " + name}; !slices.Equal(commands[len(commands)-2:], want) {
+		t.Errorf("Expected the runtime to pause and unpause the container, got %q", commands)
+	}
+	if !strings.Contains(commands[1], "--tty") {
+		t.Errorf("Expected the agent to get a terminal, got %q", commands[1])
+	}
+}
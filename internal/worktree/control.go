@@ -0,0 +1,158 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrAgentNotRunning is returned for operations that need a running agent
+var ErrAgentNotRunning = errors.New("session is not running")
+
+// ErrAgentRunning is returned for operations that need the agent of a
+// session to be stopped first
+var ErrAgentRunning = errors.New("session is running")
+
+// ErrPauseUnsupported is returned when agents cannot be paused on this platform
+var ErrPauseUnsupported = errors.New("pausing agents is not supported on this platform")
+
+// exitPollInterval is how often an agent started by another process is
+// checked for having exited
+const exitPollInterval = 50 * time.Millisecond
+
+// Stop asks the agent of a session to exit and waits until it did. It works
+// for agents started by any claude-mux process. The agent is interrupted
+// like Ctrl-C first, terminated after half the stop timeout and killed once
+// the timeout passed.
+func (m *Manager) Stop(ctx context.Context, name string) (WorktreeDetails, error) {
+	details, record, err := m.runningAgent(ctx, name)
+	if err != nil {
+		return details, err
+	}
+
+	stopping := sessionEvent(EventStopping, details)
+	stopping.Message = "stop requested"
+	m.emit(stopping)
+	m.stopProcess(details, record.PID, func(d time.Duration) bool {
+		deadline := time.Now().Add(d)
+		for agentAlive(record) {
+			if time.Now().After(deadline) {
+				return false
+			}
+			time.Sleep(exitPollInterval)
+		}
+		return true
+	})
+	return details, nil
+}
+
+// Pause suspends the agent of a session and all of its children, so it
+// uses no CPU until it is unpaused. Pausing a paused agent does nothing.
+func (m *Manager) Pause(ctx context.Context, name string) (WorktreeDetails, error) {
+	details, record, err := m.runningAgent(ctx, name)
+	if err != nil {
+		return details, err
+	}
+	pause := func() error { return pauseGroup(record.PID) }
+	if record.Container != nil {
+		pause = func() error { return record.Container.run("pause") }
+	}
+	if err := pause(); err != nil {
+		return details, fmt.Errorf("failed to pause Claude: %w", err)
+	}
+	if record.PausedAt == nil {
+		now := time.Now()
+		record.PausedAt = &now
+		m.writeAgentRecord(details, record)
+	}
+	return details, nil
+}
+
+// Unpause resumes the paused agent of a session. Unpausing an agent that
+// is not paused does nothing.
+func (m *Manager) Unpause(ctx context.Context, name string) (WorktreeDetails, error) {
+	details, record, err := m.runningAgent(ctx, name)
+	if err != nil {
+		return details, err
+	}
+	unpause := func() error { return continueGroup(record.PID) }
+	if record.Container != nil {
+		unpause = func() error { return record.Container.run("unpause") }
+	}
+	if err := unpause(); err != nil {
+		return details, fmt.Errorf("failed to unpause Claude: %w", err)
+	}
+	if record.PausedAt != nil {
+		record.PausedAt = nil
+		m.writeAgentRecord(details, record)
+	}
+	return details, nil
+}
+
+// runningAgent returns the session matching name and the agent process
+// running in it
+func (m *Manager) runningAgent(ctx context.Context, name string) (WorktreeDetails, agentRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return WorktreeDetails{}, agentRecord{}, err
+	}
+
+	details, err := m.Find(name)
+	if err != nil {
+		return details, agentRecord{}, err
+	}
+	record, err := m.readAgentRecord(details)
+	if err != nil || record.PID == 0 || record.ExitedAt != nil || !agentAlive(record) {
+		return details, agentRecord{}, fmt.Errorf("%w: %s", ErrAgentNotRunning, details.Name)
+	}
+	return details, record, nil
+}
+
+// stopRequested reports whether the agent process pid of a session was
+// asked to stop, so it exiting with an error is expected
+func (m *Manager) stopRequested(details WorktreeDetails, pid int) bool {
+	record, err := m.readAgentRecord(details)
+	return err == nil && record.PID == pid && record.Stopped
+}
+
+// stopProcess asks the agent process group led by pid to exit, escalating
+// from an interrupt to SIGTERM after half the stop timeout and to a kill
+// once it passed. exited waits up to the given time for the agent to exit
+// and reports whether it did.
+func (m *Manager) stopProcess(details WorktreeDetails, pid int, exited func(time.Duration) bool) {
+	if record, err := m.readAgentRecord(details); err == nil && record.PID == pid {
+		if record.Container != nil && record.PausedAt != nil {
+			_ = record.Container.run("unpause")
+		}
+		record.Stopped = true
+		record.PausedAt = nil
+		m.writeAgentRecord(details, record)
+	}
+
+	step := m.stopTimeout() / 2
+	if err := interruptGroup(pid); err != nil {
+		m.emit(Event{Type: EventWarning, Message: "Failed to stop Claude", Err: err})
+	}
+	// A paused agent only handles the interrupt once it continues
+	_ = continueGroup(pid)
+	if exited(step) {
+		return
+	}
+
+	if err := terminateGroup(pid); err != nil {
+		m.emit(Event{Type: EventWarning, Message: "Failed to stop Claude", Err: err})
+	}
+	if exited(m.stopTimeout() - step) {
+		return
+	}
+
+	warning := sessionEvent(EventWarning, details)
+	warning.Message = fmt.Sprintf("Claude did not exit within %v, killing it", m.stopTimeout())
+	m.emit(warning)
+	if err := killGroup(pid); err != nil {
+		m.emit(Event{Type: EventWarning, Message: "Failed to kill Claude", Err: err})
+		return
+	}
+	// A kill cannot be ignored, so this only waits for it to take effect
+	exited(m.stopTimeout())
+}
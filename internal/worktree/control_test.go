@@ -0,0 +1,203 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package worktree
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/config"
+)
+
+// startLoopingAgent starts a background agent running script before it
+// loops forever, and waits until it runs
+func startLoopingAgent(t *testing.T, script string, timeout time.Duration, events *eventLog) (*Manager, *Agent) {
+	t.Helper()
+	started := filepath.Join(t.TempDir(), "started")
+	manager := NewManager(config.Config{
+		RepoDir:          setupTestRepo(t),
+		WorktreeBasePath: ".claude-mux-test",
+		ClaudeCommand:    writeAgent(t, script+"\necho $$ > "+started+"\nwhile :; do sleep 0.05; done\n"),
+		StopTimeout:      timeout,
+	}, WithEventHandler(events.record))
+
+	ctx := context.Background()
+	details, err := manager.Create(ctx, CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	agent, err := manager.Start(ctx, details.Name, TermSize{})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	t.Cleanup(func() {
+		agent.Stop()
+		_ = agent.Close()
+	})
+	if _, err := waitForFile(started); err != nil {
+		t.Fatal(err)
+	}
+	return manager, agent
+}
+
+// processState returns the state letter Linux reports for pid, or an empty
+// string where /proc is not available
+func processState(pid int) string {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return ""
+	}
+	// The state follows the parenthesized command name
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return fields[0]
+}
+
+func TestManager_PauseUnpause(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	manager, agent := startLoopingAgent(t, "", time.Second, &eventLog{})
+	name := agent.Session().Name
+
+	for range 2 {
+		if _, err := manager.Pause(ctx, name); err != nil {
+			t.Fatalf("Pause() error = %v", err)
+		}
+	}
+	if status := sessionState(t, manager, name); status.State != AgentPaused {
+		t.Errorf("Expected the agent to be paused, got %+v", status)
+	}
+	if state := processState(agent.PID()); state != "" && state != "T" {
+		t.Errorf("Expected the agent process to be stopped, got state %s", state)
+	}
+
+	if _, err := manager.Unpause(ctx, name); err != nil {
+		t.Fatalf("Unpause() error = %v", err)
+	}
+	if status := sessionState(t, manager, name); status.State == AgentPaused {
+		t.Errorf("Expected the agent to run again, got %+v", status)
+	}
+	if state := processState(agent.PID()); state == "T" {
+		t.Errorf("Expected the agent process to continue, got state %s", state)
+	}
+
+	agent.Stop()
+	if _, err := manager.Pause(ctx, name); !errors.Is(err, ErrAgentNotRunning) {
+		t.Errorf("Pause() of a stopped agent error = %v, want ErrAgentNotRunning", err)
+	}
+	if _, err := manager.Unpause(ctx, name); !errors.Is(err, ErrAgentNotRunning) {
+		t.Errorf("Unpause() of a stopped agent error = %v, want ErrAgentNotRunning", err)
+	}
+}
+
+func TestManager_Stop(t *testing.T) {
+	t.Parallel()
+
+	const timeout = 600 * time.Millisecond
+	tests := []struct {
+		name   string
+		script string
+		pause  bool
+		// killed is set when the agent ignores the interrupt and SIGTERM
+		killed bool
+		// minDuration is how long stopping takes at least
+		minDuration time.Duration
+	}{
+		{name: "interrupted", script: "trap 'exit 0' INT"},
+		{name: "paused", script: "trap 'exit 0' INT", pause: true},
+		{name: "terminated", script: "trap '' INT", minDuration: timeout / 2},
+		{name: "killed", script: "trap '' INT TERM", killed: true, minDuration: timeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			ctx := context.Background()
+			events := &eventLog{}
+			manager, agent := startLoopingAgent(t, tt.script, timeout, events)
+			name := agent.Session().Name
+			if tt.pause {
+				if _, err := manager.Pause(ctx, name); err != nil {
+					t.Fatalf("Pause() error = %v", err)
+				}
+			}
+
+			start := time.Now()
+			if _, err := manager.Stop(ctx, name); err != nil {
+				t.Fatalf("Stop() error = %v", err)
+			}
+			elapsed := time.Since(start)
+			select {
+			case <-agent.Done():
+			case <-time.After(5 * time.Second):
+				t.Fatal("Expected the agent to have exited")
+			}
+			if elapsed < tt.minDuration || (tt.minDuration == 0 && elapsed >= timeout/2) {
+				t.Errorf("Stop() took %v, want at least %v", elapsed, tt.minDuration)
+			}
+			if killed := events.count(EventWarning) > 0; killed != tt.killed {
+				t.Errorf("Expected killed = %v, got events %+v", tt.killed, events.events)
+			}
+
+			if status := sessionState(t, manager, name); status.State != AgentStopped {
+				t.Errorf("Expected the agent to be stopped, got %+v", status)
+			}
+			if _, err := manager.Stop(ctx, name); !errors.Is(err, ErrAgentNotRunning) {
+				t.Errorf("Stop() of a stopped agent error = %v, want ErrAgentNotRunning", err)
+			}
+		})
+	}
+}
+
+func TestManager_StopReusedPID(t *testing.T) {
+	t.Parallel()
+
+	// A process that is not the agent now holds the recorded PID
+	other := exec.Command("sleep", "60")
+	other.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := other.Start(); err != nil {
+		t.Fatalf("Failed to start a process: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = other.Process.Kill()
+		_ = other.Wait()
+	})
+	start, err := processStart(other.Process.Pid)
+	if err != nil {
+		t.Skipf("Process start times are not available: %v", err)
+	}
+
+	ctx := context.Background()
+	manager, _ := newFakeManager(t)
+	details, err := manager.Create(ctx, CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	manager.writeAgentRecord(details, agentRecord{PID: other.Process.Pid, StartedAt: time.Now(), Start: start - 1})
+
+	if status := manager.agentStatus(details); status.State != AgentExited {
+		t.Errorf("Expected the agent to have exited, got %+v", status)
+	}
+	if _, err := manager.Stop(ctx, details.Name); !errors.Is(err, ErrAgentNotRunning) {
+		t.Errorf("Stop() error = %v, want ErrAgentNotRunning", err)
+	}
+	if _, err := manager.Pause(ctx, details.Name); !errors.Is(err, ErrAgentNotRunning) {
+		t.Errorf("Pause() error = %v, want ErrAgentNotRunning", err)
+	}
+	if !processAlive(other.Process.Pid) || processState(other.Process.Pid) == "T" {
+		t.Error("Expected the process that reused the PID to be left alone")
+	}
+
+	manager.writeAgentRecord(details, agentRecord{PID: other.Process.Pid, StartedAt: time.Now(), Start: start})
+	if status := manager.agentStatus(details); status.State != AgentRunning {
+		t.Errorf("Expected the recorded process to be the running agent, got %+v", status)
+	}
+}
@@ -0,0 +1,399 @@
+package worktree
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/config"
+)
+
+// ErrQuotaExceeded is returned by Create when the worktrees use up the
+// disk quota and no idle session could be archived to make room
+var ErrQuotaExceeded = errors.New("disk quota exceeded")
+
+// The disk usage measured by the last quota check is trusted for
+// quotaCheckInterval while it stays below quotaMargin percent of the quota,
+// so creating sessions does not walk every worktree each time
+const (
+	quotaCheckInterval = 5 * time.Minute
+	quotaMargin        = 90
+)
+
+// Directories whose contents are counted as dependencies or build
+// artifacts rather than as part of the checkout, wherever they are in a
+// worktree
+var (
+	dependencyDirs = []string{"node_modules", "bower_components", "vendor", ".venv", "venv", "Pods", ".bundle"}
+	artifactDirs   = []string{
+		"target", "dist", "build", "out", "bin", "obj", "coverage",
+		".next", ".nuxt", ".gradle", ".cache", ".turbo", ".parcel-cache", "__pycache__", ".pytest_cache", ".tox",
+	}
+)
+
+// DiskUsage is the disk space taken by a worktree, in bytes. Sizes are
+// apparent sizes, like du --apparent-size reports.
+type DiskUsage struct {
+	// Checkout is taken by the files of the worktree besides Artifacts and
+	// Dependencies
+	Checkout int64
+	// Artifacts is taken by build output, such as target or dist
+	// directories
+	Artifacts int64
+	// Dependencies is taken by installed dependencies, such as
+	// node_modules or vendor directories
+	Dependencies int64
+}
+
+// Total returns the disk space taken by the whole worktree
+func (u DiskUsage) Total() int64 {
+	return u.Checkout + u.Artifacts + u.Dependencies
+}
+
+// SessionDiskUsage is the disk space taken by a session
+type SessionDiskUsage struct {
+	Session
+	Usage DiskUsage
+	// LastActive is when the session was last used: when its agent last
+	// started, exited or was paused, or when it was created
+	LastActive time.Time
+}
+
+// DiskReport describes the disk space taken by the sessions of a
+// repository
+type DiskReport struct {
+	// BasePath is the directory holding the worktrees
+	BasePath string
+	// Sessions lists the sessions, largest first
+	Sessions []SessionDiskUsage
+	// Other is taken under BasePath outside of any session, e.g. by
+	// leftovers of removed worktrees
+	Other int64
+	// Total is taken by everything under BasePath. Sessions created
+	// elsewhere are not part of it.
+	Total int64
+	// Quota is the configured disk quota, zero when unlimited
+	Quota int64
+}
+
+// DiskUsage reports the disk space taken by every session and by the
+// worktree base path as a whole
+func (m *Manager) DiskUsage(ctx context.Context) (DiskReport, error) {
+	sessions, err := m.List(ctx)
+	if err != nil {
+		return DiskReport{}, err
+	}
+
+	base := m.basePath()
+	report := DiskReport{BasePath: base, Quota: m.config.DiskQuota}
+	for _, session := range sessions {
+		usage, err := diskUsage(ctx, session.Path)
+		if err != nil {
+			return DiskReport{}, err
+		}
+		details := WorktreeDetails{Name: session.Name, Branch: session.Branch, Path: session.Path}
+		report.Sessions = append(report.Sessions, SessionDiskUsage{
+			Session:    session,
+			Usage:      usage,
+			LastActive: m.lastActive(details),
+		})
+		if isWithin(base, session.Path) {
+			report.Total += usage.Total()
+		}
+	}
+	slices.SortStableFunc(report.Sessions, func(a, b SessionDiskUsage) int {
+		return cmp.Compare(b.Usage.Total(), a.Usage.Total())
+	})
+
+	report.Other, err = otherUsage(ctx, base, sessions)
+	if err != nil {
+		return DiskReport{}, err
+	}
+	report.Total += report.Other
+	return report, nil
+}
+
+// diskUsage adds up the files under dir, sorting them into the checkout,
+// build artifacts and dependencies. Files that cannot be read are skipped.
+func diskUsage(ctx context.Context, dir string) (DiskUsage, error) {
+	var usage DiskUsage
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			if path == dir {
+				return nil
+			}
+			switch {
+			case slices.Contains(dependencyDirs, entry.Name()):
+				size, err := dirSize(ctx, path, nil)
+				usage.Dependencies += size
+				return cmp.Or(err, filepath.SkipDir)
+			case slices.Contains(artifactDirs, entry.Name()):
+				size, err := dirSize(ctx, path, nil)
+				usage.Artifacts += size
+				return cmp.Or(err, filepath.SkipDir)
+			}
+			return nil
+		}
+		usage.Checkout += fileSize(entry)
+		return nil
+	})
+	return usage, err
+}
+
+// dirSize adds up the files under dir, leaving out the directories skip
+// reports true for. Files that cannot be read are skipped.
+func dirSize(ctx context.Context, dir string, skip func(path string) bool) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			if skip != nil && skip(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		size += fileSize(entry)
+		return nil
+	})
+	return size, err
+}
+
+// fileSize returns the apparent size of a file, zero if it vanished
+func fileSize(entry fs.DirEntry) int64 {
+	info, err := entry.Info()
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// otherUsage adds up the files under the base path outside of sessions
+func otherUsage(ctx context.Context, base string, sessions []Session) (int64, error) {
+	if _, err := os.Stat(base); errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	return dirSize(ctx, base, func(path string) bool {
+		return slices.ContainsFunc(sessions, func(s Session) bool {
+			return samePath(s.Path, path)
+		})
+	})
+}
+
+// lastActive returns when a session was last used: when its agent last
+// started, exited or was paused, or else when it was created or its
+// worktree last changed
+func (m *Manager) lastActive(details WorktreeDetails) time.Time {
+	var last time.Time
+	if record, err := m.readAgentRecord(details); err == nil {
+		for _, t := range []*time.Time{&record.StartedAt, record.ExitedAt, record.PausedAt} {
+			if t != nil && t.After(last) {
+				last = *t
+			}
+		}
+	}
+	if meta, err := m.readSessionMeta(details); err == nil {
+		for _, t := range []*time.Time{&meta.CreatedAt, meta.ResumedAt} {
+			if t != nil && t.After(last) {
+				last = *t
+			}
+		}
+	}
+	if last.IsZero() {
+		if info, err := os.Stat(details.Path); err == nil {
+			last = info.ModTime()
+		}
+	}
+	return last
+}
+
+// enforceQuota makes sure the worktrees leave room under the disk quota
+// before a session is created. With QuotaArchive it archives the idle
+// sessions without uncommitted changes or ignored files besides
+// dependencies and build artifacts that were used least recently until
+// they do.
+func (m *Manager) enforceQuota(ctx context.Context) error {
+	quota := m.config.DiskQuota
+	if quota <= 0 || m.recentlyWithinQuota(quota) {
+		return nil
+	}
+	report, err := m.DiskUsage(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check the disk quota: %w", err)
+	}
+	err = m.makeRoom(ctx, &report)
+	m.saveQuotaCheck(report)
+	return err
+}
+
+// makeRoom archives sessions until the worktrees of report take less than
+// its quota if QuotaArchive is configured, updating report with what was
+// archived
+func (m *Manager) makeRoom(ctx context.Context, report *DiskReport) error {
+	quota := report.Quota
+	if report.Total < quota {
+		return nil
+	}
+
+	if m.config.QuotaAction == config.QuotaArchive {
+		candidates := slices.DeleteFunc(slices.Clone(report.Sessions), func(s SessionDiskUsage) bool {
+			return !archivable(s) || !isWithin(report.BasePath, s.Path)
+		})
+		slices.SortStableFunc(candidates, func(a, b SessionDiskUsage) int {
+			return a.LastActive.Compare(b.LastActive)
+		})
+
+		for _, s := range candidates {
+			if report.Total < quota {
+				break
+			}
+			warning := Event{Type: EventWarning, Session: s.Name, Branch: s.Branch, Path: s.Path}
+			warning.Message = fmt.Sprintf("Worktrees take %s of the %s disk quota, archiving %s, idle since %s",
+				config.FormatBytes(report.Total), config.FormatBytes(quota), s.Name, s.LastActive.Format(time.DateTime))
+			// Archiving removes the worktree with everything git ignores
+			if files, err := m.ignoredFiles(s.Path); err != nil || len(files) > 0 {
+				skipped := Event{Type: EventWarning, Session: s.Name, Branch: s.Branch, Path: s.Path, Err: err}
+				skipped.Message = "Not archiving " + s.Name + ", git cannot tell which of its files it ignores"
+				if err == nil {
+					skipped.Message = fmt.Sprintf("Not archiving %s, it would delete files git ignores, such as %s", s.Name, files[0])
+				}
+				m.emit(skipped)
+				continue
+			}
+			m.emit(warning)
+			if _, err := m.Archive(ctx, s.Name); err != nil {
+				warning.Message = "Failed to archive " + s.Name
+				warning.Err = err
+				m.emit(warning)
+				continue
+			}
+			report.Total -= s.Usage.Total()
+			report.Sessions = slices.DeleteFunc(report.Sessions, func(other SessionDiskUsage) bool {
+				return other.Name == s.Name
+			})
+		}
+		if report.Total < quota {
+			return nil
+		}
+		return fmt.Errorf("%w: worktrees under %s take %s of %s and no idle session without uncommitted or ignored files is left to archive",
+			ErrQuotaExceeded, report.BasePath, config.FormatBytes(report.Total), config.FormatBytes(quota))
+	}
+	return fmt.Errorf("%w: worktrees under %s take %s of %s, archive or remove sessions to make room",
+		ErrQuotaExceeded, report.BasePath, config.FormatBytes(report.Total), config.FormatBytes(quota))
+}
+
+// ignoredFiles returns the files of the worktree at path that git ignores
+// besides dependencies and build artifacts, such as .env files
+func (m *Manager) ignoredFiles(path string) ([]string, error) {
+	files, err := m.git.Ignored(path)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(files, func(file string) bool {
+		return slices.ContainsFunc(strings.Split(strings.TrimSuffix(file, "/"), "/"), func(dir string) bool {
+			return slices.Contains(dependencyDirs, dir) || slices.Contains(artifactDirs, dir)
+		})
+	}), nil
+}
+
+// archivable reports whether a session may be archived to make room: its
+// agent does not run and it is known to have no uncommitted changes that
+// would be lost
+func archivable(s SessionDiskUsage) bool {
+	return !s.Agent.State.alive() && !s.Locked && s.StatusErr == nil && s.Changes == 0
+}
+
+// quotaCheck is the disk usage measured by the last quota check
+type quotaCheck struct {
+	Total     int64     `json:"total"`
+	Sessions  int       `json:"sessions"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// quotaCheckPath returns where the last quota check is kept, in the git
+// common directory so that every claude-mux process shares it
+func (m *Manager) quotaCheckPath() (string, error) {
+	commonDir, err := m.git.CommonDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(commonDir, "claude-mux", "disk-usage.json"), nil
+}
+
+// saveQuotaCheck records the disk usage of report for later quota checks.
+// Failing to record it only makes the next check walk the worktrees again.
+func (m *Manager) saveQuotaCheck(report DiskReport) {
+	path, err := m.quotaCheckPath()
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(quotaCheck{Total: report.Total, Sessions: len(report.Sessions), CheckedAt: time.Now()})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+	_ = os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// recentlyWithinQuota reports whether the last quota check is recent and
+// found the worktrees well within quota, counting the sessions created
+// since as large as the average one back then
+func (m *Manager) recentlyWithinQuota(quota int64) bool {
+	path, err := m.quotaCheckPath()
+	if err != nil {
+		return false
+	}
+	data, err := os.ReadFile(path) // #nosec G304 -- path derived from git's common dir
+	if err != nil {
+		return false
+	}
+	var check quotaCheck
+	if err := json.Unmarshal(data, &check); err != nil {
+		return false
+	}
+	if age := time.Since(check.CheckedAt); age < 0 || age >= quotaCheckInterval {
+		return false
+	}
+
+	worktrees, err := m.git.ListWorktrees()
+	if err != nil {
+		return false
+	}
+	sessions := 0
+	for _, wt := range worktrees {
+		if m.isClaudeWorktree(wt) {
+			sessions++
+		}
+	}
+	estimate := check.Total
+	if added := sessions - check.Sessions; added > 0 {
+		if check.Sessions == 0 {
+			return false
+		}
+		estimate += int64(added) * check.Total / int64(check.Sessions)
+	}
+	return estimate*100 < quota*quotaMargin
+}
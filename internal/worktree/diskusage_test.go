@@ -0,0 +1,189 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/git"
+)
+
+// writeSizedFile writes a file of size bytes, creating its directory
+func writeSizedFile(t *testing.T, path string, size int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Repeat("x", size)), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManager_DiskUsage(t *testing.T) {
+	t.Parallel()
+
+	manager, _ := newFakeManager(t)
+	manager.config.DiskQuota = 1 << 20
+	ctx := context.Background()
+	small, err := manager.Create(ctx, CreateOptions{Name: "small"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	large, err := manager.Create(ctx, CreateOptions{Name: "large"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	writeSizedFile(t, filepath.Join(small.Path, "main.go"), 10)
+	writeSizedFile(t, filepath.Join(large.Path, "main.go"), 100)
+	writeSizedFile(t, filepath.Join(large.Path, "web", "node_modules", "pkg", "index.js"), 200)
+	writeSizedFile(t, filepath.Join(large.Path, "tools", "vendor", "lib.go"), 50)
+	writeSizedFile(t, filepath.Join(large.Path, "target", "debug", "app"), 300)
+	// Left behind by a worktree git no longer knows about
+	writeSizedFile(t, filepath.Join(filepath.Dir(large.Path), "stale", "file"), 5)
+
+	report, err := manager.DiskUsage(ctx)
+	if err != nil {
+		t.Fatalf("DiskUsage() error = %v", err)
+	}
+	if len(report.Sessions) != 2 || report.Sessions[0].Name != large.Name || report.Sessions[1].Name != small.Name {
+		t.Fatalf("Expected both sessions, largest first, got %+v", report.Sessions)
+	}
+	if want := (DiskUsage{Checkout: 100, Artifacts: 300, Dependencies: 250}); report.Sessions[0].Usage != want {
+		t.Errorf("Expected the usage of %s to be %+v, got %+v", large.Name, want, report.Sessions[0].Usage)
+	}
+	if report.Sessions[1].LastActive.IsZero() {
+		t.Errorf("Expected when %s was last active, got none", small.Name)
+	}
+	if report.Other != 5 || report.Total != 665 || report.Quota != 1<<20 {
+		t.Errorf("Expected 5 other bytes of 665 under the %d quota, got %+v", 1<<20, report)
+	}
+	if report.BasePath != filepath.Dir(large.Path) {
+		t.Errorf("Expected the base path %s, got %s", filepath.Dir(large.Path), report.BasePath)
+	}
+}
+
+func TestManager_CreateQuota(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		action config.QuotaAction
+		quota  int64
+		// statusErr makes counting the uncommitted changes of the sessions
+		// fail, while archiving would still succeed
+		statusErr bool
+		// ignored are the files git ignores in the oldest session
+		ignored []string
+		wantErr error
+		// want lists the sessions left besides the created one
+		want []string
+	}{
+		{name: "refuse", action: config.QuotaRefuse, quota: 1000, wantErr: ErrQuotaExceeded, want: []string{"old", "changed", "recent"}},
+		{name: "archive", action: config.QuotaArchive, quota: 1000, want: []string{"changed", "recent"}},
+		{name: "archive not enough", action: config.QuotaArchive, quota: 300, wantErr: ErrQuotaExceeded, want: []string{"changed"}},
+		{name: "within quota", action: config.QuotaRefuse, quota: 2000, want: []string{"old", "changed", "recent"}},
+		{name: "archive unknown changes", action: config.QuotaArchive, quota: 1000, statusErr: true, wantErr: ErrQuotaExceeded, want: []string{"old", "changed", "recent"}},
+		{name: "archive ignored files", action: config.QuotaArchive, quota: 1000, ignored: []string{".env"}, want: []string{"old", "changed"}},
+		{name: "archive ignored artifacts", action: config.QuotaArchive, quota: 1000, ignored: []string{"node_modules/", "web/dist/"}, want: []string{"changed", "recent"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			manager, backend := newFakeManager(t)
+			ctx := context.Background()
+
+			sessions := map[string]WorktreeDetails{}
+			for name, age := range map[string]time.Duration{"old": 3 * time.Hour, "changed": 4 * time.Hour, "recent": time.Hour} {
+				details, err := manager.Create(ctx, CreateOptions{Name: name})
+				if err != nil {
+					t.Fatalf("Create() error = %v", err)
+				}
+				writeSizedFile(t, filepath.Join(details.Path, "data"), 400)
+				meta, err := manager.readSessionMeta(details)
+				if err != nil {
+					t.Fatal(err)
+				}
+				meta.CreatedAt = time.Now().Add(-age)
+				if err := manager.saveSessionMeta(meta); err != nil {
+					t.Fatal(err)
+				}
+				sessions[name] = details
+			}
+			// Archiving would lose these changes
+			backend.SetChanges(sessions["changed"].Path, []git.FileStatus{{Code: " M", Path: "data"}})
+			backend.SetIgnored(sessions["old"].Path, tt.ignored)
+			if tt.statusErr {
+				for range sessions {
+					backend.FailOnce("Status", errors.New("index.lock exists"))
+				}
+			}
+
+			manager.config.DiskQuota = tt.quota
+			manager.config.QuotaAction = tt.action
+			_, err := manager.Create(ctx, CreateOptions{Name: "new"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Create() error = %v, want %v", err, tt.wantErr)
+			}
+			for name, details := range sessions {
+				_, err := manager.Find(details.Name)
+				if want := slices.Contains(tt.want, name); (err == nil) != want {
+					t.Errorf("Expected %s to be kept: %v, Find() error = %v", name, want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestManager_CreateQuotaCheck(t *testing.T) {
+	t.Parallel()
+
+	manager, _ := newFakeManager(t)
+	manager.config.DiskQuota = 1000
+	ctx := context.Background()
+	create := func(name string) error {
+		_, err := manager.Create(ctx, CreateOptions{Name: name})
+		return err
+	}
+
+	if err := create("first"); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	first, err := manager.Find("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeSizedFile(t, filepath.Join(first.Path, "data"), 100)
+	// Measures 100 bytes in one session
+	if err := create("second"); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	writeSizedFile(t, filepath.Join(first.Path, "large"), 2000)
+
+	// Estimated at 200 bytes without walking the worktrees
+	if err := create("third"); err != nil {
+		t.Fatalf("Create() with a recent quota check error = %v", err)
+	}
+
+	path, err := manager.quotaCheckPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-quotaCheckInterval).Format(time.RFC3339)
+	if err := os.WriteFile(path, []byte(`{"total":100,"sessions":1,"checked_at":"`+old+`"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := create("fourth"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Create() with an outdated quota check error = %v, want ErrQuotaExceeded", err)
+	}
+	// The last check measured the quota exceeded, so it is not trusted
+	if err := create("fifth"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Create() over quota error = %v, want ErrQuotaExceeded", err)
+	}
+}
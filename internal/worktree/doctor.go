@@ -0,0 +1,435 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/git"
+)
+
+// minGitVersion is the oldest git release providing every worktree command
+// claude-mux relies on (`git worktree remove` arrived in 2.17)
+var minGitVersion = [2]int{2, 17}
+
+// staleLockAge is how old a lock file must be before --fix removes it
+const staleLockAge = 10 * time.Minute
+
+// agentVersionTimeout bounds how long the agent may take to print its version
+const agentVersionTimeout = 10 * time.Second
+
+// FindingLevel classifies the outcome of a doctor check
+type FindingLevel int
+
+const (
+	// LevelOK means the check passed
+	LevelOK FindingLevel = iota
+	// LevelWarning means claude-mux works but something should be fixed
+	LevelWarning
+	// LevelError means claude-mux cannot work correctly
+	LevelError
+)
+
+// Finding is the result of a single doctor check
+type Finding struct {
+	Check   string
+	Level   FindingLevel
+	Message string
+	Hint    string
+	// Fixable is set when the problem can be repaired automatically
+	Fixable bool
+	// Fixed is set when the problem was repaired automatically
+	Fixed bool
+	// FixErr is set when an automatic repair failed
+	FixErr error
+
+	fix func() error
+}
+
+// Problem reports whether the finding still needs attention
+func (f Finding) Problem() bool {
+	return f.Level != LevelOK && !f.Fixed
+}
+
+// Doctor checks the claude-mux setup of the current repository and returns
+// a finding per check, with suggested fixes for problems. With fix,
+// problems that can be repaired safely are fixed automatically.
+func (m *Manager) Doctor(ctx context.Context, fix bool) ([]Finding, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	findings := []Finding{m.checkGitVersion(), m.checkAgent(ctx)}
+
+	// Repository checks need a repository to inspect
+	if err := m.resolveRepo(); err != nil {
+		findings = append(findings, Finding{
+			Check:   "Repository",
+			Level:   LevelError,
+			Message: err.Error(),
+			Hint:    "Run claude-mux from inside a git repository or pass --repo",
+		})
+	} else {
+		findings = append(findings, m.checkBaseIgnored())
+		findings = append(findings, m.checkPrunableWorktrees()...)
+		findings = append(findings, m.checkMissingWorktrees()...)
+		findings = append(findings, m.checkOrphanBranches()...)
+		findings = append(findings, m.checkLocks()...)
+	}
+
+	for i := range findings {
+		f := &findings[i]
+		f.Fixable = f.fix != nil
+		if !fix || f.Level == LevelOK || f.fix == nil {
+			continue
+		}
+		if err := f.fix(); err != nil {
+			f.FixErr = err
+		} else {
+			f.Fixed = true
+		}
+	}
+	return findings, nil
+}
+
+// checkGitVersion verifies that git is installed and supports worktrees
+func (m *Manager) checkGitVersion() Finding {
+	f := Finding{Check: "Git"}
+
+	version, err := m.git.Version()
+	if err != nil {
+		f.Level = LevelError
+		f.Message = err.Error()
+		f.Hint = "Install git from https://git-scm.com/downloads"
+		return f
+	}
+
+	if !versionAtLeast(version, minGitVersion) {
+		f.Level = LevelError
+		f.Message = fmt.Sprintf("git %s is too old for worktree support", version)
+		f.Hint = fmt.Sprintf("Upgrade to git %d.%d or newer", minGitVersion[0], minGitVersion[1])
+		return f
+	}
+
+	f.Message = fmt.Sprintf("git %s supports worktrees", version)
+	return f
+}
+
+// versionAtLeast reports whether a dotted version string is at least min
+func versionAtLeast(version string, min [2]int) bool {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return false
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return false
+	}
+	return major > min[0] || (major == min[0] && minor >= min[1])
+}
+
+// checkAgent verifies that the agent executable exists and runs
+func (m *Manager) checkAgent(ctx context.Context) Finding {
+	f := Finding{Check: "Agent"}
+
+	path, err := exec.LookPath(m.config.ClaudeCommand)
+	if err != nil {
+		f.Level = LevelError
+		f.Message = fmt.Sprintf("%s not found in PATH", m.config.ClaudeCommand)
+		f.Hint = "Install Claude Code from https://docs.anthropic.com/en/docs/claude-code or pass --claude-cmd"
+		return f
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, agentVersionTimeout)
+	defer cancel()
+
+	// #nosec G204 -- ClaudeCommand comes from user config, not untrusted input
+	output, err := exec.CommandContext(ctx, path, "--version").Output()
+	if err != nil {
+		f.Level = LevelWarning
+		f.Message = fmt.Sprintf("%s found at %s but failed to report its version: %v", m.config.ClaudeCommand, path, err)
+		f.Hint = "Check that the agent runs correctly outside claude-mux"
+		return f
+	}
+
+	version := strings.TrimSpace(strings.SplitN(string(output), "\n", 2)[0])
+	f.Message = fmt.Sprintf("%s %s (%s)", m.config.ClaudeCommand, version, path)
+	return f
+}
+
+// checkBaseIgnored verifies that the worktree base path is usable and does
+// not show up as untracked content in the main checkout
+func (m *Manager) checkBaseIgnored() Finding {
+	f := Finding{Check: "Base path"}
+	basePath := m.basePath()
+
+	if info, err := os.Stat(basePath); err == nil && !info.IsDir() {
+		f.Level = LevelError
+		f.Message = fmt.Sprintf("%s exists but is not a directory", basePath)
+		f.Hint = "Remove the file or pass a different --base-path"
+		return f
+	}
+
+	pattern, ignored, err := m.baseIgnoreStatus()
+	switch {
+	case err != nil:
+		f.Level = LevelError
+		f.Message = fmt.Sprintf("failed to check ignore status: %v", err)
+	case pattern == "":
+		f.Message = fmt.Sprintf("%s is outside the repository", basePath)
+	case ignored:
+		f.Message = fmt.Sprintf("%s is ignored by git", basePath)
+	default:
+		f.Level = LevelWarning
+		f.Message = fmt.Sprintf("%s is inside the repository but not ignored", basePath)
+		excludeFile, err := m.git.ExcludeFile()
+		if err != nil {
+			excludeFile = "$(git rev-parse --git-path info/exclude)"
+		}
+		f.Hint = fmt.Sprintf("Add it manually with: echo '%s' >> %s", pattern, excludeFile)
+		f.fix = m.ensureBaseIgnored
+	}
+	return f
+}
+
+// checkPrunableWorktrees reports worktree metadata git would prune
+func (m *Manager) checkPrunableWorktrees() []Finding {
+	f := Finding{Check: "Stale worktrees"}
+
+	stale, err := m.git.PruneWorktrees(true)
+	switch {
+	case err != nil:
+		f.Level = LevelError
+		f.Message = err.Error()
+	case len(stale) == 0:
+		f.Message = "no stale worktree metadata"
+	default:
+		f.Level = LevelWarning
+		f.Message = fmt.Sprintf("%d stale worktree entries: %s", len(stale), strings.Join(stale, "; "))
+		f.Hint = "Run: git worktree prune"
+		f.fix = m.pruneWorktreeMetadata
+	}
+	return []Finding{f}
+}
+
+// checkMissingWorktrees reports claude-mux worktrees whose directories are gone
+func (m *Manager) checkMissingWorktrees() []Finding {
+	worktrees, err := m.git.ListWorktrees()
+	if err != nil {
+		return []Finding{{Check: "Worktree directories", Level: LevelError, Message: err.Error()}}
+	}
+
+	var findings []Finding
+	for _, wt := range worktrees {
+		if !m.isClaudeWorktree(wt) {
+			continue
+		}
+		if _, err := os.Stat(wt.Path); !os.IsNotExist(err) {
+			continue
+		}
+
+		f := Finding{
+			Check:   "Worktree directories",
+			Level:   LevelWarning,
+			Message: fmt.Sprintf("%s is registered but its directory is missing", wt.Path),
+		}
+		if wt.Locked {
+			// Locks are deliberate, so never override them automatically
+			f.Hint = fmt.Sprintf("Run: git worktree unlock %s && git worktree prune", wt.Path)
+		} else {
+			f.Hint = "Run: git worktree prune"
+			f.fix = m.pruneWorktreeMetadata
+		}
+		findings = append(findings, f)
+	}
+
+	if len(findings) == 0 {
+		findings = append(findings, Finding{
+			Check:   "Worktree directories",
+			Message: "all claude-mux worktrees are present",
+		})
+	}
+	return findings
+}
+
+// checkOrphanBranches reports claude-mux branches without a worktree
+func (m *Manager) checkOrphanBranches() []Finding {
+	orphans, err := m.orphanBranches()
+	if err != nil {
+		return []Finding{{Check: "Orphaned branches", Level: LevelError, Message: err.Error()}}
+	}
+	if len(orphans) == 0 {
+		return []Finding{{Check: "Orphaned branches", Message: "every claude-mux branch has a worktree"}}
+	}
+
+	findings := make([]Finding, 0, len(orphans))
+	for _, branch := range orphans {
+		findings = append(findings, Finding{
+			Check:   "Orphaned branches",
+			Level:   LevelWarning,
+			Message: fmt.Sprintf("%s has no worktree", branch),
+			Hint:    "Run 'claude-mux prune' to delete merged orphans, or 'claude-mux prune --force' to delete all",
+			fix: func() error {
+				// Only merged branches are deleted; unmerged work is kept
+				err := m.git.DeleteBranch(branch, false)
+				if git.IsNotMerged(err) {
+					return fmt.Errorf("branch has unmerged changes, delete it with: git branch -D %s", branch)
+				}
+				return err
+			},
+		})
+	}
+	return findings
+}
+
+// checkLocks reports locked claude-mux worktrees and leftover index lock files
+func (m *Manager) checkLocks() []Finding {
+	var findings []Finding
+
+	worktrees, err := m.git.ListWorktrees()
+	if err != nil {
+		return []Finding{{Check: "Locks", Level: LevelError, Message: err.Error()}}
+	}
+	for _, wt := range worktrees {
+		if m.isClaudeWorktree(wt) && wt.Locked {
+			findings = append(findings, Finding{
+				Check:   "Locks",
+				Level:   LevelWarning,
+				Message: fmt.Sprintf("worktree %s is locked", wt.Path),
+				Hint:    fmt.Sprintf("If the lock is no longer needed, run: git worktree unlock %s", wt.Path),
+			})
+		}
+	}
+
+	lockFiles, err := m.indexLockFiles()
+	if err != nil {
+		return append(findings, Finding{Check: "Locks", Level: LevelError, Message: err.Error()})
+	}
+	for _, lockFile := range lockFiles {
+		info, err := os.Stat(lockFile)
+		if err != nil {
+			continue
+		}
+
+		f := Finding{
+			Check:   "Locks",
+			Level:   LevelWarning,
+			Message: fmt.Sprintf("%s exists (modified %s ago)", lockFile, time.Since(info.ModTime()).Round(time.Second)),
+			Hint:    fmt.Sprintf("If no git command is running, remove it with: rm %s", lockFile),
+		}
+		if time.Since(info.ModTime()) > staleLockAge {
+			f.fix = func() error { return os.Remove(lockFile) }
+		}
+		findings = append(findings, f)
+	}
+
+	if len(findings) == 0 {
+		findings = append(findings, Finding{Check: "Locks", Message: "no locked worktrees or lock files"})
+	}
+	return findings
+}
+
+// indexLockFiles returns the index lock files present in the repository and
+// its linked worktrees
+func (m *Manager) indexLockFiles() ([]string, error) {
+	commonDir, err := m.git.CommonDir()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []string{filepath.Join(commonDir, "index.lock")}
+	linked, err := filepath.Glob(filepath.Join(commonDir, "worktrees", "*", "index.lock"))
+	if err != nil {
+		return nil, err
+	}
+	candidates = append(candidates, linked...)
+
+	var lockFiles []string
+	for _, candidate := range candidates {
+		if _, err := os.Stat(candidate); err == nil {
+			lockFiles = append(lockFiles, candidate)
+		}
+	}
+	return lockFiles, nil
+}
+
+// orphanBranches returns claude-mux branches that are not checked out in any worktree
+func (m *Manager) orphanBranches() ([]string, error) {
+	branches, err := m.git.ListBranches("claude-mux-*")
+	if err != nil {
+		return nil, err
+	}
+
+	worktrees, err := m.git.ListWorktrees()
+	if err != nil {
+		return nil, err
+	}
+	checkedOut := make(map[string]bool, len(worktrees))
+	for _, wt := range worktrees {
+		checkedOut[wt.Branch] = true
+	}
+
+	var orphans []string
+	for _, branch := range branches {
+		if !checkedOut[branch] {
+			orphans = append(orphans, branch)
+		}
+	}
+	return orphans, nil
+}
+
+// pruneWorktreeMetadata removes administrative data for vanished worktrees
+func (m *Manager) pruneWorktreeMetadata() error {
+	_, err := m.git.PruneWorktrees(false)
+	return err
+}
+
+// baseIgnoreStatus returns the exclude pattern for the base path and whether
+// git already ignores it. The pattern is empty when the base path lives
+// outside the repository.
+func (m *Manager) baseIgnoreStatus() (string, bool, error) {
+	basePath := m.basePath()
+	if !isWithin(m.root, basePath) {
+		return "", false, nil
+	}
+
+	rel, err := filepath.Rel(resolvePath(m.root), resolvePath(basePath))
+	if err != nil {
+		return "", false, err
+	}
+	pattern := "/" + filepath.ToSlash(rel) + "/"
+
+	ignored, err := m.git.IsIgnored(basePath + string(filepath.Separator))
+	if err != nil {
+		return "", false, err
+	}
+	return pattern, ignored, nil
+}
+
+// ensureBaseIgnored adds the base path to .git/info/exclude when it lives
+// inside the repository and is not ignored yet. Tracked files such as
+// .gitignore are never modified.
+func (m *Manager) ensureBaseIgnored() error {
+	pattern, ignored, err := m.baseIgnoreStatus()
+	if err != nil || pattern == "" || ignored {
+		return err
+	}
+
+	added, err := m.git.AddExclude(pattern)
+	if err != nil {
+		return err
+	}
+	if added {
+		m.emit(Event{Type: EventExcluded, Message: pattern})
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package worktree
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/git"
+)
+
+func TestManager_ensureBaseIgnored(t *testing.T) {
+	t.Parallel()
+
+	repoDir := setupTestRepo(t)
+	manager := NewManager(config.Config{
+		RepoDir:          repoDir,
+		WorktreeBasePath: ".claude-mux-test",
+		ClaudeCommand:    "echo",
+	})
+	if err := manager.resolveRepo(); err != nil {
+		t.Fatalf("resolveRepo() error = %v", err)
+	}
+
+	if f := manager.checkBaseIgnored(); f.Level != LevelWarning {
+		t.Errorf("Expected a warning before excluding, got %+v", f)
+	}
+
+	// Running twice must only add the pattern once
+	for i := 0; i < 2; i++ {
+		if err := manager.ensureBaseIgnored(); err != nil {
+			t.Fatalf("ensureBaseIgnored() error = %v", err)
+		}
+	}
+
+	if f := manager.checkBaseIgnored(); f.Level != LevelOK {
+		t.Errorf("Expected base path to be ignored, got %+v", f)
+	}
+
+	exclude, err := os.ReadFile(filepath.Join(repoDir, ".git", "info", "exclude"))
+	if err != nil {
+		t.Fatalf("Failed to read exclude file: %v", err)
+	}
+	if got := strings.Count(string(exclude), "/.claude-mux-test/"); got != 1 {
+		t.Errorf("Expected pattern to appear once in exclude file, got %d:\n%s", got, exclude)
+	}
+
+	if _, err := os.Stat(filepath.Join(repoDir, ".gitignore")); !os.IsNotExist(err) {
+		t.Errorf("Expected .gitignore to be left alone, stat error = %v", err)
+	}
+}
+
+func TestManager_checkBaseIgnored(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		basePath  func(repoDir string) string
+		gitignore string
+		want      FindingLevel
+	}{
+		{"not ignored", func(string) string { return ".claude-mux-test" }, "", LevelWarning},
+		{"ignored by .gitignore", func(string) string { return ".claude-mux-test" }, ".claude-mux-test/\n", LevelOK},
+		{"outside repository", func(string) string { return t.TempDir() }, "", LevelOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repoDir := setupTestRepo(t)
+			if tt.gitignore != "" {
+				if err := os.WriteFile(filepath.Join(repoDir, ".gitignore"), []byte(tt.gitignore), 0644); err != nil {
+					t.Fatalf("Failed to write .gitignore: %v", err)
+				}
+			}
+
+			manager := NewManager(config.Config{
+				RepoDir:          repoDir,
+				WorktreeBasePath: tt.basePath(repoDir),
+				ClaudeCommand:    "echo",
+			})
+			if err := manager.resolveRepo(); err != nil {
+				t.Fatalf("resolveRepo() error = %v", err)
+			}
+
+			if got := manager.checkBaseIgnored(); got.Level != tt.want {
+				t.Errorf("checkBaseIgnored() = %+v, want level %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"2.39.5", true},
+		{"2.17.0", true},
+		{"2.16.6", false},
+		{"1.9.5", false},
+		{"3.0", true},
+		{"2.45.1.windows.1", true},
+		{"unknown", false},
+	}
+
+	for _, tt := range tests {
+		if got := versionAtLeast(tt.version, minGitVersion); got != tt.want {
+			t.Errorf("versionAtLeast(%q) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestManager_Doctor(t *testing.T) {
+	t.Parallel()
+
+	repoDir := setupTestRepo(t)
+	manager := NewManager(config.Config{
+		RepoDir:          repoDir,
+		WorktreeBasePath: ".claude-mux-test",
+		ClaudeCommand:    "git", // any executable that understands --version
+	})
+
+	// A worktree whose directory was deleted by hand
+	missingPath := filepath.Join(repoDir, ".claude-mux-test", "missing-abc123")
+	runGit(t, repoDir, "worktree", "add", "-b", "claude-mux-main-missing-abc123", missingPath)
+	if err := os.RemoveAll(missingPath); err != nil {
+		t.Fatalf("Failed to remove worktree directory: %v", err)
+	}
+
+	// A merged branch left behind without a worktree
+	runGit(t, repoDir, "branch", "claude-mux-main-orphan-def456")
+
+	// problems runs doctor and returns the findings that still need attention
+	problems := func(fix bool) []Finding {
+		t.Helper()
+		findings, err := manager.Doctor(context.Background(), fix)
+		if err != nil {
+			t.Fatalf("Doctor() error = %v", err)
+		}
+		var remaining []Finding
+		for _, f := range findings {
+			if f.Problem() {
+				remaining = append(remaining, f)
+			}
+		}
+		return remaining
+	}
+
+	if got := problems(false); len(got) == 0 {
+		t.Fatal("Expected Doctor() to report problems")
+	}
+
+	orphans, err := manager.orphanBranches()
+	if err != nil {
+		t.Fatalf("orphanBranches() error = %v", err)
+	}
+	if len(orphans) != 1 || orphans[0] != "claude-mux-main-orphan-def456" {
+		t.Errorf("orphanBranches() = %v, want [claude-mux-main-orphan-def456]", orphans)
+	}
+
+	if got := problems(true); len(got) != 0 {
+		t.Fatalf("Expected Doctor(fix) to fix everything, remaining: %+v", got)
+	}
+
+	// After fixing, the branch of the pruned worktree is orphaned too and
+	// gets cleaned up by a second pass
+	if got := problems(true); len(got) != 0 {
+		t.Fatalf("Expected second Doctor(fix) to fix everything, remaining: %+v", got)
+	}
+	if got := problems(false); len(got) != 0 {
+		t.Errorf("Expected no problems after fixing, got: %+v", got)
+	}
+}
+
+func TestManager_DoctorFixErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		failure error
+		wantErr string
+	}{
+		{name: "unmerged", wantErr: "unmerged changes"},
+		{name: "other failure", failure: &git.Error{Subcommand: "branch", ExitCode: 1, Stderr: "error: cannot lock ref"}, wantErr: "cannot lock ref"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			manager, backend := newFakeManager(t)
+			backend.AddBranch("claude-mux-main-orphan-def456", false)
+			if tt.failure != nil {
+				backend.FailOn("DeleteBranch", tt.failure)
+			}
+
+			findings, err := manager.Doctor(context.Background(), true)
+			if err != nil {
+				t.Fatalf("Doctor() error = %v", err)
+			}
+			for _, f := range findings {
+				if f.Check == "Orphaned branches" {
+					if f.FixErr == nil || !strings.Contains(f.FixErr.Error(), tt.wantErr) {
+						t.Errorf("Expected the fix to fail with %q, got %v", tt.wantErr, f.FixErr)
+					}
+					return
+				}
+			}
+			t.Errorf("Expected an orphaned branch finding, got %+v", findings)
+		})
+	}
+}
+
+func TestManager_DoctorExcludeHint(t *testing.T) {
+	t.Parallel()
+
+	manager, _ := newFakeManager(t)
+	excludeFile, err := manager.git.ExcludeFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	findings, err := manager.Doctor(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Doctor() error = %v", err)
+	}
+	for _, f := range findings {
+		if strings.Contains(f.Hint, "echo '/.claude-mux/'") {
+			if !strings.HasSuffix(f.Hint, ">> "+excludeFile) {
+				t.Errorf("Expected the hint to point at %s, got %q", excludeFile, f.Hint)
+			}
+			return
+		}
+	}
+	t.Errorf("Expected a hint to exclude the base path, got %+v", findings)
+}
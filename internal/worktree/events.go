@@ -0,0 +1,82 @@
+package worktree
+
+// EventType identifies a step in a session's lifecycle
+type EventType string
+
+const (
+	// EventExcluded is emitted after the base path was added to .git/info/exclude.
+	// Message holds the added pattern.
+	EventExcluded EventType = "excluded"
+	// EventCreating is emitted before a session worktree is created
+	EventCreating EventType = "creating"
+	// EventRetrying is emitted when a generated session name collided and a new one is tried
+	EventRetrying EventType = "retrying"
+	// EventCreated is emitted once a session worktree exists
+	EventCreated EventType = "created"
+	// EventLaunching is emitted before the agent starts
+	EventLaunching EventType = "launching"
+	// EventStopping is emitted when the agent is asked to exit because the
+	// operation was canceled or claude-mux received a stop signal. Message
+	// holds the reason.
+	EventStopping EventType = "stopping"
+	// EventExited is emitted after the agent exited. Err holds its failure, if any.
+	EventExited EventType = "exited"
+	// EventCommitted is emitted after the agent's work was committed once it
+	// exited. Message holds the autocommit policy.
+	EventCommitted EventType = "committed"
+	// EventCheckpointed is emitted after a checkpoint was taken outside of
+	// the periodic checkpoints. Message holds its number.
+	EventCheckpointed EventType = "checkpointed"
+	// EventRolledBack is emitted after a worktree was restored to a
+	// checkpoint. Message holds its number.
+	EventRolledBack EventType = "rolled_back"
+	// EventCleaningUp is emitted before an automatic cleanup
+	EventCleaningUp EventType = "cleaning_up"
+	// EventWorktreeRemoved is emitted after a session worktree was removed
+	EventWorktreeRemoved EventType = "worktree_removed"
+	// EventBranchDeleted is emitted after a session branch was deleted
+	EventBranchDeleted EventType = "branch_deleted"
+	// EventBranchPreserved is emitted when a branch was kept because of unmerged changes
+	EventBranchPreserved EventType = "branch_preserved"
+	// EventMerged is emitted after a session branch was merged. Message holds the target branch.
+	EventMerged EventType = "merged"
+	// EventArchived is emitted after a session was archived. Message holds
+	// the ref that keeps its commits.
+	EventArchived EventType = "archived"
+	// EventCompleted is emitted when a session ends and its worktree is kept
+	EventCompleted EventType = "completed"
+	// EventWarning reports a problem that did not stop the operation
+	EventWarning EventType = "warning"
+)
+
+// Event reports progress of a Manager operation
+type Event struct {
+	Type EventType
+	// Session, Branch and Path identify the session the event is about, if any
+	Session string
+	Branch  string
+	Path    string
+	// Message carries event specific details
+	Message string
+	// Hint suggests how to resolve a warning
+	Hint string
+	// Err is the error behind a warning or failed step
+	Err error
+}
+
+// emit delivers an event to the registered handler
+func (m *Manager) emit(e Event) {
+	if m.onEvent != nil {
+		m.onEvent(e)
+	}
+}
+
+// sessionEvent builds an event about the session described by details
+func sessionEvent(t EventType, details WorktreeDetails) Event {
+	return Event{
+		Type:    t,
+		Session: details.Name,
+		Branch:  details.Branch,
+		Path:    details.Path,
+	}
+}
@@ -0,0 +1,73 @@
+package worktree
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/sandbox"
+)
+
+// isolation starts the agents of sessions, on the host or in a container
+type isolation interface {
+	// command prepares the command running the agent of a session with
+	// args. tty tells whether it runs in a terminal. release frees what
+	// the agent needed once it exited.
+	command(details WorktreeDetails, tty bool, args []string) (cmd *exec.Cmd, release func(), err error)
+	// limit applies the configured resource limits to the agent of a
+	// session before cmd starts
+	limit(details WorktreeDetails, cmd *exec.Cmd) agentCgroup
+	// container returns the container the agent of a session runs in,
+	// nil on the host
+	container(details WorktreeDetails) *agentContainer
+}
+
+// newIsolation returns the configured isolation of m
+func newIsolation(m *Manager) isolation {
+	if m.config.Isolation == config.IsolationContainer {
+		return containerIsolation{m: m}
+	}
+	return hostIsolation{m: m}
+}
+
+// hostIsolation runs agents as processes on the host, in the sandbox and
+// isolated network if enabled
+type hostIsolation struct {
+	m *Manager
+}
+
+func (h hostIsolation) command(details WorktreeDetails, _ bool, args []string) (cmd *exec.Cmd, release func(), err error) {
+	m := h.m
+	// #nosec G204 -- ClaudeCommand comes from user config, not untrusted input
+	cmd = exec.Command(m.config.ClaudeCommand, args...)
+	cmd.Dir = details.Path
+	cmd.Env = sessionEnv(details)
+	if cmd.Err != nil {
+		return cmd, func() {}, nil
+	}
+
+	var policy sandbox.Policy
+	if m.config.Sandbox {
+		policy = m.sandboxPolicy(details)
+	}
+	policy.Network, release, err = m.agentNetwork(details)
+	if err != nil {
+		return nil, nil, err
+	}
+	if policy.Writable == nil && policy.Network == nil {
+		return cmd, release, nil
+	}
+	if err := sandbox.Wrap(cmd, policy); err != nil {
+		release()
+		return nil, nil, fmt.Errorf("failed to sandbox Claude: %w", err)
+	}
+	return cmd, release, nil
+}
+
+func (h hostIsolation) limit(details WorktreeDetails, cmd *exec.Cmd) agentCgroup {
+	return h.m.limitAgent(details, cmd)
+}
+
+func (hostIsolation) container(WorktreeDetails) *agentContainer {
+	return nil
+}
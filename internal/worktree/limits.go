@@ -0,0 +1,34 @@
+package worktree
+
+import (
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/config"
+)
+
+// ResourceUsage is what an agent running under resource limits uses,
+// together with all of its children
+type ResourceUsage struct {
+	// Limits are the limits the agent runs under
+	Limits config.Limits
+	// CPUTime is the CPU time used since the agent started
+	CPUTime time.Duration
+	// Memory is the memory in use, in bytes
+	Memory int64
+	// PIDs is the number of processes and threads
+	PIDs int
+}
+
+// agentCgroup is how an agent is placed under the configured resource limits
+type agentCgroup struct {
+	// limited is set when the limits apply to the agent
+	limited bool
+	// path is the cgroup created for the agent, removed once it exited. It
+	// is empty when systemd manages the cgroup.
+	path string
+	// release runs once the agent started, or failed to
+	release func(started bool)
+}
+
+// unlimited is the agentCgroup of agents running without limits
+var unlimited = agentCgroup{release: func(bool) {}}
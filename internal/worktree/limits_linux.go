@@ -0,0 +1,331 @@
+package worktree
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/config"
+	"golang.org/x/sys/unix"
+)
+
+// supervisorCgroup is the leaf claude-mux moves into when the cgroup it
+// runs in must pass controllers on to the cgroups of agents
+const supervisorCgroup = "claude-mux.supervisor"
+
+// cgroupFS is a cgroup v2 hierarchy and the proc file system telling which
+// cgroups processes run in
+type cgroupFS struct {
+	root string
+	proc string
+}
+
+// hostCgroups is the cgroup v2 hierarchy of the host
+var hostCgroups = cgroupFS{root: "/sys/fs/cgroup", proc: "/proc"}
+
+// limitAgent prepares cmd to run under the configured resource limits. A
+// cgroup below the one claude-mux runs in is used when it was delegated
+// to the user, and a transient systemd scope otherwise. When neither
+// works, the agent runs without limits.
+func (m *Manager) limitAgent(details WorktreeDetails, cmd *exec.Cmd) agentCgroup {
+	limits := m.config.Limits
+	if limits.IsZero() || cmd.Err != nil {
+		return unlimited
+	}
+
+	cgroup, err := hostCgroups.startIn(cmd, details.Name, limits)
+	if err == nil {
+		return cgroup
+	}
+	scopeErr := systemdScope(cmd, details.Name, limits)
+	if scopeErr == nil {
+		return agentCgroup{limited: true, release: func(bool) {}}
+	}
+
+	warning := sessionEvent(EventWarning, details)
+	warning.Message = "Resource limits are not applied"
+	warning.Err = fmt.Errorf("no delegated cgroup: %w; systemd-run: %w", err, scopeErr)
+	warning.Hint = "Run claude-mux in a cgroup v2 subtree delegated to you, or where systemd-run --user works"
+	m.emit(warning)
+	return unlimited
+}
+
+// startIn creates the cgroup of a session's agent and makes cmd start in it
+func (c cgroupFS) startIn(cmd *exec.Cmd, name string, limits config.Limits) (agentCgroup, error) {
+	path, err := c.create(name, limits)
+	if err != nil {
+		return agentCgroup{}, err
+	}
+	dir, err := os.Open(path) // #nosec G304 -- path below the cgroup claude-mux runs in
+	if err != nil {
+		_ = os.Remove(path)
+		return agentCgroup{}, err
+	}
+
+	// The agent starts in the cgroup, so none of its children escape it
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+	return agentCgroup{limited: true, path: path, release: func(started bool) {
+		_ = dir.Close()
+		if !started {
+			_ = os.Remove(path)
+		}
+	}}, nil
+}
+
+// create makes a cgroup for the agent of a session below the cgroup
+// claude-mux runs in and applies limits to it
+func (c cgroupFS) create(name string, limits config.Limits) (string, error) {
+	own, err := c.of(os.Getpid())
+	if err != nil {
+		return "", err
+	}
+	parent := filepath.Join(c.root, own)
+	if filepath.Base(parent) == supervisorCgroup {
+		parent = filepath.Dir(parent)
+	}
+	if err := c.enableControllers(parent, limitControllers(limits)); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(parent, "claude-mux-"+filepath.Base(name))
+	if err := os.Mkdir(path, 0750); err != nil && !errors.Is(err, fs.ErrExist) {
+		return "", err
+	}
+	for _, file := range limitFiles(limits) {
+		if err := os.WriteFile(filepath.Join(path, file[0]), []byte(file[1]), 0600); err != nil {
+			_ = os.Remove(path)
+			return "", fmt.Errorf("failed to set %s: %w", file[0], err)
+		}
+	}
+	return path, nil
+}
+
+// enableControllers makes the controllers available to the children of
+// the cgroup dir
+func (c cgroupFS) enableControllers(dir string, controllers []string) error {
+	available, err := os.ReadFile(filepath.Join(dir, "cgroup.controllers")) // #nosec G304 -- path in the cgroup file system
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("cgroup v2 is not available in %s", dir)
+	}
+	if err != nil {
+		return err
+	}
+	enabled, err := os.ReadFile(filepath.Join(dir, "cgroup.subtree_control")) // #nosec G304 -- path in the cgroup file system
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for _, controller := range controllers {
+		if !slices.Contains(strings.Fields(string(available)), controller) {
+			return fmt.Errorf("the %s controller is not delegated to %s", controller, dir)
+		}
+		if !slices.Contains(strings.Fields(string(enabled)), controller) {
+			missing = append(missing, "+"+controller)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	enable := func() error {
+		return os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte(strings.Join(missing, " ")), 0600)
+	}
+	err = enable()
+	if !errors.Is(err, unix.EBUSY) {
+		return err
+	}
+	// Only cgroups without processes pass controllers on. When claude-mux
+	// is the only process, e.g. in a systemd service with Delegate=yes, it
+	// moves into a leaf of its own.
+	if err := c.moveSelf(dir); err != nil {
+		return err
+	}
+	return enable()
+}
+
+// moveSelf moves claude-mux from the cgroup dir into a leaf below it
+func (c cgroupFS) moveSelf(dir string) error {
+	procs, err := os.ReadFile(filepath.Join(dir, "cgroup.procs")) // #nosec G304 -- path in the cgroup file system
+	if err != nil {
+		return err
+	}
+	self := strconv.Itoa(os.Getpid())
+	if pids := strings.Fields(string(procs)); len(pids) != 1 || pids[0] != self {
+		return fmt.Errorf("%s holds other processes", dir)
+	}
+
+	leaf := filepath.Join(dir, supervisorCgroup)
+	if err := os.Mkdir(leaf, 0750); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return os.WriteFile(filepath.Join(leaf, "cgroup.procs"), []byte(self), 0600)
+}
+
+// of returns the cgroup v2 process pid runs in, relative to the root of
+// the hierarchy
+func (c cgroupFS) of(pid int) (string, error) {
+	file, err := os.Open(filepath.Join(c.proc, strconv.Itoa(pid), "cgroup")) // #nosec G304 -- path in the proc file system
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if path, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return path, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("cgroup v2 is not in use")
+}
+
+// usage reads what the processes in the cgroup at path use. Values of
+// controllers that are not enabled are zero.
+func (c cgroupFS) usage(path string) (ResourceUsage, error) {
+	if _, err := os.Stat(path); err != nil {
+		return ResourceUsage{}, err
+	}
+
+	var usage ResourceUsage
+	if stat, err := os.ReadFile(filepath.Join(path, "cpu.stat")); err == nil { // #nosec G304 -- path in the cgroup file system
+		for line := range bytes.Lines(stat) {
+			if value, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("usage_usec ")); ok {
+				usec, _ := strconv.ParseInt(string(value), 10, 64)
+				usage.CPUTime = time.Duration(usec) * time.Microsecond
+			}
+		}
+	}
+	if value, err := readCgroupInt(filepath.Join(path, "memory.current")); err == nil {
+		usage.Memory = value
+	}
+	if value, err := readCgroupInt(filepath.Join(path, "pids.current")); err == nil {
+		usage.PIDs = int(value)
+	}
+	return usage, nil
+}
+
+// cgroupUsage reads what the agent process pid uses, in the cgroup path
+// created for it or the scope systemd created
+func cgroupUsage(path string, pid int) (ResourceUsage, error) {
+	if path == "" {
+		own, err := hostCgroups.of(pid)
+		if err != nil {
+			return ResourceUsage{}, err
+		}
+		path = filepath.Join(hostCgroups.root, own)
+	}
+	return hostCgroups.usage(path)
+}
+
+func readCgroupInt(path string) (int64, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path in the cgroup file system
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// limitControllers returns the cgroup controllers enforcing limits
+func limitControllers(limits config.Limits) []string {
+	var controllers []string
+	if limits.CPUs > 0 {
+		controllers = append(controllers, "cpu")
+	}
+	if limits.Memory > 0 {
+		controllers = append(controllers, "memory")
+	}
+	if limits.PIDs > 0 {
+		controllers = append(controllers, "pids")
+	}
+	return controllers
+}
+
+// cpuPeriod is the period the CPU quota of a cgroup applies to, in microseconds
+const cpuPeriod = 100000
+
+// limitFiles returns the cgroup interface files setting limits, with
+// their values
+func limitFiles(limits config.Limits) [][2]string {
+	var files [][2]string
+	if limits.CPUs > 0 {
+		quota := int64(math.Ceil(limits.CPUs * cpuPeriod))
+		files = append(files, [2]string{"cpu.max", fmt.Sprintf("%d %d", quota, cpuPeriod)})
+	}
+	if limits.Memory > 0 {
+		files = append(files, [2]string{"memory.max", strconv.FormatInt(limits.Memory, 10)})
+	}
+	if limits.PIDs > 0 {
+		files = append(files, [2]string{"pids.max", strconv.Itoa(limits.PIDs)})
+	}
+	return files
+}
+
+// probeSystemd checks once whether systemd-run can create scopes for the
+// current user
+var probeSystemd = sync.OnceValues(func() (string, error) {
+	path, err := exec.LookPath("systemd-run")
+	if err != nil {
+		return "", err
+	}
+	args := append(scopeArgs("claude-mux probe", config.Limits{}), "true")
+	// #nosec G204 -- fixed arguments
+	if out, err := exec.Command(path, args...).CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return "", errors.New(strings.ReplaceAll(msg, "\n", " "))
+		}
+		return "", err
+	}
+	return path, nil
+})
+
+// systemdScope makes cmd run in a transient systemd scope enforcing limits.
+// systemd-run executes the agent itself, so its process ID stays the same.
+func systemdScope(cmd *exec.Cmd, name string, limits config.Limits) error {
+	path, err := probeSystemd()
+	if err != nil {
+		return err
+	}
+	args := append([]string{path}, scopeArgs("claude-mux session "+name, limits)...)
+	cmd.Args = append(append(args, cmd.Path), cmd.Args[1:]...)
+	cmd.Path = path
+	return nil
+}
+
+// scopeArgs returns the systemd-run arguments running a command in a
+// transient scope with limits, before the command
+func scopeArgs(description string, limits config.Limits) []string {
+	args := []string{"--scope", "--quiet", "--collect", "--description=" + description}
+	if os.Geteuid() != 0 {
+		args = append(args, "--user")
+	}
+	if limits.CPUs > 0 {
+		args = append(args, fmt.Sprintf("--property=CPUQuota=%d%%", int64(math.Ceil(limits.CPUs*100))))
+	}
+	if limits.Memory > 0 {
+		args = append(args, fmt.Sprintf("--property=MemoryMax=%d", limits.Memory))
+	}
+	if limits.PIDs > 0 {
+		args = append(args, fmt.Sprintf("--property=TasksMax=%d", limits.PIDs))
+	}
+	return append(args, "--")
+}
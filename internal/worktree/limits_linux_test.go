@@ -0,0 +1,168 @@
+package worktree
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/config"
+)
+
+// fakeCgroups creates a cgroup file system in which the current process
+// runs in /user.slice/claude-mux with the given controllers
+func fakeCgroups(t *testing.T, available, enabled string) (cgroupFS, string) {
+	t.Helper()
+	c := cgroupFS{root: t.TempDir(), proc: t.TempDir()}
+	own := filepath.Join(c.root, "user.slice", "claude-mux")
+	self := filepath.Join(c.proc, strconv.Itoa(os.Getpid()))
+	for dir, files := range map[string]map[string]string{
+		own:  {"cgroup.controllers": available, "cgroup.subtree_control": enabled},
+		self: {"cgroup": "0::/user.slice/claude-mux\n"},
+	} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range files {
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return c, own
+}
+
+func TestCgroupFS_Create(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		limits    config.Limits
+		available string
+		enabled   string
+		// want maps the files of the session cgroup to their content,
+		// nil when creating it fails
+		want        map[string]string
+		wantEnabled string
+	}{
+		{
+			name:      "all limits",
+			limits:    config.Limits{CPUs: 1.5, Memory: 4 << 30, PIDs: 256},
+			available: "cpuset cpu io memory pids",
+			enabled:   "cpu memory pids",
+			want: map[string]string{
+				"cpu.max":    "150000 100000",
+				"memory.max": "4294967296",
+				"pids.max":   "256",
+			},
+			wantEnabled: "cpu memory pids",
+		},
+		{
+			name:        "enables controllers",
+			limits:      config.Limits{Memory: 1 << 30},
+			available:   "cpu memory pids",
+			want:        map[string]string{"memory.max": "1073741824"},
+			wantEnabled: "+memory",
+		},
+		{
+			name:      "controller not delegated",
+			limits:    config.Limits{CPUs: 2},
+			available: "memory pids",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			c, own := fakeCgroups(t, tt.available, tt.enabled)
+
+			path, err := c.create("task-1a2b3c", tt.limits)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("create() = %s, want an error", path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("create() error = %v", err)
+			}
+			if want := filepath.Join(own, "claude-mux-task-1a2b3c"); path != want {
+				t.Errorf("create() = %s, want %s", path, want)
+			}
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]string{}
+			for _, e := range entries {
+				content, _ := os.ReadFile(filepath.Join(path, e.Name()))
+				got[e.Name()] = string(content)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected limits %v, got %v", tt.want, got)
+			}
+			if enabled, _ := os.ReadFile(filepath.Join(own, "cgroup.subtree_control")); string(enabled) != tt.wantEnabled {
+				t.Errorf("Expected subtree controllers %q, got %q", tt.wantEnabled, enabled)
+			}
+		})
+	}
+}
+
+func TestCgroupFS_Usage(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"cpu.stat":       "usage_usec 2500000\nuser_usec 2000000\nsystem_usec 500000\n",
+		"memory.current": "536870912\n",
+		"pids.current":   "12\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := cgroupFS{}.usage(dir)
+	if err != nil {
+		t.Fatalf("usage() error = %v", err)
+	}
+	want := ResourceUsage{CPUTime: 2500 * time.Millisecond, Memory: 512 << 20, PIDs: 12}
+	if got != want {
+		t.Errorf("usage() = %+v, want %+v", got, want)
+	}
+
+	if _, err := (cgroupFS{}).usage(filepath.Join(dir, "gone")); err == nil {
+		t.Error("Expected the usage of a removed cgroup to fail")
+	}
+}
+
+func TestSystemdScope(t *testing.T) {
+	t.Parallel()
+
+	args := scopeArgs("claude-mux session task", config.Limits{CPUs: 0.5, Memory: 1 << 30, PIDs: 64})
+	want := []string{
+		"--property=CPUQuota=50%",
+		"--property=MemoryMax=1073741824",
+		"--property=TasksMax=64",
+		"--",
+	}
+	if got := args[len(args)-len(want):]; !reflect.DeepEqual(got, want) {
+		t.Errorf("scopeArgs() ends with %v, want %v", got, want)
+	}
+}
+
+func TestManager_LimitAgentUnlimited(t *testing.T) {
+	t.Parallel()
+
+	manager := NewManager(config.Config{})
+	cmd := exec.Command("claude", "--continue")
+	if cgroup := manager.limitAgent(WorktreeDetails{Name: "task"}, cmd); cgroup.limited {
+		t.Error("Expected agents without limits to run unlimited")
+	}
+	if cmd.SysProcAttr != nil || len(cmd.Args) != 2 {
+		t.Errorf("Expected the command to be unchanged, got %v", cmd.Args)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !linux
+
+package worktree
+
+import (
+	"errors"
+	"os/exec"
+)
+
+// limitAgent runs agents without limits, which need Linux cgroups
+func (m *Manager) limitAgent(details WorktreeDetails, _ *exec.Cmd) agentCgroup {
+	if !m.config.Limits.IsZero() {
+		warning := sessionEvent(EventWarning, details)
+		warning.Message = "Resource limits are only supported on Linux and are not applied"
+		m.emit(warning)
+	}
+	return unlimited
+}
+
+// cgroupUsage is not supported without Linux cgroups
+func cgroupUsage(string, int) (ResourceUsage, error) {
+	return ResourceUsage{}, errors.ErrUnsupported
+}
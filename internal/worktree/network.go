@@ -0,0 +1,123 @@
+package worktree
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/sandbox"
+)
+
+// NetworkMode decides what network the agent of a session may reach
+type NetworkMode string
+
+const (
+	// NetworkHost gives the agent the network of the host
+	NetworkHost NetworkMode = "host"
+	// NetworkNone gives the agent no network besides a loopback interface
+	// of its own
+	NetworkNone NetworkMode = "none"
+	// NetworkAllowlist only lets the agent reach the API endpoint and the
+	// allowed hosts, through a filtering proxy
+	NetworkAllowlist NetworkMode = "allowlist"
+)
+
+// ParseNetworkMode parses a network mode. An empty name means host.
+func ParseNetworkMode(s string) (NetworkMode, error) {
+	switch mode := NetworkMode(s); mode {
+	case "", NetworkHost:
+		return NetworkHost, nil
+	case NetworkNone, NetworkAllowlist:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid network mode %q, want host, none or allowlist", s)
+	}
+}
+
+// NetworkPolicy confines the network access of the agent of a session
+type NetworkPolicy struct {
+	Mode NetworkMode `json:"mode,omitempty"`
+	// Allow lists the hosts an allowlisted agent may reach besides the API
+	// endpoint: host names, *.domain wildcards or IP addresses, optionally
+	// with a port. Without one only port 443 is allowed.
+	Allow []string `json:"allow,omitempty"`
+}
+
+// Validate reports an error for hosts allowed without an allowlist
+func (p NetworkPolicy) Validate() error {
+	if len(p.Allow) > 0 && p.Mode != NetworkAllowlist {
+		return errors.New("allowed hosts need the allowlist network mode")
+	}
+	return nil
+}
+
+// networkPolicy returns the network policy a session was created with.
+// Sessions without metadata use the network of the host.
+func (m *Manager) networkPolicy(details WorktreeDetails) (NetworkPolicy, error) {
+	meta, err := m.readSessionMeta(details)
+	if errors.Is(err, fs.ErrNotExist) {
+		return NetworkPolicy{}, nil
+	}
+	if err != nil {
+		return NetworkPolicy{}, fmt.Errorf("failed to read the network policy: %w", err)
+	}
+	return meta.Network, nil
+}
+
+// defaultAPIHost is the API endpoint Claude Code talks to
+const defaultAPIHost = "api.anthropic.com"
+
+// apiHosts returns the hosts of the API endpoint, which allowlisted agents
+// always reach: the default one and the one ANTHROPIC_BASE_URL points to,
+// with its port
+func apiHosts() []string {
+	hosts := []string{defaultAPIHost}
+	base, err := url.Parse(os.Getenv("ANTHROPIC_BASE_URL"))
+	if err != nil || base.Hostname() == "" {
+		return hosts
+	}
+	port := base.Port()
+	if port == "" && base.Scheme == "http" {
+		port = "80"
+	}
+	if port == "" {
+		return append(hosts, base.Hostname())
+	}
+	return append(hosts, net.JoinHostPort(base.Hostname(), port))
+}
+
+// agentNetwork returns the network the agent of a session is confined to,
+// nil for the network of the host. With an allowlist it starts the proxy
+// the agent reaches allowed hosts through; stop shuts it down once the
+// agent exited.
+func (m *Manager) agentNetwork(details WorktreeDetails) (network *sandbox.Network, stop func(), err error) {
+	policy, err := m.networkPolicy(details)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch policy.Mode {
+	case NetworkNone:
+		return &sandbox.Network{}, func() {}, nil
+	case NetworkAllowlist:
+		allow := append(apiHosts(), policy.Allow...)
+		// Other agents may write to temporary directories, but not there
+		proxy, err := sandbox.ListenProxy(config.RuntimeDir(), allow, func(host string) {
+			warning := sessionEvent(EventWarning, details)
+			warning.Message = "Blocked network access to " + host
+			warning.Hint = fmt.Sprintf("Allowed hosts: %s", strings.Join(allow, ", "))
+			m.emit(warning)
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to start the network proxy: %w", err)
+		}
+		return &sandbox.Network{Proxy: proxy.Socket()}, func() { _ = proxy.Close() }, nil
+	default:
+		return nil, func() {}, nil
+	}
+}
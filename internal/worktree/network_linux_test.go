@@ -0,0 +1,48 @@
+package worktree
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestManager_NetworkAllowlist(t *testing.T) {
+	t.Parallel()
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl is not installed")
+	}
+	if _, err := os.Stat("/proc/self/ns/user"); err != nil {
+		t.Skip("user namespaces are not supported")
+	}
+
+	var stdout bytes.Buffer
+	events := &eventLog{}
+	manager, _ := newLoggingManager(t, &stdout)
+	manager.onEvent = events.record
+	manager.config.ClaudeCommand = writeAgent(t, `curl -s -o /dev/null -w '%{http_code}' http://blocked.invalid/ > "$CLAUDE_MUX_WORKTREE/out"`+"\n")
+
+	details, err := manager.CreateAndLaunch(context.Background(), CreateOptions{
+		Name:    "task",
+		Network: NetworkPolicy{Mode: NetworkAllowlist},
+	})
+	if err != nil {
+		t.Fatalf("CreateAndLaunch() error = %v, output %q", err, stdout.String())
+	}
+	if got, _ := os.ReadFile(filepath.Join(details.Path, "out")); string(got) != "403" {
+		t.Errorf("Expected the proxy to refuse the agent, got status %q", got)
+	}
+
+	events.mu.Lock()
+	defer events.mu.Unlock()
+	var blocked bool
+	for _, e := range events.events {
+		blocked = blocked || e.Type == EventWarning && strings.Contains(e.Message, "blocked.invalid")
+	}
+	if !blocked {
+		t.Errorf("Expected a warning about blocked.invalid, got %+v", events.events)
+	}
+}
@@ -0,0 +1,82 @@
+package worktree
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestParseNetworkMode(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		input   string
+		want    NetworkMode
+		wantErr bool
+	}{
+		{"", NetworkHost, false},
+		{"host", NetworkHost, false},
+		{"none", NetworkNone, false},
+		{"allowlist", NetworkAllowlist, false},
+		{"bridge", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseNetworkMode(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseNetworkMode(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestAPIHosts(t *testing.T) {
+	tests := []struct {
+		baseURL string
+		want    []string
+	}{
+		{"", []string{"api.anthropic.com"}},
+		{"https://gateway.example", []string{"api.anthropic.com", "gateway.example"}},
+		{"https://gateway.example:8443/v1", []string{"api.anthropic.com", "gateway.example:8443"}},
+		{"http://localhost", []string{"api.anthropic.com", "localhost:80"}},
+	}
+	for _, tt := range tests {
+		t.Setenv("ANTHROPIC_BASE_URL", tt.baseURL)
+		if got := apiHosts(); !slices.Equal(got, tt.want) {
+			t.Errorf("apiHosts() with ANTHROPIC_BASE_URL=%q = %v, want %v", tt.baseURL, got, tt.want)
+		}
+	}
+}
+
+func TestManager_Create_NetworkPolicy(t *testing.T) {
+	t.Parallel()
+
+	manager, _ := newFakeManager(t)
+	if _, err := manager.Create(context.Background(), CreateOptions{
+		Name:    "task",
+		Network: NetworkPolicy{Mode: NetworkNone, Allow: []string{"github.com"}},
+	}); err == nil {
+		t.Error("Expected allowed hosts without an allowlist to be rejected")
+	}
+
+	policy := NetworkPolicy{Mode: NetworkAllowlist, Allow: []string{"github.com"}}
+	details, err := manager.Create(context.Background(), CreateOptions{Name: "task", Network: policy})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	network, stop, err := manager.agentNetwork(details)
+	if err != nil {
+		t.Fatalf("agentNetwork() error = %v", err)
+	}
+	defer stop()
+	if network == nil || network.Proxy == "" {
+		t.Errorf("Expected the agent to reach the network through a proxy, got %+v", network)
+	}
+
+	details, err = manager.Create(context.Background(), CreateOptions{Name: "open"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if network, _, err := manager.agentNetwork(details); err != nil || network != nil {
+		t.Errorf("Expected the agent to use the network of the host, got %+v, %v", network, err)
+	}
+}
@@ -0,0 +1,96 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+)
+
+// ErrNoEditor is returned by Open when no editor is given and none is
+// configured in $VISUAL or $EDITOR
+var ErrNoEditor = errors.New("no editor configured")
+
+// Shell runs the user's shell in a session worktree with the session
+// environment and waits until it exits. The exit status of the shell is
+// not an error, it is usually that of the last command run in it.
+func (m *Manager) Shell(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	details, err := m.Find(name)
+	if err != nil {
+		return err
+	}
+
+	// #nosec G204 -- the shell comes from the user's environment
+	cmd := exec.CommandContext(ctx, userShell())
+	err = m.runInteractive(cmd, details)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to run shell: %w", err)
+	}
+	return nil
+}
+
+// Open opens a session worktree in an editor and waits until the editor
+// command exits. Editors with a window, like VS Code, usually return right
+// away while terminal editors run until they are closed. An empty editor
+// uses $VISUAL or $EDITOR. The editor may include arguments.
+func (m *Manager) Open(ctx context.Context, name, editor string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	args, err := editorCommand(editor)
+	if err != nil {
+		return err
+	}
+	details, err := m.Find(name)
+	if err != nil {
+		return err
+	}
+
+	// #nosec G204 -- the editor comes from user input or environment
+	cmd := exec.CommandContext(ctx, args[0], append(args[1:], details.Path)...)
+	if err := m.runInteractive(cmd, details); err != nil {
+		return fmt.Errorf("failed to open %s in %s: %w", details.Name, args[0], err)
+	}
+	return nil
+}
+
+// editorCommand splits the editor command, falling back to the user's
+// configured editor
+func editorCommand(editor string) ([]string, error) {
+	for _, candidate := range []string{editor, os.Getenv("VISUAL"), os.Getenv("EDITOR")} {
+		if args := strings.Fields(candidate); len(args) > 0 {
+			return args, nil
+		}
+	}
+	return nil, fmt.Errorf("%w, pass --editor or set $EDITOR", ErrNoEditor)
+}
+
+// runInteractive runs cmd in the foreground of the user's terminal, in the
+// session worktree with the session environment
+func (m *Manager) runInteractive(cmd *exec.Cmd, details WorktreeDetails) error {
+	cmd.Dir = details.Path
+	cmd.Env = sessionEnv(details)
+	cmd.Stdin = m.stdin
+	cmd.Stdout = m.stdout
+	cmd.Stderr = m.stderr
+
+	if m.forwardSignals {
+		// The terminal interrupts the command itself, claude-mux waits for it
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt)
+		defer signal.Stop(signals)
+	}
+	return cmd.Run()
+}
@@ -0,0 +1,83 @@
+package worktree
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestManager_Shell(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell script as the shell")
+	}
+
+	// The shell prints where it runs and exits like after a failed command
+	shell := filepath.Join(t.TempDir(), "shell.sh")
+	script := "#!/bin/sh\necho \"$CLAUDE_MUX_SESSION $PWD\"\nexit 1\n"
+	if err := os.WriteFile(shell, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to write shell script: %v", err)
+	}
+	t.Setenv("SHELL", shell)
+
+	manager, _ := newFakeManager(t)
+	details, err := manager.Create(context.Background(), CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	var stdout bytes.Buffer
+	manager.stdout, manager.stderr = &stdout, &stdout
+
+	if err := manager.Shell(context.Background(), details.Name); err != nil {
+		t.Fatalf("Shell() error = %v", err)
+	}
+	if got, want := strings.TrimSpace(stdout.String()), details.Name+" "+details.Path; got != want {
+		t.Errorf("Shell output = %q, want %q", got, want)
+	}
+
+	if err := manager.Shell(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Shell() error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestManager_Open(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "echo from-env")
+
+	manager, _ := newFakeManager(t)
+	details, err := manager.Create(context.Background(), CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		editor string
+		want   string
+	}{
+		{"given editor", "echo --new-window", "--new-window " + details.Path},
+		{"editor from environment", "", "from-env " + details.Path},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			manager.stdout, manager.stderr = &stdout, &stdout
+			if err := manager.Open(context.Background(), details.Name, tt.editor); err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			if got := strings.TrimSpace(stdout.String()); got != tt.want {
+				t.Errorf("Editor output = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Setenv("EDITOR", "")
+	if err := manager.Open(context.Background(), details.Name, ""); !errors.Is(err, ErrNoEditor) {
+		t.Errorf("Open() without an editor error = %v, want %v", err, ErrNoEditor)
+	}
+}
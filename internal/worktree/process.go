@@ -0,0 +1,171 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/terminal"
+	"golang.org/x/term"
+)
+
+// runAgent starts the agent and waits for it to exit.
+//
+// With signal forwarding enabled, signals sent to claude-mux are passed on
+// to the agent instead of terminating claude-mux, so post-exit processing
+// such as cleanup always runs. When ctx is canceled or a stop signal
+// arrives, the agent is asked to terminate and killed if it is still
+// running after the stop timeout.
+func (m *Manager) runAgent(ctx context.Context, cmd *exec.Cmd, details WorktreeDetails) error {
+	return m.superviseAgent(ctx, cmd, details, func() (func(), error) {
+		restore := configureAgent(cmd)
+		if err := cmd.Start(); err != nil {
+			restore()
+			return nil, err
+		}
+		return restore, nil
+	})
+}
+
+// runAgentInTerminal runs the agent under a pseudo terminal relaying the
+// user's terminal, so its output is recorded while it stays interactive.
+// Keyboard signals reach the agent through its own terminal.
+func (m *Manager) runAgentInTerminal(ctx context.Context, cmd *exec.Cmd, details WorktreeDetails, stdin, stdout *os.File, log *sessionLog) error {
+	return m.superviseAgent(ctx, cmd, details, func() (func(), error) {
+		fd := int(stdin.Fd())
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return nil, err
+		}
+		size := defaultTermSize
+		if rows, cols := terminal.Size(stdout); rows > 0 {
+			size = TermSize{Rows: rows, Cols: cols}
+		}
+		tty, err := pty.StartWithSize(cmd, &pty.Winsize{Rows: size.Rows, Cols: size.Cols})
+		if err != nil {
+			_ = term.Restore(fd, state)
+			return nil, err
+		}
+
+		stopResize := terminal.NotifyResize(func() {
+			if rows, cols := terminal.Size(stdout); rows > 0 {
+				size := TermSize{Rows: rows, Cols: cols}
+				_ = pty.Setsize(tty, &pty.Winsize{Rows: size.Rows, Cols: size.Cols})
+				log.resize(size)
+			}
+		})
+		go func() {
+			_, _ = io.Copy(tty, stdin)
+		}()
+		drained := make(chan struct{})
+		go func() {
+			_, _ = io.Copy(io.MultiWriter(stdout, log), tty)
+			close(drained)
+		}()
+
+		return func() {
+			// Children of the agent may keep its terminal open
+			select {
+			case <-drained:
+			case <-time.After(time.Second):
+			}
+			stopResize()
+			_ = term.Restore(fd, state)
+			_ = tty.Close()
+		}, nil
+	})
+}
+
+// superviseAgent starts the agent with start and waits for it to exit.
+// The function returned by start runs once the agent exited.
+func (m *Manager) superviseAgent(ctx context.Context, cmd *exec.Cmd, details WorktreeDetails, start func() (func(), error)) error {
+	var signals chan os.Signal
+	if m.forwardSignals {
+		signals = make(chan os.Signal, 1)
+		signal.Notify(signals, forwardedSignals...)
+		defer signal.Stop(signals)
+	}
+
+	cgroup := m.isolation.limit(details, cmd)
+	finish, err := start()
+	cgroup.release(err == nil)
+	if err != nil {
+		return fmt.Errorf("failed to launch Claude: %w", err)
+	}
+	defer finish()
+	m.recordAgentStart(details, cmd.Process.Pid, cgroup)
+	defer m.recordAgentExit(details)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	var (
+		ctxDone  = ctx.Done()
+		deadline <-chan time.Time
+		stopErr  error
+	)
+	// stop asks the agent to exit and arms the kill timer once
+	stop := func(reason error) {
+		if deadline != nil {
+			return
+		}
+		stopErr = reason
+		stopping := sessionEvent(EventStopping, details)
+		stopping.Message = reason.Error()
+		m.emit(stopping)
+		deadline = time.After(m.stopTimeout())
+	}
+
+	for {
+		select {
+		case err := <-done:
+			if stopErr != nil {
+				return fmt.Errorf("agent stopped: %w", stopErr)
+			}
+			if err != nil && !m.stopRequested(details, cmd.Process.Pid) {
+				return fmt.Errorf("agent exited: %w", err)
+			}
+			return nil
+
+		case sig := <-signals:
+			if err := signalAgent(cmd, sig); err != nil {
+				m.emit(Event{Type: EventWarning, Message: fmt.Sprintf("Failed to forward %v to Claude", sig), Err: err})
+			}
+			if isStopSignal(sig) {
+				stop(fmt.Errorf("received %v", sig))
+			}
+
+		case <-ctxDone:
+			ctxDone = nil
+			if err := terminateAgent(cmd); err != nil {
+				m.emit(Event{Type: EventWarning, Message: "Failed to stop Claude", Err: err})
+			}
+			stop(ctx.Err())
+
+		case <-deadline:
+			deadline = nil
+			warning := sessionEvent(EventWarning, details)
+			warning.Message = fmt.Sprintf("Claude did not exit within %v, killing it", m.stopTimeout())
+			m.emit(warning)
+			if err := killAgent(cmd); err != nil {
+				m.emit(Event{Type: EventWarning, Message: "Failed to kill Claude", Err: err})
+			}
+		}
+	}
+}
+
+// stopTimeout returns how long a stopping agent may take to exit
+func (m *Manager) stopTimeout() time.Duration {
+	if m.config.StopTimeout > 0 {
+		return m.config.StopTimeout
+	}
+	return config.DefaultStopTimeout
+}
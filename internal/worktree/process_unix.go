@@ -0,0 +1,136 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package worktree
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// forwardedSignals are passed on to the agent while it runs
+var forwardedSignals = []os.Signal{unix.SIGINT, unix.SIGTERM, unix.SIGHUP, unix.SIGQUIT}
+
+// ptySupported reports whether agents can run under a pseudo terminal
+const ptySupported = true
+
+// isStopSignal reports whether sig asks claude-mux itself to exit, in which
+// case the agent is killed if it ignores the forwarded signal
+func isStopSignal(sig os.Signal) bool {
+	return sig == unix.SIGTERM || sig == unix.SIGHUP
+}
+
+// configureAgent runs the agent in its own process group so signals reach
+// all of its children. When claude-mux owns the terminal, the group is made
+// the foreground group so keyboard signals only reach the agent. The
+// returned function hands the terminal back after the agent exited.
+func configureAgent(cmd *exec.Cmd) (restore func()) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+
+	tty, ok := cmd.Stdin.(*os.File)
+	if !ok {
+		return func() {}
+	}
+	fd := int(tty.Fd())
+	self, err := unix.Getpgid(0)
+	if err != nil {
+		return func() {}
+	}
+	pgrp, err := unix.IoctlGetInt(fd, unix.TIOCGPGRP)
+	if err != nil || pgrp != self {
+		// Not a terminal, or claude-mux runs in the background
+		return func() {}
+	}
+
+	cmd.SysProcAttr.Foreground = true
+	cmd.SysProcAttr.Ctty = fd
+	return func() {
+		// A background process group is stopped by SIGTTOU when it takes
+		// the terminal back unless the signal is ignored
+		if !signal.Ignored(unix.SIGTTOU) {
+			signal.Ignore(unix.SIGTTOU)
+			defer signal.Reset(unix.SIGTTOU)
+		}
+		_ = unix.IoctlSetPointerInt(fd, unix.TIOCSPGRP, pgrp)
+	}
+}
+
+// signalAgent delivers sig to the agent's process group
+func signalAgent(cmd *exec.Cmd, sig os.Signal) error {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return cmd.Process.Signal(sig)
+	}
+	return signalGroup(cmd.Process.Pid, s)
+}
+
+// terminateAgent asks the agent's process group to exit
+func terminateAgent(cmd *exec.Cmd) error {
+	return terminateGroup(cmd.Process.Pid)
+}
+
+// killAgent kills the agent's process group
+func killAgent(cmd *exec.Cmd) error {
+	return killGroup(cmd.Process.Pid)
+}
+
+// interruptGroup interrupts the process group led by pid like Ctrl-C does
+func interruptGroup(pid int) error {
+	return signalGroup(pid, unix.SIGINT)
+}
+
+// terminateGroup asks the process group led by pid to exit
+func terminateGroup(pid int) error {
+	return signalGroup(pid, unix.SIGTERM)
+}
+
+// killGroup kills the process group led by pid
+func killGroup(pid int) error {
+	return signalGroup(pid, unix.SIGKILL)
+}
+
+// pauseGroup suspends the process group led by pid
+func pauseGroup(pid int) error {
+	return signalGroup(pid, unix.SIGSTOP)
+}
+
+// continueGroup resumes the suspended process group led by pid
+func continueGroup(pid int) error {
+	return signalGroup(pid, unix.SIGCONT)
+}
+
+// shellCommand runs command through the POSIX shell
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "/bin/sh", "-c", command)
+}
+
+func signalGroup(pid int, sig syscall.Signal) error {
+	err := unix.Kill(-pid, sig)
+	if errors.Is(err, unix.ESRCH) {
+		// The group already exited
+		return nil
+	}
+	return err
+}
+
+// userShell returns the user's login shell
+func userShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	return "/bin/sh"
+}
+
+// processAlive reports whether a process of the current user with the
+// given ID exists. Processes of other users cannot be agents it started.
+func processAlive(pid int) bool {
+	return unix.Kill(pid, 0) == nil
+}
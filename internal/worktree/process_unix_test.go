@@ -0,0 +1,239 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/config"
+)
+
+// writeAgent writes a shell script agent and returns its path
+func writeAgent(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "agent.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatalf("Failed to write agent script: %v", err)
+	}
+	return path
+}
+
+// waitForFile polls until path has content and returns it
+func waitForFile(path string) (string, error) {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if content, err := os.ReadFile(path); err == nil && len(content) > 0 {
+			return strings.TrimSpace(string(content)), nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return "", fmt.Errorf("timed out waiting for %s", path)
+}
+
+// eventLog collects events emitted by a manager
+type eventLog struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (l *eventLog) record(e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, e)
+}
+
+func (l *eventLog) count(t EventType) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for _, e := range l.events {
+		if e.Type == t {
+			n++
+		}
+	}
+	return n
+}
+
+func TestManager_CreateAndLaunch_Canceled(t *testing.T) {
+	t.Parallel()
+
+	repoDir := setupTestRepo(t)
+	started := filepath.Join(t.TempDir(), "started")
+	agent := writeAgent(t, "echo $$ > "+started+"\nexec sleep 60\n")
+
+	events := &eventLog{}
+	manager := NewManager(config.Config{
+		RepoDir:          repoDir,
+		WorktreeBasePath: ".claude-mux-test",
+		ClaudeCommand:    agent,
+		StopTimeout:      5 * time.Second,
+	}, WithEventHandler(events.record), WithStdio(nil, nil, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, _ = waitForFile(started)
+		cancel()
+	}()
+
+	details, err := manager.CreateAndLaunch(ctx, CreateOptions{Name: "cancel", Cleanup: true})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("CreateAndLaunch() error = %v, want context.Canceled", err)
+	}
+	if events.count(EventStopping) != 1 {
+		t.Errorf("Expected one %q event, got %+v", EventStopping, events.events)
+	}
+
+	// Cleanup must run even though the session was canceled
+	if events.count(EventWorktreeRemoved) != 1 {
+		t.Errorf("Expected the worktree to be cleaned up, got events %+v", events.events)
+	}
+	if _, err := os.Stat(details.Path); !os.IsNotExist(err) {
+		t.Errorf("Expected worktree %s to be removed, stat error = %v", details.Path, err)
+	}
+}
+
+func TestManager_runAgent_KillsAfterTimeout(t *testing.T) {
+	t.Parallel()
+
+	repoDir := setupTestRepo(t)
+	outDir := t.TempDir()
+	started := filepath.Join(outDir, "started")
+	childPid := filepath.Join(outDir, "child")
+	// The agent ignores SIGTERM and leaves a child behind, which must be
+	// killed along with it
+	agent := writeAgent(t, "trap '' TERM\nsleep 60 &\necho $! > "+childPid+"\necho $$ > "+started+"\nwait\n")
+
+	events := &eventLog{}
+	manager := NewManager(config.Config{
+		RepoDir:          repoDir,
+		WorktreeBasePath: ".claude-mux-test",
+		ClaudeCommand:    agent,
+		StopTimeout:      200 * time.Millisecond,
+	}, WithEventHandler(events.record), WithStdio(nil, nil, nil))
+
+	details, err := manager.Create(context.Background(), CreateOptions{Name: "stubborn"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, _ = waitForFile(started)
+		cancel()
+	}()
+
+	start := time.Now()
+	if err := manager.launchClaude(ctx, details); !errors.Is(err, context.Canceled) {
+		t.Fatalf("launchClaude() error = %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the agent to be killed after the stop timeout, took %v", elapsed)
+	}
+	if events.count(EventWarning) != 1 {
+		t.Errorf("Expected a warning about killing the agent, got %+v", events.events)
+	}
+
+	content, err := waitForFile(childPid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(content)
+	if err != nil {
+		t.Fatalf("Failed to parse child pid: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for syscall.Kill(pid, 0) == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected child process %d of the agent to be killed", pid)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestManager_runAgent_ForwardsSignals(t *testing.T) {
+	// Not parallel: the test signals its own process
+
+	repoDir := setupTestRepo(t)
+	outDir := t.TempDir()
+	started := filepath.Join(outDir, "started")
+	received := filepath.Join(outDir, "received")
+	agent := writeAgent(t, "trap 'echo TERM > "+received+"; exit 0' TERM\necho $$ > "+started+"\nwhile true; do sleep 0.05; done\n")
+
+	events := &eventLog{}
+	manager := NewManager(config.Config{
+		RepoDir:          repoDir,
+		WorktreeBasePath: ".claude-mux-test",
+		ClaudeCommand:    agent,
+	}, WithEventHandler(events.record), WithStdio(nil, nil, nil), WithSignalForwarding())
+
+	details, err := manager.Create(context.Background(), CreateOptions{Name: "signal"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	go func() {
+		if _, err := waitForFile(started); err == nil {
+			_ = syscall.Kill(os.Getpid(), syscall.SIGTERM)
+		}
+	}()
+
+	err = manager.launchClaude(context.Background(), details)
+	if err == nil || !strings.Contains(err.Error(), "terminated") {
+		t.Errorf("launchClaude() error = %v, want it to report the stop signal", err)
+	}
+	if got, err := waitForFile(received); got != "TERM" {
+		t.Errorf("Expected the agent to receive SIGTERM, got %q (%v)", got, err)
+	}
+	if events.count(EventStopping) != 1 {
+		t.Errorf("Expected one %q event, got %+v", EventStopping, events.events)
+	}
+}
+
+func TestAgent_RecordsOutput(t *testing.T) {
+	t.Parallel()
+
+	manager := NewManager(config.Config{
+		RepoDir:          setupTestRepo(t),
+		WorktreeBasePath: ".claude-mux-test",
+		ClaudeCommand:    writeAgent(t, "echo background output\n"),
+		StopTimeout:      time.Second,
+		SessionLogs:      true,
+	})
+	agent, err := manager.CreateAndStart(context.Background(), CreateOptions{Name: "task"}, TermSize{Rows: 30, Cols: 100})
+	if err != nil {
+		t.Fatalf("CreateAndStart() error = %v", err)
+	}
+
+	buf := make([]byte, 1024)
+	for {
+		if _, err := agent.Read(buf); err != nil {
+			break
+		}
+	}
+	<-agent.Done()
+	if err := agent.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	path, err := manager.LogPath(agent.Session().Name)
+	if err != nil {
+		t.Fatalf("LogPath() error = %v", err)
+	}
+	header, output := readLog(t, path)
+	if header.Width != 100 || header.Height != 30 {
+		t.Errorf("Expected the log to have the terminal size, got %+v", header)
+	}
+	if !strings.Contains(output, "background output") {
+		t.Errorf("Expected the log to contain the agent output, got %q", output)
+	}
+}
@@ -0,0 +1,111 @@
+//go:build windows
+
+package worktree
+
+import (
+	"context"
+	"os"
+	"os/exec"
+
+	"golang.org/x/sys/windows"
+)
+
+// forwardedSignals are caught while the agent runs. The console already
+// delivers Ctrl-C to the agent, so catching it only keeps claude-mux alive.
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+// ptySupported reports whether agents can run under a pseudo terminal, which claude-mux does not support on Windows
+const ptySupported = false
+
+// isStopSignal reports whether sig asks claude-mux itself to exit
+func isStopSignal(os.Signal) bool {
+	return false
+}
+
+// configureAgent prepares the agent command. Windows has no process groups
+// to set up.
+func configureAgent(*exec.Cmd) (restore func()) {
+	return func() {}
+}
+
+// signalAgent is a no-op because the console signals the agent directly
+func signalAgent(*exec.Cmd, os.Signal) error {
+	return nil
+}
+
+// terminateAgent stops the agent. Windows cannot ask a console process to
+// exit gracefully, so it is killed right away.
+func terminateAgent(cmd *exec.Cmd) error {
+	return killAgent(cmd)
+}
+
+// killAgent kills the agent process
+func killAgent(cmd *exec.Cmd) error {
+	if err := cmd.Process.Kill(); err != nil && err != os.ErrProcessDone {
+		return err
+	}
+	return nil
+}
+
+// interruptGroup stops the process pid. Windows cannot interrupt a process
+// outside of its console, so it is killed right away.
+func interruptGroup(pid int) error {
+	return killGroup(pid)
+}
+
+// terminateGroup stops the process pid by killing it
+func terminateGroup(pid int) error {
+	return killGroup(pid)
+}
+
+// killGroup kills the process pid
+func killGroup(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		// The process already exited
+		return nil
+	}
+	if err := p.Kill(); err != nil && err != os.ErrProcessDone {
+		return err
+	}
+	return nil
+}
+
+// pauseGroup is not supported, Windows has no job control signals
+func pauseGroup(int) error {
+	return ErrPauseUnsupported
+}
+
+// continueGroup is not supported, Windows has no job control signals
+func continueGroup(int) error {
+	return ErrPauseUnsupported
+}
+
+// shellCommand runs command through the Windows command interpreter
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd", "/C", command)
+}
+
+// userShell returns the Windows command interpreter
+func userShell() string {
+	if shell := os.Getenv("COMSPEC"); shell != "" {
+		return shell
+	}
+	return "cmd"
+}
+
+// processAlive reports whether a process with the given ID is still running
+func processAlive(pid int) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer func() { _ = windows.CloseHandle(h) }()
+
+	var code uint32
+	if err := windows.GetExitCodeProcess(h, &code); err != nil {
+		return false
+	}
+	// STILL_ACTIVE
+	return code == 259
+}
@@ -0,0 +1,14 @@
+package worktree
+
+import "golang.org/x/sys/unix"
+
+// processStart returns when process pid started, in microseconds since
+// the epoch
+func processStart(pid int) (uint64, error) {
+	info, err := unix.SysctlKinfoProc("kern.proc.pid", pid)
+	if err != nil {
+		return 0, err
+	}
+	start := info.Proc.P_starttime
+	return uint64(start.Sec)*1e6 + uint64(start.Usec), nil // #nosec G115 -- start times are positive
+}
@@ -0,0 +1,27 @@
+package worktree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// processStart returns when process pid started, in clock ticks since boot
+func processStart(pid int) (uint64, error) {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, err
+	}
+	// The fields follow the parenthesized command name, which may contain
+	// spaces, starting with the state, the third field
+	var fields []string
+	if end := strings.LastIndexByte(string(stat), ')'); end >= 0 {
+		fields = strings.Fields(string(stat[end+1:]))
+	}
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("unexpected /proc/%d/stat: %q", pid, stat)
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !windows
+
+package worktree
+
+import "errors"
+
+// processStart cannot tell when processes started on this platform, so
+// agents are identified by their PID alone
+func processStart(int) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
@@ -0,0 +1,99 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ResumeOptions configures resuming a session
+type ResumeOptions struct {
+	// Cleanup removes the session once the agent exits
+	Cleanup bool
+}
+
+// Resume relaunches the agent in the worktree of an existing session and
+// waits until it exits. The agent continues its previous conversation if
+// a resume flag is configured. Post-exit processing runs as for a new
+// session, with the session's autocommit policy. Canceling ctx stops the
+// agent.
+func (m *Manager) Resume(ctx context.Context, name string, opts ResumeOptions) (WorktreeDetails, error) {
+	details, runOpts, err := m.prepareResume(ctx, name, opts)
+	if err != nil {
+		return WorktreeDetails{}, err
+	}
+
+	run := m.beginRun(details, runOpts)
+	launchErr := m.launch(ctx, details, m.resumeArgs()...)
+	if err := m.afterExit(details, runOpts, run); launchErr == nil {
+		return details, err
+	}
+	return details, launchErr
+}
+
+// ResumeAndStart is like Resume but runs the agent in the background
+func (m *Manager) ResumeAndStart(ctx context.Context, name string, opts ResumeOptions, size TermSize) (*Agent, error) {
+	details, runOpts, err := m.prepareResume(ctx, name, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	run := m.beginRun(details, runOpts)
+	agent, err := m.startAgent(ctx, details, size, m.resumeArgs(), func() error {
+		return m.afterExit(details, runOpts, run)
+	})
+	if err != nil {
+		_ = m.afterExit(details, runOpts, run)
+		return nil, err
+	}
+	return agent, nil
+}
+
+// prepareResume finds the session to resume, records the resume in its
+// metadata and returns the options its post-exit processing runs with. It
+// fails while the agent of the session runs, started by any claude-mux
+// process, which a second agent would lose track of.
+func (m *Manager) prepareResume(ctx context.Context, name string, opts ResumeOptions) (WorktreeDetails, CreateOptions, error) {
+	if err := ctx.Err(); err != nil {
+		return WorktreeDetails{}, CreateOptions{}, err
+	}
+
+	details, err := m.Find(name)
+	if err != nil {
+		return WorktreeDetails{}, CreateOptions{}, err
+	}
+	if record, err := m.readAgentRecord(details); err == nil && record.PID != 0 && record.ExitedAt == nil && agentAlive(record) {
+		return WorktreeDetails{}, CreateOptions{}, fmt.Errorf("%w: %s, attach to it or stop it first", ErrAgentRunning, details.Name)
+	}
+
+	meta, err := m.readSessionMeta(details)
+	if err != nil {
+		// Sessions created before metadata was kept have none
+		meta = sessionMeta{Name: details.Name, Branch: details.Branch, Path: details.Path}
+	}
+	meta.Resumes++
+	now := time.Now()
+	meta.ResumedAt = &now
+	if err := m.saveSessionMeta(meta); err != nil {
+		warning := sessionEvent(EventWarning, details)
+		warning.Message = "Failed to update session metadata"
+		warning.Err = err
+		m.emit(warning)
+	}
+
+	return details, CreateOptions{
+		Name:       details.Name,
+		Prompt:     meta.Prompt,
+		Autocommit: meta.Autocommit,
+		Cleanup:    opts.Cleanup,
+	}, nil
+}
+
+// resumeArgs returns the arguments that make the agent continue its
+// previous conversation
+func (m *Manager) resumeArgs() []string {
+	if m.config.ClaudeResumeFlag == "" {
+		return nil
+	}
+	return []string{m.config.ClaudeResumeFlag}
+}
@@ -0,0 +1,115 @@
+package worktree
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/git"
+)
+
+func TestManager_Resume(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	manager, backend := newFakeManager(t)
+	manager.config.ClaudeResumeFlag = "--continue"
+	details, err := manager.Create(ctx, CreateOptions{Name: "task", Prompt: "Add a README", Autocommit: AutocommitWIP})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	var stdout bytes.Buffer
+	manager.stdout, manager.stderr = &stdout, &stdout
+	manager.onEvent = func(e Event) {
+		if e.Type == EventLaunching {
+			backend.SetChanges(e.Path, []git.FileStatus{{Code: "??", Path: "README.md"}})
+		}
+	}
+	if _, err := manager.Resume(ctx, "task", ResumeOptions{}); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+
+	if got := strings.TrimSpace(stdout.String()); got != "--continue" {
+		t.Errorf("Expected the agent to be started with the resume flag, got output %q", got)
+	}
+	if commits := backend.Commits(details.Branch); len(commits) != 1 || !strings.HasPrefix(commits[0], "WIP: Add a README") {
+		t.Errorf("Expected the session's autocommit policy to apply, got commits %q", commits)
+	}
+	meta, err := manager.readSessionMeta(details)
+	if err != nil {
+		t.Fatalf("readSessionMeta() error = %v", err)
+	}
+	if meta.Resumes != 1 || meta.ResumedAt == nil || meta.Prompt != "Add a README" {
+		t.Errorf("Expected the resume to be recorded, got %+v", meta)
+	}
+
+	if _, err := manager.Resume(ctx, "task", ResumeOptions{Cleanup: true}); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	if _, err := os.Stat(details.Path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the worktree to be cleaned up, Stat() error = %v", err)
+	}
+
+	if _, err := manager.Resume(ctx, "task", ResumeOptions{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Resume() of a removed session error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestManager_Resume_WithoutFlag(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	manager, _ := newFakeManager(t)
+	if _, err := manager.Create(ctx, CreateOptions{Name: "task"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	var stdout bytes.Buffer
+	manager.stdout, manager.stderr = &stdout, &stdout
+	if _, err := manager.Resume(ctx, "task", ResumeOptions{}); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	if got := strings.TrimSpace(stdout.String()); got != "" {
+		t.Errorf("Expected the agent to be started without arguments, got output %q", got)
+	}
+}
+
+func TestManager_ResumeRunning(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	manager, _ := newFakeManager(t)
+	details, err := manager.Create(ctx, CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	// The agent was started by another claude-mux process and still runs
+	manager.writeAgentRecord(details, agentRecord{PID: os.Getpid(), StartedAt: time.Now()})
+
+	for _, resume := range []func() error{
+		func() error {
+			_, err := manager.Resume(ctx, "task", ResumeOptions{})
+			return err
+		},
+		func() error {
+			_, err := manager.ResumeAndStart(ctx, "task", ResumeOptions{}, TermSize{})
+			return err
+		},
+	} {
+		if err := resume(); !errors.Is(err, ErrAgentRunning) {
+			t.Errorf("Resume() error = %v, want %v", err, ErrAgentRunning)
+		}
+	}
+	record, err := manager.readAgentRecord(details)
+	if err != nil || record.PID != os.Getpid() {
+		t.Errorf("Expected the running agent to stay recorded, got %+v, error = %v", record, err)
+	}
+	if meta, err := manager.readSessionMeta(details); err != nil || meta.Resumes != 0 {
+		t.Errorf("Expected no resume to be recorded, got %+v, error = %v", meta, err)
+	}
+}
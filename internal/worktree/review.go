@@ -0,0 +1,169 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/git"
+)
+
+// ErrNoVerifyCommand is returned by Verify when no verify command is configured
+var ErrNoVerifyCommand = errors.New("no verify command configured")
+
+// ErrUncommittedChanges is returned when uncommitted work would be lost
+var ErrUncommittedChanges = errors.New("uncommitted changes")
+
+// ErrLocked is returned when a session's worktree is locked and must not
+// be removed
+var ErrLocked = errors.New("session is locked")
+
+// archiveRefPrefix is where the commits of archived sessions are kept
+const archiveRefPrefix = "refs/claude-mux/archive/"
+
+// SessionStatus describes a session and its uncommitted changes
+type SessionStatus struct {
+	Session
+	Files []git.FileStatus
+}
+
+// Status returns a session together with its uncommitted changes
+func (m *Manager) Status(ctx context.Context, name string) (SessionStatus, error) {
+	if err := ctx.Err(); err != nil {
+		return SessionStatus{}, err
+	}
+
+	details, err := m.Find(name)
+	if err != nil {
+		return SessionStatus{}, err
+	}
+	files, err := m.git.Status(details.Path)
+	if err != nil {
+		return SessionStatus{}, err
+	}
+
+	status := SessionStatus{
+		Session: Session{
+			Name:    details.Name,
+			Branch:  details.Branch,
+			Path:    details.Path,
+			Changes: len(files),
+			Locked:  m.locked(details),
+			Agent:   m.agentStatus(details),
+		},
+		Files: files,
+	}
+	return status, nil
+}
+
+// locked reports whether the worktree of a session is locked
+func (m *Manager) locked(details WorktreeDetails) bool {
+	worktrees, err := m.git.ListWorktrees()
+	if err != nil {
+		return false
+	}
+	for _, wt := range worktrees {
+		if samePath(wt.Path, details.Path) {
+			return wt.Locked
+		}
+	}
+	return false
+}
+
+// VerifyResult is the outcome of running the verify command in a session
+type VerifyResult struct {
+	Command  string
+	Passed   bool
+	ExitCode int
+	// Output is the combined standard output and error of the command
+	Output   string
+	Duration time.Duration
+}
+
+// Verify runs the configured verify command in a session worktree. A
+// failing command is reported in the result, not as an error.
+func (m *Manager) Verify(ctx context.Context, name string) (VerifyResult, error) {
+	result := VerifyResult{Command: m.config.VerifyCommand}
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	if result.Command == "" {
+		return result, ErrNoVerifyCommand
+	}
+
+	details, err := m.Find(name)
+	if err != nil {
+		return result, err
+	}
+
+	cmd := shellCommand(ctx, result.Command)
+	cmd.Dir = details.Path
+	cmd.Env = sessionEnv(details)
+
+	start := time.Now()
+	output, err := cmd.CombinedOutput()
+	result.Duration = time.Since(start)
+	result.Output = string(output)
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		result.Passed = true
+	case errors.As(err, &exitErr) && ctx.Err() == nil:
+		result.ExitCode = exitErr.ExitCode()
+	default:
+		return result, fmt.Errorf("failed to run verify command: %w", err)
+	}
+	return result, nil
+}
+
+// Archive removes a session's worktree and branch but keeps its commits
+// reachable under refs/claude-mux/archive/<name>, and its logs as well.
+// Sessions with uncommitted changes, a running agent or a locked worktree
+// are refused so no work is lost. It returns the archive ref.
+func (m *Manager) Archive(ctx context.Context, name string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	details, err := m.FindExact(name)
+	if err != nil {
+		return "", err
+	}
+	if m.agentStatus(details).State.alive() {
+		return "", fmt.Errorf("%w: %s, stop it before archiving", ErrAgentRunning, details.Name)
+	}
+	if m.locked(details) {
+		return "", fmt.Errorf("%w: %s, unlock it with git worktree unlock before archiving", ErrLocked, details.Name)
+	}
+	changes, err := m.git.Status(details.Path)
+	if err != nil {
+		return "", err
+	}
+	if len(changes) > 0 {
+		return "", fmt.Errorf("%w: %s has %d uncommitted file(s), commit them before archiving", ErrUncommittedChanges, details.Name, len(changes))
+	}
+
+	ref := archiveRefPrefix + filepath.Base(details.Name)
+	if err := m.git.UpdateRef(ref, details.Branch); err != nil {
+		return "", err
+	}
+	if err := m.archiveSessionData(details); err != nil {
+		return "", fmt.Errorf("failed to archive session logs: %w", err)
+	}
+
+	// The ref keeps the commits, so the branch can go even if unmerged
+	removal := m.cleanup(details, true)
+	m.emitRemoval(removal)
+	if removal.Err != nil {
+		return ref, removal.Err
+	}
+
+	archived := sessionEvent(EventArchived, details)
+	archived.Message = ref
+	m.emit(archived)
+	return ref, nil
+}
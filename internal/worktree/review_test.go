@@ -0,0 +1,140 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/git"
+	"github.com/enriikke/claude-mux/internal/git/gitfake"
+)
+
+func TestManager_Status(t *testing.T) {
+	t.Parallel()
+
+	manager, backend := newFakeManager(t)
+	details, err := manager.Create(context.Background(), CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	backend.SetChanges(details.Path, []git.FileStatus{{Code: " M", Path: "main.go"}})
+	backend.Lock(details.Path)
+
+	status, err := manager.Status(context.Background(), details.Name)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if status.Changes != 1 || len(status.Files) != 1 || status.Files[0].Path != "main.go" {
+		t.Errorf("Expected one changed file, got %+v", status)
+	}
+	if !status.Locked {
+		t.Errorf("Expected the session to be reported as locked, got %+v", status)
+	}
+}
+
+func TestManager_Verify(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		command  string
+		wantErr  error
+		passed   bool
+		exitCode int
+		output   string
+	}{
+		{"passes", "echo verified", nil, true, 0, "verified"},
+		{"fails", "echo broken && exit 3", nil, false, 3, "broken"},
+		{"not configured", "", ErrNoVerifyCommand, false, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := gitfake.New(t.TempDir())
+			manager := NewManager(config.Config{
+				WorktreeBasePath: ".claude-mux",
+				VerifyCommand:    tt.command,
+			}, WithBackend(backend))
+			details, err := manager.Create(context.Background(), CreateOptions{Name: "task"})
+			if err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+
+			result, err := manager.Verify(context.Background(), details.Name)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+			if result.Passed != tt.passed || result.ExitCode != tt.exitCode {
+				t.Errorf("Verify() = %+v, want passed=%v exit code %d", result, tt.passed, tt.exitCode)
+			}
+			if !strings.Contains(result.Output, tt.output) {
+				t.Errorf("Expected output to contain %q, got %q", tt.output, result.Output)
+			}
+		})
+	}
+}
+
+func TestManager_Archive(t *testing.T) {
+	t.Parallel()
+
+	manager, backend := newFakeManager(t)
+	details, err := manager.Create(context.Background(), CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	backend.SetMerged(details.Branch, false)
+
+	// Uncommitted changes would be lost, so archiving is refused
+	backend.SetChanges(details.Path, []git.FileStatus{{Code: "??", Path: "new.go"}})
+	if _, err := manager.Archive(context.Background(), details.Name); !errors.Is(err, ErrUncommittedChanges) {
+		t.Fatalf("Archive() error = %v, want %v", err, ErrUncommittedChanges)
+	}
+	backend.SetChanges(details.Path, nil)
+
+	// An agent started by any claude-mux process still uses the worktree
+	manager.writeAgentRecord(details, agentRecord{PID: os.Getpid(), StartedAt: time.Now()})
+	if _, err := manager.Archive(context.Background(), details.Name); !errors.Is(err, ErrAgentRunning) {
+		t.Fatalf("Archive() with a live agent error = %v, want %v", err, ErrAgentRunning)
+	}
+	exited := time.Now()
+	manager.writeAgentRecord(details, agentRecord{PID: os.Getpid(), StartedAt: time.Now(), ExitedAt: &exited})
+
+	ref, err := manager.Archive(context.Background(), details.Name)
+	if err != nil {
+		t.Fatalf("Archive() error = %v", err)
+	}
+	if ref != "refs/claude-mux/archive/"+details.Name {
+		t.Errorf("Archive() = %q, want the session's archive ref", ref)
+	}
+	if rev, ok := backend.Ref(ref); !ok || rev != details.Branch {
+		t.Errorf("Expected %s to point at %s, got %q", ref, details.Branch, rev)
+	}
+	if backend.HasBranch(details.Branch) {
+		t.Errorf("Expected unmerged branch %s to be deleted once archived", details.Branch)
+	}
+	if _, err := manager.Find(details.Name); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected the archived session to be gone, Find() error = %v", err)
+	}
+}
+
+func TestManager_ArchiveLocked(t *testing.T) {
+	t.Parallel()
+
+	manager, backend := newFakeManager(t)
+	details, err := manager.Create(context.Background(), CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	backend.Lock(details.Path)
+
+	if _, err := manager.Archive(context.Background(), details.Name); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Archive() error = %v, want %v", err, ErrLocked)
+	}
+	if _, err := manager.Find(details.Name); err != nil {
+		t.Errorf("Expected the locked session to be kept, Find() error = %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package worktree
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/sandbox"
+)
+
+// claudeStateDirs are the directories below ~/.claude where Claude Code
+// keeps conversations and other state it writes while it runs
+var claudeStateDirs = []string{"projects", "todos", "shell-snapshots", "statsig", "session-env", "file-history", "plans", "debug"}
+
+// claudeStateFiles are the files of Claude Code it rewrites while it runs,
+// relative to the home directory
+var claudeStateFiles = []string{".claude.json", ".claude.json.backup", ".claude/.credentials.json", ".claude/history.jsonl"}
+
+// sandboxPolicy returns what the sandboxed agent of a session may change:
+// its worktree, the parts of the git directory its commits go to,
+// temporary directories, the state of Claude Code and the configured paths.
+// It may not read the files claude-mux keeps for the user.
+func (m *Manager) sandboxPolicy(details WorktreeDetails) sandbox.Policy {
+	writable := []string{details.Path}
+	writable = append(writable, m.gitWritable(details)...)
+	writable = append(writable, os.TempDir(), "/tmp", "/var/tmp")
+	writable = append(writable, claudeState()...)
+	writable = append(writable, m.config.SandboxWritable...)
+	slices.Sort(writable)
+	policy := sandbox.Policy{Writable: slices.Compact(writable)}
+	// The token of the dashboard would let the agent control all sessions
+	if dir, err := config.UserDir(); err == nil {
+		policy.Hidden = []string{dir}
+	}
+	return policy
+}
+
+// claudeState returns the files and directories Claude Code writes its
+// state to. Its settings and hooks in ~/.claude stay read-only, since they
+// run outside of the sandbox. The directories are created, as files cannot
+// be allowed before they exist.
+func claudeState() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	var state []string
+	for _, name := range claudeStateDirs {
+		dir := filepath.Join(home, ".claude", name)
+		if err := os.MkdirAll(dir, 0700); err == nil {
+			state = append(state, dir)
+		}
+	}
+	for _, name := range claudeStateFiles {
+		state = append(state, filepath.Join(home, name))
+	}
+	return state
+}
+
+// gitWritable returns the parts of the git common directory the agent of a
+// session changes when it commits: objects, refs, reflogs and the private
+// directory of its worktree. The rest stays read-only to confined agents:
+// the config and hooks, which run outside of the confinement, and the
+// session metadata, which holds the network policy of the session.
+func (m *Manager) gitWritable(details WorktreeDetails) []string {
+	commonDir, err := m.git.CommonDir()
+	if err != nil {
+		return nil
+	}
+	var writable []string
+	for _, name := range []string{"objects", "refs", "logs"} {
+		dir := filepath.Join(commonDir, name)
+		// Reflogs are created with the first commit, which would fail to
+		// create their directory
+		if err := os.MkdirAll(dir, 0750); err == nil {
+			writable = append(writable, dir)
+		}
+	}
+	if dir, err := worktreeGitDir(details.Path); err == nil {
+		writable = append(writable, dir)
+	}
+	return writable
+}
+
+// worktreeGitDir returns the private git directory of a linked worktree,
+// which its .git file points to. It holds the HEAD and index of the
+// worktree.
+func worktreeGitDir(path string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(path, ".git")) // #nosec G304 -- the .git file of a session worktree
+	if err != nil {
+		return "", err
+	}
+	dir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir: ")
+	if !ok {
+		return "", fmt.Errorf("%s does not point to a git directory", filepath.Join(path, ".git"))
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(path, dir)
+	}
+	return filepath.Clean(dir), nil
+}
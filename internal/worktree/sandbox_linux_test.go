@@ -0,0 +1,158 @@
+package worktree
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/enriikke/claude-mux/internal/asciicast"
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/sandbox"
+)
+
+// readMarkers returns the markers recorded in a session log
+func readMarkers(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	r, err := asciicast.NewReader(f)
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	var markers []string
+	for {
+		e, err := r.Next()
+		if err != nil {
+			return markers
+		}
+		if e.Type == asciicast.Marker {
+			markers = append(markers, e.Data)
+		}
+	}
+}
+
+// outsideDir returns a new directory the test may write to outside of the
+// writable directories of a sandbox. Temporary directories are writable in
+// the sandbox, so it is made in the first other directory that allows it.
+func outsideDir(t *testing.T, writable []string) string {
+	t.Helper()
+	var candidates []string
+	if home, err := os.UserHomeDir(); err == nil {
+		candidates = append(candidates, home)
+	}
+	if wd, err := os.Getwd(); err == nil {
+		candidates = append(candidates, wd)
+	}
+	candidates = append(candidates, "/dev/shm", filepath.Join("/run/user", strconv.Itoa(os.Getuid())))
+
+	for _, dir := range candidates {
+		if slices.ContainsFunc(writable, func(root string) bool { return samePath(root, dir) || isWithin(root, dir) }) {
+			continue
+		}
+		outside, err := os.MkdirTemp(dir, "claude-mux-sandbox-test-")
+		if err != nil {
+			continue
+		}
+		t.Cleanup(func() { _ = os.RemoveAll(outside) })
+		return outside
+	}
+	t.Skip("No directory outside of the sandbox is writable")
+	return ""
+}
+
+func TestManager_Sandbox(t *testing.T) {
+	t.Parallel()
+	if err := sandbox.Available(); err != nil {
+		t.Skip(err)
+	}
+
+	var stdout bytes.Buffer
+	manager, _ := newLoggingManager(t, &stdout)
+	manager.config.Sandbox = true
+	ctx := context.Background()
+	details, err := manager.Create(ctx, CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	escape := filepath.Join(outsideDir(t, manager.sandboxPolicy(details).Writable), "out")
+	manager.config.ClaudeCommand = writeAgent(t, `echo inside > "$CLAUDE_MUX_WORKTREE/out" && echo outside > `+escape+"\n")
+
+	if _, err := manager.LaunchCreated(ctx, details.Name, CreateOptions{}); err == nil {
+		t.Fatalf("Expected the agent to fail writing outside its sandbox, got output %q", stdout.String())
+	}
+	if _, err := os.Stat(filepath.Join(details.Path, "out")); err != nil {
+		t.Errorf("Expected the agent to write to its worktree: %v", err)
+	}
+	if _, err := os.Stat(escape); err == nil {
+		t.Errorf("Expected the agent not to write to %s", escape)
+	}
+
+	path, err := manager.LogPath(details.Name)
+	if err != nil {
+		t.Fatalf("LogPath() error = %v", err)
+	}
+	markers := readMarkers(t, path)
+	if len(markers) != 2 || !strings.Contains(markers[0], details.Path) || !strings.Contains(markers[1], escape) {
+		t.Errorf("Expected the log to mark the sandbox and the denied write to %s, got %q", escape, markers)
+	}
+}
+
+func TestManager_SandboxGit(t *testing.T) {
+	t.Parallel()
+	if err := sandbox.Available(); err != nil {
+		t.Skip(err)
+	}
+
+	// Repositories in temporary directories are writable as a whole
+	repo := outsideDir(t, []string{os.TempDir(), "/tmp", "/var/tmp"})
+	runGit(t, repo, "init")
+	runGit(t, repo, "config", "user.email", "test@example.com")
+	runGit(t, repo, "config", "user.name", "Test User")
+	runGit(t, repo, "commit", "--allow-empty", "-m", "initial")
+
+	var stdout bytes.Buffer
+	manager := NewManager(config.Config{
+		RepoDir:          repo,
+		WorktreeBasePath: ".claude-mux-test",
+		Sandbox:          true,
+	}, WithStdio(strings.NewReader(""), &stdout, &stdout))
+	ctx := context.Background()
+	details, err := manager.Create(ctx, CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	dir, err := manager.dataDir(activeData, details.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := filepath.Join(dir, "session.json")
+	before, err := os.ReadFile(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The agent commits, but cannot change the metadata holding the
+	// network policy of its session
+	manager.config.ClaudeCommand = writeAgent(t, `git commit -q --allow-empty -m sandboxed && ! echo '{}' > `+meta+"\n")
+	if _, err := manager.LaunchCreated(ctx, details.Name, CreateOptions{}); err != nil {
+		t.Fatalf("Expected the agent to commit but not to change its metadata: %v, output %q", err, stdout.String())
+	}
+	log, err := exec.Command("git", "-C", details.Path, "log", "-1", "--format=%s").Output()
+	if err != nil || strings.TrimSpace(string(log)) != "sandboxed" {
+		t.Errorf("Expected the agent to commit, got %q, %v", log, err)
+	}
+	if after, _ := os.ReadFile(meta); !bytes.Equal(after, before) {
+		t.Errorf("Expected the session metadata to be left alone, got %s", after)
+	}
+}
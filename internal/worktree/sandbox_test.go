@@ -0,0 +1,46 @@
+package worktree
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/enriikke/claude-mux/internal/config"
+)
+
+func TestManager_SandboxPolicy(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	manager, _ := newFakeManager(t)
+	extra := filepath.Join(home, ".cache")
+	manager.config.SandboxWritable = []string{extra}
+	policy := manager.sandboxPolicy(WorktreeDetails{Path: filepath.Join(home, "worktree")})
+	writable := policy.Writable
+
+	for _, path := range []string{
+		filepath.Join(home, ".claude.json"),
+		filepath.Join(home, ".claude", "projects"),
+		filepath.Join(home, ".claude", "todos"),
+		extra,
+	} {
+		if !slices.Contains(writable, path) {
+			t.Errorf("Expected %s to be writable, got %v", path, writable)
+		}
+	}
+	// The home directory of the test is in a temporary directory, which is
+	// writable as a whole
+	writable = slices.DeleteFunc(writable, func(root string) bool { return !isWithin(home, root) })
+	for _, path := range []string{
+		filepath.Join(home, ".claude", "settings.json"),
+		filepath.Join(home, ".claude", "hooks", "stop.sh"),
+	} {
+		if slices.ContainsFunc(writable, func(root string) bool { return samePath(root, path) || isWithin(root, path) }) {
+			t.Errorf("Expected %s to stay read-only, got %v", path, writable)
+		}
+	}
+
+	if dir, err := config.UserDir(); err != nil || !slices.Equal(policy.Hidden, []string{dir}) {
+		t.Errorf("Expected %s to be hidden, got %v", dir, policy.Hidden)
+	}
+}
@@ -0,0 +1,267 @@
+package worktree
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/asciicast"
+	"github.com/enriikke/claude-mux/internal/sandbox"
+)
+
+// ErrNoLog is returned when a session has no output log
+var ErrNoLog = errors.New("no output log")
+
+// Kinds of session data directories
+const (
+	activeData   = "sessions"
+	archivedData = "archive"
+)
+
+// sessionMeta is the metadata kept about a session next to its logs
+type sessionMeta struct {
+	Name      string    `json:"name"`
+	Branch    string    `json:"branch"`
+	Path      string    `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+	// Prompt, Autocommit and Network are the options the session was
+	// created with
+	Prompt     string           `json:"prompt,omitempty"`
+	Autocommit AutocommitPolicy `json:"autocommit,omitempty"`
+	Network    NetworkPolicy    `json:"network,omitzero"`
+	// Resumes counts how often the agent was resumed, last at ResumedAt
+	Resumes   int        `json:"resumes,omitempty"`
+	ResumedAt *time.Time `json:"resumed_at,omitempty"`
+}
+
+// dataDir returns the directory holding the data of a session. It is kept
+// in the git common directory, outside of any worktree, so it is never
+// committed and is shared by all worktrees.
+func (m *Manager) dataDir(kind, name string) (string, error) {
+	commonDir, err := m.git.CommonDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(commonDir, "claude-mux", kind, filepath.Base(name)), nil
+}
+
+// writeSessionMeta records the metadata of a new session
+func (m *Manager) writeSessionMeta(details WorktreeDetails, opts CreateOptions) error {
+	return m.saveSessionMeta(sessionMeta{
+		Name:       details.Name,
+		Branch:     details.Branch,
+		Path:       details.Path,
+		CreatedAt:  time.Now(),
+		Prompt:     opts.Prompt,
+		Autocommit: opts.Autocommit,
+		Network:    opts.Network,
+	})
+}
+
+// saveSessionMeta writes the metadata of a session
+func (m *Manager) saveSessionMeta(meta sessionMeta) error {
+	dir, err := m.dataDir(activeData, meta.Name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "session.json"), append(data, '\n'), 0600)
+}
+
+// readSessionMeta returns the metadata recorded for a session
+func (m *Manager) readSessionMeta(details WorktreeDetails) (sessionMeta, error) {
+	dir, err := m.dataDir(activeData, details.Name)
+	if err != nil {
+		return sessionMeta{}, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "session.json")) // #nosec G304 -- path derived from git's common dir
+	if err != nil {
+		return sessionMeta{}, err
+	}
+	var meta sessionMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return sessionMeta{}, fmt.Errorf("invalid session metadata: %w", err)
+	}
+	return meta, nil
+}
+
+// removeSessionData deletes the metadata and logs of a session
+func (m *Manager) removeSessionData(details WorktreeDetails) error {
+	dir, err := m.dataDir(activeData, details.Name)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// archiveSessionData moves the metadata and logs of a session aside so
+// they outlive its worktree
+func (m *Manager) archiveSessionData(details WorktreeDetails) error {
+	dir, err := m.dataDir(activeData, details.Name)
+	if err != nil {
+		return err
+	}
+	archive, err := m.dataDir(archivedData, details.Name)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(archive), 0700); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(archive); err != nil {
+		return err
+	}
+	return os.Rename(dir, archive)
+}
+
+// LogPath returns the output log of the most recent run of a session's
+// agent. Logs of archived sessions are found by their full name.
+func (m *Manager) LogPath(name string) (string, error) {
+	if err := m.resolveRepo(); err != nil {
+		return "", err
+	}
+
+	var dir string
+	details, err := m.Find(name)
+	switch {
+	case err == nil:
+		if dir, err = m.dataDir(activeData, details.Name); err != nil {
+			return "", err
+		}
+	case errors.Is(err, ErrNotFound):
+		archive, archiveErr := m.dataDir(archivedData, name)
+		if archiveErr != nil {
+			return "", archiveErr
+		}
+		if _, statErr := os.Stat(archive); statErr != nil {
+			return "", err
+		}
+		dir = archive
+	default:
+		return "", err
+	}
+
+	path, err := latestLog(dir)
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		return "", fmt.Errorf("%w for %s", ErrNoLog, name)
+	}
+	return path, nil
+}
+
+// latestLog returns the log of the most recent agent run in a session data
+// directory, or an empty path if there is none
+func latestLog(dir string) (string, error) {
+	logs, err := filepath.Glob(filepath.Join(dir, "*.cast"))
+	if err != nil || len(logs) == 0 {
+		return "", err
+	}
+	sort.Strings(logs)
+	return logs[len(logs)-1], nil
+}
+
+// sessionLog records the terminal output of an agent
+type sessionLog struct {
+	*asciicast.Writer
+	file *os.File
+	// denials spots file access the sandbox denied, nil when not sandboxed
+	denials *sandbox.Monitor
+}
+
+// openSessionLog starts a new output log for a run of the session's agent.
+// It returns nil when logging is disabled or the log cannot be created, in
+// which case the agent runs unrecorded.
+func (m *Manager) openSessionLog(details WorktreeDetails, size TermSize) *sessionLog {
+	if !m.config.SessionLogs {
+		return nil
+	}
+
+	log, err := m.createSessionLog(details, size)
+	if err != nil {
+		warning := sessionEvent(EventWarning, details)
+		warning.Message = "Failed to create the session log, output is not recorded"
+		warning.Err = err
+		m.emit(warning)
+		return nil
+	}
+	if m.config.Sandbox {
+		log.watchSandbox(m.sandboxPolicy(details))
+	}
+	return log
+}
+
+func (m *Manager) createSessionLog(details WorktreeDetails, size TermSize) (*sessionLog, error) {
+	dir, err := m.dataDir(activeData, details.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	// Names sort by start time, so the last one is the most recent run
+	path := filepath.Join(dir, time.Now().Format("20060102-150405.000")+".cast")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600) // #nosec G304 -- path derived from git's common dir
+	if err != nil {
+		return nil, err
+	}
+
+	if size.Rows == 0 || size.Cols == 0 {
+		size = defaultTermSize
+	}
+	w, err := asciicast.NewWriter(file, asciicast.Header{
+		Width:  int(size.Cols),
+		Height: int(size.Rows),
+		Title:  details.Name,
+		Env:    map[string]string{"TERM": os.Getenv("TERM"), "SHELL": os.Getenv("SHELL")},
+	})
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return &sessionLog{Writer: w, file: file}, nil
+}
+
+// watchSandbox records the sandbox of the agent, and marks the file access
+// it denies as the agent reports it
+func (l *sessionLog) watchSandbox(policy sandbox.Policy) {
+	_ = l.Mark(sandbox.Describe(policy))
+	l.denials = sandbox.NewMonitor(func(denial string) {
+		_ = l.Mark("sandbox denied: " + denial)
+	})
+}
+
+// Write records output of the agent
+func (l *sessionLog) Write(p []byte) (int, error) {
+	if l.denials != nil {
+		_, _ = l.denials.Write(p)
+	}
+	return l.Writer.Write(p)
+}
+
+// resize records a change of the agent's terminal size
+func (l *sessionLog) resize(size TermSize) {
+	_ = l.Resize(int(size.Cols), int(size.Rows))
+}
+
+// Close writes buffered output and closes the log
+func (l *sessionLog) Close() error {
+	return errors.Join(l.Flush(), l.file.Close())
+}
@@ -0,0 +1,150 @@
+package worktree
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/enriikke/claude-mux/internal/asciicast"
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/git/gitfake"
+)
+
+// newLoggingManager returns a fake manager that records session logs
+func newLoggingManager(t *testing.T, stdout *bytes.Buffer) (*Manager, *gitfake.Backend) {
+	t.Helper()
+	backend := gitfake.New(t.TempDir())
+	manager := NewManager(config.Config{
+		WorktreeBasePath: ".claude-mux",
+		ClaudeCommand:    "echo",
+		SessionLogs:      true,
+	}, WithBackend(backend), WithStdio(strings.NewReader(""), stdout, stdout))
+	return manager, backend
+}
+
+// readLog returns the header and output recorded in a session log
+func readLog(t *testing.T, path string) (asciicast.Header, string) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	r, err := asciicast.NewReader(f)
+	if err != nil {
+		t.Fatalf("NewReader() error = %v", err)
+	}
+	var output strings.Builder
+	for {
+		e, err := r.Next()
+		if err != nil {
+			break
+		}
+		if e.Type == asciicast.Output {
+			output.WriteString(e.Data)
+		}
+	}
+	return r.Header, output.String()
+}
+
+func TestManager_SessionLog(t *testing.T) {
+	t.Parallel()
+
+	var stdout bytes.Buffer
+	manager, _ := newLoggingManager(t, &stdout)
+	details, err := manager.Create(context.Background(), CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	dir, err := manager.dataDir(activeData, details.Name)
+	if err != nil {
+		t.Fatalf("dataDir() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "session.json"))
+	if err != nil {
+		t.Fatalf("Expected session metadata: %v", err)
+	}
+	var meta sessionMeta
+	if err := json.Unmarshal(data, &meta); err != nil || meta.Branch != details.Branch || meta.CreatedAt.IsZero() {
+		t.Errorf("Unexpected session metadata %s (%v)", data, err)
+	}
+
+	if _, err := manager.LogPath(details.Name); !errors.Is(err, ErrNoLog) {
+		t.Errorf("LogPath() before the first launch error = %v, want %v", err, ErrNoLog)
+	}
+
+	if err := manager.Launch(context.Background(), details.Name); err != nil {
+		t.Fatalf("Launch() error = %v", err)
+	}
+	path, err := manager.LogPath(details.Name)
+	if err != nil {
+		t.Fatalf("LogPath() error = %v", err)
+	}
+	header, output := readLog(t, path)
+	if header.Title != details.Name || header.Width != 80 || header.Height != 24 {
+		t.Errorf("Unexpected log header %+v", header)
+	}
+	// The agent still writes to the configured output
+	if output != stdout.String() || output == "" {
+		t.Errorf("Expected the log to contain the agent output %q, got %q", stdout.String(), output)
+	}
+
+	if _, err := manager.Remove(context.Background(), details.Name, true); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected session data to be removed with the session, Stat() error = %v", err)
+	}
+	if _, err := manager.LogPath(details.Name); !errors.Is(err, ErrNotFound) {
+		t.Errorf("LogPath() of a removed session error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestManager_SessionLogArchived(t *testing.T) {
+	t.Parallel()
+
+	var stdout bytes.Buffer
+	manager, _ := newLoggingManager(t, &stdout)
+	details, err := manager.Create(context.Background(), CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if err := manager.Launch(context.Background(), details.Name); err != nil {
+		t.Fatalf("Launch() error = %v", err)
+	}
+
+	if _, err := manager.Archive(context.Background(), details.Name); err != nil {
+		t.Fatalf("Archive() error = %v", err)
+	}
+	path, err := manager.LogPath(details.Name)
+	if err != nil {
+		t.Fatalf("LogPath() of an archived session error = %v", err)
+	}
+	if _, output := readLog(t, path); output == "" {
+		t.Error("Expected the archived log to keep the agent output")
+	}
+}
+
+func TestManager_SessionLogDisabled(t *testing.T) {
+	t.Parallel()
+
+	manager, _ := newFakeManager(t)
+	details, err := manager.Create(context.Background(), CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	manager.stdout, manager.stderr = &bytes.Buffer{}, &bytes.Buffer{}
+	if err := manager.Launch(context.Background(), details.Name); err != nil {
+		t.Fatalf("Launch() error = %v", err)
+	}
+	if _, err := manager.LogPath(details.Name); !errors.Is(err, ErrNoLog) {
+		t.Errorf("LogPath() error = %v, want %v", err, ErrNoLog)
+	}
+}
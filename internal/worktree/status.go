@@ -0,0 +1,229 @@
+package worktree
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/config"
+)
+
+// AgentState describes what the agent of a session is doing
+type AgentState string
+
+// Agent states
+const (
+	// AgentIdle means no agent ran in the session yet
+	AgentIdle AgentState = "idle"
+	// AgentRunning means the agent runs and recently produced output
+	AgentRunning AgentState = "running"
+	// AgentWaiting means the agent runs but has been quiet for a while,
+	// which for an interactive agent means it waits for input
+	AgentWaiting AgentState = "waiting"
+	// AgentPaused means the agent was paused and uses no CPU until it is
+	// unpaused
+	AgentPaused AgentState = "paused"
+	// AgentExited means the last agent that ran in the session exited
+	AgentExited AgentState = "exited"
+	// AgentStopped means the last agent that ran in the session exited
+	// because it was stopped
+	AgentStopped AgentState = "stopped"
+)
+
+// alive reports whether the agent in this state still runs, if paused
+func (s AgentState) alive() bool {
+	switch s {
+	case AgentRunning, AgentWaiting, AgentPaused:
+		return true
+	}
+	return false
+}
+
+// waitingAfter is how long a running agent may be quiet before it is
+// considered waiting for input. Agents show progress while they work.
+const waitingAfter = 5 * time.Second
+
+// agentFile holds the agent process of a session, next to its logs
+const agentFile = "agent.json"
+
+// agentRecord is the agent process last started in a session. It is kept
+// on disk so any claude-mux process can tell whether the agent runs.
+type agentRecord struct {
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"started_at"`
+	// Start is when the process started as the platform reports it, so a
+	// process that reused the PID is not taken for the agent. It is zero
+	// where the platform cannot tell.
+	Start    uint64     `json:"start,omitempty"`
+	ExitedAt *time.Time `json:"exited_at,omitempty"`
+	// PausedAt is set while the agent is paused
+	PausedAt *time.Time `json:"paused_at,omitempty"`
+	// Stopped is set once the agent was asked to stop
+	Stopped bool `json:"stopped,omitempty"`
+	// Limits are the resource limits the agent runs under, if any
+	Limits *config.Limits `json:"limits,omitempty"`
+	// Cgroup is the cgroup created for the agent, removed once it exited.
+	// It is empty when the agent runs without limits or systemd manages
+	// its cgroup.
+	Cgroup string `json:"cgroup,omitempty"`
+	// Container is the container the agent runs in, nil on the host
+	Container *agentContainer `json:"container,omitempty"`
+}
+
+// AgentStatus describes the agent of a session
+type AgentStatus struct {
+	State AgentState
+	// PID is the process ID of the running or last agent, 0 when idle
+	PID       int
+	StartedAt time.Time
+	// LastOutputAt is when the agent last wrote to its terminal. It is
+	// zero when output is not recorded, and then running and waiting
+	// agents cannot be told apart.
+	LastOutputAt time.Time
+	// Resources is what a running agent uses, set when it runs under
+	// resource limits
+	Resources *ResourceUsage
+}
+
+// recordAgentStart records that an agent process started in a session,
+// in cgroup. Failing to record it only affects status reporting, so it is
+// a warning.
+func (m *Manager) recordAgentStart(details WorktreeDetails, pid int, cgroup agentCgroup) {
+	record := agentRecord{PID: pid, StartedAt: time.Now(), Container: m.isolation.container(details)}
+	record.Start, _ = processStart(pid)
+	if cgroup.limited {
+		limits := m.config.Limits
+		record.Limits, record.Cgroup = &limits, cgroup.path
+	}
+	m.writeAgentRecord(details, record)
+}
+
+// recordAgentExit records that the agent process of a session exited
+func (m *Manager) recordAgentExit(details WorktreeDetails) {
+	record, err := m.readAgentRecord(details)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	record.ExitedAt = &now
+	m.writeAgentRecord(details, record)
+	if record.Cgroup != "" {
+		// Fails while children the agent left behind still run in it
+		_ = os.Remove(record.Cgroup)
+	}
+}
+
+func (m *Manager) writeAgentRecord(details WorktreeDetails, record agentRecord) {
+	err := func() error {
+		dir, err := m.dataDir(activeData, details.Name)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		// Renaming a complete file over the record keeps readers from
+		// seeing a partly written one, which would look like no agent
+		tmp, err := os.CreateTemp(dir, agentFile+".*")
+		if err != nil {
+			return err
+		}
+		_, err = tmp.Write(append(data, '\n'))
+		if closeErr := tmp.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(tmp.Name(), filepath.Join(dir, agentFile))
+		}
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+		return err
+	}()
+	if err != nil {
+		warning := sessionEvent(EventWarning, details)
+		warning.Message = "Failed to record the agent process, its status is unknown"
+		warning.Err = err
+		m.emit(warning)
+	}
+}
+
+func (m *Manager) readAgentRecord(details WorktreeDetails) (agentRecord, error) {
+	dir, err := m.dataDir(activeData, details.Name)
+	if err != nil {
+		return agentRecord{}, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, agentFile)) // #nosec G304 -- path derived from git's common dir
+	if err != nil {
+		return agentRecord{}, err
+	}
+	var record agentRecord
+	err = json.Unmarshal(data, &record)
+	return record, err
+}
+
+// agentAlive reports whether the recorded agent process still runs. A
+// process that reused its PID since, or that belongs to another user, is
+// not the agent.
+func agentAlive(record agentRecord) bool {
+	if !processAlive(record.PID) {
+		return false
+	}
+	if record.Start == 0 {
+		return true
+	}
+	start, err := processStart(record.PID)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return true
+	}
+	return err == nil && start == record.Start
+}
+
+// agentStatus determines the state of the agent of a session from its
+// recorded process and the time its output log was last written
+func (m *Manager) agentStatus(details WorktreeDetails) AgentStatus {
+	record, err := m.readAgentRecord(details)
+	if err != nil || record.PID == 0 {
+		return AgentStatus{State: AgentIdle}
+	}
+
+	status := AgentStatus{State: AgentExited, PID: record.PID, StartedAt: record.StartedAt}
+	if dir, err := m.dataDir(activeData, details.Name); err == nil {
+		// Logs of earlier runs say nothing about the current one, whose log
+		// is created right before the agent starts
+		if path, _ := latestLog(dir); path != "" {
+			if info, err := os.Stat(path); err == nil && !info.ModTime().Before(record.StartedAt.Add(-time.Second)) {
+				status.LastOutputAt = info.ModTime()
+			}
+		}
+	}
+	if record.ExitedAt != nil || !agentAlive(record) {
+		if record.Stopped {
+			status.State = AgentStopped
+		}
+		return status
+	}
+	if record.Limits != nil {
+		if usage, err := cgroupUsage(record.Cgroup, record.PID); err == nil {
+			usage.Limits = *record.Limits
+			status.Resources = &usage
+		}
+	}
+
+	if record.PausedAt != nil {
+		status.State = AgentPaused
+		return status
+	}
+
+	status.State = AgentRunning
+	if !status.LastOutputAt.IsZero() && time.Since(status.LastOutputAt) > waitingAfter {
+		status.State = AgentWaiting
+	}
+	return status
+}
@@ -0,0 +1,94 @@
+package worktree
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/config"
+)
+
+// sessionState returns the agent state List reports for a session
+func sessionState(t *testing.T, manager *Manager, name string) AgentStatus {
+	t.Helper()
+	sessions, err := manager.List(context.Background())
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	for _, s := range sessions {
+		if s.Name == name {
+			return s.Agent
+		}
+	}
+	t.Fatalf("List() did not return %s", name)
+	return AgentStatus{}
+}
+
+func TestManager_agentStatus(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("background agents need a pseudo terminal")
+	}
+
+	ctx := context.Background()
+	manager := NewManager(config.Config{
+		RepoDir:          setupTestRepo(t),
+		WorktreeBasePath: ".claude-mux-test",
+		ClaudeCommand:    "/bin/sh",
+		StopTimeout:      time.Second,
+		SessionLogs:      true,
+	})
+	details, err := manager.Create(ctx, CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if status := sessionState(t, manager, details.Name); status.State != AgentIdle || status.PID != 0 {
+		t.Errorf("Expected a new session to be idle, got %+v", status)
+	}
+
+	agent, err := manager.Start(ctx, details.Name, TermSize{})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			if _, err := agent.Read(buf); err != nil {
+				return
+			}
+		}
+	}()
+	status := sessionState(t, manager, details.Name)
+	if status.State != AgentRunning || status.PID != agent.PID() {
+		t.Errorf("Expected the agent to run as pid %d, got %+v", agent.PID(), status)
+	}
+
+	// An agent that has been quiet for a while waits for input
+	path, err := manager.LogPath(details.Name)
+	if err != nil {
+		t.Fatalf("LogPath() error = %v", err)
+	}
+	quiet := time.Now().Add(-time.Minute)
+	status.StartedAt = status.StartedAt.Add(-2 * time.Minute)
+	manager.writeAgentRecord(details, agentRecord{PID: agent.PID(), StartedAt: status.StartedAt})
+	if err := os.Chtimes(path, quiet, quiet); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+	if status := sessionState(t, manager, details.Name); status.State != AgentWaiting || !status.LastOutputAt.Equal(quiet) {
+		t.Errorf("Expected a quiet agent to be waiting, got %+v", status)
+	}
+
+	agent.Stop()
+	_ = agent.Close()
+	if status := sessionState(t, manager, details.Name); status.State != AgentStopped || status.PID != agent.PID() {
+		t.Errorf("Expected the agent to have stopped, got %+v", status)
+	}
+
+	// Agents that died without their exit being recorded exited as well
+	manager.writeAgentRecord(details, agentRecord{PID: agent.PID(), StartedAt: time.Now()})
+	if status := sessionState(t, manager, details.Name); status.State != AgentExited {
+		t.Errorf("Expected a dead agent to have exited, got %+v", status)
+	}
+}
@@ -1,166 +1,572 @@
 package worktree
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/enriikke/claude-mux/internal/config"
 	"github.com/enriikke/claude-mux/internal/git"
+	"github.com/enriikke/claude-mux/internal/terminal"
+)
+
+var (
+	// ErrNotRepository is returned when claude-mux runs outside a git repository
+	ErrNotRepository = errors.New("not in a git repository")
+
+	// ErrNotFound is returned when no session matches the given name
+	ErrNotFound = errors.New("session not found")
+
+	// ErrAmbiguous is returned when a partial name matches several sessions
+	ErrAmbiguous = errors.New("ambiguous session name")
 )
 
 // Manager handles git worktree operations for Claude sessions
 type Manager struct {
-	config config.Config
-	git    *git.Client
+	config  config.Config
+	git     git.Backend
+	onEvent func(Event)
+	// isolation starts agents on the host or in containers
+	isolation isolation
+
+	// forwardSignals passes signals received while the agent runs on to it
+	forwardSignals bool
+
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+
+	repoOnce sync.Once
+	root     string
+	repoErr  error
+}
+
+// Option customizes a Manager
+type Option func(*Manager)
+
+// WithBackend makes the manager use b for git operations instead of the git executable
+func WithBackend(b git.Backend) Option {
+	return func(m *Manager) {
+		m.git = b
+	}
+}
+
+// WithEventHandler registers fn to receive progress events
+func WithEventHandler(fn func(Event)) Option {
+	return func(m *Manager) {
+		m.onEvent = fn
+	}
+}
+
+// WithStdio connects the agent to the given streams instead of the
+// standard streams of the current process
+func WithStdio(stdin io.Reader, stdout, stderr io.Writer) Option {
+	return func(m *Manager) {
+		m.stdin = stdin
+		m.stdout = stdout
+		m.stderr = stderr
+	}
+}
+
+// WithSignalForwarding makes the manager catch signals while the agent
+// runs and pass them on to it. Only tools that own the process and its
+// terminal, like the CLI, should enable it.
+func WithSignalForwarding() Option {
+	return func(m *Manager) {
+		m.forwardSignals = true
+	}
 }
 
 // NewManager creates a new worktree manager
-func NewManager(cfg config.Config) *Manager {
-	return &Manager{
+func NewManager(cfg config.Config, opts ...Option) *Manager {
+	m := &Manager{
 		config: cfg,
-		git:    git.NewClient(cfg.Verbose),
+		git:    git.NewClient(cfg.RepoDir, cfg.Verbose),
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.isolation = newIsolation(m)
+	return m
 }
 
-// CreateAndLaunch creates a new worktree and launches Claude Code
-func (m *Manager) CreateAndLaunch(name string) error {
+// errChangesNotCounted is the StatusErr of sessions listed by ListAgents
+var errChangesNotCounted = errors.New("uncommitted changes were not counted")
+
+// Session describes a claude-mux worktree
+type Session struct {
+	Name   string
+	Branch string
+	Path   string
+	Locked bool
+	// Changes is the number of files with uncommitted changes
+	Changes int
+	// StatusErr is why the changes could not be counted, in which case
+	// Changes is zero but unknown
+	StatusErr error
+	// Agent describes the agent running in the session, if any
+	Agent AgentStatus
+}
+
+// CreateOptions configures a new session
+type CreateOptions struct {
+	// Name is a human readable prefix for the session name
+	Name string
+	// Prompt is the task passed to the agent when it starts
+	Prompt string
+	// Autocommit commits the agent's work once it exits, before any cleanup
+	Autocommit AutocommitPolicy
+	// Cleanup removes the session once the agent exits
+	Cleanup bool
+	// Network confines the network access of the agent whenever it runs
+	Network NetworkPolicy
+}
+
+// Create creates a new session worktree without launching the agent
+func (m *Manager) Create(ctx context.Context, opts CreateOptions) (WorktreeDetails, error) {
+	if err := ctx.Err(); err != nil {
+		return WorktreeDetails{}, err
+	}
+
+	if err := opts.Network.Validate(); err != nil {
+		return WorktreeDetails{}, err
+	}
+
 	// Validate we're in a git repository
-	if err := m.git.ValidateRepo(); err != nil {
-		return fmt.Errorf("not in a git repository: %w", err)
+	if err := m.resolveRepo(); err != nil {
+		return WorktreeDetails{}, err
+	}
+	if err := m.enforceQuota(ctx); err != nil {
+		return WorktreeDetails{}, err
 	}
 
-	// Generate worktree details
-	details, err := m.generateWorktreeDetails(name)
-	if err != nil {
-		return fmt.Errorf("failed to generate worktree details: %w", err)
+	// Keep worktrees from showing up as untracked content
+	if err := m.ensureBaseIgnored(); err != nil {
+		m.emit(Event{
+			Type:    EventWarning,
+			Message: fmt.Sprintf("Failed to exclude %s from git", m.basePath()),
+			Err:     err,
+		})
 	}
 
 	// Create the worktree
-	fmt.Printf("🌳 Creating worktree: %s\n", details.Name)
-	if err := m.createWorktree(details); err != nil {
-		return fmt.Errorf("failed to create worktree: %w", err)
+	details, err := m.createUniqueWorktree(ctx, opts.Name)
+	if err != nil {
+		return WorktreeDetails{}, err
+	}
+	if err := m.writeSessionMeta(details, opts); err != nil {
+		warning := sessionEvent(EventWarning, details)
+		warning.Message = "Failed to write session metadata"
+		warning.Err = err
+		m.emit(warning)
 	}
 
-	fmt.Printf("✅ Worktree created at: %s\n", details.Path)
-	fmt.Printf("🌿 Branch: %s\n", details.Branch)
+	m.emit(sessionEvent(EventCreated, details))
+	return details, nil
+}
 
-	// Launch Claude Code
-	fmt.Printf("\n🚀 Launching Claude Code...\n")
-	if err := m.launchClaude(details.Path); err != nil {
-		if m.config.AutoCleanup {
-			_ = m.cleanup(details)
-		}
-		return fmt.Errorf("failed to launch Claude: %w", err)
+// Launch runs the agent in the worktree of an existing session until it
+// exits. Canceling ctx stops the agent.
+func (m *Manager) Launch(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	details, err := m.Find(name)
+	if err != nil {
+		return err
 	}
+	return m.launch(ctx, details)
+}
 
-	// Cleanup if requested
-	if m.config.AutoCleanup {
-		fmt.Printf("\n🧹 Cleaning up worktree...\n")
-		return m.cleanup(details)
+// LaunchCreated runs the agent for the first time in a session made by
+// Create, as CreateAndLaunch does for a new session, e.g. from another
+// process. The prompt and autocommit policy of opts are recorded with the
+// session; its Name is ignored.
+func (m *Manager) LaunchCreated(ctx context.Context, name string, opts CreateOptions) (WorktreeDetails, error) {
+	if err := ctx.Err(); err != nil {
+		return WorktreeDetails{}, err
 	}
 
-	fmt.Printf("\n✨ Session completed. Worktree preserved at: %s\n", details.Path)
-	fmt.Printf("💡 To remove: claude-mux remove %s\n", details.Name)
-	return nil
+	details, err := m.Find(name)
+	if err != nil {
+		return WorktreeDetails{}, err
+	}
+	opts.Name = details.Name
+	meta, err := m.readSessionMeta(details)
+	if err != nil {
+		meta = sessionMeta{Name: details.Name, Branch: details.Branch, Path: details.Path, CreatedAt: time.Now()}
+	}
+	meta.Prompt, meta.Autocommit = opts.Prompt, opts.Autocommit
+	if err := m.saveSessionMeta(meta); err != nil {
+		warning := sessionEvent(EventWarning, details)
+		warning.Message = "Failed to update session metadata"
+		warning.Err = err
+		m.emit(warning)
+	}
+
+	run := m.beginRun(details, opts)
+	launchErr := m.launch(ctx, details, agentArgs(opts)...)
+	if err := m.afterExit(details, opts, run); launchErr == nil {
+		return details, err
+	}
+	return details, launchErr
 }
 
-// List shows all active Claude worktrees
-func (m *Manager) List() error {
-	worktrees, err := m.git.ListWorktrees()
+// CreateAndLaunch creates a new worktree and launches Claude Code. Canceling
+// ctx stops the agent; post-exit processing still runs.
+func (m *Manager) CreateAndLaunch(ctx context.Context, opts CreateOptions) (WorktreeDetails, error) {
+	details, err := m.Create(ctx, opts)
 	if err != nil {
-		return err
+		return WorktreeDetails{}, err
 	}
 
-	// Filter for claude-mux worktrees
-	var claudeWorktrees []git.Worktree
-	for _, wt := range worktrees {
-		if strings.Contains(wt.Branch, "claude-mux-") ||
-			strings.Contains(wt.Path, m.config.WorktreeBasePath) {
-			claudeWorktrees = append(claudeWorktrees, wt)
-		}
+	run := m.beginRun(details, opts)
+	launchErr := m.launch(ctx, details, agentArgs(opts)...)
+	if err := m.afterExit(details, opts, run); launchErr == nil {
+		return details, err
+	}
+	return details, launchErr
+}
+
+// afterExit runs once the agent of a new session exited, whether it
+// succeeded, failed or was stopped. The worktree is kept when committing
+// the agent's work failed, so cleanup never destroys it.
+func (m *Manager) afterExit(details WorktreeDetails, opts CreateOptions, run agentRun) error {
+	if err := m.autocommit(details, opts, run); err != nil {
+		warning := sessionEvent(EventWarning, details)
+		warning.Message = "Failed to commit the agent's work"
+		warning.Err = err
+		warning.Hint = fmt.Sprintf("Commit it yourself in %s", details.Path)
+		m.emit(warning)
+		m.emit(sessionEvent(EventCompleted, details))
+		return fmt.Errorf("failed to commit the agent's work: %w", err)
 	}
 
-	if len(claudeWorktrees) == 0 {
-		fmt.Println("No active Claude worktrees found.")
+	if !opts.Cleanup {
+		m.emit(sessionEvent(EventCompleted, details))
 		return nil
 	}
 
-	fmt.Println("Active Claude worktrees:")
-	fmt.Println()
-	for _, wt := range claudeWorktrees {
-		status := "active"
-		if wt.Locked {
-			status = "locked"
+	// Branches holding committed work survive the cleanup
+	m.emit(sessionEvent(EventCleaningUp, details))
+	removal := m.cleanup(details, !opts.Autocommit.enabled())
+	m.emitRemoval(removal)
+	return removal.Err
+}
+
+// launch runs the agent in a session worktree and reports its lifecycle
+func (m *Manager) launch(ctx context.Context, details WorktreeDetails, args ...string) error {
+	m.emit(sessionEvent(EventLaunching, details))
+	stopCheckpoints := m.watchCheckpoints(details)
+	err := m.launchClaude(ctx, details, args...)
+	stopCheckpoints()
+
+	exited := sessionEvent(EventExited, details)
+	exited.Err = err
+	m.emit(exited)
+	return err
+}
+
+// List returns all active Claude worktrees
+func (m *Manager) List(ctx context.Context) ([]Session, error) {
+	return m.list(ctx, true)
+}
+
+// ListAgents is like List without counting the changes of the sessions,
+// which takes a git status per worktree, so their StatusErr is set. It
+// suits callers polling for the state of agents.
+func (m *Manager) ListAgents(ctx context.Context) ([]Session, error) {
+	return m.list(ctx, false)
+}
+
+func (m *Manager) list(ctx context.Context, countChanges bool) ([]Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := m.resolveRepo(); err != nil {
+		return nil, err
+	}
+
+	worktrees, err := m.git.ListWorktrees()
+	if err != nil {
+		return nil, err
+	}
+
+	// Filter for claude-mux worktrees
+	var sessions []Session
+	for _, wt := range worktrees {
+		if !m.isClaudeWorktree(wt) {
+			continue
 		}
-		fmt.Printf("  %s\n", wt.Branch)
-		fmt.Printf("    Path:   %s\n", wt.Path)
-		fmt.Printf("    Status: %s\n", status)
-		fmt.Println()
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		session := Session{
+			Name:   filepath.Base(wt.Path),
+			Branch: wt.Branch,
+			Path:   wt.Path,
+			Locked: wt.Locked,
+		}
+		if countChanges {
+			changes, err := m.git.Status(wt.Path)
+			session.Changes, session.StatusErr = len(changes), err
+		} else {
+			session.StatusErr = errChangesNotCounted
+		}
+		session.Agent = m.agentStatus(WorktreeDetails{Name: session.Name, Branch: session.Branch, Path: session.Path})
+		sessions = append(sessions, session)
 	}
 
-	return nil
+	return sessions, nil
+}
+
+// Find returns the session whose name or branch matches name. Exact
+// matches win over partial ones, which must be unique.
+func (m *Manager) Find(name string) (WorktreeDetails, error) {
+	return m.find(name, false)
+}
+
+// FindExact returns the session whose name or branch is name. Operations
+// that destroy work use it, so a partial name never picks another session.
+func (m *Manager) FindExact(name string) (WorktreeDetails, error) {
+	return m.find(name, true)
 }
 
-// Remove deletes a specific worktree and its branch
-func (m *Manager) Remove(name string, force bool) error {
-	// Find the worktree
+func (m *Manager) find(name string, exact bool) (WorktreeDetails, error) {
+	if err := m.resolveRepo(); err != nil {
+		return WorktreeDetails{}, err
+	}
+
 	worktrees, err := m.git.ListWorktrees()
 	if err != nil {
-		return err
+		return WorktreeDetails{}, err
 	}
 
-	var target *git.Worktree
+	var partial []git.Worktree
 	for _, wt := range worktrees {
+		if !m.isClaudeWorktree(wt) {
+			continue
+		}
+		if filepath.Base(wt.Path) == name || wt.Branch == name {
+			return worktreeDetails(wt), nil
+		}
 		if strings.Contains(wt.Branch, name) || strings.HasSuffix(wt.Path, name) {
-			target = &wt
-			break
+			partial = append(partial, wt)
 		}
 	}
 
-	if target == nil {
-		return fmt.Errorf("worktree '%s' not found", name)
+	var candidates []string
+	for _, wt := range partial {
+		candidates = append(candidates, filepath.Base(wt.Path))
+	}
+	switch {
+	case len(partial) == 0:
+		return WorktreeDetails{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	case exact:
+		return WorktreeDetails{}, fmt.Errorf("%w: %s, give the full name of %s", ErrNotFound, name, strings.Join(candidates, " or "))
+	case len(partial) > 1:
+		return WorktreeDetails{}, fmt.Errorf("%w: %s matches %s", ErrAmbiguous, name, strings.Join(candidates, ", "))
+	}
+	return worktreeDetails(partial[0]), nil
+}
+
+// worktreeDetails describes the session of a claude-mux worktree
+func worktreeDetails(wt git.Worktree) WorktreeDetails {
+	return WorktreeDetails{
+		Name:   filepath.Base(wt.Path),
+		Branch: wt.Branch,
+		Path:   wt.Path,
+	}
+}
+
+// Remove deletes a specific worktree and its branch. Branches with
+// unmerged changes are only deleted when force is set.
+func (m *Manager) Remove(ctx context.Context, name string, force bool) (Removal, error) {
+	if err := ctx.Err(); err != nil {
+		return Removal{}, err
 	}
 
-	details := WorktreeDetails{
-		Name:   name,
-		Branch: target.Branch,
-		Path:   target.Path,
+	details, err := m.FindExact(name)
+	if err != nil {
+		return Removal{}, err
 	}
 
-	return m.cleanup(details)
+	removal := m.cleanup(details, force)
+	m.emitRemoval(removal)
+	return removal, removal.Err
 }
 
-// Prune removes all Claude worktrees
-func (m *Manager) Prune() error {
-	worktrees, err := m.git.ListWorktrees()
+// Diff returns the changes committed on a session branch since it diverged
+// from the branch checked out in the main worktree
+func (m *Manager) Diff(ctx context.Context, name string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	details, err := m.Find(name)
 	if err != nil {
+		return "", err
+	}
+	return m.git.Diff("HEAD", details.Branch)
+}
+
+// Merge merges a session branch into the branch checked out in the main
+// worktree. Uncommitted changes in the session worktree are not merged.
+func (m *Manager) Merge(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
 
-	count := 0
+	details, err := m.Find(name)
+	if err != nil {
+		return err
+	}
+
+	if changes, err := m.git.Status(details.Path); err == nil && len(changes) > 0 {
+		warning := sessionEvent(EventWarning, details)
+		warning.Message = fmt.Sprintf("%s has %d uncommitted file(s) that will not be merged", details.Name, len(changes))
+		warning.Hint = fmt.Sprintf("Commit them first in %s", details.Path)
+		m.emit(warning)
+	}
+
+	target, err := m.git.CurrentBranch()
+	if err != nil {
+		return err
+	}
+	if err := m.git.Merge(details.Branch); err != nil {
+		return err
+	}
+
+	merged := sessionEvent(EventMerged, details)
+	merged.Message = target
+	m.emit(merged)
+	return nil
+}
+
+// PruneReport describes what Prune removed, or would remove in a dry run
+type PruneReport struct {
+	DryRun bool
+	// StaleMetadata describes administrative entries of vanished worktrees
+	StaleMetadata []string
+	// Worktrees lists the claude-mux worktrees that were removed
+	Worktrees []Removal
+	// Kept lists the claude-mux worktrees left in place because their
+	// agent runs or they are locked, with Err saying which
+	Kept []Removal
+	// BranchesDeleted lists orphaned branches that were deleted
+	BranchesDeleted []string
+	// BranchesPreserved lists orphaned branches kept because of unmerged changes
+	BranchesPreserved []string
+	// Errors lists problems that did not stop the prune
+	Errors []error
+}
+
+// Prune removes all Claude worktrees, stale worktree metadata, and claude-mux
+// branches left behind without a worktree. Worktrees whose agent runs or
+// that are locked are kept, and so are branches with unmerged changes
+// unless force is set. With dryRun nothing is removed.
+func (m *Manager) Prune(ctx context.Context, dryRun, force bool) (PruneReport, error) {
+	report := PruneReport{DryRun: dryRun}
+	if err := ctx.Err(); err != nil {
+		return report, err
+	}
+	if err := m.resolveRepo(); err != nil {
+		return report, err
+	}
+
+	// Drop metadata for vanished directories first so their branches are
+	// treated as orphans below
+	stale, err := m.git.PruneWorktrees(dryRun)
+	if err != nil {
+		report.Errors = append(report.Errors, err)
+	}
+	report.StaleMetadata = stale
+
+	worktrees, err := m.git.ListWorktrees()
+	if err != nil {
+		return report, err
+	}
+
 	for _, wt := range worktrees {
-		if strings.Contains(wt.Branch, "claude-mux-") ||
-			strings.Contains(wt.Path, m.config.WorktreeBasePath) {
-			details := WorktreeDetails{
-				Name:   filepath.Base(wt.Path),
-				Branch: wt.Branch,
-				Path:   wt.Path,
-			}
-			if err := m.cleanup(details); err != nil {
-				fmt.Printf("⚠️  Failed to remove %s: %v\n", wt.Path, err)
-			} else {
-				count++
-			}
+		if !m.isClaudeWorktree(wt) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		details := WorktreeDetails{
+			Name:   filepath.Base(wt.Path),
+			Branch: wt.Branch,
+			Path:   wt.Path,
+		}
+		switch {
+		case m.agentStatus(details).State.alive():
+			report.Kept = append(report.Kept, Removal{WorktreeDetails: details, Err: fmt.Errorf("%w: %s", ErrAgentRunning, details.Name)})
+			continue
+		case wt.Locked:
+			report.Kept = append(report.Kept, Removal{WorktreeDetails: details, Err: fmt.Errorf("%w: %s", ErrLocked, details.Name)})
+			continue
+		}
+		if dryRun {
+			report.Worktrees = append(report.Worktrees, Removal{WorktreeDetails: details})
+			continue
+		}
+
+		removal := m.cleanup(details, force)
+		if removal.Err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("failed to remove %s: %w", wt.Path, removal.Err))
+			continue
 		}
+		report.Worktrees = append(report.Worktrees, removal)
+	}
+
+	if err := m.pruneOrphanBranches(&report, force); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// pruneOrphanBranches deletes claude-mux branches without a worktree and
+// records the outcome in report
+func (m *Manager) pruneOrphanBranches(report *PruneReport, force bool) error {
+	orphans, err := m.orphanBranches()
+	if err != nil {
+		return err
 	}
 
-	fmt.Printf("🧹 Removed %d worktree(s)\n", count)
+	for _, branch := range orphans {
+		merged, err := m.git.IsMerged(branch, "HEAD")
+		if err != nil {
+			report.Errors = append(report.Errors, err)
+			continue
+		}
+		if !merged && !force {
+			report.BranchesPreserved = append(report.BranchesPreserved, branch)
+			continue
+		}
+
+		if !report.DryRun {
+			if err := m.git.DeleteBranch(branch, !merged); err != nil {
+				report.Errors = append(report.Errors, err)
+				continue
+			}
+		}
+		report.BranchesDeleted = append(report.BranchesDeleted, branch)
+	}
 	return nil
 }
 
@@ -173,6 +579,10 @@ type WorktreeDetails struct {
 
 // generateWorktreeDetails creates unique names for a new worktree
 func (m *Manager) generateWorktreeDetails(name string) (WorktreeDetails, error) {
+	if err := m.resolveRepo(); err != nil {
+		return WorktreeDetails{}, err
+	}
+
 	// Get current branch for context
 	currentBranch, err := m.git.CurrentBranch()
 	if err != nil {
@@ -202,23 +612,147 @@ func (m *Manager) generateWorktreeDetails(name string) (WorktreeDetails, error)
 	branch = strings.ReplaceAll(branch, "/", "-")
 	branch = strings.ReplaceAll(branch, " ", "-")
 
-	// Get absolute path for worktree
-	basePath := m.config.WorktreeBasePath
-	if !filepath.IsAbs(basePath) {
-		cwd, err := os.Getwd()
-		if err != nil {
-			return WorktreeDetails{}, err
-		}
-		basePath = filepath.Join(cwd, basePath)
-	}
-
 	return WorktreeDetails{
 		Name:   sessionName,
 		Branch: branch,
-		Path:   filepath.Join(basePath, sessionName),
+		Path:   filepath.Join(m.basePath(), sessionName),
 	}, nil
 }
 
+// SessionGroup returns the name a session was created with, without the
+// unique suffix, so sessions started for the same task can be found
+// together. Sessions created without a name are grouped by the second
+// they were created in.
+func SessionGroup(name string) string {
+	i := strings.LastIndexByte(name, '-')
+	if i <= 0 {
+		return name
+	}
+	if _, err := hex.DecodeString(name[i+1:]); err != nil || len(name)-i-1 != 6 {
+		return name
+	}
+	return name[:i]
+}
+
+// Root returns the root of the main worktree of the repository
+func (m *Manager) Root() (string, error) {
+	if err := m.resolveRepo(); err != nil {
+		return "", err
+	}
+	return m.root, nil
+}
+
+// resolveRepo locates the main worktree root. When run from inside a session
+// worktree, git operations are re-targeted at the parent repository so new
+// sessions are never nested inside another session.
+func (m *Manager) resolveRepo() error {
+	m.repoOnce.Do(func() {
+		if err := m.git.ValidateRepo(); err != nil {
+			m.repoErr = ErrNotRepository
+			return
+		}
+
+		root, err := m.git.MainWorktreeRoot()
+		if err != nil {
+			m.repoErr = err
+			return
+		}
+		m.root = root
+
+		topLevel, err := m.git.TopLevel()
+		if err != nil {
+			m.repoErr = err
+			return
+		}
+		if samePath(topLevel, root) {
+			return
+		}
+
+		branch, err := m.git.CurrentBranch()
+		if err != nil {
+			m.repoErr = err
+			return
+		}
+		if m.isClaudeWorktree(git.Worktree{Path: topLevel, Branch: branch}) {
+			m.git = m.git.At(root)
+		}
+	})
+	return m.repoErr
+}
+
+// basePath returns the absolute worktree base path, anchored at the main
+// worktree root when configured as a relative path
+func (m *Manager) basePath() string {
+	if filepath.IsAbs(m.config.WorktreeBasePath) {
+		return filepath.Clean(m.config.WorktreeBasePath)
+	}
+	return filepath.Join(m.root, m.config.WorktreeBasePath)
+}
+
+// isClaudeWorktree reports whether a worktree belongs to claude-mux
+func (m *Manager) isClaudeWorktree(wt git.Worktree) bool {
+	return strings.HasPrefix(wt.Branch, "claude-mux-") || isWithin(m.basePath(), wt.Path)
+}
+
+// isWithin reports whether path is inside dir
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(resolvePath(dir), resolvePath(path))
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// samePath reports whether two paths refer to the same location
+func samePath(a, b string) bool {
+	return resolvePath(a) == resolvePath(b)
+}
+
+// resolvePath cleans a path and resolves symlinks where possible
+func resolvePath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return filepath.Clean(path)
+}
+
+// maxCreateAttempts bounds how often a colliding session name is regenerated
+const maxCreateAttempts = 3
+
+// createUniqueWorktree generates session details and creates the worktree,
+// picking a fresh name when the generated branch or path already exists
+func (m *Manager) createUniqueWorktree(ctx context.Context, name string) (WorktreeDetails, error) {
+	for attempt := 1; ; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return WorktreeDetails{}, err
+		}
+
+		details, err := m.generateWorktreeDetails(name)
+		if err != nil {
+			return WorktreeDetails{}, fmt.Errorf("failed to generate worktree details: %w", err)
+		}
+
+		m.emit(sessionEvent(EventCreating, details))
+		err = m.createWorktree(details)
+		switch {
+		case err == nil:
+			return details, nil
+		case (git.IsBranchExists(err) || git.IsPathExists(err)) && attempt < maxCreateAttempts:
+			retry := sessionEvent(EventRetrying, details)
+			retry.Err = err
+			m.emit(retry)
+		case git.IsBranchExists(err):
+			return WorktreeDetails{}, fmt.Errorf("branch %s already exists: %w", details.Branch, err)
+		case git.IsPathExists(err):
+			return WorktreeDetails{}, fmt.Errorf("path %s already exists, remove it or pick another --base-path: %w", details.Path, err)
+		case git.IsInvalidRef(err):
+			return WorktreeDetails{}, fmt.Errorf("invalid session name %q: %w", name, err)
+		default:
+			return WorktreeDetails{}, fmt.Errorf("failed to create worktree: %w", err)
+		}
+	}
+}
+
 // createWorktree creates a new git worktree
 func (m *Manager) createWorktree(details WorktreeDetails) error {
 	// Create parent directory with secure permissions
@@ -231,55 +765,128 @@ func (m *Manager) createWorktree(details WorktreeDetails) error {
 	return m.git.CreateWorktree(details.Path, details.Branch)
 }
 
-// launchClaude starts Claude Code in the specified directory
-func (m *Manager) launchClaude(worktreePath string) error {
-	// Change to worktree directory
-	originalDir, err := os.Getwd()
+// launchClaude starts Claude Code in the worktree directory and waits for it
+// to exit. Its output is recorded in the session log: in a terminal through
+// a pseudo terminal, otherwise by copying its output streams.
+func (m *Manager) launchClaude(ctx context.Context, details WorktreeDetails, args ...string) error {
+	stdin, inTerminal := terminal.File(m.stdin)
+	stdout, outTerminal := terminal.File(m.stdout)
+	cmd, release, err := m.isolation.command(details, inTerminal, args)
 	if err != nil {
 		return err
 	}
+	defer release()
 
-	if err := os.Chdir(worktreePath); err != nil {
-		return fmt.Errorf("failed to change directory: %w", err)
+	if inTerminal && outTerminal && ptySupported {
+		rows, cols := terminal.Size(stdout)
+		if log := m.openSessionLog(details, TermSize{Rows: rows, Cols: cols}); log != nil {
+			defer func() { _ = log.Close() }()
+			return m.runAgentInTerminal(ctx, cmd, details, stdin, stdout, log)
+		}
 	}
 
-	defer func() {
-		err := os.Chdir(originalDir)
-		if err != nil {
-			fmt.Printf("⚠️  Failed to restore original directory: %v\n", err)
+	cmd.Stdin = m.stdin
+	cmd.Stdout = m.stdout
+	cmd.Stderr = m.stderr
+	if !outTerminal {
+		if log := m.openSessionLog(details, defaultTermSize); log != nil {
+			defer func() { _ = log.Close() }()
+			cmd.Stdout = io.MultiWriter(m.stdout, log)
+			cmd.Stderr = io.MultiWriter(m.stderr, log)
 		}
-	}()
+	}
+	return m.runAgent(ctx, cmd, details)
+}
 
-	// Launch Claude Code
-	// #nosec G204 -- ClaudeCommand comes from user config, not untrusted input
-	cmd := exec.Command(m.config.ClaudeCommand)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// agentArgs returns the arguments the agent of a new session starts with.
+// Claude Code takes the initial prompt as its first argument.
+func agentArgs(opts CreateOptions) []string {
+	if opts.Prompt == "" {
+		return nil
+	}
+	return []string{opts.Prompt}
+}
+
+// sessionEnv returns the environment for processes running in a session worktree
+func sessionEnv(details WorktreeDetails) []string {
+	return append(os.Environ(),
+		"PWD="+details.Path,
+		"CLAUDE_MUX_SESSION="+details.Name,
+		"CLAUDE_MUX_BRANCH="+details.Branch,
+		"CLAUDE_MUX_WORKTREE="+details.Path,
+	)
+}
 
-	return cmd.Run()
+// Removal describes the outcome of removing a session worktree
+type Removal struct {
+	WorktreeDetails
+	// BranchDeleted is set when the session branch was deleted
+	BranchDeleted bool
+	// BranchPreserved is set when the branch was kept because of unmerged changes
+	BranchPreserved bool
+	// BranchErr is set when deleting the branch failed for another reason
+	BranchErr error
+	// Err is set when the worktree could not be removed
+	Err error
 }
 
-// cleanup removes a worktree and its branch
-func (m *Manager) cleanup(details WorktreeDetails) error {
-	// Remove worktree
+// cleanup removes a worktree and its branch. Branches with unmerged changes
+// are only deleted when force is set.
+func (m *Manager) cleanup(details WorktreeDetails, force bool) Removal {
+	removal := Removal{WorktreeDetails: details}
+
+	// Remove worktree. On failure the branch is still checked out, so it
+	// cannot be deleted either.
 	if err := m.git.RemoveWorktree(details.Path); err != nil {
-		fmt.Printf("⚠️  Failed to remove worktree: %v\n", err)
-	} else {
-		fmt.Printf("✅ Removed worktree: %s\n", details.Path)
+		removal.Err = err
+		return removal
 	}
+	// Logs, metadata and checkpoints are only useful while the session exists
+	_ = m.removeSessionData(details)
+	_ = m.removeCheckpoints(details)
 
 	// Try to delete branch
-	if err := m.git.DeleteBranch(details.Branch, false); err != nil {
-		// Try force delete
-		if err := m.git.DeleteBranch(details.Branch, true); err != nil {
-			fmt.Printf("ℹ️  Branch preserved (has unmerged changes): %s\n", details.Branch)
+	err := m.git.DeleteBranch(details.Branch, false)
+	if git.IsNotMerged(err) && force {
+		err = m.git.DeleteBranch(details.Branch, true)
+	}
+
+	switch {
+	case err == nil:
+		removal.BranchDeleted = true
+	case git.IsNotMerged(err):
+		removal.BranchPreserved = true
+	default:
+		removal.BranchErr = err
+	}
+	return removal
+}
+
+// emitRemoval reports the outcome of cleanup as events
+func (m *Manager) emitRemoval(r Removal) {
+	if r.Err != nil {
+		warning := sessionEvent(EventWarning, r.WorktreeDetails)
+		if git.IsLockedWorktree(r.Err) {
+			warning.Message = fmt.Sprintf("Worktree is locked: %s", r.Path)
+			warning.Hint = fmt.Sprintf("To unlock: git worktree unlock %s", r.Path)
 		} else {
-			fmt.Printf("✅ Deleted branch: %s\n", details.Branch)
+			warning.Message = "Failed to remove worktree"
+			warning.Err = r.Err
 		}
-	} else {
-		fmt.Printf("✅ Deleted branch: %s\n", details.Branch)
+		m.emit(warning)
+		return
+	}
+	m.emit(sessionEvent(EventWorktreeRemoved, r.WorktreeDetails))
+
+	switch {
+	case r.BranchDeleted:
+		m.emit(sessionEvent(EventBranchDeleted, r.WorktreeDetails))
+	case r.BranchPreserved:
+		m.emit(sessionEvent(EventBranchPreserved, r.WorktreeDetails))
+	case r.BranchErr != nil:
+		warning := sessionEvent(EventWarning, r.WorktreeDetails)
+		warning.Message = fmt.Sprintf("Failed to delete branch %s", r.Branch)
+		warning.Err = r.BranchErr
+		m.emit(warning)
 	}
-
-	return nil
 }
@@ -1,72 +1,53 @@
 package worktree
 
 import (
+	"bytes"
+	"context"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 
 	"github.com/enriikke/claude-mux/internal/config"
 )
 
-// restoreDirectory returns a function that restores the working directory
-// and reports any error via t.Errorf
-func restoreDirectory(t *testing.T, dir string) func() {
-	return func() {
-		if err := os.Chdir(dir); err != nil {
-			t.Errorf("Failed to restore directory: %v", err)
-		}
+// runGit runs a git command in dir and fails the test on error
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to run git %v: %v\n%s", args, err, output)
 	}
 }
 
 func setupTestRepo(t *testing.T) string {
+	t.Helper()
 	tmpDir := t.TempDir()
-	originalDir, err := os.Getwd()
-	if err != nil {
-		t.Fatalf("Failed to get current directory: %v", err)
-	}
-
-	// Initialize git repo
-	if err := os.Chdir(tmpDir); err != nil {
-		t.Fatalf("Failed to change to temp directory: %v", err)
-	}
-
-	commands := [][]string{
-		{"git", "init"},
-		{"git", "config", "user.email", "test@example.com"},
-		{"git", "config", "user.name", "Test User"},
-	}
 
-	for _, cmd := range commands {
-		if err := exec.Command(cmd[0], cmd[1:]...).Run(); err != nil {
-			t.Fatalf("Failed to run %v: %v", cmd, err)
-		}
-	}
+	runGit(t, tmpDir, "init")
+	runGit(t, tmpDir, "config", "user.email", "test@example.com")
+	runGit(t, tmpDir, "config", "user.name", "Test User")
 
 	// Create initial commit
 	testFile := filepath.Join(tmpDir, "test.txt")
 	if err := os.WriteFile(testFile, []byte("test"), 0644); err != nil {
 		t.Fatalf("Failed to write test file: %v", err)
 	}
-
-	if err := exec.Command("git", "add", ".").Run(); err != nil {
-		t.Fatalf("Failed to git add: %v", err)
-	}
-	if err := exec.Command("git", "commit", "-m", "initial").Run(); err != nil {
-		t.Fatalf("Failed to git commit: %v", err)
-	}
-
-	// Return to original directory
-	if err := os.Chdir(originalDir); err != nil {
-		t.Fatalf("Failed to restore directory: %v", err)
-	}
+	runGit(t, tmpDir, "add", ".")
+	runGit(t, tmpDir, "commit", "-m", "initial")
 
 	return tmpDir
 }
 
 func TestManager_generateWorktreeDetails(t *testing.T) {
+	t.Parallel()
+
+	repoDir := setupTestRepo(t)
 	cfg := config.Config{
+		RepoDir:          repoDir,
 		WorktreeBasePath: ".claude-mux-test",
 		ClaudeCommand:    "echo",
 		AutoCleanup:      false,
@@ -75,17 +56,6 @@ func TestManager_generateWorktreeDetails(t *testing.T) {
 
 	manager := NewManager(cfg)
 
-	// Setup test repo
-	repoDir := setupTestRepo(t)
-	originalDir, err := os.Getwd()
-	if err != nil {
-		t.Fatalf("Failed to get current directory: %v", err)
-	}
-	defer restoreDirectory(t, originalDir)()
-	if err := os.Chdir(repoDir); err != nil {
-		t.Fatalf("Failed to change to repo directory: %v", err)
-	}
-
 	tests := []struct {
 		name     string
 		input    string
@@ -112,16 +82,68 @@ func TestManager_generateWorktreeDetails(t *testing.T) {
 				t.Errorf("Expected branch to start with 'claude-mux-', got %q", details.Branch)
 			}
 
-			// Check path includes base path
-			if !strings.Contains(details.Path, cfg.WorktreeBasePath) {
-				t.Errorf("Expected path to contain base path %q, got %q", cfg.WorktreeBasePath, details.Path)
+			// Check path is anchored at the repository directory
+			wantPrefix := filepath.Join(repoDir, cfg.WorktreeBasePath)
+			if !strings.HasPrefix(details.Path, wantPrefix) {
+				t.Errorf("Expected path to start with %q, got %q", wantPrefix, details.Path)
+			}
+		})
+	}
+}
+
+func TestManager_generateWorktreeDetails_AnchorsAtMainWorktree(t *testing.T) {
+	t.Parallel()
+
+	repoDir := setupTestRepo(t)
+	subDir := filepath.Join(repoDir, "src", "api")
+	if err := os.MkdirAll(subDir, 0750); err != nil {
+		t.Fatalf("Failed to create subdirectory: %v", err)
+	}
+
+	// Create a session worktree to run from
+	sessionPath := filepath.Join(repoDir, ".claude-mux-test", "existing-abc123")
+	runGit(t, repoDir, "worktree", "add", "-b", "claude-mux-main-existing-abc123", sessionPath)
+
+	tests := []struct {
+		name string
+		dir  string
+	}{
+		{"from repository root", repoDir},
+		{"from subdirectory", subDir},
+		{"from inside a session worktree", sessionPath},
+	}
+
+	wantBase, _ := filepath.EvalSymlinks(filepath.Join(repoDir, ".claude-mux-test"))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := NewManager(config.Config{
+				RepoDir:          tt.dir,
+				WorktreeBasePath: ".claude-mux-test",
+				ClaudeCommand:    "echo",
+			})
+
+			details, err := manager.generateWorktreeDetails("task")
+			if err != nil {
+				t.Fatalf("generateWorktreeDetails() error = %v", err)
+			}
+
+			gotBase, _ := filepath.EvalSymlinks(filepath.Dir(details.Path))
+			if gotBase != wantBase {
+				t.Errorf("Expected worktree under %q, got %q", wantBase, details.Path)
+			}
+			if strings.Contains(details.Branch, "existing") {
+				t.Errorf("Expected branch to be based on the parent repository, got %q", details.Branch)
 			}
 		})
 	}
 }
 
 func TestManager_List(t *testing.T) {
+	t.Parallel()
+
+	repoDir := setupTestRepo(t)
 	cfg := config.Config{
+		RepoDir:          repoDir,
 		WorktreeBasePath: ".claude-mux-test",
 		ClaudeCommand:    "echo",
 		AutoCleanup:      false,
@@ -130,33 +152,82 @@ func TestManager_List(t *testing.T) {
 
 	manager := NewManager(cfg)
 
-	// Setup test repo
+	// Test listing with no worktrees (should not error)
+	if _, err := manager.List(context.Background()); err != nil {
+		t.Errorf("List() with no worktrees should not error: %v", err)
+	}
+
+	// Create a worktree manually
+	worktreePath := filepath.Join(repoDir, ".claude-mux-test", "test-worktree")
+	runGit(t, repoDir, "worktree", "add", "-b", "claude-mux-test", worktreePath)
+
+	// Test listing with a worktree
+	if _, err := manager.List(context.Background()); err != nil {
+		t.Errorf("List() with worktrees should not error: %v", err)
+	}
+}
+
+func TestManager_launchClaude(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script agent is not supported on windows")
+	}
+	t.Parallel()
+
 	repoDir := setupTestRepo(t)
-	originalDir, err := os.Getwd()
+	outFile := filepath.Join(t.TempDir(), "agent.out")
+	script := filepath.Join(t.TempDir(), "agent.sh")
+	content := "#!/bin/sh\npwd > " + outFile + "\necho \"$CLAUDE_MUX_SESSION\" >> " + outFile + "\n"
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatalf("Failed to write agent script: %v", err)
+	}
+
+	manager := NewManager(config.Config{
+		RepoDir:          repoDir,
+		WorktreeBasePath: ".claude-mux-test",
+		ClaudeCommand:    script,
+	})
+
+	details, err := manager.generateWorktreeDetails("launch")
 	if err != nil {
-		t.Fatalf("Failed to get current directory: %v", err)
+		t.Fatalf("generateWorktreeDetails() error = %v", err)
 	}
-	defer restoreDirectory(t, originalDir)()
-	if err := os.Chdir(repoDir); err != nil {
-		t.Fatalf("Failed to change to repo directory: %v", err)
+	if err := manager.createWorktree(details); err != nil {
+		t.Fatalf("createWorktree() error = %v", err)
 	}
 
-	// Test listing with no worktrees (should not error)
-	err = manager.List()
+	cwdBefore, err := os.Getwd()
 	if err != nil {
-		t.Errorf("List() with no worktrees should not error: %v", err)
+		t.Fatalf("Failed to get current directory: %v", err)
 	}
 
-	// Create a worktree manually
-	worktreePath := filepath.Join(repoDir, ".claude-mux-test", "test-worktree")
-	if err := exec.Command("git", "worktree", "add", "-b", "claude-mux-test", worktreePath).Run(); err != nil {
-		t.Fatalf("Failed to create worktree: %v", err)
+	if err := manager.launchClaude(context.Background(), details); err != nil {
+		t.Fatalf("launchClaude() error = %v", err)
 	}
 
-	// Test listing with a worktree
-	err = manager.List()
+	cwdAfter, err := os.Getwd()
 	if err != nil {
-		t.Errorf("List() with worktrees should not error: %v", err)
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+	if cwdBefore != cwdAfter {
+		t.Errorf("launchClaude() changed the process directory from %q to %q", cwdBefore, cwdAfter)
+	}
+
+	output, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("Failed to read agent output: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines of agent output, got %q", output)
+	}
+
+	gotDir, _ := filepath.EvalSymlinks(lines[0])
+	wantDir, _ := filepath.EvalSymlinks(details.Path)
+	if gotDir != wantDir {
+		t.Errorf("Agent ran in %q, want %q", gotDir, wantDir)
+	}
+	if lines[1] != details.Name {
+		t.Errorf("Expected CLAUDE_MUX_SESSION=%q, got %q", details.Name, lines[1])
 	}
 }
 
@@ -179,3 +250,170 @@ func TestWorktreeDetails(t *testing.T) {
 		t.Errorf("Expected Path to be '/tmp/claude-mux/test-task', got %q", details.Path)
 	}
 }
+
+func TestSessionGroup(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"refactor-auth-1a2b3c", "refactor-auth"},
+		{"20240102-150405-1a2b3c", "20240102-150405"},
+		{"refactor-auth", "refactor-auth"},
+		{"task-1a2b3x", "task-1a2b3x"},
+		{"-1a2b3c", "-1a2b3c"},
+	}
+
+	for _, tt := range tests {
+		if got := SessionGroup(tt.name); got != tt.want {
+			t.Errorf("SessionGroup(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestManager_LaunchCreated(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	manager, backend := newFakeManager(t)
+	details, err := manager.Create(ctx, CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	var stdout bytes.Buffer
+	manager.stdout, manager.stderr = &stdout, &stdout
+	simulateAgentWork(manager, backend)
+	if _, err := manager.LaunchCreated(ctx, details.Name, CreateOptions{Prompt: "Add a README", Autocommit: AutocommitSquash}); err != nil {
+		t.Fatalf("LaunchCreated() error = %v", err)
+	}
+	if got := strings.TrimSpace(stdout.String()); got != "Add a README" {
+		t.Errorf("Expected the prompt to be passed to the agent, got output %q", got)
+	}
+	if commits := backend.Commits(details.Branch); len(commits) != 1 || !strings.HasPrefix(commits[0], "Add a README") {
+		t.Errorf("Expected the work to be squashed, got commits %q", commits)
+	}
+	meta, err := manager.readSessionMeta(details)
+	if err != nil || meta.Prompt != "Add a README" || meta.Autocommit != AutocommitSquash {
+		t.Errorf("Expected the options to be recorded for resuming, got %+v, %v", meta, err)
+	}
+}
+
+func TestManager_Prune(t *testing.T) {
+	t.Parallel()
+
+	repoDir := setupTestRepo(t)
+	manager := NewManager(config.Config{
+		RepoDir:          repoDir,
+		WorktreeBasePath: ".claude-mux-test",
+		ClaudeCommand:    "echo",
+	})
+
+	// A regular session worktree
+	activePath := filepath.Join(repoDir, ".claude-mux-test", "active-abc123")
+	runGit(t, repoDir, "worktree", "add", "-b", "claude-mux-main-active-abc123", activePath)
+
+	// A session worktree whose directory was deleted by hand
+	gonePath := filepath.Join(repoDir, ".claude-mux-test", "gone-abc123")
+	runGit(t, repoDir, "worktree", "add", "-b", "claude-mux-main-gone-abc123", gonePath)
+	if err := os.RemoveAll(gonePath); err != nil {
+		t.Fatalf("Failed to remove worktree directory: %v", err)
+	}
+
+	// Orphaned branches: one merged, one with unmerged work
+	runGit(t, repoDir, "branch", "claude-mux-main-merged-abc123")
+	runGit(t, repoDir, "checkout", "-q", "-b", "claude-mux-main-unmerged-abc123")
+	if err := os.WriteFile(filepath.Join(repoDir, "work.txt"), []byte("work"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	runGit(t, repoDir, "add", "work.txt")
+	runGit(t, repoDir, "commit", "-q", "-m", "work")
+	runGit(t, repoDir, "checkout", "-q", "-")
+
+	branches := func() []string {
+		t.Helper()
+		out, err := exec.Command("git", "-C", repoDir, "for-each-ref", "--format=%(refname:short)", "refs/heads/claude-mux-*").Output()
+		if err != nil {
+			t.Fatalf("Failed to list branches: %v", err)
+		}
+		return strings.Fields(string(out))
+	}
+
+	// A dry run must not change anything
+	if _, err := manager.Prune(context.Background(), true, false); err != nil {
+		t.Fatalf("Prune(dryRun) error = %v", err)
+	}
+	if got := branches(); len(got) != 4 {
+		t.Fatalf("Expected dry run to keep all 4 branches, got %v", got)
+	}
+	if _, err := os.Stat(activePath); err != nil {
+		t.Fatalf("Expected dry run to keep worktree: %v", err)
+	}
+
+	// Without force only unmerged work survives
+	if _, err := manager.Prune(context.Background(), false, false); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if got := branches(); len(got) != 1 || got[0] != "claude-mux-main-unmerged-abc123" {
+		t.Errorf("Expected only the unmerged branch to remain, got %v", got)
+	}
+	if _, err := os.Stat(activePath); !os.IsNotExist(err) {
+		t.Errorf("Expected worktree to be removed, stat error = %v", err)
+	}
+
+	// Force removes unmerged orphans too
+	if _, err := manager.Prune(context.Background(), false, true); err != nil {
+		t.Fatalf("Prune(force) error = %v", err)
+	}
+	if got := branches(); len(got) != 0 {
+		t.Errorf("Expected no branches after forced prune, got %v", got)
+	}
+}
+
+func TestManager_Remove(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		force      bool
+		wantBranch bool
+	}{
+		{"keeps unmerged branch", false, true},
+		{"force deletes unmerged branch", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			repoDir := setupTestRepo(t)
+			manager := NewManager(config.Config{
+				RepoDir:          repoDir,
+				WorktreeBasePath: ".claude-mux-test",
+				ClaudeCommand:    "echo",
+			})
+
+			branch := "claude-mux-main-task-abc123"
+			worktreePath := filepath.Join(repoDir, ".claude-mux-test", "task-abc123")
+			runGit(t, repoDir, "worktree", "add", "-b", branch, worktreePath)
+			if err := os.WriteFile(filepath.Join(worktreePath, "work.txt"), []byte("work"), 0644); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+			runGit(t, worktreePath, "add", "work.txt")
+			runGit(t, worktreePath, "commit", "-q", "-m", "work")
+
+			if _, err := manager.Remove(context.Background(), "task-abc123", tt.force); err != nil {
+				t.Fatalf("Remove() error = %v", err)
+			}
+
+			if _, err := os.Stat(worktreePath); !os.IsNotExist(err) {
+				t.Errorf("Expected worktree to be removed, stat error = %v", err)
+			}
+			err := exec.Command("git", "-C", repoDir, "rev-parse", "--verify", "-q", "refs/heads/"+branch).Run()
+			if gotBranch := err == nil; gotBranch != tt.wantBranch {
+				t.Errorf("Branch exists = %v, want %v", gotBranch, tt.wantBranch)
+			}
+		})
+	}
+}
@@ -0,0 +1,563 @@
+// Package claudemux is the public Go API of claude-mux.
+//
+// It manages sessions: isolated git worktrees, each on its own branch, in
+// which an AI coding agent such as Claude Code runs. A Client creates,
+// lists, launches, merges and removes sessions of a single repository:
+//
+//	client := claudemux.New(claudemux.Options{RepoDir: "/path/to/repo"})
+//	session, err := client.Create(ctx, claudemux.CreateOptions{Name: "refactor-auth"})
+//	if err != nil {
+//		return err
+//	}
+//	err = client.Launch(ctx, session.Name)
+//
+// Progress is reported through the Options.OnEvent callback instead of
+// being printed, so the package is safe to embed in other tools.
+package claudemux
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/git"
+	"github.com/enriikke/claude-mux/internal/worktree"
+)
+
+var (
+	// ErrNotRepository is returned when the client does not point into a git repository
+	ErrNotRepository = worktree.ErrNotRepository
+
+	// ErrNotFound is returned when no session matches the given name
+	ErrNotFound = worktree.ErrNotFound
+
+	// ErrAmbiguous is returned when a partial name matches several sessions
+	ErrAmbiguous = worktree.ErrAmbiguous
+
+	// ErrNoLog is returned by LogPath when a session has no output log
+	ErrNoLog = worktree.ErrNoLog
+
+	// ErrNoCheckpoint is returned by Rollback when a session has no checkpoint with the given number
+	ErrNoCheckpoint = worktree.ErrNoCheckpoint
+
+	// ErrNoEditor is returned by Open when no editor is given and none is configured
+	ErrNoEditor = worktree.ErrNoEditor
+
+	// ErrAgentNotRunning is returned by Stop, Pause and Unpause when the
+	// session's agent does not run
+	ErrAgentNotRunning = worktree.ErrAgentNotRunning
+
+	// ErrAgentRunning is returned by Resume while the session's agent
+	// still runs
+	ErrAgentRunning = worktree.ErrAgentRunning
+
+	// ErrLocked is returned when a session's worktree is locked and must
+	// not be removed
+	ErrLocked = worktree.ErrLocked
+
+	// ErrPauseUnsupported is returned by Pause and Unpause on platforms
+	// without job control, such as Windows
+	ErrPauseUnsupported = worktree.ErrPauseUnsupported
+
+	// ErrQuotaExceeded is returned by Create when the sessions use up
+	// Options.DiskQuota and no idle session could be archived to make room
+	ErrQuotaExceeded = worktree.ErrQuotaExceeded
+)
+
+// GitError describes a git command that failed. Use errors.As to inspect
+// the subcommand, exit code and git's error output.
+type GitError = git.Error
+
+// Options configures a Client. The zero value operates on the repository
+// containing the current directory with the default settings of the CLI.
+type Options struct {
+	// RepoDir is any directory inside the repository. Empty means the current directory.
+	RepoDir string
+
+	// BasePath is where session worktrees are created. Relative paths are
+	// resolved against the main worktree root. Defaults to ".claude-mux".
+	BasePath string
+
+	// AgentCommand is the agent executable launched in sessions. Defaults to "claude".
+	AgentCommand string
+
+	// AgentResumeFlag is passed to the agent by Resume to continue its
+	// previous conversation. Defaults to "--continue" when AgentCommand is
+	// empty; other agents are resumed without arguments unless it is set.
+	AgentResumeFlag string
+
+	// Verbose echoes git commands to standard error
+	Verbose bool
+
+	// StopTimeout is how long the agent may take to exit after being asked
+	// to stop, e.g. because the context was canceled, before it is killed.
+	// Defaults to 10 seconds.
+	StopTimeout time.Duration
+
+	// ForwardSignals catches signals sent to the current process while an
+	// agent runs and passes them on to the agent, so cleanup still runs
+	// when the process is interrupted. Only enable it in programs that own
+	// the process and its terminal, such as command line tools.
+	ForwardSignals bool
+
+	// DisableLogs stops recording the terminal output of agents. By default
+	// every run of an agent is recorded in an asciicast v2 log kept with
+	// the session, see LogPath.
+	DisableLogs bool
+
+	// CheckpointInterval is how often the worktree of a running agent is
+	// checked for changes, which are kept as a checkpoint. Zero disables
+	// periodic checkpoints.
+	CheckpointInterval time.Duration
+
+	// MaxCheckpoints is how many checkpoints a session keeps, the oldest
+	// are deleted beyond it. Defaults to 100.
+	MaxCheckpoints int
+
+	// Limits caps the CPU, memory and processes of every agent, each in a
+	// cgroup of its own. It needs Linux with cgroup v2, delegated to the
+	// user or through systemd; elsewhere agents run unlimited with a
+	// warning. The zero value sets no limits.
+	Limits Limits
+
+	// Sandbox confines agents with the Landlock LSM of Linux: they may only
+	// change their worktree, the repository's git directory, temporary
+	// directories and SandboxWritable. Agents fail to launch where the
+	// sandbox is not available.
+	Sandbox bool
+
+	// SandboxWritable lists further files and directories sandboxed agents
+	// may change. The conversations and state Claude Code keeps in the home
+	// directory are always writable; its settings and hooks are not.
+	SandboxWritable []string
+
+	// Isolation is where agents run: IsolationHost, the default, or
+	// IsolationContainer, which runs them with the runtime and image of
+	// Container. The worktree and the repository's git directory are
+	// mounted at the same paths, and the runtime enforces Limits and the
+	// none network mode; the sandbox and the allowlist network mode are
+	// not available in containers.
+	Isolation Isolation
+
+	// Container configures the containers agents run in with
+	// IsolationContainer
+	Container ContainerOptions
+
+	// DiskQuota caps the disk space taken under BasePath, in bytes. Once
+	// it is used up, Create refuses new sessions or archives idle ones,
+	// depending on QuotaAction. Zero is unlimited.
+	DiskQuota int64
+
+	// QuotaAction is what Create does once DiskQuota is used up. Defaults
+	// to QuotaRefuse.
+	QuotaAction QuotaAction
+
+	// OnEvent receives progress events. It is called synchronously from the
+	// goroutine running the operation.
+	OnEvent func(Event)
+
+	// Stdin, Stdout and Stderr are connected to the agent. They default to
+	// the standard streams of the current process.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Client manages the sessions of one repository. A Client is safe for
+// concurrent use.
+type Client struct {
+	manager *worktree.Manager
+}
+
+// New creates a client for the repository described by opts
+func New(opts Options) *Client {
+	cfg := config.DefaultConfig()
+	cfg.RepoDir = opts.RepoDir
+	cfg.Verbose = opts.Verbose
+	if opts.BasePath != "" {
+		cfg.WorktreeBasePath = opts.BasePath
+	}
+	if opts.AgentCommand != "" {
+		cfg.ClaudeCommand = opts.AgentCommand
+		cfg.ClaudeResumeFlag = ""
+	}
+	if opts.AgentResumeFlag != "" {
+		cfg.ClaudeResumeFlag = opts.AgentResumeFlag
+	}
+	if opts.StopTimeout > 0 {
+		cfg.StopTimeout = opts.StopTimeout
+	}
+	cfg.SessionLogs = !opts.DisableLogs
+	cfg.CheckpointInterval = opts.CheckpointInterval
+	cfg.MaxCheckpoints = opts.MaxCheckpoints
+	cfg.Limits = opts.Limits
+	cfg.Sandbox = opts.Sandbox
+	cfg.SandboxWritable = opts.SandboxWritable
+	cfg.Isolation = opts.Isolation
+	cfg.Container = opts.Container
+	cfg.DiskQuota = opts.DiskQuota
+	cfg.QuotaAction = opts.QuotaAction
+
+	var managerOpts []worktree.Option
+	if opts.OnEvent != nil {
+		onEvent := opts.OnEvent
+		managerOpts = append(managerOpts, worktree.WithEventHandler(func(e worktree.Event) {
+			onEvent(newEvent(e))
+		}))
+	}
+	if opts.ForwardSignals {
+		managerOpts = append(managerOpts, worktree.WithSignalForwarding())
+	}
+	if opts.Stdin != nil || opts.Stdout != nil || opts.Stderr != nil {
+		managerOpts = append(managerOpts, worktree.WithStdio(opts.Stdin, opts.Stdout, opts.Stderr))
+	}
+
+	return &Client{manager: worktree.NewManager(cfg, managerOpts...)}
+}
+
+// Root returns the root of the main worktree of the repository
+func (c *Client) Root(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return c.manager.Root()
+}
+
+// CreateOptions configures a new session
+type CreateOptions struct {
+	// Name is a human readable prefix for the session. A unique suffix is
+	// always appended; an empty name uses a timestamp.
+	Name string
+
+	// Network confines the network access of the agent of the session,
+	// including when it is resumed. Isolating the network needs user
+	// namespaces of Linux.
+	Network NetworkPolicy
+}
+
+// Create creates a session worktree without launching the agent
+func (c *Client) Create(ctx context.Context, opts CreateOptions) (*Session, error) {
+	details, err := c.manager.Create(ctx, worktree.CreateOptions{Name: opts.Name, Network: opts.Network})
+	if err != nil {
+		return nil, err
+	}
+	return newDetailsSession(details), nil
+}
+
+// Launch runs the agent in an existing session and blocks until it exits.
+// Canceling ctx stops the agent.
+func (c *Client) Launch(ctx context.Context, name string) error {
+	return c.manager.Launch(ctx, name)
+}
+
+// LaunchOptions configures LaunchCreated
+type LaunchOptions struct {
+	// Prompt is the task passed to the agent when it starts
+	Prompt string
+
+	// Autocommit commits the agent's work once it exits, see RunOptions
+	Autocommit AutocommitPolicy
+
+	// Cleanup removes the session once the agent exits
+	Cleanup bool
+}
+
+// LaunchCreated runs the agent for the first time in a session made by
+// Create and blocks until it exits. It behaves like CreateAndLaunch, so a
+// session can be created in one place and its agent run in another, such
+// as a tmux window. The prompt and autocommit policy are kept for Resume.
+func (c *Client) LaunchCreated(ctx context.Context, name string, opts LaunchOptions) (*Session, error) {
+	details, err := c.manager.LaunchCreated(ctx, name, worktree.CreateOptions{
+		Prompt:     opts.Prompt,
+		Autocommit: opts.Autocommit,
+		Cleanup:    opts.Cleanup,
+	})
+	if details.Name == "" {
+		return nil, err
+	}
+	return newDetailsSession(details), err
+}
+
+// AutocommitPolicy decides how the work an agent leaves behind is
+// committed once it exits
+type AutocommitPolicy = worktree.AutocommitPolicy
+
+// Autocommit policies
+const (
+	// AutocommitOff leaves the worktree as the agent left it
+	AutocommitOff = worktree.AutocommitOff
+	// AutocommitWIP commits uncommitted changes on top of the agent's own commits
+	AutocommitWIP = worktree.AutocommitWIP
+	// AutocommitSquash replaces the commits made while the agent ran and
+	// any uncommitted changes with a single commit
+	AutocommitSquash = worktree.AutocommitSquash
+)
+
+// ParseAutocommitPolicy parses "off", "wip" or "squash". An empty name means off.
+func ParseAutocommitPolicy(s string) (AutocommitPolicy, error) {
+	return worktree.ParseAutocommitPolicy(s)
+}
+
+// RunOptions configures CreateAndLaunch
+type RunOptions struct {
+	CreateOptions
+
+	// Prompt is the task passed to the agent when it starts
+	Prompt string
+
+	// Autocommit commits the agent's work once it exits, so the session
+	// branch holds everything it did. The commit message records the
+	// session, the prompt and how long the agent ran. Cleanup then keeps
+	// the branch until it is merged, and keeps the whole session when
+	// committing fails.
+	Autocommit AutocommitPolicy
+
+	// Cleanup removes the session once the agent exits
+	Cleanup bool
+}
+
+// CreateAndLaunch creates a session, runs the agent in it until it exits
+// and optionally removes the session afterwards. Canceling ctx stops the
+// agent; cleanup still runs. The returned session is valid even when
+// launching failed.
+func (c *Client) CreateAndLaunch(ctx context.Context, opts RunOptions) (*Session, error) {
+	details, err := c.manager.CreateAndLaunch(ctx, worktree.CreateOptions{
+		Name:       opts.Name,
+		Prompt:     opts.Prompt,
+		Autocommit: opts.Autocommit,
+		Cleanup:    opts.Cleanup,
+		Network:    opts.Network,
+	})
+	if details.Name == "" {
+		return nil, err
+	}
+	return newDetailsSession(details), err
+}
+
+// ResumeOptions configures Resume
+type ResumeOptions struct {
+	// Cleanup removes the session once the agent exits
+	Cleanup bool
+}
+
+// Resume relaunches the agent in the worktree of an existing session and
+// blocks until it exits. The agent continues its previous conversation if
+// it supports a resume flag, see Options.AgentResumeFlag. The session's
+// autocommit policy applies again when the agent exits. Canceling ctx stops
+// the agent; cleanup still runs.
+func (c *Client) Resume(ctx context.Context, name string, opts ResumeOptions) (*Session, error) {
+	details, err := c.manager.Resume(ctx, name, worktree.ResumeOptions{Cleanup: opts.Cleanup})
+	if details.Name == "" {
+		return nil, err
+	}
+	return newDetailsSession(details), err
+}
+
+// Stop asks the agent of a session to exit and waits until it did, keeping
+// the worktree. Agents started by any claude-mux process can be stopped.
+// The agent is interrupted like Ctrl-C first, terminated after half of
+// Options.StopTimeout and killed once it passed.
+func (c *Client) Stop(ctx context.Context, name string) (*Session, error) {
+	details, err := c.manager.Stop(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(ctx, details.Name)
+}
+
+// Pause suspends the agent of a session and all of its children until it
+// is unpaused, so it uses no CPU
+func (c *Client) Pause(ctx context.Context, name string) (*Session, error) {
+	details, err := c.manager.Pause(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(ctx, details.Name)
+}
+
+// Unpause resumes the paused agent of a session
+func (c *Client) Unpause(ctx context.Context, name string) (*Session, error) {
+	details, err := c.manager.Unpause(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(ctx, details.Name)
+}
+
+// List returns all sessions of the repository
+func (c *Client) List(ctx context.Context) ([]Session, error) {
+	sessions, err := c.manager.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Session, 0, len(sessions))
+	for _, s := range sessions {
+		result = append(result, newSession(s))
+	}
+	return result, nil
+}
+
+// Get returns the session matching name. Exact name or branch matches win
+// over partial matches.
+func (c *Client) Get(ctx context.Context, name string) (*Session, error) {
+	sessions, err := c.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	details, err := c.manager.Find(name)
+	if err != nil {
+		return nil, err
+	}
+	for i := range sessions {
+		if sessions[i].Path == details.Path {
+			return &sessions[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// Path returns the worktree path of the session matching name. Unlike Get
+// it does not inspect the worktree, so it is cheap enough for shell prompts.
+func (c *Client) Path(ctx context.Context, name string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	details, err := c.manager.Find(name)
+	if err != nil {
+		return "", err
+	}
+	return details.Path, nil
+}
+
+// Shell runs the user's shell in a session worktree and blocks until it
+// exits. The shell is connected to Stdin, Stdout and Stderr, and finds the
+// session in CLAUDE_MUX_SESSION, CLAUDE_MUX_BRANCH and CLAUDE_MUX_WORKTREE.
+func (c *Client) Shell(ctx context.Context, name string) error {
+	return c.manager.Shell(ctx, name)
+}
+
+// Open opens a session worktree in an editor such as "code", "vim" or
+// "idea" and blocks until the editor command exits. An empty editor uses
+// $VISUAL or $EDITOR.
+func (c *Client) Open(ctx context.Context, name, editor string) error {
+	return c.manager.Open(ctx, name, editor)
+}
+
+// RemoveOptions configures Remove
+type RemoveOptions struct {
+	// Force deletes the session branch even if it has unmerged changes
+	Force bool
+}
+
+// Remove deletes a session worktree and its branch
+func (c *Client) Remove(ctx context.Context, name string, opts RemoveOptions) (*RemoveResult, error) {
+	removal, err := c.manager.Remove(ctx, name, opts.Force)
+	if removal.Name == "" {
+		return nil, err
+	}
+	result := newRemoveResult(removal)
+	return &result, err
+}
+
+// Diff returns the changes committed in a session since it branched off
+func (c *Client) Diff(ctx context.Context, name string) (string, error) {
+	return c.manager.Diff(ctx, name)
+}
+
+// Merge merges a session branch into the branch checked out in the main worktree
+func (c *Client) Merge(ctx context.Context, name string) error {
+	return c.manager.Merge(ctx, name)
+}
+
+// LogPath returns the asciicast v2 log of the most recent agent run in a
+// session. Logs are removed with the session; those of archived sessions
+// are found by their full name.
+func (c *Client) LogPath(ctx context.Context, name string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return c.manager.LogPath(name)
+}
+
+// Checkpoints returns the checkpoints of a session, oldest first
+func (c *Client) Checkpoints(ctx context.Context, name string) ([]Checkpoint, error) {
+	checkpoints, err := c.manager.Checkpoints(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Checkpoint, 0, len(checkpoints))
+	for _, cp := range checkpoints {
+		result = append(result, newCheckpoint(cp))
+	}
+	return result, nil
+}
+
+// CreateCheckpoint snapshots the files of a session worktree without
+// touching its branch or index. It reports false and returns the latest
+// checkpoint when nothing changed since.
+func (c *Client) CreateCheckpoint(ctx context.Context, name string) (*Checkpoint, bool, error) {
+	cp, created, err := c.manager.CreateCheckpoint(ctx, name)
+	if err != nil {
+		return nil, false, err
+	}
+	result := newCheckpoint(cp)
+	return &result, created, nil
+}
+
+// Rollback restores the files of a session worktree to a checkpoint. The
+// current files are checkpointed first, so a rollback can be undone.
+// Commits made since the checkpoint stay on the branch.
+func (c *Client) Rollback(ctx context.Context, name string, number int) error {
+	return c.manager.Rollback(ctx, name, number)
+}
+
+// PruneOptions configures Prune
+type PruneOptions struct {
+	// DryRun reports what would be removed without removing anything
+	DryRun bool
+	// Force also deletes branches with unmerged changes
+	Force bool
+}
+
+// Prune removes all sessions, stale worktree metadata and claude-mux
+// branches left behind without a worktree. Sessions whose agent runs or
+// whose worktree is locked are kept.
+func (c *Client) Prune(ctx context.Context, opts PruneOptions) (*PruneReport, error) {
+	report, err := c.manager.Prune(ctx, opts.DryRun, opts.Force)
+	result := newPruneReport(report)
+	return &result, err
+}
+
+// DiskUsage reports the disk space taken by every session, split into the
+// checkout, build artifacts and dependencies, and by BasePath as a whole
+func (c *Client) DiskUsage(ctx context.Context) (*DiskReport, error) {
+	report, err := c.manager.DiskUsage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := newDiskReport(report)
+	return &result, nil
+}
+
+// DoctorOptions configures Doctor
+type DoctorOptions struct {
+	// Fix repairs problems automatically where it is safe to do so
+	Fix bool
+}
+
+// Doctor checks the claude-mux setup and returns one finding per check
+func (c *Client) Doctor(ctx context.Context, opts DoctorOptions) ([]Finding, error) {
+	findings, err := c.manager.Doctor(ctx, opts.Fix)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Finding, 0, len(findings))
+	for _, f := range findings {
+		result = append(result, newFinding(f))
+	}
+	return result, nil
+}
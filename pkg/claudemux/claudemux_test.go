@@ -0,0 +1,447 @@
+package claudemux
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runGit runs a git command in dir and fails the test on error
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Failed to run git %v: %v\n%s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func setupTestRepo(t *testing.T) string {
+	t.Helper()
+	tmpDir := t.TempDir()
+
+	runGit(t, tmpDir, "init")
+	runGit(t, tmpDir, "config", "user.email", "test@example.com")
+	runGit(t, tmpDir, "config", "user.name", "Test User")
+
+	if err := os.WriteFile(filepath.Join(tmpDir, "test.txt"), []byte("test"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	runGit(t, tmpDir, "add", ".")
+	runGit(t, tmpDir, "commit", "-m", "initial")
+
+	return tmpDir
+}
+
+// eventRecorder collects the events delivered to Options.OnEvent
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *eventRecorder) record(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *eventRecorder) types() []EventType {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var types []EventType
+	for _, e := range r.events {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func (r *eventRecorder) has(t EventType) bool {
+	for _, got := range r.types() {
+		if got == t {
+			return true
+		}
+	}
+	return false
+}
+
+func TestClient_SessionLifecycle(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repoDir := setupTestRepo(t)
+	events := &eventRecorder{}
+	client := New(Options{
+		RepoDir:      repoDir,
+		BasePath:     ".claude-mux-test",
+		AgentCommand: "true",
+		OnEvent:      events.record,
+	})
+
+	session, err := client.Create(ctx, CreateOptions{Name: "feature"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if !strings.HasPrefix(session.Name, "feature-") {
+		t.Errorf("Expected session name to start with feature-, got %q", session.Name)
+	}
+	if session.Group != "feature" {
+		t.Errorf("Expected session group feature, got %q", session.Group)
+	}
+	if !events.has(EventCreated) {
+		t.Errorf("Expected a %q event, got %v", EventCreated, events.types())
+	}
+
+	sessions, err := client.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].Name != session.Name || sessions[0].Group != "feature" {
+		t.Fatalf("List() = %+v, want only %q", sessions, session.Name)
+	}
+	if path, err := client.Path(ctx, session.Name); err != nil || path != session.Path {
+		t.Errorf("Path() = %q, %v, want %q", path, err, session.Path)
+	}
+
+	// Commit a change in the session so there is something to diff and merge
+	if err := os.WriteFile(filepath.Join(session.Path, "feature.txt"), []byte("feature"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	got, err := client.Get(ctx, session.Name)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got.Changes != 1 {
+		t.Errorf("Expected 1 uncommitted change, got %d", got.Changes)
+	}
+	runGit(t, session.Path, "add", ".")
+	runGit(t, session.Path, "commit", "-m", "add feature")
+
+	diff, err := client.Diff(ctx, session.Name)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if !strings.Contains(diff, "feature.txt") {
+		t.Errorf("Expected diff to mention feature.txt, got:\n%s", diff)
+	}
+
+	if err := client.Launch(ctx, session.Name); err != nil {
+		t.Fatalf("Launch() error = %v", err)
+	}
+	if !events.has(EventExited) {
+		t.Errorf("Expected a %q event, got %v", EventExited, events.types())
+	}
+	if path, err := client.LogPath(ctx, session.Name); err != nil || filepath.Ext(path) != ".cast" {
+		t.Errorf("LogPath() = %q, %v, want the log of the launch", path, err)
+	}
+
+	if err := client.Merge(ctx, session.Name); err != nil {
+		t.Fatalf("Merge() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, "feature.txt")); err != nil {
+		t.Errorf("Expected feature.txt in the main worktree after merging: %v", err)
+	}
+
+	result, err := client.Remove(ctx, session.Name, RemoveOptions{})
+	if err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if !result.BranchDeleted {
+		t.Errorf("Expected merged branch to be deleted, got %+v", result)
+	}
+
+	sessions, err = client.List(ctx)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("Expected no sessions after removing, got %+v", sessions)
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	notRepo := New(Options{RepoDir: t.TempDir()})
+	if _, err := notRepo.List(ctx); !errors.Is(err, ErrNotRepository) {
+		t.Errorf("List() outside a repository error = %v, want ErrNotRepository", err)
+	}
+
+	client := New(Options{RepoDir: setupTestRepo(t), BasePath: ".claude-mux-test"})
+	if _, err := client.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get() error = %v, want ErrNotFound", err)
+	}
+	if _, err := client.Remove(ctx, "missing", RemoveOptions{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Remove() error = %v, want ErrNotFound", err)
+	}
+	if _, err := client.Path(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Path() error = %v, want ErrNotFound", err)
+	}
+
+	session, err := client.Create(ctx, CreateOptions{Name: "idle"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := client.Stop(ctx, session.Name); !errors.Is(err, ErrAgentNotRunning) {
+		t.Errorf("Stop() of an idle session error = %v, want ErrAgentNotRunning", err)
+	}
+	if _, err := client.Pause(ctx, session.Name); !errors.Is(err, ErrAgentNotRunning) {
+		t.Errorf("Pause() of an idle session error = %v, want ErrAgentNotRunning", err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := client.Create(canceled, CreateOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Create() with canceled context error = %v, want context.Canceled", err)
+	}
+}
+
+func TestClient_Prune(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := New(Options{RepoDir: setupTestRepo(t), BasePath: ".claude-mux-test"})
+
+	for _, name := range []string{"one", "two"} {
+		if _, err := client.Create(ctx, CreateOptions{Name: name}); err != nil {
+			t.Fatalf("Create(%q) error = %v", name, err)
+		}
+	}
+
+	report, err := client.Prune(ctx, PruneOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Prune(dry run) error = %v", err)
+	}
+	if len(report.Removed) != 2 {
+		t.Errorf("Expected dry run to list 2 sessions, got %+v", report.Removed)
+	}
+	if sessions, _ := client.List(ctx); len(sessions) != 2 {
+		t.Fatalf("Expected dry run to keep sessions, got %+v", sessions)
+	}
+
+	if _, err := client.Prune(ctx, PruneOptions{}); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if sessions, _ := client.List(ctx); len(sessions) != 0 {
+		t.Errorf("Expected no sessions after pruning, got %+v", sessions)
+	}
+}
+
+func TestClient_DiskQuota(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	repo := setupTestRepo(t)
+	client := New(Options{RepoDir: repo, BasePath: ".claude-mux-test", DiskQuota: 1})
+
+	first, err := client.Create(ctx, CreateOptions{Name: "first"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	report, err := client.DiskUsage(ctx)
+	if err != nil {
+		t.Fatalf("DiskUsage() error = %v", err)
+	}
+	if len(report.Sessions) != 1 || report.Sessions[0].Session.Name != first.Name || report.Sessions[0].Usage.Checkout == 0 {
+		t.Fatalf("Expected the checkout of %s to take space, got %+v", first.Name, report.Sessions)
+	}
+	if report.Total < report.Sessions[0].Usage.Total() || report.Quota != 1 {
+		t.Errorf("Expected the total to cover the session under the quota, got %+v", report)
+	}
+
+	if _, err := client.Create(ctx, CreateOptions{Name: "second"}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("Create() beyond the quota error = %v, want ErrQuotaExceeded", err)
+	}
+
+	events := &eventRecorder{}
+	archiving := New(Options{RepoDir: repo, BasePath: ".claude-mux-test", DiskQuota: 1, QuotaAction: QuotaArchive, OnEvent: events.record})
+	if _, err := archiving.Create(ctx, CreateOptions{Name: "second"}); err != nil {
+		t.Fatalf("Create() archiving idle sessions error = %v", err)
+	}
+	if !events.has(EventArchived) {
+		t.Errorf("Expected %s to be archived, got events %v", first.Name, events.types())
+	}
+	if _, err := archiving.Get(ctx, first.Name); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected %s to be archived, Get() error = %v", first.Name, err)
+	}
+}
+
+func TestClient_Rollback(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	client := New(Options{RepoDir: setupTestRepo(t), BasePath: ".claude-mux-test", AgentCommand: "true"})
+	session, err := client.Create(ctx, CreateOptions{Name: "rollback"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	file := filepath.Join(session.Path, "notes.txt")
+
+	if err := os.WriteFile(file, []byte("good"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	checkpoint, created, err := client.CreateCheckpoint(ctx, session.Name)
+	if err != nil || !created {
+		t.Fatalf("CreateCheckpoint() = %+v, %v, %v", checkpoint, created, err)
+	}
+
+	if err := os.WriteFile(file, []byte("off the rails"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := client.Rollback(ctx, session.Name, checkpoint.Number); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if data, _ := os.ReadFile(file); string(data) != "good" {
+		t.Errorf("Expected notes.txt to be restored, got %q", data)
+	}
+
+	checkpoints, err := client.Checkpoints(ctx, session.Name)
+	if err != nil || len(checkpoints) != 2 {
+		t.Errorf("Checkpoints() = %+v, %v, want the restored and the saved state", checkpoints, err)
+	}
+	if err := client.Rollback(ctx, session.Name, 9); !errors.Is(err, ErrNoCheckpoint) {
+		t.Errorf("Rollback() error = %v, want %v", err, ErrNoCheckpoint)
+	}
+}
+
+func TestClient_Resume(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var stdout strings.Builder
+	client := New(Options{
+		RepoDir:         setupTestRepo(t),
+		BasePath:        ".claude-mux-test",
+		AgentCommand:    "echo",
+		AgentResumeFlag: "--continue",
+		Stdout:          &stdout,
+	})
+	session, err := client.Create(ctx, CreateOptions{Name: "resume"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	resumed, err := client.Resume(ctx, session.Name, ResumeOptions{})
+	if err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	if resumed.Path != session.Path {
+		t.Errorf("Expected the agent to run in %s, got %s", session.Path, resumed.Path)
+	}
+	if got := strings.TrimSpace(stdout.String()); got != "--continue" {
+		t.Errorf("Expected the agent to be passed the resume flag, got output %q", got)
+	}
+
+	if _, err := client.Resume(ctx, "missing", ResumeOptions{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Resume() error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestClient_LaunchCreated(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var stdout strings.Builder
+	client := New(Options{
+		RepoDir:      setupTestRepo(t),
+		BasePath:     ".claude-mux-test",
+		AgentCommand: "echo",
+		Stdout:       &stdout,
+	})
+	session, err := client.Create(ctx, CreateOptions{Name: "later"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	if _, err := client.LaunchCreated(ctx, session.Name, LaunchOptions{Prompt: "Add a README", Cleanup: true}); err != nil {
+		t.Fatalf("LaunchCreated() error = %v", err)
+	}
+	if got := strings.TrimSpace(stdout.String()); got != "Add a README" {
+		t.Errorf("Expected the agent to be passed the prompt, got output %q", got)
+	}
+	if _, err := os.Stat(session.Path); !os.IsNotExist(err) {
+		t.Errorf("Expected the session to be cleaned up, stat error = %v", err)
+	}
+}
+
+func TestClient_StopPauseUnpause(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS == "windows" {
+		t.Skip("agents cannot be paused on Windows")
+	}
+
+	ctx := context.Background()
+	agent := filepath.Join(t.TempDir(), "agent.sh")
+	if err := os.WriteFile(agent, []byte("#!/bin/sh\nexec sleep 60\n"), 0755); err != nil {
+		t.Fatalf("Failed to write agent script: %v", err)
+	}
+	client := New(Options{
+		RepoDir:      setupTestRepo(t),
+		BasePath:     ".claude-mux-test",
+		AgentCommand: agent,
+		StopTimeout:  time.Second,
+		Stdin:        strings.NewReader(""),
+	})
+	session, err := client.Create(ctx, CreateOptions{Name: "task"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// The agent runs in the foreground of another goroutine
+	launched := make(chan error, 1)
+	go func() {
+		launched <- client.Launch(ctx, session.Name)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		current, err := client.Get(ctx, session.Name)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if current.State == AgentRunning {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the agent to run, got %+v", current)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	paused, err := client.Pause(ctx, session.Name)
+	if err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	if paused.State != AgentPaused {
+		t.Errorf("Expected the agent to be paused, got %+v", paused)
+	}
+	unpaused, err := client.Unpause(ctx, session.Name)
+	if err != nil {
+		t.Fatalf("Unpause() error = %v", err)
+	}
+	if unpaused.State == AgentPaused {
+		t.Errorf("Expected the agent to run again, got %+v", unpaused)
+	}
+
+	stopped, err := client.Stop(ctx, session.Name)
+	if err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if stopped.State != AgentStopped {
+		t.Errorf("Expected the agent to be stopped, got %+v", stopped)
+	}
+	select {
+	case <-launched:
+	case <-time.After(5 * time.Second):
+		t.Error("Expected Launch() to return once the agent was stopped")
+	}
+}
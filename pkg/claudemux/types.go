@@ -0,0 +1,380 @@
+package claudemux
+
+import (
+	"time"
+
+	"github.com/enriikke/claude-mux/internal/config"
+	"github.com/enriikke/claude-mux/internal/worktree"
+)
+
+// Session is an isolated worktree and branch in which an agent runs
+type Session struct {
+	// Name identifies the session, e.g. "refactor-auth-1a2b3c"
+	Name string
+	// Group is the name the session was created with, e.g. "refactor-auth".
+	// Sessions started for the same task share it.
+	Group string
+	// Branch is the git branch checked out in the worktree
+	Branch string
+	// Path is the absolute path of the worktree
+	Path string
+	// Locked is set when git reports the worktree as locked
+	Locked bool
+	// Changes is the number of files with uncommitted changes
+	Changes int
+	// State tells whether the session's agent runs, waits for input, is
+	// paused or exited
+	State AgentState
+	// PID is the process ID of the running or last agent, 0 when idle
+	PID int
+	// LastOutputAt is when the agent last wrote to its terminal, zero when
+	// its output is not logged
+	LastOutputAt time.Time
+	// Resources is what a running agent uses, set when it runs under
+	// Options.Limits
+	Resources *ResourceUsage
+}
+
+// Limits caps the resources an agent and all of its children may use.
+// Zero values are unlimited.
+type Limits = config.Limits
+
+// ResourceUsage is what an agent running under resource limits uses
+type ResourceUsage = worktree.ResourceUsage
+
+// ParseMemory parses an amount of memory such as "512M" or "4G" into bytes
+func ParseMemory(s string) (int64, error) {
+	return config.ParseMemory(s)
+}
+
+// ParseDiskQuota parses an amount of disk space such as "50G" into bytes
+func ParseDiskQuota(s string) (int64, error) {
+	return config.ParseDiskQuota(s)
+}
+
+// QuotaAction is what creating a session does once the disk quota is used up
+type QuotaAction = config.QuotaAction
+
+// Quota actions
+const (
+	// QuotaRefuse refuses to create the session
+	QuotaRefuse = config.QuotaRefuse
+	// QuotaArchive archives the idle sessions without uncommitted changes
+	// that were used least recently until there is room. Their commits are
+	// kept under refs/claude-mux/archive/<name>. Sessions with files git
+	// ignores besides dependencies and build artifacts, such as .env files,
+	// are not archived, since archiving would delete them.
+	QuotaArchive = config.QuotaArchive
+)
+
+// ParseQuotaAction parses "refuse" or "archive". An empty name means refuse.
+func ParseQuotaAction(s string) (QuotaAction, error) {
+	return config.ParseQuotaAction(s)
+}
+
+// Isolation is where agents run
+type Isolation = config.Isolation
+
+// Isolations
+const (
+	// IsolationHost runs agents as processes on the host
+	IsolationHost = config.IsolationHost
+	// IsolationContainer runs agents in containers with the worktree and
+	// the repository's git directory mounted
+	IsolationContainer = config.IsolationContainer
+)
+
+// ParseIsolation parses "host" or "container". An empty name means host.
+func ParseIsolation(s string) (Isolation, error) {
+	return config.ParseIsolation(s)
+}
+
+// ContainerOptions configures the containers agents run in: the Runtime
+// command, such as podman or docker, the Image providing the agent command
+// and further Args to the run command of the runtime
+type ContainerOptions = config.Container
+
+// NetworkMode decides what network the agent of a session may reach
+type NetworkMode = worktree.NetworkMode
+
+// Network modes
+const (
+	// NetworkHost gives the agent the network of the host
+	NetworkHost = worktree.NetworkHost
+	// NetworkNone gives the agent no network besides a loopback interface
+	// of its own
+	NetworkNone = worktree.NetworkNone
+	// NetworkAllowlist only lets the agent reach the API endpoint and the
+	// allowed hosts, through a filtering proxy run by claude-mux
+	NetworkAllowlist = worktree.NetworkAllowlist
+)
+
+// NetworkPolicy confines the network access of the agent of a session.
+// Allow lists host names, *.domain wildcards or IP addresses, optionally with
+// a port such as example.com:8080. Without one only port 443 is allowed.
+type NetworkPolicy = worktree.NetworkPolicy
+
+// ParseNetworkMode parses "host", "none" or "allowlist". An empty name means host.
+func ParseNetworkMode(s string) (NetworkMode, error) {
+	return worktree.ParseNetworkMode(s)
+}
+
+// AgentState describes what the agent of a session is doing
+type AgentState = worktree.AgentState
+
+// Agent states
+const (
+	// AgentIdle means no agent ran in the session yet
+	AgentIdle = worktree.AgentIdle
+	// AgentRunning means the agent runs and recently produced output
+	AgentRunning = worktree.AgentRunning
+	// AgentWaiting means the agent runs but has been quiet for a while
+	AgentWaiting = worktree.AgentWaiting
+	// AgentPaused means the agent was paused, see Client.Pause
+	AgentPaused = worktree.AgentPaused
+	// AgentExited means the last agent that ran in the session exited
+	AgentExited = worktree.AgentExited
+	// AgentStopped means the last agent that ran in the session was stopped
+	AgentStopped = worktree.AgentStopped
+)
+
+func newSession(s worktree.Session) Session {
+	return Session{
+		Name:    s.Name,
+		Group:   worktree.SessionGroup(s.Name),
+		Branch:  s.Branch,
+		Path:    s.Path,
+		Locked:  s.Locked,
+		Changes: s.Changes,
+
+		State:        s.Agent.State,
+		PID:          s.Agent.PID,
+		LastOutputAt: s.Agent.LastOutputAt,
+		Resources:    s.Agent.Resources,
+	}
+}
+
+// newDetailsSession describes a session whose worktree was not inspected
+func newDetailsSession(details worktree.WorktreeDetails) *Session {
+	return &Session{
+		Name:   details.Name,
+		Group:  worktree.SessionGroup(details.Name),
+		Branch: details.Branch,
+		Path:   details.Path,
+	}
+}
+
+// EventType identifies a step in a session's lifecycle
+type EventType string
+
+// Event types reported through Options.OnEvent
+const (
+	EventExcluded        EventType = EventType(worktree.EventExcluded)
+	EventCreating        EventType = EventType(worktree.EventCreating)
+	EventRetrying        EventType = EventType(worktree.EventRetrying)
+	EventCreated         EventType = EventType(worktree.EventCreated)
+	EventLaunching       EventType = EventType(worktree.EventLaunching)
+	EventStopping        EventType = EventType(worktree.EventStopping)
+	EventExited          EventType = EventType(worktree.EventExited)
+	EventCommitted       EventType = EventType(worktree.EventCommitted)
+	EventCheckpointed    EventType = EventType(worktree.EventCheckpointed)
+	EventRolledBack      EventType = EventType(worktree.EventRolledBack)
+	EventCleaningUp      EventType = EventType(worktree.EventCleaningUp)
+	EventWorktreeRemoved EventType = EventType(worktree.EventWorktreeRemoved)
+	EventBranchDeleted   EventType = EventType(worktree.EventBranchDeleted)
+	EventBranchPreserved EventType = EventType(worktree.EventBranchPreserved)
+	EventMerged          EventType = EventType(worktree.EventMerged)
+	EventArchived        EventType = EventType(worktree.EventArchived)
+	EventCompleted       EventType = EventType(worktree.EventCompleted)
+	EventWarning         EventType = EventType(worktree.EventWarning)
+)
+
+// Event reports progress of a Client operation
+type Event struct {
+	Type EventType
+	// Session, Branch and Path identify the session the event is about, if any
+	Session string
+	Branch  string
+	Path    string
+	// Message carries event specific details, e.g. the merge target for EventMerged
+	Message string
+	// Hint suggests how to resolve a warning
+	Hint string
+	// Err is the error behind a warning or failed step
+	Err error
+}
+
+func newEvent(e worktree.Event) Event {
+	return Event{
+		Type:    EventType(e.Type),
+		Session: e.Session,
+		Branch:  e.Branch,
+		Path:    e.Path,
+		Message: e.Message,
+		Hint:    e.Hint,
+		Err:     e.Err,
+	}
+}
+
+// Checkpoint is a snapshot of the files of a session worktree, including
+// uncommitted and untracked ones
+type Checkpoint struct {
+	// Number identifies the checkpoint within its session, starting at 1
+	Number int
+	// Commit is the commit holding the snapshot, kept under
+	// refs/claude-mux/checkpoints/<session>/<number>
+	Commit    string
+	CreatedAt time.Time
+}
+
+func newCheckpoint(c worktree.Checkpoint) Checkpoint {
+	return Checkpoint{Number: c.Number, Commit: c.Commit, CreatedAt: c.CreatedAt}
+}
+
+// RemoveResult describes the outcome of removing a session
+type RemoveResult struct {
+	Session Session
+	// BranchDeleted is set when the session branch was deleted
+	BranchDeleted bool
+	// BranchPreserved is set when the branch was kept because of unmerged changes
+	BranchPreserved bool
+	// BranchErr is set when deleting the branch failed for another reason
+	BranchErr error
+}
+
+func newRemoveResult(r worktree.Removal) RemoveResult {
+	return RemoveResult{
+		Session:         Session{Name: r.Name, Branch: r.Branch, Path: r.Path},
+		BranchDeleted:   r.BranchDeleted,
+		BranchPreserved: r.BranchPreserved,
+		BranchErr:       r.BranchErr,
+	}
+}
+
+// KeptSession is a session Prune left in place
+type KeptSession struct {
+	Session Session
+	// Err says why, matching ErrAgentRunning or ErrLocked
+	Err error
+}
+
+// PruneReport describes what Prune removed, or would remove in a dry run
+type PruneReport struct {
+	DryRun bool
+	// StaleMetadata describes administrative entries of vanished worktrees
+	StaleMetadata []string
+	// Removed lists the sessions that were removed
+	Removed []RemoveResult
+	// Kept lists the sessions left in place because their agent runs or
+	// their worktree is locked
+	Kept []KeptSession
+	// BranchesDeleted lists orphaned branches that were deleted
+	BranchesDeleted []string
+	// BranchesPreserved lists orphaned branches kept because of unmerged changes
+	BranchesPreserved []string
+	// Errors lists problems that did not stop the prune
+	Errors []error
+}
+
+func newPruneReport(r worktree.PruneReport) PruneReport {
+	report := PruneReport{
+		DryRun:            r.DryRun,
+		StaleMetadata:     r.StaleMetadata,
+		BranchesDeleted:   r.BranchesDeleted,
+		BranchesPreserved: r.BranchesPreserved,
+		Errors:            r.Errors,
+	}
+	for _, removal := range r.Worktrees {
+		report.Removed = append(report.Removed, newRemoveResult(removal))
+	}
+	for _, kept := range r.Kept {
+		report.Kept = append(report.Kept, KeptSession{
+			Session: Session{Name: kept.Name, Branch: kept.Branch, Path: kept.Path},
+			Err:     kept.Err,
+		})
+	}
+	return report
+}
+
+// DiskUsage is the disk space taken by a worktree, in bytes: by its
+// Checkout, by build Artifacts such as target or dist directories and by
+// Dependencies such as node_modules or vendor directories
+type DiskUsage = worktree.DiskUsage
+
+// SessionDiskUsage is the disk space taken by a session
+type SessionDiskUsage struct {
+	Session Session
+	Usage   DiskUsage
+	// LastActive is when the session was last used: when its agent last
+	// started, exited or was paused, or when it was created
+	LastActive time.Time
+}
+
+// DiskReport describes the disk space taken by the sessions of a
+// repository
+type DiskReport struct {
+	// BasePath is the directory holding the worktrees
+	BasePath string
+	// Sessions lists the sessions, largest first
+	Sessions []SessionDiskUsage
+	// Other is taken under BasePath outside of any session
+	Other int64
+	// Total is taken by everything under BasePath
+	Total int64
+	// Quota is Options.DiskQuota, zero when unlimited
+	Quota int64
+}
+
+func newDiskReport(r worktree.DiskReport) DiskReport {
+	report := DiskReport{BasePath: r.BasePath, Other: r.Other, Total: r.Total, Quota: r.Quota}
+	for _, s := range r.Sessions {
+		report.Sessions = append(report.Sessions, SessionDiskUsage{
+			Session:    newSession(s.Session),
+			Usage:      s.Usage,
+			LastActive: s.LastActive,
+		})
+	}
+	return report
+}
+
+// FindingLevel classifies the outcome of a doctor check
+type FindingLevel int
+
+// Finding levels, from best to worst
+const (
+	LevelOK      FindingLevel = FindingLevel(worktree.LevelOK)
+	LevelWarning FindingLevel = FindingLevel(worktree.LevelWarning)
+	LevelError   FindingLevel = FindingLevel(worktree.LevelError)
+)
+
+// Finding is the result of a single doctor check
+type Finding struct {
+	Check   string
+	Level   FindingLevel
+	Message string
+	// Hint suggests how to fix the problem by hand
+	Hint string
+	// Fixable is set when Doctor can repair the problem with DoctorOptions.Fix
+	Fixable bool
+	// Fixed is set when the problem was repaired automatically
+	Fixed bool
+	// FixErr is set when an automatic repair failed
+	FixErr error
+}
+
+// Problem reports whether the finding still needs attention
+func (f Finding) Problem() bool {
+	return f.Level != LevelOK && !f.Fixed
+}
+
+func newFinding(f worktree.Finding) Finding {
+	return Finding{
+		Check:   f.Check,
+		Level:   FindingLevel(f.Level),
+		Message: f.Message,
+		Hint:    f.Hint,
+		Fixable: f.Fixable,
+		Fixed:   f.Fixed,
+		FixErr:  f.FixErr,
+	}
+}